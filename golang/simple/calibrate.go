@@ -0,0 +1,44 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"crud-example/utils"
+)
+
+// runCalibrateHash implements the calibrate-hash command: it measures password hashing on
+// this host and prints the parameters reaching the target latency as environment variables
+func runCalibrateHash(args []string) error {
+	flags := flag.NewFlagSet("calibrate-hash", flag.ContinueOnError)
+	algorithm := flags.String("algorithm", utils.HasherArgon2id, "hashing algorithm to calibrate: bcrypt or argon2id")
+	target := flags.Duration("target", 250*time.Millisecond, "minimum time a single hash should take")
+	memory := flags.Uint("memory", 64*1024, "Argon2id memory in KiB")
+	parallelism := flags.Uint("parallelism", 4, "Argon2id parallelism")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	switch *algorithm {
+	case utils.HasherBcrypt:
+		cost, elapsed := utils.CalibrateBcrypt(*target)
+		fmt.Fprintf(os.Stderr, "bcrypt cost %d takes %s\n", cost, elapsed.Round(time.Millisecond))
+		fmt.Printf("PASSWORD_HASHER=%s\nBCRYPT_COST=%d\n", utils.HasherBcrypt, cost)
+	case utils.HasherArgon2id:
+		if *parallelism == 0 || *parallelism > utils.Argon2MaxParallelism {
+			return fmt.Errorf("parallelism must be between 1 and %d", utils.Argon2MaxParallelism)
+		}
+		if *memory < 8**parallelism || *memory > utils.Argon2MaxMemory {
+			return fmt.Errorf("memory must be between 8 KiB per lane and %d KiB", utils.Argon2MaxMemory)
+		}
+		hasher, elapsed := utils.CalibrateArgon2id(*target, uint32(*memory), uint8(*parallelism))
+		fmt.Fprintf(os.Stderr, "argon2id m=%d,t=%d,p=%d takes %s\n", hasher.Memory, hasher.Iterations, hasher.Parallelism, elapsed.Round(time.Millisecond))
+		fmt.Printf("PASSWORD_HASHER=%s\nARGON2_MEMORY=%d\nARGON2_ITERATIONS=%d\nARGON2_PARALLELISM=%d\n",
+			utils.HasherArgon2id, hasher.Memory, hasher.Iterations, hasher.Parallelism)
+	default:
+		return fmt.Errorf("unknown algorithm %q", *algorithm)
+	}
+	return nil
+}
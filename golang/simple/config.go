@@ -0,0 +1,36 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"crud-example/config"
+)
+
+// runConfig implements the config command:
+//
+//	config print [--redacted]    print the effective configuration as YAML
+//
+// The configuration is printed even when invalid, so that it can be fixed; the validation
+// errors are returned afterwards.
+func runConfig(cfg *config.Config, cfgErr error, args []string) error {
+	if len(args) == 0 || args[0] != "print" {
+		return errors.New("usage: config print [--redacted]")
+	}
+
+	flags := flag.NewFlagSet("config print", flag.ContinueOnError)
+	redacted := flags.Bool("redacted", false, "hide secrets such as DB_PASSWORD and JWT_SECRET")
+	if err := flags.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	if err := cfg.Print(os.Stdout, *redacted); err != nil {
+		return err
+	}
+	if cfgErr != nil {
+		return fmt.Errorf("invalid configuration:\n%w", cfgErr)
+	}
+	return nil
+}
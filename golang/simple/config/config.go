@@ -0,0 +1,702 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// Config is the application configuration. Each setting is read, in increasing order of
+// precedence, from its default, the configuration file, its environment variable and its
+// command line flag. The struct tags name the setting in each source:
+//   - key: the key in the configuration file, under the key of its section
+//   - env: the environment variable; the flag is its lower case form with dashes (DB_HOST
+//     is -db-host)
+//   - default: the value used when no source sets it
+//   - secret: the value is hidden by config print --redacted and can also be read from the
+//     file named by <env>_FILE
+//
+// Fields without an env tag are not settings of their own; the OIDC clients are read from
+// the file and the environment under names derived from OIDC_PROVIDERS.
+type Config struct {
+	Server   ServerConfig   `key:"server"`
+	Database DatabaseConfig `key:"database"`
+	JWT      JWTConfig      `key:"jwt"`
+	Password PasswordConfig `key:"password"`
+	Lockout  LockoutConfig  `key:"lockout"`
+	Tokens   TokensConfig   `key:"tokens"`
+	Mail     MailConfig     `key:"mail"`
+	WebAuthn WebAuthnConfig `key:"webauthn"`
+	MFA      MFAConfig      `key:"mfa"`
+	Account  AccountConfig  `key:"account"`
+	Sessions SessionsConfig `key:"sessions"`
+	OIDC     OIDCConfig     `key:"oidc"`
+	Log      LogConfig      `key:"log"`
+}
+
+// ServerConfig configures the HTTP server
+type ServerConfig struct {
+	Port        int    `key:"port" env:"PORT" default:"8080" usage:"HTTP port"`
+	Environment string `key:"environment" env:"ENVIRONMENT" default:"development" usage:"deployment environment reported by /health"`
+	GinMode     string `key:"gin_mode" env:"GIN_MODE" default:"debug" usage:"Gin mode: debug, release or test"`
+	// AppURL is the public URL of the application, used in emailed links, as the default
+	// passkey origin and as the default audience of OAuth client tokens
+	AppURL string `key:"app_url" env:"APP_URL" default:"http://localhost:8080" usage:"public URL of the application"`
+	// RequestTimeout bounds every request and its database queries; routes may set less
+	RequestTimeout time.Duration `key:"request_timeout" env:"REQUEST_TIMEOUT" default:"30s" usage:"deadline of each request and its database queries"`
+}
+
+// DatabaseConfig configures the database connection
+type DatabaseConfig struct {
+	Driver   string `key:"driver" env:"DB_DRIVER" default:"postgres" usage:"database driver: postgres, mysql or sqlite"`
+	Host     string `key:"host" env:"DB_HOST" default:"localhost" usage:"database host"`
+	Port     int    `key:"port" env:"DB_PORT" usage:"database port (default 5432 for postgres, 3306 for mysql)"`
+	User     string `key:"user" env:"DB_USER" default:"postgres" usage:"database user"`
+	Password string `key:"password" env:"DB_PASSWORD" default:"password" secret:"true" usage:"database password"`
+	Name     string `key:"name" env:"DB_NAME" usage:"database name, or file path with sqlite (default crud_example, crud_example.db with sqlite)"`
+	SSLMode  string `key:"ssl_mode" env:"DB_SSL_MODE" default:"disable" usage:"SSL mode: disable, allow, prefer, require, verify-ca or verify-full"`
+	// MigrateOnStart applies pending migrations when the server starts
+	MigrateOnStart bool `key:"migrate_on_start" env:"DB_MIGRATE_ON_START" default:"true" usage:"apply pending migrations at startup"`
+	// AutoMigrate lets GORM sync the tables with the models, for development only
+	AutoMigrate bool `key:"auto_migrate" env:"DB_AUTO_MIGRATE" default:"false" usage:"sync tables with GORM AutoMigrate (development only)"`
+
+	// Connection pool; 0 means unlimited for MaxOpenConns and the lifetimes
+	MaxOpenConns    int           `key:"max_open_conns" env:"DB_MAX_OPEN_CONNS" default:"100" usage:"maximum open connections (0 for unlimited)"`
+	MaxIdleConns    int           `key:"max_idle_conns" env:"DB_MAX_IDLE_CONNS" default:"10" usage:"maximum idle connections kept in the pool"`
+	ConnMaxLifetime time.Duration `key:"conn_max_lifetime" env:"DB_CONN_MAX_LIFETIME" default:"30m" usage:"maximum time a connection is reused (0 for no limit)"`
+	ConnMaxIdleTime time.Duration `key:"conn_max_idle_time" env:"DB_CONN_MAX_IDLE_TIME" default:"5m" usage:"maximum time a connection stays idle (0 for no limit)"`
+
+	// Replicas are DSNs, in the format of the driver, of read replicas of the database
+	Replicas             string        `key:"replicas" env:"DB_REPLICAS" secret:"true" usage:"comma separated DSNs of read replicas"`
+	ReplicaCheckInterval time.Duration `key:"replica_check_interval" env:"DB_REPLICA_CHECK_INTERVAL" default:"10s" usage:"interval between health checks of the read replicas"`
+}
+
+// JWTConfig configures token signing and lifetimes
+type JWTConfig struct {
+	Secret            string        `key:"secret" env:"JWT_SECRET" secret:"true" usage:"HS256 signing secret"`
+	Expiration        time.Duration `key:"expiration" env:"JWT_EXPIRATION" default:"15m" usage:"access token lifetime"`
+	RefreshExpiration time.Duration `key:"refresh_expiration" env:"REFRESH_TOKEN_EXPIRATION" default:"720h" usage:"refresh token lifetime"`
+	SigningKeyFile    string        `key:"signing_key_file" env:"JWT_SIGNING_KEY_FILE" usage:"PEM private key signing tokens instead of JWT_SECRET"`
+	PreviousKeyFiles  string        `key:"previous_key_files" env:"JWT_PREVIOUS_KEY_FILES" usage:"comma separated PEM files of rotated-out keys, each optionally suffixed with @<RFC3339 time>"`
+	OAuthAudience     string        `key:"oauth_audience" env:"OAUTH_AUDIENCE" usage:"aud claim of tokens issued to OAuth clients (default APP_URL)"`
+}
+
+// PasswordConfig configures the password policy and how passwords are hashed
+type PasswordConfig struct {
+	MinLength            int  `key:"min_length" env:"PASSWORD_MIN_LENGTH" default:"8" usage:"minimum password length"`
+	RequireUpper         bool `key:"require_upper" env:"PASSWORD_REQUIRE_UPPER" default:"false" usage:"require an uppercase letter"`
+	RequireLower         bool `key:"require_lower" env:"PASSWORD_REQUIRE_LOWER" default:"false" usage:"require a lowercase letter"`
+	RequireDigit         bool `key:"require_digit" env:"PASSWORD_REQUIRE_DIGIT" default:"false" usage:"require a digit"`
+	RequireSymbol        bool `key:"require_symbol" env:"PASSWORD_REQUIRE_SYMBOL" default:"false" usage:"require a symbol"`
+	DisallowPersonalInfo bool `key:"disallow_personal_info" env:"PASSWORD_DISALLOW_PERSONAL_INFO" default:"true" usage:"reject passwords containing the user's name or email"`
+	MinEntropy           int  `key:"min_entropy" env:"PASSWORD_MIN_ENTROPY" default:"0" usage:"minimum estimated entropy in bits (0 disables the check)"`
+	// BreachedDir holds the breached password range files, named by SHA-1 prefix
+	BreachedDir      string        `key:"breached_dir" env:"PASSWORD_BREACHED_DIR" usage:"directory of breached password range files"`
+	BreachedMinCount int           `key:"breached_min_count" env:"PASSWORD_BREACHED_MIN_COUNT" default:"1" usage:"times a password must have been breached to be rejected"`
+	History          int           `key:"history" env:"PASSWORD_HISTORY" default:"5" usage:"recent passwords, the current one included, that cannot be reused"`
+	MaxAge           time.Duration `key:"max_age" env:"PASSWORD_MAX_AGE" default:"0" usage:"age after which a password must be changed (0 disables it)"`
+
+	// Hashing of new passwords; existing hashes are upgraded as users log in
+	Hasher            string `key:"hasher" env:"PASSWORD_HASHER" default:"bcrypt" usage:"password hashing algorithm: bcrypt or argon2id"`
+	BcryptCost        int    `key:"bcrypt_cost" env:"BCRYPT_COST" default:"10" usage:"bcrypt cost"`
+	Argon2Memory      int    `key:"argon2_memory" env:"ARGON2_MEMORY" default:"65536" usage:"argon2id memory in KiB"`
+	Argon2Iterations  int    `key:"argon2_iterations" env:"ARGON2_ITERATIONS" default:"3" usage:"argon2id iterations"`
+	Argon2Parallelism int    `key:"argon2_parallelism" env:"ARGON2_PARALLELISM" default:"4" usage:"argon2id parallelism"`
+}
+
+// LockoutConfig configures the brute-force protection of logins
+type LockoutConfig struct {
+	MaxAttempts      int           `key:"max_attempts" env:"LOGIN_MAX_ATTEMPTS" default:"5" usage:"failed logins of an account before it is locked"`
+	MaxAttemptsPerIP int           `key:"max_attempts_per_ip" env:"LOGIN_MAX_ATTEMPTS_PER_IP" default:"20" usage:"failed logins from an IP address before it is locked"`
+	Duration         time.Duration `key:"duration" env:"LOGIN_LOCKOUT_DURATION" default:"15m" usage:"how long a lockout lasts"`
+	Window           time.Duration `key:"window" env:"LOGIN_ATTEMPT_WINDOW" default:"15m" usage:"period in which failed logins are counted"`
+}
+
+// TokensConfig configures the lifetimes and throttles of emailed and impersonation tokens
+type TokensConfig struct {
+	PasswordResetExpiration         time.Duration `key:"password_reset_expiration" env:"PASSWORD_RESET_EXPIRATION" default:"1h" usage:"password reset link lifetime"`
+	PasswordResetMaxPerHour         int           `key:"password_reset_max_per_hour" env:"PASSWORD_RESET_MAX_PER_HOUR" default:"5" usage:"password reset links sent to a user per hour"`
+	EmailVerificationExpiration     time.Duration `key:"email_verification_expiration" env:"EMAIL_VERIFICATION_EXPIRATION" default:"24h" usage:"email verification link lifetime"`
+	EmailVerificationResendInterval time.Duration `key:"email_verification_resend_interval" env:"EMAIL_VERIFICATION_RESEND_INTERVAL" default:"1m" usage:"minimum time between verification emails to a user"`
+	MagicLinkExpiration             time.Duration `key:"magic_link_expiration" env:"MAGIC_LINK_EXPIRATION" default:"15m" usage:"sign-in link lifetime"`
+	MagicLinkMaxPerHour             int           `key:"magic_link_max_per_hour" env:"MAGIC_LINK_MAX_PER_HOUR" default:"5" usage:"sign-in links sent to an email per hour"`
+	ImpersonationTTL                time.Duration `key:"impersonation_ttl" env:"IMPERSONATION_TTL" default:"30m" usage:"admin impersonation token lifetime"`
+}
+
+// MailConfig configures email delivery
+type MailConfig struct {
+	Driver       string `key:"driver" env:"MAILER" default:"log" usage:"mailer: log, file or smtp"`
+	Dir          string `key:"dir" env:"MAILER_DIR" default:"mail" usage:"directory the file mailer writes emails to"`
+	From         string `key:"from" env:"MAIL_FROM" default:"no-reply@example.com" usage:"sender of the emails"`
+	SMTPHost     string `key:"smtp_host" env:"SMTP_HOST" usage:"SMTP server host"`
+	SMTPPort     int    `key:"smtp_port" env:"SMTP_PORT" default:"587" usage:"SMTP server port"`
+	SMTPUser     string `key:"smtp_user" env:"SMTP_USER" usage:"SMTP user"`
+	SMTPPassword string `key:"smtp_password" env:"SMTP_PASSWORD" secret:"true" usage:"SMTP password"`
+}
+
+// WebAuthnConfig identifies the relying party of passkeys; the ID and origins default to
+// those of APP_URL
+type WebAuthnConfig struct {
+	RPID    string        `key:"rp_id" env:"WEBAUTHN_RP_ID" usage:"domain passkeys are scoped to (default the host of APP_URL)"`
+	RPName  string        `key:"rp_name" env:"WEBAUTHN_RP_NAME" usage:"name shown by authenticators (default MFA_ISSUER)"`
+	Origins string        `key:"origins" env:"WEBAUTHN_ORIGINS" usage:"comma separated origins passkeys may be used from (default the origin of APP_URL)"`
+	Timeout time.Duration `key:"timeout" env:"WEBAUTHN_TIMEOUT" default:"5m" usage:"time to complete a passkey ceremony"`
+}
+
+// MFAConfig configures the second factors
+type MFAConfig struct {
+	Issuer string `key:"issuer" env:"MFA_ISSUER" default:"CRUD Example" usage:"issuer shown by authenticator apps, and default name of the passkey relying party"`
+}
+
+// AccountConfig configures what accounts may do before their email is verified and after
+// their deletion is requested
+type AccountConfig struct {
+	EmailVerificationPolicy string `key:"email_verification_policy" env:"EMAIL_VERIFICATION_POLICY" default:"optional" usage:"what unverified users may do: optional, api or login"`
+	// DeletionGracePeriod is how long a requested account deletion can still be cancelled
+	DeletionGracePeriod time.Duration `key:"deletion_grace_period" env:"ACCOUNT_DELETION_GRACE_PERIOD" default:"168h" usage:"time before a requested account deletion takes effect"`
+}
+
+// SessionsConfig configures the tracking of login sessions
+type SessionsConfig struct {
+	// LastSeenInterval is how often the coalesced last-seen times of sessions are written
+	LastSeenInterval time.Duration `key:"last_seen_interval" env:"SESSION_LAST_SEEN_INTERVAL" default:"1m" usage:"interval between writes of the last-seen times of sessions"`
+}
+
+// OIDCConfig lists the external identity providers for social login. Each provider <name>
+// is configured with OIDC_<NAME>_ISSUER, OIDC_<NAME>_CLIENT_ID and OIDC_<NAME>_CLIENT_SECRET
+// (or OIDC_<NAME>_CLIENT_SECRET_FILE), or with the keys <name>_issuer, <name>_client_id and
+// <name>_client_secret of the oidc section of the configuration file.
+type OIDCConfig struct {
+	Providers string `key:"providers" env:"OIDC_PROVIDERS" usage:"comma separated names of the OIDC identity providers"`
+	// Clients holds the settings of each provider in Providers, in the same order
+	Clients []OIDCClientConfig
+}
+
+// OIDCClientConfig is the registration of the application with an OIDC provider
+type OIDCClientConfig struct {
+	Name         string
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+}
+
+// LogConfig configures the application log
+type LogConfig struct {
+	Level string `key:"level" env:"LOG_LEVEL" default:"info" usage:"log level: debug, info, warn or error"`
+	File  string `key:"file" env:"LOG_FILE" usage:"file the log is also written to"`
+}
+
+// Password hashing algorithms accepted by PASSWORD_HASHER
+const (
+	HasherBcrypt   = "bcrypt"
+	HasherArgon2id = "argon2id"
+)
+
+// Mailers accepted by MAILER
+const (
+	MailerLog  = "log"
+	MailerFile = "file"
+	MailerSMTP = "smtp"
+)
+
+// Email verification policies accepted by EMAIL_VERIFICATION_POLICY
+const (
+	// VerificationOptional lets unverified users log in and use the API
+	VerificationOptional = "optional"
+	// VerificationAPI lets unverified users log in but not access /api/users
+	VerificationAPI = "api"
+	// VerificationLogin prevents unverified users from logging in
+	VerificationLogin = "login"
+)
+
+// Log levels accepted by LOG_LEVEL
+const (
+	LogDebug = "debug"
+	LogInfo  = "info"
+	LogWarn  = "warn"
+	LogError = "error"
+)
+
+var (
+	current   *Config
+	currentMu sync.RWMutex
+)
+
+// Set makes cfg the configuration returned by Current
+func Set(cfg *Config) {
+	currentMu.Lock()
+	defer currentMu.Unlock()
+	current = cfg
+}
+
+// Current returns the configuration set at startup or, when none was, the defaults
+// overridden by the environment
+func Current() *Config {
+	currentMu.RLock()
+	cfg := current
+	currentMu.RUnlock()
+	if cfg != nil {
+		return cfg
+	}
+
+	cfg = &Config{}
+	for _, s := range cfg.settings() {
+		if s.def != "" {
+			s.set(s.def)
+		}
+		if value, ok, err := lookupEnv(s.env, s.secret); err == nil && ok {
+			s.set(value)
+		}
+	}
+	cfg.OIDC.loadClients(nil)
+	return cfg
+}
+
+// Load builds the configuration from the defaults, the file named by -config or
+// CONFIG_FILE, the environment and the flags in args, and validates it. It returns the
+// arguments left after the flags. Every invalid setting is reported in the returned error;
+// the configuration is only nil when the flags cannot be parsed.
+func Load(args []string) (*Config, []string, error) {
+	cfg := &Config{}
+	settings := cfg.settings()
+
+	flags := flag.NewFlagSet("api", flag.ContinueOnError)
+	file := flags.String("config", os.Getenv("CONFIG_FILE"), "YAML or TOML configuration file")
+	flagValues := make([]flagValue, len(settings))
+	for i, s := range settings {
+		flagValues[i].isBool = s.value.Kind() == reflect.Bool
+		flags.Var(&flagValues[i], s.flag(), s.usage)
+	}
+	if err := flags.Parse(args); err != nil {
+		return nil, nil, err
+	}
+
+	var errs []error
+	apply := func(s setting, value, source string) {
+		if err := s.set(value); err != nil {
+			errs = append(errs, fmt.Errorf("%s (%s): %w", s.env, source, err))
+		}
+	}
+
+	for _, s := range settings {
+		if s.def != "" {
+			apply(s, s.def, "default")
+		}
+	}
+
+	var values map[string]string
+	if *file != "" {
+		var err error
+		if values, err = readFile(*file); err != nil {
+			errs = append(errs, err)
+		}
+		for _, s := range settings {
+			if value, ok := values[s.key]; ok {
+				apply(s, value, *file)
+				delete(values, s.key)
+			}
+		}
+	}
+
+	for _, s := range settings {
+		value, ok, err := lookupEnv(s.env, s.secret)
+		if err != nil {
+			errs = append(errs, err)
+		} else if ok {
+			apply(s, value, "environment")
+		}
+	}
+
+	for i, s := range settings {
+		if flagValues[i].set {
+			apply(s, flagValues[i].value, "flag -"+s.flag())
+		}
+	}
+
+	// The keys of the OIDC clients are only known once OIDC_PROVIDERS is
+	errs = append(errs, cfg.OIDC.loadClients(values)...)
+	unknown := make([]string, 0, len(values))
+	for key := range values {
+		unknown = append(unknown, key)
+	}
+	sort.Strings(unknown)
+	for _, key := range unknown {
+		errs = append(errs, fmt.Errorf("%s: unknown setting %q", *file, key))
+	}
+
+	if err := cfg.Validate(); err != nil {
+		errs = append(errs, err)
+	}
+	return cfg, flags.Args(), errors.Join(errs...)
+}
+
+// Validate checks every setting and reports all the invalid ones
+func (c *Config) Validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...interface{}) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	check(c.Server.Port > 0 && c.Server.Port <= 65535, "PORT must be between 1 and 65535")
+	check(oneOf(c.Server.GinMode, "debug", "release", "test"), "GIN_MODE must be debug, release or test")
+	check(c.Server.RequestTimeout > 0, "REQUEST_TIMEOUT must be positive")
+	appURL, err := url.Parse(c.Server.AppURL)
+	check(err == nil && oneOf(appURL.Scheme, "http", "https") && appURL.Host != "", "APP_URL must be an http or https URL")
+
+	check(oneOf(c.Database.Driver, DriverPostgres, DriverMySQL, DriverSQLite), "DB_DRIVER must be %s, %s or %s", DriverPostgres, DriverMySQL, DriverSQLite)
+	_, compiled := drivers[c.Database.Driver]
+	check(compiled || !oneOf(c.Database.Driver, DriverMySQL, DriverSQLite),
+		"DB_DRIVER %s is not compiled into this binary, build it with -tags %s", c.Database.Driver, c.Database.Driver)
+	check(c.Database.Port >= 0 && c.Database.Port <= 65535, "DB_PORT must be between 1 and 65535")
+	check(c.Database.Driver == DriverSQLite || c.Database.Host != "", "DB_HOST is required")
+	_, ok := sslModes[c.Database.SSLMode]
+	check(ok, "DB_SSL_MODE must be disable, allow, prefer, require, verify-ca or verify-full")
+	check(c.Database.MaxOpenConns >= 0, "DB_MAX_OPEN_CONNS must not be negative")
+	check(c.Database.MaxIdleConns >= 0, "DB_MAX_IDLE_CONNS must not be negative")
+	check(c.Database.MaxOpenConns == 0 || c.Database.MaxIdleConns <= c.Database.MaxOpenConns,
+		"DB_MAX_IDLE_CONNS must not exceed DB_MAX_OPEN_CONNS")
+	check(c.Database.ConnMaxLifetime >= 0, "DB_CONN_MAX_LIFETIME must not be negative")
+	check(c.Database.ConnMaxIdleTime >= 0, "DB_CONN_MAX_IDLE_TIME must not be negative")
+	check(c.Database.Driver != DriverSQLite || c.Database.Replicas == "", "DB_REPLICAS is not supported with sqlite")
+	check(c.Database.ReplicaCheckInterval > 0, "DB_REPLICA_CHECK_INTERVAL must be positive")
+
+	check(c.JWT.Expiration > 0, "JWT_EXPIRATION must be positive")
+	check(c.JWT.RefreshExpiration > 0, "REFRESH_TOKEN_EXPIRATION must be positive")
+	check(c.JWT.SigningKeyFile != "" || c.Server.GinMode != "release" || c.JWT.Secret != "",
+		"JWT_SECRET or JWT_SIGNING_KEY_FILE is required in release mode")
+
+	check(c.Password.MinLength > 0, "PASSWORD_MIN_LENGTH must be positive")
+	check(c.Password.MinEntropy >= 0, "PASSWORD_MIN_ENTROPY must not be negative")
+	check(c.Password.BreachedMinCount > 0, "PASSWORD_BREACHED_MIN_COUNT must be positive")
+	check(c.Password.History > 0, "PASSWORD_HISTORY must be positive")
+	check(c.Password.MaxAge >= 0, "PASSWORD_MAX_AGE must not be negative")
+	check(oneOf(c.Password.Hasher, HasherBcrypt, HasherArgon2id), "PASSWORD_HASHER must be %s or %s", HasherBcrypt, HasherArgon2id)
+	// The upper bounds of the parameters are checked when the hasher is built
+	check(c.Password.BcryptCost > 0, "BCRYPT_COST must be positive")
+	check(c.Password.Argon2Memory > 0, "ARGON2_MEMORY must be positive")
+	check(c.Password.Argon2Iterations > 0, "ARGON2_ITERATIONS must be positive")
+	check(c.Password.Argon2Parallelism > 0, "ARGON2_PARALLELISM must be positive")
+
+	check(c.Lockout.MaxAttempts > 0, "LOGIN_MAX_ATTEMPTS must be positive")
+	check(c.Lockout.MaxAttemptsPerIP > 0, "LOGIN_MAX_ATTEMPTS_PER_IP must be positive")
+	check(c.Lockout.Duration > 0, "LOGIN_LOCKOUT_DURATION must be positive")
+	check(c.Lockout.Window > 0, "LOGIN_ATTEMPT_WINDOW must be positive")
+
+	check(c.Tokens.PasswordResetExpiration > 0, "PASSWORD_RESET_EXPIRATION must be positive")
+	check(c.Tokens.PasswordResetMaxPerHour > 0, "PASSWORD_RESET_MAX_PER_HOUR must be positive")
+	check(c.Tokens.EmailVerificationExpiration > 0, "EMAIL_VERIFICATION_EXPIRATION must be positive")
+	check(c.Tokens.EmailVerificationResendInterval > 0, "EMAIL_VERIFICATION_RESEND_INTERVAL must be positive")
+	check(c.Tokens.MagicLinkExpiration > 0, "MAGIC_LINK_EXPIRATION must be positive")
+	check(c.Tokens.MagicLinkMaxPerHour > 0, "MAGIC_LINK_MAX_PER_HOUR must be positive")
+	check(c.Tokens.ImpersonationTTL > 0, "IMPERSONATION_TTL must be positive")
+
+	check(oneOf(c.Mail.Driver, MailerLog, MailerFile, MailerSMTP), "MAILER must be %s, %s or %s", MailerLog, MailerFile, MailerSMTP)
+	check(c.Mail.Driver != MailerFile || c.Mail.Dir != "", "MAILER_DIR is required with the file mailer")
+	check(c.Mail.Driver != MailerSMTP || c.Mail.SMTPHost != "", "SMTP_HOST is required with the smtp mailer")
+	check(c.Mail.SMTPPort > 0 && c.Mail.SMTPPort <= 65535, "SMTP_PORT must be between 1 and 65535")
+
+	check(c.WebAuthn.Timeout > 0, "WEBAUTHN_TIMEOUT must be positive")
+
+	check(c.MFA.Issuer != "", "MFA_ISSUER is required")
+
+	check(oneOf(c.Account.EmailVerificationPolicy, VerificationOptional, VerificationAPI, VerificationLogin),
+		"EMAIL_VERIFICATION_POLICY must be %s, %s or %s", VerificationOptional, VerificationAPI, VerificationLogin)
+	check(c.Account.DeletionGracePeriod > 0, "ACCOUNT_DELETION_GRACE_PERIOD must be positive")
+
+	check(c.Sessions.LastSeenInterval > 0, "SESSION_LAST_SEEN_INTERVAL must be positive")
+
+	seen := map[string]bool{}
+	for _, client := range c.OIDC.Clients {
+		prefix := oidcPrefix(client.Name)
+		check(providerName.MatchString(client.Name), "OIDC_PROVIDERS: provider name %q must only contain lower case letters, digits and dashes", client.Name)
+		check(!seen[client.Name], "OIDC_PROVIDERS: provider %q is listed twice", client.Name)
+		seen[client.Name] = true
+		issuer, err := url.Parse(client.Issuer)
+		check(err == nil && oneOf(issuer.Scheme, "http", "https") && issuer.Host != "", "%sISSUER must be an http or https URL", prefix)
+		check(client.ClientID != "", "%sCLIENT_ID is required", prefix)
+	}
+
+	check(oneOf(c.Log.Level, LogDebug, LogInfo, LogWarn, LogError), "LOG_LEVEL must be debug, info, warn or error")
+	return errors.Join(errs...)
+}
+
+// Print writes the configuration as YAML, in the format of the configuration file. When
+// redacted is set, secrets are replaced with asterisks.
+func (c *Config) Print(w io.Writer, redacted bool) error {
+	root := &yaml.Node{Kind: yaml.MappingNode}
+	sections := map[string]*yaml.Node{}
+	add := func(sectionKey, value, env string, secret bool) {
+		section, key, _ := strings.Cut(sectionKey, ".")
+		node, ok := sections[section]
+		if !ok {
+			node = &yaml.Node{Kind: yaml.MappingNode}
+			sections[section] = node
+			root.Content = append(root.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: section}, node)
+		}
+
+		if redacted && secret && value != "" {
+			value = "********"
+		}
+		valueNode := &yaml.Node{Kind: yaml.ScalarNode, Value: value, LineComment: env}
+		if value == "" {
+			valueNode.Style = yaml.DoubleQuotedStyle
+		}
+		node.Content = append(node.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: key}, valueNode)
+	}
+
+	for _, s := range c.settings() {
+		add(s.key, s.String(), s.env, s.secret)
+	}
+	for i := range c.OIDC.Clients {
+		for _, f := range c.OIDC.Clients[i].fields() {
+			add(f.key, *f.value, f.env, f.secret)
+		}
+	}
+
+	encoder := yaml.NewEncoder(w)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(root); err != nil {
+		return err
+	}
+	return encoder.Close()
+}
+
+// LookupSecret returns the value of the environment variable key or, when <key>_FILE is set
+// instead, the content of that file without its trailing newline
+func LookupSecret(key string) (string, error) {
+	value, _, err := lookupEnv(key, true)
+	return value, err
+}
+
+// lookupEnv returns the environment variable key and whether it is set. Secrets can be
+// given in the file named by <key>_FILE, as done by Docker and Kubernetes secrets.
+func lookupEnv(key string, secret bool) (string, bool, error) {
+	value, ok := os.LookupEnv(key)
+	if !secret {
+		return value, ok && value != "", nil
+	}
+
+	path := os.Getenv(key + "_FILE")
+	if path == "" {
+		return value, ok && value != "", nil
+	}
+	if ok && value != "" {
+		return "", false, fmt.Errorf("%s and %s_FILE are both set", key, key)
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return "", false, fmt.Errorf("%s_FILE: %w", key, err)
+	}
+	return strings.TrimRight(string(content), "\r\n"), true, nil
+}
+
+// readFile reads a YAML or TOML configuration file, chosen by its extension, into raw
+// values by "<section>.<key>"
+func readFile(path string) (map[string]string, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var sections map[string]interface{}
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(content, &sections)
+	case ".toml":
+		err = toml.Unmarshal(content, &sections)
+	default:
+		return nil, fmt.Errorf("%s: unsupported configuration file format %q, use .yaml, .yml or .toml", path, ext)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	values := map[string]string{}
+	for name, section := range sections {
+		settings, ok := section.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("%s: %q must be a section", path, name)
+		}
+		for key, value := range settings {
+			switch v := value.(type) {
+			case nil:
+				value = ""
+			case []interface{}:
+				items := make([]string, len(v))
+				for i, item := range v {
+					items[i] = fmt.Sprint(item)
+				}
+				value = strings.Join(items, ",")
+			}
+			values[name+"."+key] = fmt.Sprint(value)
+		}
+	}
+	return values, nil
+}
+
+// providerName matches the names of OIDC providers, which appear in the callback URLs
+var providerName = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+
+// oidcPrefix returns the prefix of the environment variables of the OIDC provider name
+func oidcPrefix(name string) string {
+	return "OIDC_" + strings.ToUpper(strings.ReplaceAll(name, "-", "_")) + "_"
+}
+
+// oidcField is a setting of an OIDC client
+type oidcField struct {
+	key    string
+	env    string
+	secret bool
+	value  *string
+}
+
+// fields returns the settings of the client with their file key and environment variable
+func (o *OIDCClientConfig) fields() []oidcField {
+	prefix := oidcPrefix(o.Name)
+	return []oidcField{
+		{key: "oidc." + o.Name + "_issuer", env: prefix + "ISSUER", value: &o.Issuer},
+		{key: "oidc." + o.Name + "_client_id", env: prefix + "CLIENT_ID", value: &o.ClientID},
+		{key: "oidc." + o.Name + "_client_secret", env: prefix + "CLIENT_SECRET", secret: true, value: &o.ClientSecret},
+	}
+}
+
+// loadClients builds a client for each provider in Providers from the file values, which it
+// consumes, and the environment, which overrides them
+func (o *OIDCConfig) loadClients(values map[string]string) []error {
+	var errs []error
+	o.Clients = nil
+	for _, name := range strings.Split(o.Providers, ",") {
+		if name = strings.TrimSpace(name); name == "" {
+			continue
+		}
+		client := OIDCClientConfig{Name: name}
+		for _, f := range client.fields() {
+			if value, ok := values[f.key]; ok {
+				*f.value = strings.TrimSpace(value)
+				delete(values, f.key)
+			}
+			value, ok, err := lookupEnv(f.env, f.secret)
+			if err != nil {
+				errs = append(errs, err)
+			} else if ok {
+				*f.value = value
+			}
+		}
+		o.Clients = append(o.Clients, client)
+	}
+	return errs
+}
+
+func oneOf(value string, allowed ...string) bool {
+	for _, a := range allowed {
+		if value == a {
+			return true
+		}
+	}
+	return false
+}
+
+// setting is a field of Config with the names it has in each source
+type setting struct {
+	key    string
+	env    string
+	def    string
+	usage  string
+	secret bool
+	value  reflect.Value
+}
+
+// settings returns the fields of every section of c
+func (c *Config) settings() []setting {
+	var settings []setting
+	root := reflect.ValueOf(c).Elem()
+	for i := 0; i < root.NumField(); i++ {
+		section := root.Field(i)
+		sectionKey := root.Type().Field(i).Tag.Get("key")
+		for j := 0; j < section.NumField(); j++ {
+			field := section.Type().Field(j)
+			if field.Tag.Get("env") == "" {
+				continue
+			}
+			settings = append(settings, setting{
+				key:    sectionKey + "." + field.Tag.Get("key"),
+				env:    field.Tag.Get("env"),
+				def:    field.Tag.Get("default"),
+				usage:  field.Tag.Get("usage"),
+				secret: field.Tag.Get("secret") == "true",
+				value:  section.Field(j),
+			})
+		}
+	}
+	return settings
+}
+
+func (s setting) flag() string {
+	return strings.ReplaceAll(strings.ToLower(s.env), "_", "-")
+}
+
+// set parses raw into the field
+func (s setting) set(raw string) error {
+	raw = strings.TrimSpace(raw)
+	switch s.value.Interface().(type) {
+	case string:
+		s.value.SetString(raw)
+	case int:
+		value, err := strconv.Atoi(raw)
+		if err != nil {
+			return fmt.Errorf("invalid integer %q", raw)
+		}
+		s.value.SetInt(int64(value))
+	case bool:
+		value, err := strconv.ParseBool(raw)
+		if err != nil {
+			return fmt.Errorf("invalid boolean %q", raw)
+		}
+		s.value.SetBool(value)
+	case time.Duration:
+		value, err := time.ParseDuration(raw)
+		if err != nil {
+			return fmt.Errorf("invalid duration %q", raw)
+		}
+		s.value.SetInt(int64(value))
+	default:
+		return fmt.Errorf("unsupported setting type %s", s.value.Type())
+	}
+	return nil
+}
+
+func (s setting) String() string {
+	return fmt.Sprint(s.value.Interface())
+}
+
+// flagValue records the value of a setting given on the command line, applied last
+type flagValue struct {
+	value  string
+	set    bool
+	isBool bool
+}
+
+func (f *flagValue) String() string { return f.value }
+
+func (f *flagValue) Set(value string) error {
+	f.value, f.set = value, true
+	return nil
+}
+
+func (f *flagValue) IsBoolFlag() bool { return f.isBool }
@@ -0,0 +1,247 @@
+package config
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+)
+
+// clearEnv unsets every configuration variable for the duration of the test
+func clearEnv(t *testing.T) {
+	for _, s := range (&Config{}).settings() {
+		t.Setenv(s.env, "")
+		t.Setenv(s.env+"_FILE", "")
+	}
+	t.Setenv("CONFIG_FILE", "")
+}
+
+// withDriver makes the database driver name available for the duration of the test, as if
+// the binary had been built with its tag
+func withDriver(t *testing.T, name string) {
+	previous, ok := drivers[name]
+	drivers[name] = sqlite.Open
+	t.Cleanup(func() {
+		if ok {
+			drivers[name] = previous
+		} else {
+			delete(drivers, name)
+		}
+	})
+}
+
+func writeFile(t *testing.T, name, content string) string {
+	path := filepath.Join(t.TempDir(), name)
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	return path
+}
+
+func TestLoadDefaults(t *testing.T) {
+	clearEnv(t)
+
+	cfg, args, err := Load([]string{"migrate", "up"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"migrate", "up"}, args)
+	assert.Equal(t, 8080, cfg.Server.Port)
+	assert.Equal(t, DriverPostgres, cfg.Database.Driver)
+	assert.True(t, cfg.Database.MigrateOnStart)
+	assert.Equal(t, 15*time.Minute, cfg.JWT.Expiration)
+	assert.Equal(t, HasherBcrypt, cfg.Password.Hasher)
+	assert.True(t, cfg.Password.DisallowPersonalInfo)
+	assert.Equal(t, 5, cfg.Lockout.MaxAttempts)
+	assert.Equal(t, time.Hour, cfg.Tokens.PasswordResetExpiration)
+	assert.Equal(t, MailerLog, cfg.Mail.Driver)
+	assert.Equal(t, 5*time.Minute, cfg.WebAuthn.Timeout)
+	assert.Equal(t, "CRUD Example", cfg.MFA.Issuer)
+	assert.Equal(t, VerificationOptional, cfg.Account.EmailVerificationPolicy)
+	assert.Equal(t, 7*24*time.Hour, cfg.Account.DeletionGracePeriod)
+	assert.Equal(t, time.Minute, cfg.Sessions.LastSeenInterval)
+	assert.Empty(t, cfg.OIDC.Clients)
+	assert.Equal(t, LogInfo, cfg.Log.Level)
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	clearEnv(t)
+	yamlFile := writeFile(t, "config.yaml", `
+server:
+  port: 9000
+  environment: staging
+database:
+  host: db.internal
+  user: app
+jwt:
+  expiration: 5m
+  previous_key_files: [old.pem, older.pem@2026-01-01T00:00:00Z]
+`)
+	t.Setenv("DB_HOST", "db.env")
+	t.Setenv("JWT_EXPIRATION", "10m")
+
+	cfg, _, err := Load([]string{"-config", yamlFile, "-jwt-expiration", "20m", "-db-auto-migrate"})
+	require.NoError(t, err)
+	assert.Equal(t, 9000, cfg.Server.Port, "file overrides default")
+	assert.Equal(t, "staging", cfg.Server.Environment)
+	assert.Equal(t, "app", cfg.Database.User)
+	assert.Equal(t, "db.env", cfg.Database.Host, "environment overrides file")
+	assert.Equal(t, 20*time.Minute, cfg.JWT.Expiration, "flag overrides environment")
+	assert.True(t, cfg.Database.AutoMigrate)
+	assert.Equal(t, "old.pem,older.pem@2026-01-01T00:00:00Z", cfg.JWT.PreviousKeyFiles)
+}
+
+func TestLoadTOML(t *testing.T) {
+	clearEnv(t)
+	withDriver(t, DriverSQLite)
+	t.Setenv("CONFIG_FILE", writeFile(t, "config.toml", `
+[database]
+driver = "sqlite"
+name = "data/app.db"
+
+[log]
+level = "debug"
+`))
+
+	cfg, _, err := Load(nil)
+	require.NoError(t, err)
+	assert.Equal(t, DriverSQLite, cfg.Database.Driver)
+	assert.Equal(t, "data/app.db", cfg.Database.Name)
+	assert.Equal(t, LogDebug, cfg.Log.Level)
+}
+
+func TestLoadOIDCClients(t *testing.T) {
+	clearEnv(t)
+	yamlFile := writeFile(t, "config.yaml", `
+oidc:
+  providers: google, corp-sso
+  google_issuer: https://accounts.google.com
+  google_client_id: from-file
+  corp-sso_issuer: https://sso.example.com
+  corp-sso_client_id: corp
+`)
+	t.Setenv("OIDC_GOOGLE_CLIENT_ID", "from-env")
+	t.Setenv("OIDC_CORP_SSO_CLIENT_SECRET_FILE", writeFile(t, "corp_secret", "corp-secret\n"))
+
+	cfg, _, err := Load([]string{"-config", yamlFile})
+	require.NoError(t, err)
+	assert.Equal(t, []OIDCClientConfig{
+		{Name: "google", Issuer: "https://accounts.google.com", ClientID: "from-env"},
+		{Name: "corp-sso", Issuer: "https://sso.example.com", ClientID: "corp", ClientSecret: "corp-secret"},
+	}, cfg.OIDC.Clients)
+
+	// Keys of providers that are not listed are unknown
+	t.Setenv("OIDC_PROVIDERS", "google")
+	_, _, err = Load([]string{"-config", yamlFile})
+	assert.ErrorContains(t, err, `unknown setting "oidc.corp-sso_issuer"`)
+
+	t.Setenv("OIDC_PROVIDERS", "google,Okta,google")
+	_, _, err = Load(nil)
+	assert.ErrorContains(t, err, "OIDC_GOOGLE_ISSUER must be an http or https URL")
+	assert.ErrorContains(t, err, "OIDC_OKTA_CLIENT_ID is required")
+	assert.ErrorContains(t, err, `provider name "Okta" must only contain lower case letters, digits and dashes`)
+	assert.ErrorContains(t, err, `provider "google" is listed twice`)
+}
+
+func TestLoadDriverNotCompiled(t *testing.T) {
+	clearEnv(t)
+	t.Setenv("DB_DRIVER", DriverMySQL)
+	_, compiled := drivers[DriverMySQL]
+
+	_, _, err := Load(nil)
+	if compiled {
+		assert.NoError(t, err)
+	} else {
+		assert.ErrorContains(t, err, "DB_DRIVER mysql is not compiled into this binary, build it with -tags mysql")
+	}
+
+	withDriver(t, DriverMySQL)
+	_, _, err = Load(nil)
+	assert.NoError(t, err)
+}
+
+func TestLoadSecretFiles(t *testing.T) {
+	clearEnv(t)
+	t.Setenv("DB_PASSWORD_FILE", writeFile(t, "db_password", "from-file\n"))
+
+	cfg, _, err := Load(nil)
+	require.NoError(t, err)
+	assert.Equal(t, "from-file", cfg.Database.Password)
+
+	// The variable and its file are mutually exclusive
+	t.Setenv("DB_PASSWORD", "from-env")
+	_, _, err = Load(nil)
+	assert.ErrorContains(t, err, "DB_PASSWORD and DB_PASSWORD_FILE are both set")
+
+	secret, err := LookupSecret("DB_PASSWORD")
+	assert.Error(t, err)
+	assert.Empty(t, secret)
+}
+
+func TestLoadReportsEveryError(t *testing.T) {
+	clearEnv(t)
+	t.Setenv("PORT", "http")
+	t.Setenv("DB_SSL_MODE", "on")
+	t.Setenv("GIN_MODE", "release")
+	t.Setenv("APP_URL", "localhost:8080")
+	t.Setenv("PASSWORD_HASHER", "md5")
+	t.Setenv("LOGIN_MAX_ATTEMPTS", "0")
+	t.Setenv("MAILER", "smtp")
+	t.Setenv("EMAIL_VERIFICATION_POLICY", "strict")
+	t.Setenv("ACCOUNT_DELETION_GRACE_PERIOD", "0s")
+
+	cfg, _, err := Load([]string{"-config", writeFile(t, "config.yaml", "log:\n  levl: debug\n")})
+	require.NotNil(t, cfg)
+	require.Error(t, err)
+	for _, message := range []string{
+		`PORT (environment): invalid integer "http"`,
+		`unknown setting "log.levl"`,
+		"DB_SSL_MODE must be",
+		"JWT_SECRET or JWT_SIGNING_KEY_FILE is required in release mode",
+		"APP_URL must be an http or https URL",
+		"PASSWORD_HASHER must be bcrypt or argon2id",
+		"LOGIN_MAX_ATTEMPTS must be positive",
+		"SMTP_HOST is required with the smtp mailer",
+		"EMAIL_VERIFICATION_POLICY must be optional, api or login",
+		"ACCOUNT_DELETION_GRACE_PERIOD must be positive",
+	} {
+		assert.ErrorContains(t, err, message)
+	}
+
+	_, _, err = Load([]string{"-no-such-flag"})
+	assert.Error(t, err)
+}
+
+func TestPrint(t *testing.T) {
+	clearEnv(t)
+	t.Setenv("JWT_SECRET", "jwt-secret")
+	t.Setenv("SMTP_PASSWORD", "smtp-secret")
+	t.Setenv("OIDC_PROVIDERS", "google")
+	t.Setenv("OIDC_GOOGLE_ISSUER", "https://accounts.google.com")
+	t.Setenv("OIDC_GOOGLE_CLIENT_ID", "client")
+	t.Setenv("OIDC_GOOGLE_CLIENT_SECRET", "oidc-secret")
+	cfg, _, err := Load(nil)
+	require.NoError(t, err)
+
+	var out bytes.Buffer
+	require.NoError(t, cfg.Print(&out, true))
+	assert.Contains(t, out.String(), "secret: '********' # JWT_SECRET")
+	assert.Contains(t, out.String(), "smtp_password: '********' # SMTP_PASSWORD")
+	assert.Contains(t, out.String(), "max_attempts: 5 # LOGIN_MAX_ATTEMPTS")
+	assert.Contains(t, out.String(), "google_client_secret: '********' # OIDC_GOOGLE_CLIENT_SECRET")
+	assert.NotContains(t, out.String(), "jwt-secret")
+	assert.NotContains(t, out.String(), "smtp-secret")
+	assert.NotContains(t, out.String(), "oidc-secret")
+
+	// The unredacted output is a configuration file loading the same configuration
+	out.Reset()
+	require.NoError(t, cfg.Print(&out, false))
+	clearEnv(t)
+	for _, name := range []string{"ISSUER", "CLIENT_ID", "CLIENT_SECRET"} {
+		t.Setenv("OIDC_GOOGLE_"+name, "")
+	}
+	reloaded, _, err := Load([]string{"-config", writeFile(t, "printed.yaml", out.String())})
+	require.NoError(t, err)
+	assert.Equal(t, cfg, reloaded)
+}
@@ -1,38 +1,95 @@
 package config
 
 import (
+	"context"
 	"fmt"
 	"log"
-	"os"
+	"net/url"
+	"strconv"
+	"time"
 
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 	"gorm.io/gorm/logger"
 )
 
-var DB *gorm.DB
+// Database drivers accepted by DB_DRIVER
+const (
+	DriverPostgres = "postgres"
+	DriverMySQL    = "mysql"
+	DriverSQLite   = "sqlite"
+)
+
+// drivers opens a GORM dialector for a DSN, by driver name. PostgreSQL is always available;
+// MySQL and SQLite are registered by the files built with the mysql and sqlite tags, so
+// binaries only link the drivers they use (the SQLite driver needs cgo).
+var drivers = map[string]func(dsn string) gorm.Dialector{
+	DriverPostgres: postgres.Open,
+}
+
+// sslModes are the DB_SSL_MODE values, as in libpq, mapped to the tls parameter of MySQL
+var sslModes = map[string]string{
+	"disable":     "false",
+	"allow":       "preferred",
+	"prefer":      "preferred",
+	"require":     "skip-verify",
+	"verify-ca":   "true",
+	"verify-full": "true",
+}
 
-func InitDB() (*gorm.DB, error) {
-	// Get database configuration from environment
-	host := getEnv("DB_HOST", "localhost")
-	port := getEnv("DB_PORT", "5432")
-	user := getEnv("DB_USER", "postgres")
-	password := getEnv("DB_PASSWORD", "password")
-	dbname := getEnv("DB_NAME", "crud_example")
+// InitDB connects to the database configured in cfg
+func InitDB(cfg *Config) (*gorm.DB, error) {
+	driver := cfg.Database.Driver
+	dsn, err := cfg.Database.DSN()
+	if err != nil {
+		return nil, err
+	}
 
-	// Create DSN (Data Source Name)
-	dsn := fmt.Sprintf("host=%s user=%s password=%s dbname=%s port=%s sslmode=disable TimeZone=UTC",
-		host, user, password, dbname, port)
+	db, err := open(cfg, dsn)
+	if err != nil {
+		return nil, err
+	}
 
-	// Configure GORM logger
+	// Test connection
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get sql.DB: %w", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := sqlDB.PingContext(ctx); err != nil {
+		return nil, fmt.Errorf("failed to ping database: %w", err)
+	}
+
+	log.Printf("✅ Connected to %s database", driver)
+	return db, nil
+}
+
+// open opens a connection pool to dsn with the driver, logger and pool settings of cfg. It
+// does not connect yet; callers ping the database with a deadline.
+func open(cfg *Config, dsn string) (*gorm.DB, error) {
+	driver := cfg.Database.Driver
+	dialector, ok := drivers[driver]
+	if !ok {
+		return nil, fmt.Errorf("database driver %q is not compiled in, build with -tags %s", driver, driver)
+	}
+
+	// Configure GORM logger: SQL statements at debug level or in development, slow
+	// queries and errors otherwise
 	gormLogger := logger.Default
-	if os.Getenv("ENVIRONMENT") == "development" {
+	switch {
+	case cfg.Log.Level == LogDebug || cfg.Server.Environment == "development":
 		gormLogger = logger.Default.LogMode(logger.Info)
+	case cfg.Log.Level == LogError:
+		gormLogger = logger.Default.LogMode(logger.Error)
 	}
 
-	// Connect to database
-	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{
-		Logger: gormLogger,
+	// Connect to database. TranslateError turns the unique constraint errors of every driver
+	// into gorm.ErrDuplicatedKey.
+	db, err := gorm.Open(dialector(dsn), &gorm.Config{
+		Logger:               gormLogger,
+		TranslateError:       true,
+		DisableAutomaticPing: true,
 	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to connect to database: %w", err)
@@ -45,22 +102,58 @@ func InitDB() (*gorm.DB, error) {
 	}
 
 	// Configure connection pool
-	sqlDB.SetMaxIdleConns(10)
-	sqlDB.SetMaxOpenConns(100)
-
-	// Test connection
-	if err := sqlDB.Ping(); err != nil {
-		return nil, fmt.Errorf("failed to ping database: %w", err)
+	sqlDB.SetMaxOpenConns(cfg.Database.MaxOpenConns)
+	sqlDB.SetMaxIdleConns(cfg.Database.MaxIdleConns)
+	sqlDB.SetConnMaxLifetime(cfg.Database.ConnMaxLifetime)
+	sqlDB.SetConnMaxIdleTime(cfg.Database.ConnMaxIdleTime)
+	if driver == DriverSQLite {
+		// SQLite allows a single writer; more connections only fail with "database is locked"
+		sqlDB.SetMaxOpenConns(1)
 	}
-
-	DB = db
-	log.Println("✅ Connected to PostgreSQL database")
 	return db, nil
 }
 
-func getEnv(key, defaultValue string) string {
-	if value := os.Getenv(key); value != "" {
+// DSN builds the data source name of the configured driver. Port and Name default per
+// driver when unset; for SQLite, Name is the path of the database file.
+func (d DatabaseConfig) DSN() (string, error) {
+	if _, ok := sslModes[d.SSLMode]; !ok {
+		return "", fmt.Errorf("invalid DB_SSL_MODE %q", d.SSLMode)
+	}
+	orDefault := func(value, defaultValue string) string {
+		if value == "" {
+			return defaultValue
+		}
 		return value
 	}
-	return defaultValue
-} 
\ No newline at end of file
+	port := ""
+	if d.Port != 0 {
+		port = strconv.Itoa(d.Port)
+	}
+
+	switch d.Driver {
+	case DriverPostgres:
+		u := url.URL{
+			Scheme:   "postgres",
+			User:     url.UserPassword(d.User, d.Password),
+			Host:     fmt.Sprintf("%s:%s", d.Host, orDefault(port, "5432")),
+			Path:     orDefault(d.Name, "crud_example"),
+			RawQuery: url.Values{"sslmode": {d.SSLMode}, "TimeZone": {"UTC"}}.Encode(),
+		}
+		return u.String(), nil
+	case DriverMySQL:
+		// multiStatements lets a migration file run as a single Exec
+		params := url.Values{
+			"charset":         {"utf8mb4"},
+			"parseTime":       {"true"},
+			"loc":             {"UTC"},
+			"tls":             {sslModes[d.SSLMode]},
+			"multiStatements": {"true"},
+		}
+		return fmt.Sprintf("%s:%s@tcp(%s:%s)/%s?%s", d.User, d.Password, d.Host, orDefault(port, "3306"),
+			orDefault(d.Name, "crud_example"), params.Encode()), nil
+	case DriverSQLite:
+		return orDefault(d.Name, "crud_example.db") + "?_busy_timeout=5000", nil
+	default:
+		return "", fmt.Errorf("unsupported DB_DRIVER %q, use %s, %s or %s", d.Driver, DriverPostgres, DriverMySQL, DriverSQLite)
+	}
+}
@@ -0,0 +1,9 @@
+//go:build mysql
+
+package config
+
+import "gorm.io/driver/mysql"
+
+func init() {
+	drivers[DriverMySQL] = mysql.Open
+}
@@ -0,0 +1,9 @@
+//go:build sqlite
+
+package config
+
+import "gorm.io/driver/sqlite"
+
+func init() {
+	drivers[DriverSQLite] = sqlite.Open
+}
@@ -0,0 +1,159 @@
+package config
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"strings"
+	"sync/atomic"
+
+	"gorm.io/gorm"
+)
+
+// Replicas routes reads that tolerate replication lag to the read replicas in DB_REPLICAS,
+// round robin over the replicas that passed their last health check. Reads go to the
+// primary instead when no replica is healthy, outside a request that allowed replica reads
+// (see WithReadRouting), and once that request wrote to the primary, so a request always
+// reads its own writes.
+type Replicas struct {
+	primary  *gorm.DB
+	replicas []*replica
+	next     atomic.Uint64
+}
+
+// replica is a read replica and the result of its last health check
+type replica struct {
+	name    string
+	db      *gorm.DB
+	healthy atomic.Bool
+}
+
+// ReplicaStatus describes a read replica for monitoring
+type ReplicaStatus struct {
+	Name    string
+	Healthy bool
+	Stats   sql.DBStats
+}
+
+// OpenReplicas opens the read replicas configured in cfg for primary and checks their health.
+// Replicas that are down do not fail startup; they receive reads once a health check passes.
+// Without replicas, every read goes to the primary.
+func OpenReplicas(ctx context.Context, cfg *Config, primary *gorm.DB) (*Replicas, error) {
+	r := &Replicas{primary: primary}
+	for i, dsn := range strings.Split(cfg.Database.Replicas, ",") {
+		dsn = strings.TrimSpace(dsn)
+		if dsn == "" {
+			continue
+		}
+		db, err := open(cfg, dsn)
+		if err != nil {
+			return nil, fmt.Errorf("replica %d: %w", i+1, err)
+		}
+		// The DSN holds the password, so replicas are named by position in logs
+		r.replicas = append(r.replicas, &replica{name: fmt.Sprintf("replica %d", i+1), db: db})
+	}
+	if len(r.replicas) == 0 {
+		return r, nil
+	}
+
+	// Writes to the primary pin the remaining reads of their request to the primary
+	callbacks := primary.Callback()
+	for _, err := range []error{
+		callbacks.Create().After("gorm:create").Register("replicas:pin_primary", pinPrimary),
+		callbacks.Update().After("gorm:update").Register("replicas:pin_primary", pinPrimary),
+		callbacks.Delete().After("gorm:delete").Register("replicas:pin_primary", pinPrimary),
+		callbacks.Raw().After("gorm:raw").Register("replicas:pin_primary", pinPrimary),
+	} {
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	r.Check(ctx)
+	return r, nil
+}
+
+// Reader returns the database to run a read in the request carried by ctx on
+func (r *Replicas) Reader(ctx context.Context) *gorm.DB {
+	if len(r.replicas) == 0 || PrimaryReads(ctx) {
+		return r.primary
+	}
+	start := r.next.Add(1)
+	for i := range r.replicas {
+		replica := r.replicas[(start+uint64(i))%uint64(len(r.replicas))]
+		if replica.healthy.Load() {
+			return replica.db
+		}
+	}
+	return r.primary
+}
+
+// Check pings every replica and routes reads only to those that answered. Changes in the
+// health of a replica are logged.
+func (r *Replicas) Check(ctx context.Context) {
+	for _, replica := range r.replicas {
+		err := ping(ctx, replica.db)
+		healthy := err == nil
+		if replica.healthy.Swap(healthy) == healthy {
+			continue
+		}
+		if healthy {
+			log.Printf("✅ Read %s is healthy", replica.name)
+		} else {
+			log.Printf("⚠️  Read %s is unhealthy, reading from the other replicas or the primary: %v", replica.name, err)
+		}
+	}
+}
+
+// Status returns the health and connection pool statistics of every replica
+func (r *Replicas) Status() []ReplicaStatus {
+	statuses := make([]ReplicaStatus, 0, len(r.replicas))
+	for _, replica := range r.replicas {
+		status := ReplicaStatus{Name: replica.name, Healthy: replica.healthy.Load()}
+		if sqlDB, err := replica.db.DB(); err == nil {
+			status.Stats = sqlDB.Stats()
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses
+}
+
+func ping(ctx context.Context, db *gorm.DB) error {
+	sqlDB, err := db.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.PingContext(ctx)
+}
+
+// readRouting is the read routing state of a request; primary is set once its reads must
+// go to the primary
+type readRouting struct {
+	primary atomic.Bool
+}
+
+type readRoutingKey struct{}
+
+// WithReadRouting returns a copy of ctx in which reads may go to a replica until the request
+// writes to the primary, or in which every read goes to the primary when primary is set
+func WithReadRouting(ctx context.Context, primary bool) context.Context {
+	state := &readRouting{}
+	state.primary.Store(primary)
+	return context.WithValue(ctx, readRoutingKey{}, state)
+}
+
+// PrimaryReads reports whether reads in ctx must go to the primary, which is the case
+// outside WithReadRouting
+func PrimaryReads(ctx context.Context) bool {
+	state, ok := ctx.Value(readRoutingKey{}).(*readRouting)
+	return !ok || state.primary.Load()
+}
+
+// pinPrimary is the GORM callback sending the remaining reads of a request to the primary
+// after it wrote there
+func pinPrimary(db *gorm.DB) {
+	if state, ok := db.Statement.Context.Value(readRoutingKey{}).(*readRouting); ok {
+		state.primary.Store(true)
+	}
+}
@@ -0,0 +1,74 @@
+package config
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+	"crud-example/models"
+)
+
+// openTestReplicas opens a primary and two replicas that are never connected to; nothing
+// listens on port 1, so health checks fail
+func openTestReplicas(t *testing.T) *Replicas {
+	clearEnv(t)
+	cfg, _, err := Load(nil)
+	require.NoError(t, err)
+	cfg.Log.Level = LogError
+	cfg.Database.Replicas = "postgres://replica@127.0.0.1:1/one, postgres://replica@127.0.0.1:1/two"
+
+	primary, err := open(cfg, "postgres://primary@127.0.0.1:1/primary")
+	require.NoError(t, err)
+	replicas, err := OpenReplicas(context.Background(), cfg, primary)
+	require.NoError(t, err)
+	require.Len(t, replicas.replicas, 2)
+	return replicas
+}
+
+func TestReplicasReader(t *testing.T) {
+	replicas := openTestReplicas(t)
+	one, two := replicas.replicas[0], replicas.replicas[1]
+	ctx := WithReadRouting(context.Background(), false)
+
+	// The replicas failed their first health check
+	assert.Same(t, replicas.primary, replicas.Reader(ctx))
+
+	one.healthy.Store(true)
+	two.healthy.Store(true)
+	first, second := replicas.Reader(ctx), replicas.Reader(ctx)
+	assert.ElementsMatch(t, []*gorm.DB{one.db, two.db}, []*gorm.DB{first, second}, "reads alternate between replicas")
+
+	// Outside a request, or when the request forces it, reads go to the primary
+	assert.Same(t, replicas.primary, replicas.Reader(context.Background()))
+	assert.Same(t, replicas.primary, replicas.Reader(WithReadRouting(context.Background(), true)))
+
+	// Unhealthy replicas are skipped
+	one.healthy.Store(false)
+	assert.Same(t, two.db, replicas.Reader(ctx))
+	assert.Same(t, two.db, replicas.Reader(ctx))
+
+	// A health check finds the replica down
+	replicas.Check(context.Background())
+	assert.Same(t, replicas.primary, replicas.Reader(ctx))
+	for _, status := range replicas.Status() {
+		assert.False(t, status.Healthy, status.Name)
+	}
+}
+
+func TestReplicasReadAfterWrite(t *testing.T) {
+	replicas := openTestReplicas(t)
+	for _, replica := range replicas.replicas {
+		replica.healthy.Store(true)
+	}
+	ctx := WithReadRouting(context.Background(), false)
+	require.False(t, PrimaryReads(ctx))
+
+	// A dry run goes through the write callbacks without connecting
+	dryRun := replicas.primary.Session(&gorm.Session{DryRun: true, SkipDefaultTransaction: true})
+	require.NoError(t, dryRun.WithContext(ctx).Create(&models.User{Email: "user@example.com"}).Error)
+
+	assert.True(t, PrimaryReads(ctx))
+	assert.Same(t, replicas.primary, replicas.Reader(ctx))
+}
@@ -0,0 +1,44 @@
+// Package dbtest opens throwaway databases for tests. It is only imported by tests, so the
+// SQLite driver is not linked into the server unless it is built with the sqlite tag.
+package dbtest
+
+import (
+	"context"
+	"testing"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+	"crud-example/migrations"
+)
+
+// Open returns an in-memory SQLite database with every migration applied, configured like
+// the server's connection. The SQLite driver needs cgo; without it the test is skipped.
+func Open(t testing.TB) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{
+		Logger:         logger.Default.LogMode(logger.Silent),
+		TranslateError: true,
+	})
+	if err != nil {
+		// An in-memory database only fails to open when the driver was built without cgo
+		t.Skipf("SQLite is unavailable, run the tests with cgo: %v", err)
+	}
+
+	// Each connection to :memory: is a separate database
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatalf("open SQLite: %v", err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { sqlDB.Close() })
+
+	migrator, err := migrations.New(db)
+	if err != nil {
+		t.Fatalf("load migrations: %v", err)
+	}
+	if _, err := migrator.Up(context.Background()); err != nil {
+		t.Fatalf("migrate SQLite: %v", err)
+	}
+	return db
+}
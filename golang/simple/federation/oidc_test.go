@@ -0,0 +1,218 @@
+package federation
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeProvider is a minimal OpenID Connect provider issuing ID tokens for a fixed user
+type fakeProvider struct {
+	*httptest.Server
+	key      *rsa.PrivateKey
+	clientID string
+	// claims overrides or adds claims of the issued ID token
+	claims jwt.MapClaims
+	// authorizations maps issued codes to the PKCE challenge and nonce of their request
+	authorizations map[string][2]string
+}
+
+func newFakeProvider(t *testing.T) *fakeProvider {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	f := &fakeProvider{key: key, clientID: "client-1", claims: jwt.MapClaims{}, authorizations: map[string][2]string{}}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 f.URL,
+			"authorization_endpoint": f.URL + "/authorize",
+			"token_endpoint":         f.URL + "/token",
+			"jwks_uri":               f.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": "key-1",
+			"use": "sig",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		authorization, ok := f.authorizations[r.PostForm.Get("code")]
+		if !ok || PKCEChallenge(r.PostForm.Get("code_verifier")) != authorization[0] || r.PostForm.Get("client_id") != f.clientID {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+			return
+		}
+		delete(f.authorizations, r.PostForm.Get("code"))
+
+		claims := jwt.MapClaims{
+			"iss":            f.URL,
+			"sub":            "subject-1",
+			"aud":            f.clientID,
+			"exp":            time.Now().Add(time.Minute).Unix(),
+			"iat":            time.Now().Unix(),
+			"nonce":          authorization[1],
+			"email":          "jane@example.com",
+			"email_verified": true,
+			"name":           "Jane",
+		}
+		for k, v := range f.claims {
+			claims[k] = v
+		}
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+		token.Header["kid"] = "key-1"
+		signed, _ := token.SignedString(key)
+		json.NewEncoder(w).Encode(map[string]string{"access_token": "opaque", "token_type": "Bearer", "id_token": signed})
+	})
+	f.Server = httptest.NewServer(mux)
+	t.Cleanup(f.Close)
+	return f
+}
+
+// authorize simulates the user logging in at the provider and returns the issued code
+func (f *fakeProvider) authorize(t *testing.T, authURL string) string {
+	u, err := url.Parse(authURL)
+	require.NoError(t, err)
+	query := u.Query()
+	assert.Equal(t, "code", query.Get("response_type"))
+	assert.Equal(t, "S256", query.Get("code_challenge_method"))
+
+	code := "code-" + query.Get("state")
+	f.authorizations[code] = [2]string{query.Get("code_challenge"), query.Get("nonce")}
+	return code
+}
+
+func (f *fakeProvider) provider() *OIDCProvider {
+	return NewOIDCProvider(OIDCConfig{
+		Name:        "fake",
+		Issuer:      f.URL,
+		ClientID:    f.clientID,
+		RedirectURL: "http://localhost:8080/api/auth/oidc/fake/callback",
+	})
+}
+
+func TestOIDCLoginFlow(t *testing.T) {
+	f := newFakeProvider(t)
+	p := f.provider()
+	ctx := context.Background()
+
+	verifier, challenge, err := NewPKCE()
+	require.NoError(t, err)
+	authURL, err := p.AuthCodeURL(ctx, AuthRequest{State: "state", Nonce: "nonce", CodeChallenge: challenge})
+	require.NoError(t, err)
+
+	code := f.authorize(t, authURL)
+	identity, err := p.Exchange(ctx, code, verifier, "nonce")
+	require.NoError(t, err)
+	assert.Equal(t, &Identity{
+		Provider:      "fake",
+		Subject:       "subject-1",
+		Email:         "jane@example.com",
+		EmailVerified: true,
+		Name:          "Jane",
+	}, identity)
+
+	// Codes are single-use
+	_, err = p.Exchange(ctx, code, verifier, "nonce")
+	assert.Error(t, err)
+}
+
+func TestOIDCExchangeRejects(t *testing.T) {
+	tests := []struct {
+		name     string
+		claims   jwt.MapClaims
+		verifier string
+		nonce    string
+	}{
+		{name: "wrong code verifier", verifier: "wrong"},
+		{name: "wrong nonce", nonce: "other"},
+		{name: "wrong audience", claims: jwt.MapClaims{"aud": "someone-else"}},
+		{name: "wrong issuer", claims: jwt.MapClaims{"iss": "https://evil.example.com"}},
+		{name: "expired", claims: jwt.MapClaims{"exp": time.Now().Add(-time.Minute).Unix()}},
+		{name: "no subject", claims: jwt.MapClaims{"sub": ""}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFakeProvider(t)
+			f.claims = tt.claims
+			p := f.provider()
+			ctx := context.Background()
+
+			verifier, challenge, err := NewPKCE()
+			require.NoError(t, err)
+			authURL, err := p.AuthCodeURL(ctx, AuthRequest{State: "state", Nonce: "nonce", CodeChallenge: challenge})
+			require.NoError(t, err)
+			code := f.authorize(t, authURL)
+
+			if tt.verifier != "" {
+				verifier = tt.verifier
+			}
+			nonce := "nonce"
+			if tt.nonce != "" {
+				nonce = tt.nonce
+			}
+
+			_, err = p.Exchange(ctx, code, verifier, nonce)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestOIDCEmailVerifiedAsString(t *testing.T) {
+	f := newFakeProvider(t)
+	f.claims = jwt.MapClaims{"email_verified": "false"}
+	p := f.provider()
+	ctx := context.Background()
+
+	verifier, challenge, err := NewPKCE()
+	require.NoError(t, err)
+	authURL, err := p.AuthCodeURL(ctx, AuthRequest{State: "state", Nonce: "nonce", CodeChallenge: challenge})
+	require.NoError(t, err)
+
+	identity, err := p.Exchange(ctx, f.authorize(t, authURL), verifier, "nonce")
+	require.NoError(t, err)
+	assert.False(t, identity.EmailVerified)
+}
+
+func TestNewPKCE(t *testing.T) {
+	verifier, challenge, err := NewPKCE()
+	require.NoError(t, err)
+	assert.Len(t, verifier, 43)
+	assert.Len(t, challenge, 43)
+	assert.Equal(t, challenge, PKCEChallenge(verifier))
+
+	other, _, err := NewPKCE()
+	require.NoError(t, err)
+	assert.NotEqual(t, verifier, other)
+}
+
+func TestRegistry(t *testing.T) {
+	_, err := Get("missing")
+	assert.ErrorIs(t, err, ErrUnknownProvider)
+
+	Register(NewOIDCProvider(OIDCConfig{Name: "registered"}))
+	defer Unregister("registered")
+
+	p, err := Get("registered")
+	require.NoError(t, err)
+	assert.Equal(t, "registered", p.Name())
+	assert.Contains(t, Names(), "registered")
+}
@@ -0,0 +1,154 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"crud-example/middleware"
+	"crud-example/models"
+	"crud-example/utils"
+)
+
+// ListAPIKeys returns the API keys of the current user
+func (h *Handler) ListAPIKeys(c *gin.Context) {
+	user := middleware.CurrentUser(c)
+
+	keys, err := h.APIKeys.ListByUser(c.Request.Context(), user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get API keys"})
+		return
+	}
+
+	responses := []models.APIKeyResponse{}
+	for _, key := range keys {
+		responses = append(responses, key.ToResponse())
+	}
+
+	c.JSON(http.StatusOK, gin.H{"api_keys": responses})
+}
+
+// CreateAPIKey creates an API key for the current user. The key is only returned once.
+func (h *Handler) CreateAPIKey(c *gin.Context) {
+	user := middleware.CurrentUser(c)
+	var keyCreate models.APIKeyCreate
+
+	// Bind JSON to struct
+	if err := c.ShouldBindJSON(&keyCreate); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data", "details": err.Error()})
+		return
+	}
+
+	// Keys can only be restricted to permissions the user already has
+	for _, scope := range keyCreate.Scopes {
+		if !models.IsValidPermission(scope) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown scope", "details": scope})
+			return
+		}
+		if !user.HasPermission(scope) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Scope not allowed for your role", "details": scope})
+			return
+		}
+	}
+
+	if keyCreate.ExpiresAt != nil && !keyCreate.ExpiresAt.After(time.Now()) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Expiry must be in the future"})
+		return
+	}
+
+	rawKey, publicID, keyHash, err := utils.GenerateAPIKey()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate API key"})
+		return
+	}
+
+	key := models.APIKey{
+		UserID:    user.ID,
+		Name:      keyCreate.Name,
+		PublicID:  publicID,
+		KeyHash:   keyHash,
+		Scopes:    strings.Join(keyCreate.Scopes, ","),
+		ExpiresAt: keyCreate.ExpiresAt,
+	}
+	if err := h.APIKeys.Create(c.Request.Context(), &key); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create API key"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "API key created successfully, store it now: it will not be shown again",
+		"api_key": key.ToResponse(),
+		"key":     rawKey,
+	})
+}
+
+// UpdateAPIKey relabels an API key of the current user
+func (h *Handler) UpdateAPIKey(c *gin.Context) {
+	key, ok := h.findOwnAPIKey(c)
+	if !ok {
+		return
+	}
+
+	var keyUpdate models.APIKeyUpdate
+
+	// Bind JSON to struct
+	if err := c.ShouldBindJSON(&keyUpdate); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data", "details": err.Error()})
+		return
+	}
+
+	if err := h.APIKeys.Rename(c.Request.Context(), key.ID, keyUpdate.Name); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update API key"})
+		return
+	}
+	key.Name = keyUpdate.Name
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "API key updated successfully",
+		"api_key": key.ToResponse(),
+	})
+}
+
+// RevokeAPIKey revokes an API key of the current user
+func (h *Handler) RevokeAPIKey(c *gin.Context) {
+	key, ok := h.findOwnAPIKey(c)
+	if !ok {
+		return
+	}
+
+	if key.RevokedAt == nil {
+		now := time.Now()
+		if err := h.APIKeys.Revoke(c.Request.Context(), key.ID, now); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke API key"})
+			return
+		}
+		key.RevokedAt = &now
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "API key revoked successfully",
+		"api_key": key.ToResponse(),
+	})
+}
+
+// findOwnAPIKey loads the API key from the URL that belongs to the current user,
+// writing the error response when it cannot be found
+func (h *Handler) findOwnAPIKey(c *gin.Context) (*models.APIKey, bool) {
+	user := middleware.CurrentUser(c)
+
+	// Get API key ID from URL parameter
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid API key ID"})
+		return nil, false
+	}
+
+	key, err := h.APIKeys.FindByUser(c.Request.Context(), uint(id), user.ID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "API key not found"})
+		return nil, false
+	}
+	return key, true
+}
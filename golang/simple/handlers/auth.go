@@ -1,8 +1,9 @@
 package handlers
 
 import (
+	"errors"
+	"log"
 	"net/http"
-	"strconv"
 
 	"github.com/gin-gonic/gin"
 	"crud-example/config"
@@ -11,7 +12,7 @@ import (
 )
 
 // Register handles user registration
-func Register(c *gin.Context) {
+func (h *Handler) Register(c *gin.Context) {
 	var userCreate models.UserCreate
 
 	// Bind JSON to struct
@@ -21,12 +22,15 @@ func Register(c *gin.Context) {
 	}
 
 	// Check if user already exists
-	var existingUser models.User
-	if err := config.DB.Where("email = ?", userCreate.Email).First(&existingUser).Error; err == nil {
+	if h.emailTaken(c.Request.Context(), userCreate.Email, 0) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Email already registered"})
 		return
 	}
 
+	if !checkPasswordPolicy(c, userCreate.Password, userCreate.Name, userCreate.Email) {
+		return
+	}
+
 	// Hash password
 	hashedPassword, err := utils.HashPassword(userCreate.Password)
 	if err != nil {
@@ -41,29 +45,44 @@ func Register(c *gin.Context) {
 		Password: hashedPassword,
 		Age:      userCreate.Age,
 		IsActive: true,
+		Role:     models.RoleUser,
 	}
 
-	if err := config.DB.Create(&user).Error; err != nil {
+	if err := h.Users.Create(c.Request.Context(), &user); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create user"})
 		return
 	}
 
-	// Generate token
-	token, err := utils.GenerateToken(user.ID, user.Email)
+	// Send email verification link; the account exists even if delivery fails
+	// and a new link can be requested through the resend endpoint
+	if err := h.sendVerificationEmail(c.Request.Context(), &user); err != nil {
+		log.Printf("Failed to send verification email to user %d: %v", user.ID, err)
+	}
+
+	// Unverified users only receive tokens if the verification policy allows it
+	if config.Current().Account.EmailVerificationPolicy == config.VerificationLogin {
+		c.JSON(http.StatusCreated, gin.H{
+			"message": "User registered successfully, please verify your email address",
+			"user":    user.ToResponse(),
+		})
+		return
+	}
+
+	// Generate tokens
+	token, refreshToken, err := h.issueTokens(c, &user)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
 		return
 	}
 
-	c.JSON(http.StatusCreated, gin.H{
-		"message": "User registered successfully",
-		"user":    user.ToResponse(),
-		"token":   token,
-	})
+	response := tokenResponse(token, refreshToken)
+	response["message"] = "User registered successfully"
+	response["user"] = user.ToResponse()
+	c.JSON(http.StatusCreated, response)
 }
 
 // Login handles user login
-func Login(c *gin.Context) {
+func (h *Handler) Login(c *gin.Context) {
 	var loginData models.UserLogin
 
 	// Bind JSON to struct
@@ -72,18 +91,30 @@ func Login(c *gin.Context) {
 		return
 	}
 
+	// Refuse attempts while the account or the client IP is locked or throttled
+	identifiers := loginIdentifiers(c, loginData.Email)
+	if status, message := h.loginRefusal(c, identifiers); status != 0 {
+		c.JSON(status, gin.H{"error": message})
+		return
+	}
+
 	// Find user by email
-	var user models.User
-	if err := config.DB.Where("email = ?", loginData.Email).First(&user).Error; err != nil {
+	user, err := h.Users.FindByEmail(c.Request.Context(), loginData.Email)
+	if err != nil {
+		// Compare against a dummy hash so unknown emails take as long as wrong passwords
+		utils.CheckDummyPassword(loginData.Password)
+		h.recordLoginFailure(c, identifiers, nil)
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
 		return
 	}
 
 	// Check password
 	if !utils.CheckPassword(loginData.Password, user.Password) {
+		h.recordLoginFailure(c, identifiers, &user.ID)
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
 		return
 	}
+	h.upgradePasswordHash(c.Request.Context(), user, loginData.Password)
 
 	// Check if user is active
 	if !user.IsActive {
@@ -91,16 +122,85 @@ func Login(c *gin.Context) {
 		return
 	}
 
-	// Generate token
-	token, err := utils.GenerateToken(user.ID, user.Email)
+	// With MFA the failures are only cleared once the second factor passes, see completeMFA
+	if !user.MFAEnabled {
+		h.resetLoginFailures(c.Request.Context(), identifiers)
+	}
+
+	h.completeLogin(c, user)
+}
+
+// Refresh exchanges a refresh token for a new token pair, rotating the refresh token
+func (h *Handler) Refresh(c *gin.Context) {
+	var refreshData models.RefreshRequest
+
+	// Bind JSON to struct
+	if err := c.ShouldBindJSON(&refreshData); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data", "details": err.Error()})
+		return
+	}
+
+	session, user, refreshToken, err := h.rotateRefreshToken(c, refreshData.RefreshToken, "")
+	switch {
+	case errors.Is(err, errInvalidRefreshToken):
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid refresh token"})
+		return
+	case errors.Is(err, errRefreshTokenExpired):
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Refresh token expired or revoked"})
+		return
+	case errors.Is(err, errRefreshTokenReuse):
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Refresh token reuse detected"})
+		return
+	case errors.Is(err, errRefreshUserInactive):
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found or inactive"})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to rotate refresh token"})
+		return
+	}
+
+	// Generate access token
+	token, err := utils.GenerateSessionToken(user.ID, user.Email, user.Role, session.SessionToken)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"message": "Login successful",
-		"user":    user.ToResponse(),
-		"token":   token,
-	})
-} 
\ No newline at end of file
+	response := tokenResponse(token, refreshToken)
+	response["message"] = "Token refreshed successfully"
+	c.JSON(http.StatusOK, response)
+} 
+
+// Logout revokes the current access token and the session it belongs to
+func (h *Handler) Logout(c *gin.Context) {
+	claims := c.MustGet("claims").(*utils.Claims)
+
+	if err := h.Revocations.RevokeToken(c.Request.Context(), claims); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke token"})
+		return
+	}
+
+	// Revoke the refresh token family the access token was issued for
+	if claims.SessionID != "" {
+		if session, err := h.Sessions.FindByToken(c.Request.Context(), claims.SessionID); err == nil && session.UserID == claims.UserID {
+			if err := h.revokeSession(c.Request.Context(), session); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke session"})
+				return
+			}
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Logged out successfully"})
+}
+
+// LogoutAll revokes every access token and session of the current user
+func (h *Handler) LogoutAll(c *gin.Context) {
+	claims := c.MustGet("claims").(*utils.Claims)
+
+	if err := h.revokeUserSessions(c.Request.Context(), claims.UserID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke sessions"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Logged out from all sessions successfully"})
+}
\ No newline at end of file
@@ -1,54 +1,45 @@
 package handlers
 
 import (
-	"bytes"
+	"context"
 	"encoding/json"
 	"net/http"
-	"net/http/httptest"
 	"testing"
 
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
-	"gorm.io/driver/sqlite"
-	"gorm.io/gorm"
-	"crud-example/config"
+	"github.com/stretchr/testify/require"
+	"crud-example/middleware"
 	"crud-example/models"
 )
 
-func setupTestDB() *gorm.DB {
-	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
-	if err != nil {
-		panic("Failed to connect to test database")
-	}
-	
-	// Auto migrate
-	db.AutoMigrate(&models.User{})
-	
-	return db
-}
+func setupAuthRouter(h *Handler) *gin.Engine {
+	r := gin.New()
 
-func setupTestRouter() *gin.Engine {
-	gin.SetMode(gin.TestMode)
-	r := gin.Default()
-	
-	// Set test database
-	testDB := setupTestDB()
-	config.SetDB(testDB)
-	
 	// Setup routes
 	api := r.Group("/api")
 	auth := api.Group("/auth")
 	{
-		auth.POST("/register", Register)
-		auth.POST("/login", Login)
+		auth.POST("/register", h.Register)
+		auth.POST("/login", h.Login)
 	}
-	
+
+	return r
+}
+
+// setupLogoutRouter adds the logout routes, behind AuthMiddleware as in main, to the token routes
+func setupLogoutRouter(h *Handler) *gin.Engine {
+	r := setupTokensRouter(h)
+	authenticate := middleware.AuthMiddleware(h.Authentication())
+	r.POST("/api/auth/logout", authenticate, middleware.RequireTokenAuth(), h.Logout)
+	r.POST("/api/auth/logout-all", authenticate, middleware.RequireTokenAuth(), middleware.RequireNoImpersonation(), h.LogoutAll)
 	return r
 }
 
 func TestRegister(t *testing.T) {
-	r := setupTestRouter()
-	
+	h, stores := setupTestHandler()
+	r := setupAuthRouter(h)
+
 	tests := []struct {
 		name       string
 		payload    map[string]interface{}
@@ -58,19 +49,29 @@ func TestRegister(t *testing.T) {
 		{
 			name: "Valid registration",
 			payload: map[string]interface{}{
-				"username": "testuser",
+				"name":     "Test User",
 				"email":    "test@example.com",
-				"password": "password123",
+				"password": "Tr0ub4dor&3x",
 			},
 			wantStatus: http.StatusCreated,
 			wantError:  false,
 		},
+		{
+			name: "Email already registered",
+			payload: map[string]interface{}{
+				"name":     "Test User",
+				"email":    "test@example.com",
+				"password": "Tr0ub4dor&3x",
+			},
+			wantStatus: http.StatusBadRequest,
+			wantError:  true,
+		},
 		{
 			name: "Invalid email",
 			payload: map[string]interface{}{
-				"username": "testuser",
+				"name":     "Test User",
 				"email":    "invalid-email",
-				"password": "password123",
+				"password": "Tr0ub4dor&3x",
 			},
 			wantStatus: http.StatusBadRequest,
 			wantError:  true,
@@ -78,51 +79,52 @@ func TestRegister(t *testing.T) {
 		{
 			name: "Missing fields",
 			payload: map[string]interface{}{
-				"username": "testuser",
+				"name": "Test User",
 			},
 			wantStatus: http.StatusBadRequest,
 			wantError:  true,
 		},
 	}
-	
+
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			jsonData, _ := json.Marshal(tt.payload)
-			req, _ := http.NewRequest("POST", "/api/auth/register", bytes.NewBuffer(jsonData))
-			req.Header.Set("Content-Type", "application/json")
-			
-			w := httptest.NewRecorder()
-			r.ServeHTTP(w, req)
-			
+			w := performRequest(r, "POST", "/api/auth/register", tt.payload)
+
 			assert.Equal(t, tt.wantStatus, w.Code)
-			
+
 			if !tt.wantError {
 				var response map[string]interface{}
 				err := json.Unmarshal(w.Body.Bytes(), &response)
 				assert.NoError(t, err)
 				assert.Contains(t, response, "token")
+				assert.Contains(t, response, "refresh_token")
 				assert.Contains(t, response, "user")
 			}
 		})
 	}
+
+	// The registration started a session and sent a verification link
+	user, err := stores.users.FindByEmail(context.Background(), "test@example.com")
+	require.NoError(t, err)
+	assert.False(t, user.IsVerified)
+	assert.Len(t, stores.sessions.All(user.ID), 1)
+	assert.Len(t, stores.verifications.All(), 1)
+	_, sent := stores.mail.Last("test@example.com")
+	assert.True(t, sent)
 }
 
 func TestLogin(t *testing.T) {
-	r := setupTestRouter()
-	
+	h, _ := setupTestHandler()
+	r := setupAuthRouter(h)
+
 	// First register a user
-	registerPayload := map[string]interface{}{
-		"username": "testuser",
+	w := performRequest(r, "POST", "/api/auth/register", map[string]interface{}{
+		"name":     "Test User",
 		"email":    "test@example.com",
-		"password": "password123",
-	}
-	
-	jsonData, _ := json.Marshal(registerPayload)
-	req, _ := http.NewRequest("POST", "/api/auth/register", bytes.NewBuffer(jsonData))
-	req.Header.Set("Content-Type", "application/json")
-	w := httptest.NewRecorder()
-	r.ServeHTTP(w, req)
-	
+		"password": "Tr0ub4dor&3x",
+	})
+	require.Equal(t, http.StatusCreated, w.Code)
+
 	tests := []struct {
 		name       string
 		payload    map[string]interface{}
@@ -133,7 +135,7 @@ func TestLogin(t *testing.T) {
 			name: "Valid login",
 			payload: map[string]interface{}{
 				"email":    "test@example.com",
-				"password": "password123",
+				"password": "Tr0ub4dor&3x",
 			},
 			wantStatus: http.StatusOK,
 			wantError:  false,
@@ -151,24 +153,19 @@ func TestLogin(t *testing.T) {
 			name: "User not found",
 			payload: map[string]interface{}{
 				"email":    "nonexistent@example.com",
-				"password": "password123",
+				"password": "Tr0ub4dor&3x",
 			},
 			wantStatus: http.StatusUnauthorized,
 			wantError:  true,
 		},
 	}
-	
+
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			jsonData, _ := json.Marshal(tt.payload)
-			req, _ := http.NewRequest("POST", "/api/auth/login", bytes.NewBuffer(jsonData))
-			req.Header.Set("Content-Type", "application/json")
-			
-			w := httptest.NewRecorder()
-			r.ServeHTTP(w, req)
-			
+			w := performRequest(r, "POST", "/api/auth/login", tt.payload)
+
 			assert.Equal(t, tt.wantStatus, w.Code)
-			
+
 			if !tt.wantError {
 				var response map[string]interface{}
 				err := json.Unmarshal(w.Body.Bytes(), &response)
@@ -178,4 +175,79 @@ func TestLogin(t *testing.T) {
 			}
 		})
 	}
-} 
\ No newline at end of file
+}
+
+func TestLoginThrottling(t *testing.T) {
+	h, _ := setupTestHandler()
+	r := setupAuthRouter(h)
+
+	w := performRequest(r, "POST", "/api/auth/register", map[string]interface{}{
+		"name":     "Test User",
+		"email":    "test@example.com",
+		"password": "Tr0ub4dor&3x",
+	})
+	require.Equal(t, http.StatusCreated, w.Code)
+
+	wrong := map[string]interface{}{"email": "test@example.com", "password": "wrongpassword"}
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, http.StatusUnauthorized, performRequest(r, "POST", "/api/auth/login", wrong).Code)
+	}
+
+	// After the third failure the next attempt has to wait, even with the right password
+	w = performRequest(r, "POST", "/api/auth/login", map[string]interface{}{
+		"email":    "test@example.com",
+		"password": "Tr0ub4dor&3x",
+	})
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.NotEmpty(t, w.Header().Get("Retry-After"))
+}
+
+func TestLogout(t *testing.T) {
+	h, _ := setupTestHandler()
+	r := setupLogoutRouter(h)
+	createTestUser(t, h, "test@example.com", models.RoleUser)
+	accessToken, refreshToken := loginTestUser(t, r, "test@example.com")
+	otherAccessToken, otherRefreshToken := loginTestUser(t, r, "test@example.com")
+
+	w := performAuthorizedRequest(r, "POST", "/api/auth/logout", accessToken, nil)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	// The access token and the refresh tokens of its session are rejected
+	assert.Equal(t, http.StatusUnauthorized, performAuthorizedRequest(r, "GET", "/api/users/me", accessToken, nil).Code)
+	assert.Equal(t, http.StatusUnauthorized, performAuthorizedRequest(r, "POST", "/api/auth/logout", accessToken, nil).Code)
+	assert.Equal(t, http.StatusUnauthorized, refresh(r, refreshToken).Code)
+
+	// The other sessions go on
+	assert.Equal(t, http.StatusOK, performAuthorizedRequest(r, "GET", "/api/users/me", otherAccessToken, nil).Code)
+	assert.Equal(t, http.StatusOK, refresh(r, otherRefreshToken).Code)
+}
+
+func TestLogoutAll(t *testing.T) {
+	h, _ := setupTestHandler()
+	r := setupLogoutRouter(h)
+	user := createTestUser(t, h, "test@example.com", models.RoleUser)
+	createTestUser(t, h, "other@example.com", models.RoleUser)
+	accessToken, refreshToken := loginTestUser(t, r, "test@example.com")
+	otherDeviceToken, otherDeviceRefreshToken := loginTestUser(t, r, "test@example.com")
+	otherUserToken, otherUserRefreshToken := loginTestUser(t, r, "other@example.com")
+
+	w := performAuthorizedRequest(r, "POST", "/api/auth/logout-all", accessToken, nil)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	// Every access and refresh token of the user is rejected
+	for _, token := range []string{accessToken, otherDeviceToken} {
+		assert.Equal(t, http.StatusUnauthorized, performAuthorizedRequest(r, "GET", "/api/users/me", token, nil).Code)
+	}
+	for _, token := range []string{refreshToken, otherDeviceRefreshToken} {
+		assert.Equal(t, http.StatusUnauthorized, refresh(r, token).Code)
+	}
+	active, err := h.Sessions.ListActive(context.Background(), user.ID)
+	require.NoError(t, err)
+	assert.Empty(t, active)
+
+	// Other users are not signed out, and the user can log in again
+	assert.Equal(t, http.StatusOK, performAuthorizedRequest(r, "GET", "/api/users/me", otherUserToken, nil).Code)
+	assert.Equal(t, http.StatusOK, refresh(r, otherUserRefreshToken).Code)
+	accessToken, _ = loginTestUser(t, r, "test@example.com")
+	assert.Equal(t, http.StatusOK, performAuthorizedRequest(r, "GET", "/api/users/me", accessToken, nil).Code)
+}
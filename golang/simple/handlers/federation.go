@@ -0,0 +1,312 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"crud-example/federation"
+	"crud-example/middleware"
+	"crud-example/models"
+	"crud-example/repository"
+	"crud-example/utils"
+)
+
+// federationStateCookie binds an authorization request to the browser that started it
+const federationStateCookie = "oidc_state"
+
+// federationStateTTL is how long a user has to complete the login at the provider
+const federationStateTTL = 10 * time.Minute
+
+// ListIdentityProviders returns the names of the configured identity providers
+func (h *Handler) ListIdentityProviders(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"providers": federation.Names()})
+}
+
+// OIDCLogin redirects the user to the identity provider to log in
+func (h *Handler) OIDCLogin(c *gin.Context) {
+	authURL, err := h.startFederation(c, nil)
+	if err != nil {
+		respondFederationError(c, err)
+		return
+	}
+
+	c.Redirect(http.StatusFound, authURL)
+}
+
+// LinkIdentity returns the provider URL that links an external account to the current user
+func (h *Handler) LinkIdentity(c *gin.Context) {
+	user := middleware.CurrentUser(c)
+
+	authURL, err := h.startFederation(c, &user.ID)
+	if err != nil {
+		respondFederationError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"authorization_url": authURL})
+}
+
+// OIDCCallback completes an authorization request: it either logs the user in,
+// creating or linking the account on first use, or links the provider to the user who started it
+func (h *Handler) OIDCCallback(c *gin.Context) {
+	providerName := c.Param("provider")
+	provider, err := federation.Get(providerName)
+	if err != nil {
+		respondFederationError(c, err)
+		return
+	}
+
+	if errCode := c.Query("error"); errCode != "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Login at identity provider failed", "details": errCode})
+		return
+	}
+
+	state := c.Query("state")
+	code := c.Query("code")
+	cookie, _ := c.Cookie(federationStateCookie)
+	c.SetCookie(federationStateCookie, "", -1, "/api/auth/oidc", "", c.Request.TLS != nil, true)
+	if state == "" || code == "" || cookie != state {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid authorization response"})
+		return
+	}
+
+	// Consume the state; deleting it first makes every authorization response single-use
+	request, err := h.Federation.ConsumeState(c.Request.Context(), utils.HashToken(state), providerName)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired authorization request"})
+		return
+	}
+
+	identity, err := provider.Exchange(c.Request.Context(), code, request.CodeVerifier, request.Nonce)
+	if err != nil {
+		log.Printf("Identity provider %s rejected authorization code: %v", providerName, err)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Failed to verify identity"})
+		return
+	}
+
+	if request.UserID != nil {
+		h.linkIdentity(c, *request.UserID, identity)
+		return
+	}
+
+	user, err := h.federatedUser(c.Request.Context(), identity)
+	if errors.Is(err, errUnverifiedAccount) {
+		c.JSON(http.StatusConflict, gin.H{"error": "An account with this email already exists, log in with your password to link it"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to log in"})
+		return
+	}
+
+	if !user.IsActive {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User account is inactive"})
+		return
+	}
+
+	h.completeLogin(c, user)
+}
+
+// ListIdentities returns the external accounts linked to the current user
+func (h *Handler) ListIdentities(c *gin.Context) {
+	user := middleware.CurrentUser(c)
+
+	identities, err := h.Federation.ListIdentities(c.Request.Context(), user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get identities"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"identities": identities})
+}
+
+// UnlinkIdentity removes the link between the current user and a provider
+func (h *Handler) UnlinkIdentity(c *gin.Context) {
+	user := middleware.CurrentUser(c)
+	provider := c.Param("provider")
+
+	deleted, err := h.Federation.DeleteIdentity(c.Request.Context(), user.ID, provider)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to unlink identity"})
+		return
+	}
+	if !deleted {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Identity not linked"})
+		return
+	}
+
+	h.Audit.Record(c.Request.Context(), utils.AuditEvent{
+		Message:   "Identity provider unlinked",
+		UserID:    &user.ID,
+		IPAddress: c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+		Context:   map[string]interface{}{"provider": provider},
+	})
+
+	c.JSON(http.StatusOK, gin.H{"message": "Identity unlinked successfully"})
+}
+
+// startFederation stores a new authorization request and returns the provider URL for it
+func (h *Handler) startFederation(c *gin.Context, userID *uint) (string, error) {
+	providerName := c.Param("provider")
+	provider, err := federation.Get(providerName)
+	if err != nil {
+		return "", err
+	}
+
+	state, err := utils.GenerateRandomToken(32)
+	if err != nil {
+		return "", err
+	}
+	nonce, err := utils.GenerateRandomToken(32)
+	if err != nil {
+		return "", err
+	}
+	verifier, challenge, err := federation.NewPKCE()
+	if err != nil {
+		return "", err
+	}
+
+	authURL, err := provider.AuthCodeURL(c.Request.Context(), federation.AuthRequest{
+		State:         state,
+		Nonce:         nonce,
+		CodeChallenge: challenge,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	request := models.FederationState{
+		StateHash:    utils.HashToken(state),
+		Provider:     providerName,
+		Nonce:        nonce,
+		CodeVerifier: verifier,
+		UserID:       userID,
+		ExpiresAt:    time.Now().Add(federationStateTTL),
+	}
+	if err := h.Federation.CreateState(c.Request.Context(), &request); err != nil {
+		return "", err
+	}
+
+	// Clean up requests that were never completed
+	if err := h.Federation.DeleteExpiredStates(c.Request.Context(), time.Now()); err != nil {
+		log.Printf("Failed to delete expired authorization requests: %v", err)
+	}
+
+	c.SetCookie(federationStateCookie, state, int(federationStateTTL.Seconds()), "/api/auth/oidc", "", c.Request.TLS != nil, true)
+	return authURL, nil
+}
+
+// respondFederationError maps errors of the start of a federated login to responses
+func respondFederationError(c *gin.Context, err error) {
+	if errors.Is(err, federation.ErrUnknownProvider) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Unknown identity provider"})
+		return
+	}
+	log.Printf("Identity provider %s unavailable: %v", c.Param("provider"), err)
+	c.JSON(http.StatusBadGateway, gin.H{"error": "Identity provider unavailable"})
+}
+
+// errUnverifiedAccount is returned when an external identity matches the email of a local
+// account but either side has not verified the address. Linking automatically would let
+// whoever registered the address first take over the account of its real owner.
+var errUnverifiedAccount = errors.New("local account email not verified")
+
+// federatedUser returns the user an external identity logs in as, linking it to the local
+// account with the same verified email or creating a new account on first use
+func (h *Handler) federatedUser(ctx context.Context, identity *federation.Identity) (*models.User, error) {
+	now := time.Now()
+
+	link, err := h.Federation.FindIdentity(ctx, identity.Provider, identity.Subject)
+	if err == nil {
+		user, err := h.Users.FindByID(ctx, link.UserID)
+		if err != nil {
+			return nil, err
+		}
+		if err := h.Federation.TouchIdentity(ctx, link.ID, now); err != nil {
+			log.Printf("Failed to record login with identity %d: %v", link.ID, err)
+		}
+		return user, nil
+	}
+	if !errors.Is(err, repository.ErrNotFound) {
+		return nil, err
+	}
+
+	email := strings.ToLower(strings.TrimSpace(identity.Email))
+	if email == "" {
+		return nil, errors.New("identity provider returned no email")
+	}
+
+	// Only an email verified on both sides proves the identity owns the local account
+	accept := func(user *models.User) error {
+		if !identity.EmailVerified || !user.IsVerified {
+			return errUnverifiedAccount
+		}
+		return nil
+	}
+	create := func() (*models.User, error) {
+		// Names are measured in characters, so that no multi-byte character is split
+		name := identity.Name
+		if utf8.RuneCountInString(name) < 2 {
+			name = strings.SplitN(email, "@", 2)[0]
+		}
+		if r := []rune(name); len(r) > 50 {
+			name = string(r[:50])
+		}
+
+		// The account has no password until the user sets one through a reset
+		return &models.User{
+			Name:       name,
+			Email:      email,
+			IsActive:   true,
+			IsVerified: identity.EmailVerified,
+			Role:       models.RoleUser,
+		}, nil
+	}
+
+	return h.Federation.LinkByEmail(ctx, email, &models.FederatedIdentity{
+		Provider:    identity.Provider,
+		Subject:     identity.Subject,
+		Email:       identity.Email,
+		LastLoginAt: &now,
+	}, accept, create)
+}
+
+// linkIdentity links an external identity to the user who started the link request
+func (h *Handler) linkIdentity(c *gin.Context, userID uint, identity *federation.Identity) {
+	if existing, err := h.Federation.FindIdentity(c.Request.Context(), identity.Provider, identity.Subject); err == nil {
+		if existing.UserID == userID {
+			c.JSON(http.StatusOK, gin.H{"message": "Identity already linked", "identity": existing})
+			return
+		}
+		c.JSON(http.StatusConflict, gin.H{"error": "Identity is linked to another account"})
+		return
+	}
+
+	link := models.FederatedIdentity{
+		UserID:   userID,
+		Provider: identity.Provider,
+		Subject:  identity.Subject,
+		Email:    identity.Email,
+	}
+	if err := h.Federation.CreateIdentity(c.Request.Context(), &link); err != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "Failed to link identity"})
+		return
+	}
+
+	h.Audit.Record(c.Request.Context(), utils.AuditEvent{
+		Message:   "Identity provider linked",
+		UserID:    &userID,
+		IPAddress: c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+		Context:   map[string]interface{}{"provider": identity.Provider},
+	})
+
+	c.JSON(http.StatusOK, gin.H{"message": "Identity linked successfully", "identity": link})
+}
@@ -0,0 +1,194 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"crud-example/config"
+	"crud-example/federation"
+	"crud-example/models"
+)
+
+// fakeProvider is an identity provider that skips the browser: the code it hands out for
+// an authorization request exchanges for identity, once the PKCE verifier and nonce match
+type fakeProvider struct {
+	identity  federation.Identity
+	challenge string
+	nonce     string
+}
+
+func (p *fakeProvider) Name() string { return "fake" }
+
+func (p *fakeProvider) AuthCodeURL(ctx context.Context, req federation.AuthRequest) (string, error) {
+	p.challenge, p.nonce = req.CodeChallenge, req.Nonce
+	return "https://idp.example.com/authorize?" + url.Values{"state": {req.State}}.Encode(), nil
+}
+
+func (p *fakeProvider) Exchange(ctx context.Context, code, codeVerifier, nonce string) (*federation.Identity, error) {
+	if code != "fake-code" || federation.PKCEChallenge(codeVerifier) != p.challenge || nonce != p.nonce {
+		return nil, errors.New("invalid authorization code")
+	}
+	identity := p.identity
+	identity.Provider = p.Name()
+	return &identity, nil
+}
+
+func setupFederationRouter(t *testing.T, h *Handler) (*gin.Engine, *fakeProvider) {
+	provider := &fakeProvider{}
+	federation.Register(provider)
+	t.Cleanup(func() { federation.Unregister(provider.Name()) })
+
+	r := gin.New()
+	oidc := r.Group("/api/auth/oidc")
+	{
+		oidc.GET("/:provider/login", h.OIDCLogin)
+		oidc.GET("/:provider/callback", h.OIDCCallback)
+	}
+	return r, provider
+}
+
+// oidcLogin logs in at the fake provider as identity and returns the callback response,
+// along with the callback URL so that tests can replay it
+func oidcLogin(t *testing.T, r http.Handler, provider *fakeProvider, identity federation.Identity) (*httptest.ResponseRecorder, string) {
+	provider.identity = identity
+
+	w := performRequest(r, "GET", "/api/auth/oidc/fake/login", nil)
+	require.Equal(t, http.StatusFound, w.Code, w.Body.String())
+	location, err := url.Parse(w.Header().Get("Location"))
+	require.NoError(t, err)
+	state := location.Query().Get("state")
+	require.NotEmpty(t, state)
+
+	callback := "/api/auth/oidc/fake/callback?" + url.Values{"state": {state}, "code": {"fake-code"}}.Encode()
+	return oidcCallback(r, callback, state), callback
+}
+
+// oidcCallback returns from the provider to callback in the browser holding the state cookie
+func oidcCallback(r http.Handler, callback, state string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest("GET", callback, nil)
+	req.AddCookie(&http.Cookie{Name: federationStateCookie, Value: state})
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+// federatedUserIDs returns the users the identities of the provider are linked to, by subject
+func federatedUserIDs(t *testing.T, h *Handler) map[string]uint {
+	var links []models.FederatedIdentity
+	require.NoError(t, h.db.Where("provider = ?", "fake").Find(&links).Error)
+	ids := map[string]uint{}
+	for _, link := range links {
+		ids[link.Subject] = link.UserID
+	}
+	return ids
+}
+
+func TestOIDCCallbackNewAccount(t *testing.T) {
+	h, _ := setupDBTestHandler(t)
+	r, provider := setupFederationRouter(t, h)
+	identity := federation.Identity{Subject: "subject-1", Email: "New@Example.com", EmailVerified: true, Name: "New User"}
+
+	w, callback := oidcLogin(t, r, provider, identity)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	decodeTokens(t, w.Body.Bytes())
+
+	user, err := h.Users.FindByEmail(context.Background(), "new@example.com")
+	require.NoError(t, err)
+	assert.Equal(t, "New User", user.Name)
+	assert.True(t, user.IsVerified)
+	assert.Equal(t, map[string]uint{"subject-1": user.ID}, federatedUserIDs(t, h))
+
+	// Authorization responses are single use
+	u, _ := url.Parse(callback)
+	w = oidcCallback(r, callback, u.Query().Get("state"))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// The next login finds the linked account
+	w, _ = oidcLogin(t, r, provider, identity)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var users int64
+	require.NoError(t, h.db.Model(&models.User{}).Count(&users).Error)
+	assert.Equal(t, int64(1), users)
+}
+
+func TestOIDCCallbackLongName(t *testing.T) {
+	h, _ := setupDBTestHandler(t)
+	r, provider := setupFederationRouter(t, h)
+	identity := federation.Identity{Subject: "subject-1", Email: "new@example.com", EmailVerified: true, Name: strings.Repeat("é", 60)}
+
+	w, _ := oidcLogin(t, r, provider, identity)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	// The name is cut to 50 characters, not 50 bytes
+	user, err := h.Users.FindByEmail(context.Background(), "new@example.com")
+	require.NoError(t, err)
+	assert.Equal(t, strings.Repeat("é", 50), user.Name)
+}
+
+func TestOIDCCallbackLinksVerifiedEmail(t *testing.T) {
+	h, _ := setupDBTestHandler(t)
+	r, provider := setupFederationRouter(t, h)
+	user := createTestUser(t, h, "local@example.com", models.RoleUser)
+	user.IsVerified = true
+	require.NoError(t, h.Users.Save(context.Background(), &user))
+
+	w, _ := oidcLogin(t, r, provider, federation.Identity{Subject: "subject-1", Email: "LOCAL@example.com", EmailVerified: true})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	decodeTokens(t, w.Body.Bytes())
+	assert.Equal(t, map[string]uint{"subject-1": user.ID}, federatedUserIDs(t, h))
+}
+
+func TestOIDCCallbackConflict(t *testing.T) {
+	h, _ := setupDBTestHandler(t)
+	r, provider := setupFederationRouter(t, h)
+	createTestUser(t, h, "unverified@example.com", models.RoleUser)
+	verified := createTestUser(t, h, "verified@example.com", models.RoleUser)
+	verified.IsVerified = true
+	require.NoError(t, h.Users.Save(context.Background(), &verified))
+
+	tests := []struct {
+		name     string
+		identity federation.Identity
+	}{
+		{
+			name:     "Local email not verified",
+			identity: federation.Identity{Subject: "subject-1", Email: "unverified@example.com", EmailVerified: true},
+		},
+		{
+			name:     "Provider email not verified",
+			identity: federation.Identity{Subject: "subject-2", Email: "verified@example.com", EmailVerified: false},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w, _ := oidcLogin(t, r, provider, tt.identity)
+			assert.Equal(t, http.StatusConflict, w.Code)
+			assert.Contains(t, w.Body.String(), "log in with your password to link it")
+		})
+	}
+	assert.Empty(t, federatedUserIDs(t, h))
+}
+
+func TestOIDCCallbackVerificationPolicy(t *testing.T) {
+	t.Setenv("EMAIL_VERIFICATION_POLICY", config.VerificationLogin)
+	h, _ := setupDBTestHandler(t)
+	r, provider := setupFederationRouter(t, h)
+
+	// The account is created with the unverified email, but cannot log in yet
+	w, _ := oidcLogin(t, r, provider, federation.Identity{Subject: "subject-1", Email: "new@example.com", EmailVerified: false})
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Contains(t, w.Body.String(), "Email address not verified")
+
+	w, _ = oidcLogin(t, r, provider, federation.Identity{Subject: "subject-2", Email: "other@example.com", EmailVerified: true})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	decodeTokens(t, w.Body.Bytes())
+}
@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+	"crud-example/config"
+	"crud-example/middleware"
+	"crud-example/repository"
+	"crud-example/utils"
+)
+
+// stateCacheTTL bounds how long an instance trusts its cached view of token revocations and
+// active sessions before reading them again, so changes made by other instances propagate
+const stateCacheTTL = 30 * time.Second
+
+// Handler serves the API endpoints. Every table is reached through a repository so the
+// handlers can be tested without a database; the revocation store, the session tracker, the
+// audit log and the settings cache the repositories they are built on.
+type Handler struct {
+	Replicas       *config.Replicas
+	Users          repository.UserRepository
+	Sessions       repository.SessionRepository
+	LoginFailures  repository.LoginFailureRepository
+	Verifications  repository.VerificationTokenRepository
+	PasswordResets repository.PasswordResetTokenRepository
+	MagicLinks     repository.MagicLinkRepository
+	APIKeys        repository.APIKeyRepository
+	MFA            repository.MFARepository
+	Passkeys       repository.PasskeyRepository
+	OAuthClients   repository.OAuthClientRepository
+	OAuthCodes     repository.OAuthCodeRepository
+	Federation     repository.FederationRepository
+
+	Revocations    *utils.RevocationStore
+	SessionTracker *utils.SessionTracker
+	Audit          *utils.AuditLog
+	Settings       *utils.Settings
+
+	// db is the primary database, only used to report the health of its connection pool
+	db *gorm.DB
+
+	// background tracks the work started by inBackground
+	background sync.WaitGroup
+}
+
+// New returns a Handler backed by db, reading users through replicas unless it is nil
+func New(db *gorm.DB, replicas *config.Replicas) *Handler {
+	var reads repository.ReadRouter
+	if replicas != nil {
+		reads = replicas
+	}
+	sessions := repository.NewSessionRepository(db)
+	return &Handler{
+		Replicas:       replicas,
+		Users:          repository.NewUserRepository(db, reads),
+		Sessions:       sessions,
+		LoginFailures:  repository.NewLoginFailureRepository(db),
+		Verifications:  repository.NewVerificationTokenRepository(db),
+		PasswordResets: repository.NewPasswordResetTokenRepository(db),
+		MagicLinks:     repository.NewMagicLinkRepository(db),
+		APIKeys:        repository.NewAPIKeyRepository(db),
+		MFA:            repository.NewMFARepository(db),
+		Passkeys:       repository.NewPasskeyRepository(db),
+		OAuthClients:   repository.NewOAuthClientRepository(db),
+		OAuthCodes:     repository.NewOAuthCodeRepository(db),
+		Federation:     repository.NewFederationRepository(db),
+		Revocations:    utils.NewRevocationStore(repository.NewRevocationRepository(db), stateCacheTTL),
+		SessionTracker: utils.NewSessionTracker(sessions, stateCacheTTL),
+		Audit:          utils.NewAuditLog(repository.NewAuditRepository(db)),
+		Settings:       utils.NewSettings(repository.NewSettingRepository(db)),
+		db:             db,
+	}
+}
+
+// Authentication returns the stores AuthMiddleware checks credentials against
+func (h *Handler) Authentication() middleware.Authentication {
+	return middleware.Authentication{
+		Users:       h.Users,
+		APIKeys:     h.APIKeys,
+		Revocations: h.Revocations,
+		Sessions:    h.SessionTracker,
+		Audit:       h.Audit,
+	}
+}
+
+// inBackground runs fn after the handler returns, so that the response time does not depend
+// on its work; endpoints that must not reveal whether an email is registered send through it.
+// fn keeps the values of ctx but not its cancellation.
+func (h *Handler) inBackground(ctx context.Context, fn func(ctx context.Context)) {
+	ctx = context.WithoutCancel(ctx)
+	h.background.Add(1)
+	go func() {
+		defer h.background.Done()
+		fn(ctx)
+	}()
+}
@@ -0,0 +1,129 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+	"crud-example/dbtest"
+	"crud-example/mailer"
+	"crud-example/models"
+	"crud-example/repository"
+	"crud-example/utils"
+)
+
+// testStores gives tests access to the in-memory stores behind a test Handler
+type testStores struct {
+	users         *repository.MemoryUserRepository
+	sessions      *repository.MemorySessionRepository
+	verifications *repository.MemoryVerificationTokenRepository
+	revocations   *repository.MemoryRevocationRepository
+	audit         *repository.MemoryAuditRepository
+	mail          *mailer.MemoryMailer
+}
+
+// auditEvents returns the recorded audit events with the message, oldest first
+func (s *testStores) auditEvents(message string) []models.SystemLog {
+	var events []models.SystemLog
+	for _, entry := range s.audit.All() {
+		if entry.Message == message {
+			events = append(events, entry)
+		}
+	}
+	return events
+}
+
+// setupTestHandler returns a Handler backed by in-memory repositories
+func setupTestHandler() (*Handler, *testStores) {
+	gin.SetMode(gin.TestMode)
+
+	users := repository.NewMemoryUserRepository()
+	stores := &testStores{
+		users:         users,
+		sessions:      repository.NewMemorySessionRepository(),
+		verifications: repository.NewMemoryVerificationTokenRepository(),
+		revocations:   repository.NewMemoryRevocationRepository(),
+		audit:         repository.NewMemoryAuditRepository(),
+		mail:          &mailer.MemoryMailer{},
+	}
+	mailer.SetMailer(stores.mail)
+
+	h := &Handler{
+		Users:          users,
+		Sessions:       stores.sessions,
+		LoginFailures:  repository.NewMemoryLoginFailureRepository(),
+		Verifications:  stores.verifications,
+		PasswordResets: repository.NewMemoryPasswordResetTokenRepository(),
+		MagicLinks:     repository.NewMemoryMagicLinkRepository(),
+		APIKeys:        repository.NewMemoryAPIKeyRepository(),
+		MFA:            repository.NewMemoryMFARepository(users),
+		Passkeys:       repository.NewMemoryPasskeyRepository(),
+		OAuthClients:   repository.NewMemoryOAuthClientRepository(),
+		OAuthCodes:     repository.NewMemoryOAuthCodeRepository(),
+		Federation:     repository.NewMemoryFederationRepository(users),
+		Revocations:    utils.NewRevocationStore(stores.revocations, stateCacheTTL),
+		SessionTracker: utils.NewSessionTracker(stores.sessions, stateCacheTTL),
+		Audit:          utils.NewAuditLog(stores.audit),
+		Settings:       utils.NewSettings(repository.NewMemorySettingRepository()),
+	}
+	return h, stores
+}
+
+// setupDBTestHandler returns a Handler backed by an in-memory SQLite database, so the
+// handlers run against the database repositories
+func setupDBTestHandler(t *testing.T) (*Handler, *mailer.MemoryMailer) {
+	gin.SetMode(gin.TestMode)
+
+	mail := &mailer.MemoryMailer{}
+	mailer.SetMailer(mail)
+
+	return New(dbtest.Open(t), nil), mail
+}
+
+// performRequest sends payload, if any, as JSON to the router and records the response
+func performRequest(r http.Handler, method, path string, payload interface{}) *httptest.ResponseRecorder {
+	var body bytes.Buffer
+	if payload != nil {
+		json.NewEncoder(&body).Encode(payload)
+	}
+
+	req, _ := http.NewRequest(method, path, &body)
+	req.Header.Set("Content-Type", "application/json")
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+// performAuthorizedRequest is performRequest with a bearer token
+func performAuthorizedRequest(r http.Handler, method, path, token string, payload interface{}) *httptest.ResponseRecorder {
+	var body bytes.Buffer
+	if payload != nil {
+		json.NewEncoder(&body).Encode(payload)
+	}
+
+	req, _ := http.NewRequest(method, path, &body)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+var linkPattern = regexp.MustCompile(`https?://\S+`)
+
+// mailedLink returns the link in the last email sent to the address
+func mailedLink(t *testing.T, mail *mailer.MemoryMailer, to string) *url.URL {
+	msg, ok := mail.Last(to)
+	require.True(t, ok, "no email sent to %s", to)
+	link, err := url.Parse(linkPattern.FindString(msg.Body))
+	require.NoError(t, err)
+	return link
+}
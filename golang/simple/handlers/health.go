@@ -0,0 +1,56 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// DatabaseHealth pings the database and reports the statistics of its connection pool, so
+// that monitoring can alert on saturation (in_use close to max_open, a growing wait_count).
+// Read replicas are listed with the result of their last health check; an unhealthy replica
+// does not make the service unavailable since its reads go to the primary.
+func (h *Handler) DatabaseHealth(c *gin.Context) {
+	sqlDB, err := h.db.DB()
+	if err != nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"status": "unavailable", "error": "Failed to get database connection"})
+		return
+	}
+
+	status, code := "OK", http.StatusOK
+	if err := sqlDB.PingContext(c.Request.Context()); err != nil {
+		status, code = "unavailable", http.StatusServiceUnavailable
+	}
+
+	response := gin.H{
+		"status": status,
+		"pool":   poolStats(sqlDB.Stats()),
+	}
+	if h.Replicas != nil {
+		replicas := []gin.H{}
+		for _, replica := range h.Replicas.Status() {
+			replicas = append(replicas, gin.H{
+				"name":    replica.Name,
+				"healthy": replica.Healthy,
+				"pool":    poolStats(replica.Stats),
+			})
+		}
+		response["replicas"] = replicas
+	}
+	c.JSON(code, response)
+}
+
+func poolStats(stats sql.DBStats) gin.H {
+	return gin.H{
+		"max_open":             stats.MaxOpenConnections,
+		"open":                 stats.OpenConnections,
+		"in_use":               stats.InUse,
+		"idle":                 stats.Idle,
+		"wait_count":           stats.WaitCount,
+		"wait_duration_ms":     stats.WaitDuration.Milliseconds(),
+		"max_idle_closed":      stats.MaxIdleClosed,
+		"max_idle_time_closed": stats.MaxIdleTimeClosed,
+		"max_lifetime_closed":  stats.MaxLifetimeClosed,
+	}
+}
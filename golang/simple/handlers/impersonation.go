@@ -0,0 +1,107 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"crud-example/middleware"
+	"crud-example/models"
+	"crud-example/utils"
+)
+
+// StartImpersonation issues a short-lived token to act as another user. The token carries
+// the administrator in its act claim and cannot be refreshed. Administrators cannot be impersonated.
+func (h *Handler) StartImpersonation(c *gin.Context) {
+	admin := middleware.CurrentUser(c)
+	claims := c.MustGet("claims").(*utils.Claims)
+
+	// Get user ID from URL parameter
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	var request models.ImpersonationRequest
+
+	// Bind JSON to struct
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data", "details": err.Error()})
+		return
+	}
+
+	if claims.Impersonated() {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Already impersonating a user"})
+		return
+	}
+	if uint(id) == admin.ID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Cannot impersonate yourself"})
+		return
+	}
+
+	user, err := h.Users.FindActiveByID(c.Request.Context(), uint(id))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	if user.Role == models.RoleAdmin {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Administrators cannot be impersonated"})
+		return
+	}
+
+	token, err := utils.GenerateImpersonationToken(user.ID, user.Email, user.Role, utils.Actor{UserID: admin.ID, Email: admin.Email})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		return
+	}
+	expiresAt := time.Now().Add(utils.ImpersonationTTL())
+
+	h.Audit.Record(c.Request.Context(), utils.AuditEvent{
+		Level:     utils.AuditWarning,
+		Message:   "Impersonation started",
+		UserID:    &user.ID,
+		IPAddress: c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+		Context: map[string]interface{}{
+			"admin_id":   admin.ID,
+			"reason":     request.Reason,
+			"expires_at": expiresAt,
+		},
+	})
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":    "Impersonation started",
+		"token":      token,
+		"token_type": "Bearer",
+		"expires_in": int(utils.ImpersonationTTL().Seconds()),
+		"user":       user.ToResponse(),
+	})
+}
+
+// StopImpersonation revokes the impersonation token used for the request
+func (h *Handler) StopImpersonation(c *gin.Context) {
+	claims := c.MustGet("claims").(*utils.Claims)
+
+	if !claims.Impersonated() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Not an impersonation token"})
+		return
+	}
+
+	if err := h.Revocations.RevokeToken(c.Request.Context(), claims); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke token"})
+		return
+	}
+
+	h.Audit.Record(c.Request.Context(), utils.AuditEvent{
+		Level:     utils.AuditInfo,
+		Message:   "Impersonation stopped",
+		UserID:    &claims.UserID,
+		IPAddress: c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+		Context:   map[string]interface{}{"admin_id": claims.Actor.UserID},
+	})
+
+	c.JSON(http.StatusOK, gin.H{"message": "Impersonation stopped"})
+}
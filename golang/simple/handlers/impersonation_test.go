@@ -0,0 +1,131 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"crud-example/middleware"
+	"crud-example/models"
+	"crud-example/utils"
+)
+
+// setupImpersonationRouter adds the impersonation routes, behind AuthMiddleware as in main,
+// to the token routes
+func setupImpersonationRouter(h *Handler) *gin.Engine {
+	r := setupTokensRouter(h)
+	authenticate := middleware.AuthMiddleware(h.Authentication())
+	r.POST("/api/admin/users/:id/impersonate", authenticate, middleware.RequireRole(models.RoleAdmin), middleware.RequireTokenAuth(), h.StartImpersonation)
+	r.POST("/api/auth/impersonation/stop", authenticate, h.StopImpersonation)
+	return r
+}
+
+// impersonate starts impersonating the user with the administrator's access token
+func impersonate(r http.Handler, adminToken string, id uint, reason string) *httptest.ResponseRecorder {
+	return performAuthorizedRequest(r, "POST", fmt.Sprintf("/api/admin/users/%d/impersonate", id), adminToken, map[string]interface{}{"reason": reason})
+}
+
+func TestStartImpersonation(t *testing.T) {
+	t.Setenv("IMPERSONATION_TTL", "10m")
+	h, stores := setupTestHandler()
+	r := setupImpersonationRouter(h)
+	admin := createTestUser(t, h, "admin@example.com", models.RoleAdmin)
+	otherAdmin := createTestUser(t, h, "other-admin@example.com", models.RoleAdmin)
+	user := createTestUser(t, h, "test@example.com", models.RoleUser)
+	adminToken, _ := loginTestUser(t, r, "admin@example.com")
+	userToken, _ := loginTestUser(t, r, "test@example.com")
+
+	tests := []struct {
+		name       string
+		token      string
+		id         uint
+		reason     string
+		wantStatus int
+	}{
+		{name: "Not an administrator", token: userToken, id: admin.ID, reason: "Support ticket 42", wantStatus: http.StatusForbidden},
+		{name: "Without a reason", token: adminToken, id: user.ID, wantStatus: http.StatusBadRequest},
+		{name: "Yourself", token: adminToken, id: admin.ID, reason: "Support ticket 42", wantStatus: http.StatusBadRequest},
+		{name: "Another administrator", token: adminToken, id: otherAdmin.ID, reason: "Support ticket 42", wantStatus: http.StatusForbidden},
+		{name: "Unknown user", token: adminToken, id: 999, reason: "Support ticket 42", wantStatus: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := impersonate(r, tt.token, tt.id, tt.reason)
+			assert.Equal(t, tt.wantStatus, w.Code, w.Body.String())
+		})
+	}
+	assert.Empty(t, stores.auditEvents("Impersonation started"))
+
+	w := impersonate(r, adminToken, user.ID, "Support ticket 42")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var response struct {
+		Token     string `json:"token"`
+		ExpiresIn int    `json:"expires_in"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, 600, response.ExpiresIn)
+
+	// The token acts as the user on behalf of the administrator, for IMPERSONATION_TTL
+	claims, err := utils.ValidateToken(response.Token)
+	require.NoError(t, err)
+	assert.Equal(t, user.ID, claims.UserID)
+	assert.Equal(t, models.RoleUser, claims.Role)
+	assert.Equal(t, &utils.Actor{UserID: admin.ID, Email: admin.Email}, claims.Actor)
+	assert.Equal(t, 10*time.Minute, claims.ExpiresAt.Sub(claims.IssuedAt.Time))
+	assert.Empty(t, claims.SessionID, "impersonation tokens cannot be refreshed")
+
+	started := stores.auditEvents("Impersonation started")
+	require.Len(t, started, 1)
+	assert.Equal(t, &user.ID, started[0].UserID)
+	var context map[string]interface{}
+	require.NoError(t, json.Unmarshal([]byte(started[0].Context), &context))
+	assert.EqualValues(t, admin.ID, context["admin_id"])
+	assert.Equal(t, "Support ticket 42", context["reason"])
+
+	// Requests made with the token are audited
+	w = performAuthorizedRequest(r, "GET", "/api/users/me", response.Token, nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "test@example.com")
+	requests := stores.auditEvents("Impersonated request")
+	require.Len(t, requests, 1)
+	assert.Equal(t, &user.ID, requests[0].UserID)
+	assert.Contains(t, requests[0].Context, `"path":"/api/users/me"`)
+}
+
+func TestStopImpersonation(t *testing.T) {
+	h, stores := setupTestHandler()
+	r := setupImpersonationRouter(h)
+	admin := createTestUser(t, h, "admin@example.com", models.RoleAdmin)
+	user := createTestUser(t, h, "test@example.com", models.RoleUser)
+	adminToken, _ := loginTestUser(t, r, "admin@example.com")
+
+	w := impersonate(r, adminToken, user.ID, "Support ticket 42")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var response struct {
+		Token string `json:"token"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+
+	// Only impersonation tokens can be stopped
+	w = performAuthorizedRequest(r, "POST", "/api/auth/impersonation/stop", adminToken, nil)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = performAuthorizedRequest(r, "POST", "/api/auth/impersonation/stop", response.Token, nil)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	// The token is revoked, the administrator's own token is not
+	assert.Equal(t, http.StatusUnauthorized, performAuthorizedRequest(r, "GET", "/api/users/me", response.Token, nil).Code)
+	assert.Equal(t, http.StatusUnauthorized, performAuthorizedRequest(r, "POST", "/api/auth/impersonation/stop", response.Token, nil).Code)
+	assert.Equal(t, http.StatusOK, performAuthorizedRequest(r, "GET", "/api/users/me", adminToken, nil).Code)
+
+	stopped := stores.auditEvents("Impersonation stopped")
+	require.Len(t, stopped, 1)
+	assert.Equal(t, &user.ID, stopped[0].UserID)
+	assert.JSONEq(t, fmt.Sprintf(`{"admin_id": %d}`, admin.ID), stopped[0].Context)
+}
@@ -0,0 +1,200 @@
+package handlers
+
+import (
+	"context"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"crud-example/config"
+	"crud-example/middleware"
+	"crud-example/models"
+	"crud-example/utils"
+)
+
+// lockoutPolicy holds the brute-force protection thresholds of a login failure scope
+type lockoutPolicy struct {
+	maxAttempts int
+	lockout     time.Duration
+	window      time.Duration
+}
+
+// loginPolicy returns the thresholds for a scope, configurable through
+// LOGIN_MAX_ATTEMPTS, LOGIN_MAX_ATTEMPTS_PER_IP, LOGIN_LOCKOUT_DURATION and LOGIN_ATTEMPT_WINDOW
+func loginPolicy(scope string) lockoutPolicy {
+	cfg := config.Current().Lockout
+	policy := lockoutPolicy{
+		maxAttempts: cfg.MaxAttempts,
+		lockout:     cfg.Duration,
+		window:      cfg.Window,
+	}
+	if scope == models.LoginScopeIP {
+		policy.maxAttempts = cfg.MaxAttemptsPerIP
+	}
+	return policy
+}
+
+// progressiveDelay is the wait imposed on an account before the next attempt after the
+// given number of consecutive failures: none for the first two, then doubling up to 30s.
+// IP addresses, shared by many users and allowed more failures, are only locked out.
+func progressiveDelay(failures int) time.Duration {
+	if failures < 3 {
+		return 0
+	}
+	delay := time.Duration(math.Pow(2, float64(failures-3))) * time.Second
+	if delay > 30*time.Second {
+		delay = 30 * time.Second
+	}
+	return delay
+}
+
+// loginIdentifiers returns the failure tracking identifiers of a login attempt
+func loginIdentifiers(c *gin.Context, email string) map[string]string {
+	return map[string]string{
+		models.LoginScopeAccount: strings.ToLower(strings.TrimSpace(email)),
+		models.LoginScopeIP:      c.ClientIP(),
+	}
+}
+
+// loginRetryAfter returns how long the client has to wait before another attempt is allowed,
+// and whether the wait is a lockout rather than a progressive delay
+func (h *Handler) loginRetryAfter(ctx context.Context, identifiers map[string]string) (time.Duration, bool, error) {
+	failures, err := h.LoginFailures.Find(ctx, identifiers)
+	if err != nil {
+		return 0, false, err
+	}
+
+	now := time.Now()
+	var wait time.Duration
+	var locked bool
+	for _, failure := range failures {
+		if d := failure.NextAttemptAt.Sub(now); d > wait {
+			wait = d
+		}
+		if failure.LockedUntil != nil && failure.LockedUntil.After(now) {
+			locked = true
+			if d := failure.LockedUntil.Sub(now); d > wait {
+				wait = d
+			}
+		}
+	}
+	return wait, locked, nil
+}
+
+// loginRefusal returns the status and message refusing an attempt while the account or the
+// client IP is locked out (423) or has to wait after its last failure (429), setting
+// Retry-After; the status is 0 when the attempt may proceed
+func (h *Handler) loginRefusal(c *gin.Context, identifiers map[string]string) (int, string) {
+	retryAfter, locked, err := h.loginRetryAfter(c.Request.Context(), identifiers)
+	if err != nil {
+		return http.StatusInternalServerError, "Failed to check login attempts"
+	}
+	if retryAfter <= 0 {
+		return 0, ""
+	}
+
+	c.Header("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+	if locked {
+		return http.StatusLocked, "Too many failed login attempts, login is locked for a while"
+	}
+	return http.StatusTooManyRequests, "Too many failed login attempts, please try again later"
+}
+
+// recordLoginFailure counts a failed attempt in every scope and locks the scopes that
+// reached their threshold. Lockouts are written to the audit log.
+func (h *Handler) recordLoginFailure(c *gin.Context, identifiers map[string]string, userID *uint) {
+	for scope, identifier := range identifiers {
+		policy := loginPolicy(scope)
+		var locked *models.LoginFailure
+
+		err := h.LoginFailures.Record(c.Request.Context(), scope, identifier, func(failure *models.LoginFailure) {
+			now := time.Now()
+			currentlyLocked := failure.LockedUntil != nil && now.Before(*failure.LockedUntil)
+			// Old failures are forgotten once the window passed and no lockout is running
+			if !currentlyLocked && now.Sub(failure.LastFailureAt) > policy.window {
+				failure.Failures = 0
+				failure.LockedUntil = nil
+			}
+
+			failure.Failures++
+			failure.LastFailureAt = now
+			failure.NextAttemptAt = now
+			if scope == models.LoginScopeAccount {
+				failure.NextAttemptAt = now.Add(progressiveDelay(failure.Failures))
+			}
+			if !currentlyLocked && failure.Failures >= policy.maxAttempts {
+				lockedUntil := now.Add(policy.lockout)
+				failure.LockedUntil = &lockedUntil
+				locked = failure
+			}
+		})
+		if err != nil {
+			log.Printf("Failed to record login failure for %s %s: %v", scope, identifier, err)
+			continue
+		}
+
+		if locked != nil {
+			event := utils.AuditEvent{
+				Level:     utils.AuditWarning,
+				Message:   "Login lockout",
+				IPAddress: c.ClientIP(),
+				UserAgent: c.Request.UserAgent(),
+				Context: map[string]interface{}{
+					"scope":        scope,
+					"identifier":   identifier,
+					"failures":     locked.Failures,
+					"locked_until": locked.LockedUntil,
+				},
+			}
+			if scope == models.LoginScopeAccount {
+				event.UserID = userID
+			}
+			h.Audit.Record(c.Request.Context(), event)
+		}
+	}
+}
+
+// resetLoginFailures clears the failures of an account after a successful login.
+// The IP scope is left alone so an attacker cannot reset it with their own account.
+func (h *Handler) resetLoginFailures(ctx context.Context, identifiers map[string]string) {
+	if err := h.LoginFailures.Delete(ctx, models.LoginScopeAccount, identifiers[models.LoginScopeAccount]); err != nil {
+		log.Printf("Failed to reset login failures: %v", err)
+	}
+}
+
+// UnlockUser lifts the login lockout of a user's account
+func (h *Handler) UnlockUser(c *gin.Context) {
+	// Get user ID from URL parameter
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	user, err := h.Users.FindByID(c.Request.Context(), uint(id))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	if err := h.LoginFailures.Delete(c.Request.Context(), models.LoginScopeAccount, strings.ToLower(user.Email)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to unlock user"})
+		return
+	}
+
+	admin := middleware.CurrentUser(c)
+	h.Audit.Record(c.Request.Context(), utils.AuditEvent{
+		Level:     utils.AuditInfo,
+		Message:   "Login lockout lifted",
+		UserID:    &user.ID,
+		IPAddress: c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+		Context:   map[string]interface{}{"admin_id": admin.ID},
+	})
+
+	c.JSON(http.StatusOK, gin.H{"message": "User unlocked successfully"})
+}
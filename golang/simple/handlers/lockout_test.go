@@ -0,0 +1,136 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"crud-example/models"
+	"crud-example/utils"
+)
+
+// setupLockoutRouter registers the login route and the unlock endpoint, the latter behind a
+// stand-in for AuthMiddleware that authenticates every request as admin
+func setupLockoutRouter(h *Handler, admin models.User) *gin.Engine {
+	r := gin.New()
+	r.POST("/api/auth/login", h.Login)
+	adminRoutes := r.Group("/api/admin")
+	adminRoutes.Use(func(c *gin.Context) {
+		c.Set("user", admin)
+		c.Next()
+	})
+	adminRoutes.POST("/users/:id/unlock", h.UnlockUser)
+	return r
+}
+
+// loginFrom attempts a login from the client IP address ip
+func loginFrom(r http.Handler, ip, email, password string) *httptest.ResponseRecorder {
+	body, _ := json.Marshal(map[string]string{"email": email, "password": password})
+	req := httptest.NewRequest("POST", "/api/auth/login", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.RemoteAddr = ip + ":1234"
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+// assertLocked checks that w refuses the login with 423 until the lockout ends
+func assertLocked(t *testing.T, w *httptest.ResponseRecorder) {
+	t.Helper()
+	assert.Equal(t, http.StatusLocked, w.Code, w.Body.String())
+	retryAfter, err := strconv.Atoi(w.Header().Get("Retry-After"))
+	require.NoError(t, err)
+	assert.InDelta(t, 15*60, retryAfter, 1)
+}
+
+func TestLoginAccountLockout(t *testing.T) {
+	t.Setenv("LOGIN_MAX_ATTEMPTS", "3")
+	h, stores := setupTestHandler()
+	user := createTestUser(t, h, "test@example.com", models.RoleUser)
+	r := setupLockoutRouter(h, user)
+
+	// The failures are counted whatever the client IP and the case of the email
+	for i, email := range []string{"TEST@example.com", "Test@Example.com", "test@example.com"} {
+		w := loginFrom(r, fmt.Sprintf("192.0.2.%d", i+1), email, "wrong-password")
+		require.Equal(t, http.StatusUnauthorized, w.Code, "attempt %d", i+1)
+	}
+
+	// The account is locked out, even with the right password and from another IP
+	assertLocked(t, loginFrom(r, "192.0.2.4", "test@example.com", "Tr0ub4dor&3x"))
+
+	events := stores.auditEvents("Login lockout")
+	require.Len(t, events, 1)
+	assert.Equal(t, utils.AuditWarning, events[0].Level)
+	assert.Equal(t, &user.ID, events[0].UserID)
+	var context map[string]interface{}
+	require.NoError(t, json.Unmarshal([]byte(events[0].Context), &context))
+	assert.Equal(t, models.LoginScopeAccount, context["scope"])
+	assert.Equal(t, "test@example.com", context["identifier"])
+	assert.EqualValues(t, 3, context["failures"])
+}
+
+func TestLoginIPLockout(t *testing.T) {
+	t.Setenv("LOGIN_MAX_ATTEMPTS_PER_IP", "4")
+	h, stores := setupTestHandler()
+	user := createTestUser(t, h, "test@example.com", models.RoleUser)
+	r := setupLockoutRouter(h, user)
+
+	// Failures on other accounts, registered or not, add up on the client IP
+	for _, email := range []string{"a@example.com", "b@example.com", "c@example.com"} {
+		require.Equal(t, http.StatusUnauthorized, loginFrom(r, "198.51.100.7", email, "wrong-password").Code)
+	}
+
+	// The progressive delay only applies to accounts, so the IP is not throttled before its
+	// threshold
+	w := loginFrom(r, "198.51.100.7", "test@example.com", "Tr0ub4dor&3x")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	require.Equal(t, http.StatusUnauthorized, loginFrom(r, "198.51.100.7", "d@example.com", "wrong-password").Code)
+	assertLocked(t, loginFrom(r, "198.51.100.7", "test@example.com", "Tr0ub4dor&3x"))
+
+	// Other clients can still log in to the account
+	assert.Equal(t, http.StatusOK, loginFrom(r, "198.51.100.8", "test@example.com", "Tr0ub4dor&3x").Code)
+
+	events := stores.auditEvents("Login lockout")
+	require.Len(t, events, 1)
+	assert.Nil(t, events[0].UserID)
+	assert.Equal(t, "198.51.100.7", events[0].IPAddress)
+	var context map[string]interface{}
+	require.NoError(t, json.Unmarshal([]byte(events[0].Context), &context))
+	assert.Equal(t, models.LoginScopeIP, context["scope"])
+	assert.Equal(t, "198.51.100.7", context["identifier"])
+}
+
+func TestUnlockUser(t *testing.T) {
+	t.Setenv("LOGIN_MAX_ATTEMPTS", "3")
+	h, stores := setupTestHandler()
+	admin := createTestUser(t, h, "admin@example.com", models.RoleAdmin)
+	user := createTestUser(t, h, "test@example.com", models.RoleUser)
+	r := setupLockoutRouter(h, admin)
+
+	for i := 0; i < 3; i++ {
+		require.Equal(t, http.StatusUnauthorized, loginFrom(r, "192.0.2.1", "test@example.com", "wrong-password").Code)
+	}
+	assertLocked(t, loginFrom(r, "192.0.2.1", "test@example.com", "Tr0ub4dor&3x"))
+
+	assert.Equal(t, http.StatusBadRequest, performRequest(r, "POST", "/api/admin/users/abc/unlock", nil).Code)
+	assert.Equal(t, http.StatusNotFound, performRequest(r, "POST", "/api/admin/users/999/unlock", nil).Code)
+
+	w := performRequest(r, "POST", fmt.Sprintf("/api/admin/users/%d/unlock", user.ID), nil)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, http.StatusOK, loginFrom(r, "192.0.2.1", "test@example.com", "Tr0ub4dor&3x").Code)
+
+	// The unlock is attributed to the administrator
+	lifted := stores.auditEvents("Login lockout lifted")
+	require.Len(t, lifted, 1)
+	assert.Equal(t, &user.ID, lifted[0].UserID)
+	assert.JSONEq(t, fmt.Sprintf(`{"admin_id": %d}`, admin.ID), lifted[0].Context)
+}
@@ -0,0 +1,167 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"crud-example/config"
+	"crud-example/mailer"
+	"crud-example/models"
+	"crud-example/utils"
+)
+
+// magicLinkMessage is returned whether or not a link was actually sent
+const magicLinkMessage = "If the email is registered, a sign-in link has been sent"
+
+// magicLinkCookie holds the nonce binding a sign-in link to the browser that requested it
+const magicLinkCookie = "magic_link_nonce"
+
+// magicLinkTTL returns how long sign-in links stay valid (MAGIC_LINK_EXPIRATION, default 15m)
+func magicLinkTTL() time.Duration {
+	return config.Current().Tokens.MagicLinkExpiration
+}
+
+// RequestMagicLink emails a single-use sign-in link. The link only works in the browser
+// that requested it, and only the latest link requested from a browser is accepted there.
+// The response never reveals whether the email is registered or was throttled.
+func (h *Handler) RequestMagicLink(c *gin.Context) {
+	var request models.MagicLinkRequest
+
+	// Bind JSON to struct
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data", "details": err.Error()})
+		return
+	}
+
+	nonce, err := utils.GenerateRandomToken(32)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate sign-in link"})
+		return
+	}
+	ttl := magicLinkTTL()
+	c.SetCookie(magicLinkCookie, nonce, int(ttl.Seconds()), "/api/auth/magic-link", "", c.Request.TLS != nil, true)
+
+	// The lookup and the email happen after responding, so the response time is the same
+	// whether or not the email is registered
+	email := strings.ToLower(strings.TrimSpace(request.Email))
+	h.inBackground(c.Request.Context(), func(ctx context.Context) {
+		user, err := h.Users.FindByEmailFold(ctx, email)
+		if err != nil || !user.IsActive {
+			return
+		}
+
+		throttled, err := h.magicLinkThrottled(ctx, email)
+		if err != nil {
+			log.Printf("Failed to check magic link throttle for user %d: %v", user.ID, err)
+			return
+		}
+		if throttled {
+			return
+		}
+
+		if err := h.sendMagicLink(ctx, user, email, nonce, ttl); err != nil {
+			log.Printf("Failed to send magic link to user %d: %v", user.ID, err)
+		}
+	})
+
+	c.JSON(http.StatusAccepted, gin.H{"message": magicLinkMessage})
+}
+
+// sendMagicLink stores a new sign-in link bound to nonce and emails it to the user
+func (h *Handler) sendMagicLink(ctx context.Context, user *models.User, email, nonce string, ttl time.Duration) error {
+	token, err := utils.GenerateRandomToken(32)
+	if err != nil {
+		return err
+	}
+
+	link := models.MagicLinkToken{
+		UserID:    user.ID,
+		Email:     email,
+		TokenHash: utils.HashToken(token),
+		NonceHash: utils.HashToken(nonce),
+		ExpiresAt: time.Now().Add(ttl),
+	}
+	if err := h.MagicLinks.Create(ctx, &link); err != nil {
+		return err
+	}
+
+	callback := appURL("/api/auth/magic-link/callback", url.Values{"token": {token}})
+	return mailer.Send(mailer.Message{
+		To:      user.Email,
+		Subject: "Your sign-in link",
+		Body: fmt.Sprintf("Hi %s,\n\nOpen the following link in the same browser to sign in. It expires in %s and can only be used once.\n\n%s\n\nIf you did not request it you can ignore this email.\n",
+			user.Name, ttl, callback),
+	})
+}
+
+// magicLinkThrottled reports whether too many sign-in links were sent to the email in the
+// last hour (MAGIC_LINK_MAX_PER_HOUR, default 5)
+func (h *Handler) magicLinkThrottled(ctx context.Context, email string) (bool, error) {
+	lastHour, err := h.MagicLinks.CountSince(ctx, email, time.Now().Add(-time.Hour))
+	if err != nil {
+		return false, err
+	}
+	return lastHour >= int64(config.Current().Tokens.MagicLinkMaxPerHour), nil
+}
+
+// MagicLinkCallback exchanges a sign-in link for tokens. Opening the link proves
+// ownership of the email address, so it also verifies it.
+func (h *Handler) MagicLinkCallback(c *gin.Context) {
+	token := c.Query("token")
+	nonce, _ := c.Cookie(magicLinkCookie)
+	if token == "" || nonce == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired sign-in link"})
+		return
+	}
+
+	link, err := h.MagicLinks.FindUnused(c.Request.Context(), utils.HashToken(token))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired sign-in link"})
+		return
+	}
+
+	// Links opened in another browser than the one that requested them are refused
+	if !utils.CompareTokenHash(nonce, link.NonceHash) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Sign-in link must be opened in the browser that requested it"})
+		return
+	}
+
+	used, err := h.MagicLinks.MarkUsed(c.Request.Context(), link.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to sign in"})
+		return
+	}
+	if !used {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired sign-in link"})
+		return
+	}
+	c.SetCookie(magicLinkCookie, "", -1, "/api/auth/magic-link", "", c.Request.TLS != nil, true)
+
+	// The link only proves ownership of the address it was sent to
+	user, err := h.Users.FindByID(c.Request.Context(), link.UserID)
+	if err != nil || strings.ToLower(user.Email) != link.Email {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired sign-in link"})
+		return
+	}
+
+	if !user.IsActive {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User account is inactive"})
+		return
+	}
+
+	if !user.IsVerified {
+		user.IsVerified = true
+		if err := h.Users.Save(c.Request.Context(), user); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to sign in"})
+			return
+		}
+	}
+
+	h.completeLogin(c, user)
+}
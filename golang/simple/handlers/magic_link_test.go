@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"crud-example/models"
+)
+
+func setupMagicLinkRouter(h *Handler) *gin.Engine {
+	r := gin.New()
+
+	auth := r.Group("/api/auth")
+	{
+		auth.POST("/magic-link", h.RequestMagicLink)
+		auth.GET("/magic-link/callback", h.MagicLinkCallback)
+	}
+
+	return r
+}
+
+// requestMagicLink asks for a sign-in link and returns the nonce cookie set in the browser
+func requestMagicLink(t *testing.T, h *Handler, r http.Handler, email string) string {
+	w := performRequest(r, "POST", "/api/auth/magic-link", map[string]interface{}{"email": email})
+	require.Equal(t, http.StatusAccepted, w.Code, w.Body.String())
+	assert.Contains(t, w.Body.String(), magicLinkMessage)
+	h.background.Wait()
+
+	for _, cookie := range w.Result().Cookies() {
+		if cookie.Name == magicLinkCookie {
+			return cookie.Value
+		}
+	}
+	t.Fatal("no nonce cookie set")
+	return ""
+}
+
+// openMagicLink opens a sign-in link in a browser holding nonce
+func openMagicLink(r http.Handler, link, nonce string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest("GET", link, nil)
+	if nonce != "" {
+		req.AddCookie(&http.Cookie{Name: magicLinkCookie, Value: nonce})
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestMagicLink(t *testing.T) {
+	h, mail := setupDBTestHandler(t)
+	r := setupMagicLinkRouter(h)
+	user := createTestUser(t, h, "test@example.com", models.RoleUser)
+
+	nonce := requestMagicLink(t, h, r, "Test@Example.com")
+	link := mailedLink(t, mail, "test@example.com")
+	assert.Equal(t, "/api/auth/magic-link/callback", link.Path)
+
+	// The link only works in the browser that requested it
+	w := openMagicLink(r, link.RequestURI(), "")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = openMagicLink(r, link.RequestURI(), "another-browser")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "browser that requested it")
+
+	w = openMagicLink(r, link.RequestURI(), nonce)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	decodeTokens(t, w.Body.Bytes())
+
+	// Opening the link verified the email
+	verified, err := h.Users.FindByID(context.Background(), user.ID)
+	require.NoError(t, err)
+	assert.True(t, verified.IsVerified)
+
+	// Links are single use
+	w = openMagicLink(r, link.RequestURI(), nonce)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "Invalid or expired sign-in link")
+}
+
+func TestMagicLinkThrottle(t *testing.T) {
+	h, mail := setupDBTestHandler(t)
+	r := setupMagicLinkRouter(h)
+	createTestUser(t, h, "test@example.com", models.RoleUser)
+
+	// Unknown emails get the same answer and no email
+	requestMagicLink(t, h, r, "unknown@example.com")
+	assert.Empty(t, mail.Messages())
+
+	for i := 0; i < 5; i++ {
+		requestMagicLink(t, h, r, "test@example.com")
+	}
+	assert.Equal(t, 5, sentTo(mail, "test@example.com"))
+
+	// The sixth request in the hour is answered the same but sends nothing
+	nonce := requestMagicLink(t, h, r, "test@example.com")
+	assert.Equal(t, 5, sentTo(mail, "test@example.com"))
+
+	// ... so the last link sent does not work with the nonce of the throttled request
+	w := openMagicLink(r, mailedLink(t, mail, "test@example.com").RequestURI(), nonce)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
@@ -0,0 +1,16 @@
+package handlers
+
+import (
+	"net/url"
+
+	"crud-example/config"
+)
+
+// appURL builds an absolute link to the application (APP_URL) with the given query parameters
+func appURL(path string, query url.Values) string {
+	link := config.Current().Server.AppURL + path
+	if len(query) > 0 {
+		link += "?" + query.Encode()
+	}
+	return link
+}
@@ -0,0 +1,352 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"crud-example/config"
+	"crud-example/middleware"
+	"crud-example/models"
+	"crud-example/repository"
+	"crud-example/utils"
+)
+
+// recoveryCodeCount is the number of recovery codes generated on enrolment
+const recoveryCodeCount = 10
+
+// maxMFAAttempts is the number of wrong codes accepted per pending MFA token
+const maxMFAAttempts = 5
+
+// EnrollMFA starts TOTP enrolment and returns the secret and provisioning URI for the QR code
+func (h *Handler) EnrollMFA(c *gin.Context) {
+	user := middleware.CurrentUser(c)
+
+	if user.MFAEnabled {
+		c.JSON(http.StatusConflict, gin.H{"error": "MFA is already enabled"})
+		return
+	}
+
+	secret, err := utils.GenerateTOTPSecret()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate MFA secret"})
+		return
+	}
+
+	// Starting over replaces any unconfirmed secret
+	mfa := models.UserMFA{UserID: user.ID, Secret: secret}
+	if err := h.MFA.SaveSecret(c.Request.Context(), &mfa); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start MFA enrolment"})
+		return
+	}
+
+	issuer := config.Current().MFA.Issuer
+	c.JSON(http.StatusOK, gin.H{
+		"message":     "Scan the QR code with an authenticator app and confirm with a code",
+		"secret":      secret,
+		"otpauth_uri": utils.TOTPProvisioningURI(secret, issuer, user.Email),
+	})
+}
+
+// ConfirmMFA enables MFA after checking a first code and returns the recovery codes, shown only once
+func (h *Handler) ConfirmMFA(c *gin.Context) {
+	user := middleware.CurrentUser(c)
+	var request models.MFACodeRequest
+
+	// Bind JSON to struct
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data", "details": err.Error()})
+		return
+	}
+
+	mfa, err := h.MFA.FindPending(c.Request.Context(), user.ID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No pending MFA enrolment"})
+		return
+	}
+
+	step, ok := utils.ValidateTOTP(mfa.Secret, request.Code, time.Now(), mfa.LastUsedStep)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid MFA code"})
+		return
+	}
+
+	codes, err := utils.GenerateRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate recovery codes"})
+		return
+	}
+
+	hashes := make([]string, len(codes))
+	for i, code := range codes {
+		hashes[i] = utils.HashToken(utils.NormalizeRecoveryCode(code))
+	}
+	if err := h.MFA.Enable(c.Request.Context(), user.ID, step, hashes); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to enable MFA"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":        "MFA enabled successfully",
+		"recovery_codes": codes,
+	})
+}
+
+// DisableMFA turns MFA off after checking the password and a current code
+func (h *Handler) DisableMFA(c *gin.Context) {
+	user := middleware.CurrentUser(c)
+	var request models.MFADisableRequest
+
+	// Bind JSON to struct
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data", "details": err.Error()})
+		return
+	}
+
+	if !user.MFAEnabled {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "MFA is not enabled"})
+		return
+	}
+
+	if !h.confirmPassword(c, &user, request.Password) {
+		return
+	}
+
+	if ok, err := h.checkTOTP(c.Request.Context(), user.ID, request.Code); err != nil || !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid MFA code"})
+		return
+	}
+
+	if err := h.removeMFA(c.Request.Context(), user.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to disable MFA"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "MFA disabled successfully"})
+}
+
+// VerifyMFA completes a login started by a user with MFA enabled, exchanging the
+// pending MFA token and a TOTP or recovery code for an access token
+func (h *Handler) VerifyMFA(c *gin.Context) {
+	var request models.MFAVerifyRequest
+
+	// Bind JSON to struct
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data", "details": err.Error()})
+		return
+	}
+
+	claims, user, found := h.pendingMFAUser(c, request.MFAToken)
+	if !found {
+		return
+	}
+
+	var ok bool
+	var err error
+	if request.Code != "" {
+		ok, err = h.checkTOTP(c.Request.Context(), user.ID, request.Code)
+	} else {
+		ok, err = h.useRecoveryCode(c.Request.Context(), user.ID, request.RecoveryCode)
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify MFA code"})
+		return
+	}
+	if !ok {
+		h.rejectMFAAttempt(c, claims, user, "Invalid MFA code")
+		return
+	}
+
+	h.completeMFA(c, claims, user)
+}
+
+// GetMFAPolicy returns the roles that must use MFA
+func (h *Handler) GetMFAPolicy(c *gin.Context) {
+	roles, err := h.Settings.MFARequiredRoles(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get MFA policy"})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.MFAPolicy{Roles: roles})
+}
+
+// UpdateMFAPolicy sets the roles that must use MFA
+func (h *Handler) UpdateMFAPolicy(c *gin.Context) {
+	var policy models.MFAPolicy
+
+	// Bind JSON to struct
+	if err := c.ShouldBindJSON(&policy); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data", "details": err.Error()})
+		return
+	}
+
+	if err := h.Settings.Set(c.Request.Context(), utils.SettingMFARequiredRoles, strings.Join(policy.Roles, ","), "Roles that must use MFA"); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update MFA policy"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "MFA policy updated successfully",
+		"roles":   policy.Roles,
+	})
+}
+
+// ResetUserMFA removes the MFA enrolment of a user who lost their authenticator
+func (h *Handler) ResetUserMFA(c *gin.Context) {
+	// Get user ID from URL parameter
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	user, err := h.Users.FindByID(c.Request.Context(), uint(id))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	if err := h.removeMFA(c.Request.Context(), user.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reset MFA"})
+		return
+	}
+
+	admin := middleware.CurrentUser(c)
+	h.Audit.Record(c.Request.Context(), utils.AuditEvent{
+		Level:     utils.AuditWarning,
+		Message:   "MFA reset",
+		UserID:    &user.ID,
+		IPAddress: c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+		Context:   map[string]interface{}{"admin_id": admin.ID},
+	})
+
+	c.JSON(http.StatusOK, gin.H{"message": "MFA reset successfully"})
+}
+
+// checkTOTP validates a code against the user's confirmed secret and records its
+// time step so the same code cannot be replayed
+func (h *Handler) checkTOTP(ctx context.Context, userID uint, code string) (bool, error) {
+	mfa, err := h.MFA.FindEnabled(ctx, userID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	step, ok := utils.ValidateTOTP(mfa.Secret, code, time.Now(), mfa.LastUsedStep)
+	if !ok {
+		return false, nil
+	}
+
+	return h.MFA.UseStep(ctx, userID, step)
+}
+
+// useRecoveryCode consumes one of the user's unused recovery codes
+func (h *Handler) useRecoveryCode(ctx context.Context, userID uint, code string) (bool, error) {
+	return h.MFA.UseRecoveryCode(ctx, userID, utils.HashToken(utils.NormalizeRecoveryCode(code)))
+}
+
+// removeMFA deletes the user's MFA secret and recovery codes
+func (h *Handler) removeMFA(ctx context.Context, userID uint) error {
+	return h.MFA.Remove(ctx, userID)
+}
+
+// pendingMFAUser validates a pending MFA token and loads its user, writing the error
+// response when either is not usable
+func (h *Handler) pendingMFAUser(c *gin.Context, mfaToken string) (*utils.Claims, *models.User, bool) {
+	claims, err := utils.ValidateMFAToken(mfaToken)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired MFA token"})
+		return nil, nil, false
+	}
+
+	// Pending tokens are single use
+	revoked, err := h.Revocations.IsRevoked(c.Request.Context(), claims)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check token status"})
+		return nil, nil, false
+	}
+	if revoked {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired MFA token"})
+		return nil, nil, false
+	}
+
+	user, err := h.Users.FindActiveByID(c.Request.Context(), claims.UserID)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found or inactive"})
+		return nil, nil, false
+	}
+
+	// The second factor is subject to the same lockout as the password
+	if status, message := h.loginRefusal(c, loginIdentifiers(c, user.Email)); status != 0 {
+		c.JSON(status, gin.H{"error": message})
+		return nil, nil, false
+	}
+	return claims, user, true
+}
+
+// rejectMFAAttempt answers a failed second factor, revoking the pending token once too
+// many attempts were made with it. The failure also counts as a failed login of the user,
+// so that logging in again for a fresh token does not give an attacker more guesses.
+func (h *Handler) rejectMFAAttempt(c *gin.Context, claims *utils.Claims, user *models.User, message string) {
+	h.recordLoginFailure(c, loginIdentifiers(c, user.Email), &user.ID)
+
+	exhausted, err := h.recordMFAFailure(c.Request.Context(), claims)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record MFA attempt"})
+		return
+	}
+	if exhausted {
+		if err := h.Revocations.RevokeToken(c.Request.Context(), claims); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke MFA token"})
+			return
+		}
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Too many invalid codes, please log in again"})
+		return
+	}
+	c.JSON(http.StatusUnauthorized, gin.H{"error": message})
+}
+
+// completeMFA consumes the pending token after a valid second factor and issues the tokens
+func (h *Handler) completeMFA(c *gin.Context, claims *utils.Claims, user *models.User) {
+	if err := h.Revocations.RevokeToken(c.Request.Context(), claims); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke MFA token"})
+		return
+	}
+	if err := h.LoginFailures.Delete(c.Request.Context(), models.LoginScopeMFAToken, claims.ID); err != nil {
+		log.Printf("Failed to clear MFA attempts of user %d: %v", user.ID, err)
+	}
+	h.resetLoginFailures(c.Request.Context(), loginIdentifiers(c, user.Email))
+
+	h.respondWithTokens(c, user)
+}
+
+// recordMFAFailure counts a wrong code for the pending token and reports whether the limit
+// was reached. The count is kept with the login failures so every instance shares it.
+func (h *Handler) recordMFAFailure(ctx context.Context, claims *utils.Claims) (bool, error) {
+	var failures int
+	err := h.LoginFailures.Record(ctx, models.LoginScopeMFAToken, claims.ID, func(failure *models.LoginFailure) {
+		now := time.Now()
+		failure.Failures++
+		failure.LastFailureAt = now
+		failure.NextAttemptAt = now
+		failures = failure.Failures
+	})
+	if err != nil {
+		return false, err
+	}
+	return failures >= maxMFAAttempts, nil
+}
+
+// PurgeMFAAttempts forgets the wrong codes counted for pending MFA tokens that have expired
+func (h *Handler) PurgeMFAAttempts(ctx context.Context) error {
+	return h.LoginFailures.DeleteBefore(ctx, models.LoginScopeMFAToken, time.Now().Add(-utils.MFATokenTTL))
+}
@@ -0,0 +1,266 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"crud-example/models"
+	"crud-example/utils"
+)
+
+// setupMFARouter serves the MFA endpoints, authenticating the management endpoints as the
+// user with userID
+func setupMFARouter(h *Handler, userID *uint) *gin.Engine {
+	r := gin.New()
+
+	auth := r.Group("/api/auth")
+	{
+		auth.POST("/login", h.Login)
+		auth.POST("/mfa/verify", h.VerifyMFA)
+	}
+
+	current := func(c *gin.Context) {
+		user, err := h.Users.FindByID(c.Request.Context(), *userID)
+		if err != nil {
+			c.AbortWithStatus(http.StatusUnauthorized)
+			return
+		}
+		c.Set("user", *user)
+		c.Next()
+	}
+	mfa := auth.Group("/mfa", current)
+	{
+		mfa.POST("/enroll", h.EnrollMFA)
+		mfa.POST("/confirm", h.ConfirmMFA)
+	}
+	r.POST("/api/admin/users/:id/mfa/reset", current, h.ResetUserMFA)
+
+	return r
+}
+
+// enrollMFA enables TOTP for the authenticated user and returns the secret and recovery codes.
+// The confirmation uses the previous time step, leaving the current one for a login.
+func enrollMFA(t *testing.T, r http.Handler) (string, []string) {
+	w := performRequest(r, "POST", "/api/auth/mfa/enroll", nil)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var enrolment struct {
+		Secret string `json:"secret"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &enrolment))
+
+	code, err := utils.TOTPCode(enrolment.Secret, utils.TOTPStep(time.Now())-1)
+	require.NoError(t, err)
+	w = performRequest(r, "POST", "/api/auth/mfa/confirm", map[string]interface{}{"code": code})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var confirmation struct {
+		RecoveryCodes []string `json:"recovery_codes"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &confirmation))
+	require.Len(t, confirmation.RecoveryCodes, recoveryCodeCount)
+	return enrolment.Secret, confirmation.RecoveryCodes
+}
+
+// startMFALogin logs in with the password of createTestUser and returns the pending MFA token
+func startMFALogin(t *testing.T, r http.Handler, email string) string {
+	w := performRequest(r, "POST", "/api/auth/login", map[string]interface{}{
+		"email":    email,
+		"password": "Tr0ub4dor&3x",
+	})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var response struct {
+		MFARequired bool   `json:"mfa_required"`
+		MFAToken    string `json:"mfa_token"`
+		Token       string `json:"token"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	require.True(t, response.MFARequired)
+	require.NotEmpty(t, response.MFAToken)
+	assert.Empty(t, response.Token, "no access token before the second factor")
+	return response.MFAToken
+}
+
+func verifyMFA(r http.Handler, payload map[string]interface{}) *httptest.ResponseRecorder {
+	return performRequest(r, "POST", "/api/auth/mfa/verify", payload)
+}
+
+func TestMFALogin(t *testing.T) {
+	h, _ := setupDBTestHandler(t)
+	user := createTestUser(t, h, "test@example.com", models.RoleUser)
+	r := setupMFARouter(h, &user.ID)
+	secret, _ := enrollMFA(t, r)
+
+	mfaToken := startMFALogin(t, r, "test@example.com")
+
+	w := verifyMFA(r, map[string]interface{}{"mfa_token": mfaToken, "code": "000000"})
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Contains(t, w.Body.String(), "Invalid MFA code")
+
+	code, err := utils.TOTPCode(secret, utils.TOTPStep(time.Now()))
+	require.NoError(t, err)
+	w = verifyMFA(r, map[string]interface{}{"mfa_token": mfaToken, "code": code})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	decodeTokens(t, w.Body.Bytes())
+
+	// The pending token and the code are single use
+	w = verifyMFA(r, map[string]interface{}{"mfa_token": mfaToken, "code": code})
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Contains(t, w.Body.String(), "Invalid or expired MFA token")
+	w = verifyMFA(r, map[string]interface{}{"mfa_token": startMFALogin(t, r, "test@example.com"), "code": code})
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Contains(t, w.Body.String(), "Invalid MFA code")
+
+	// A successful second factor forgets the wrong codes of its token, leaving those of the
+	// second login
+	var attempts int64
+	require.NoError(t, h.db.Model(&models.LoginFailure{}).Where("scope = ?", models.LoginScopeMFAToken).Count(&attempts).Error)
+	assert.Equal(t, int64(1), attempts)
+}
+
+func TestMFARecoveryCodes(t *testing.T) {
+	h, _ := setupDBTestHandler(t)
+	user := createTestUser(t, h, "test@example.com", models.RoleUser)
+	r := setupMFARouter(h, &user.ID)
+	_, recoveryCodes := enrollMFA(t, r)
+
+	w := verifyMFA(r, map[string]interface{}{"mfa_token": startMFALogin(t, r, "test@example.com"), "recovery_code": recoveryCodes[0]})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	decodeTokens(t, w.Body.Bytes())
+
+	// Each recovery code works once
+	w = verifyMFA(r, map[string]interface{}{"mfa_token": startMFALogin(t, r, "test@example.com"), "recovery_code": recoveryCodes[0]})
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	w = verifyMFA(r, map[string]interface{}{"mfa_token": startMFALogin(t, r, "test@example.com"), "recovery_code": recoveryCodes[1]})
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+}
+
+func TestMFAAttemptLimit(t *testing.T) {
+	h, _ := setupDBTestHandler(t)
+	user := createTestUser(t, h, "test@example.com", models.RoleUser)
+	r := setupMFARouter(h, &user.ID)
+	_, recoveryCodes := enrollMFA(t, r)
+	mfaToken := startMFALogin(t, r, "test@example.com")
+
+	// Wrong codes also throttle the account; lift that to reach the limit of the pending token
+	unthrottle := func() {
+		require.NoError(t, h.db.Where("scope <> ?", models.LoginScopeMFAToken).Delete(&models.LoginFailure{}).Error)
+	}
+
+	for i := 1; i < maxMFAAttempts; i++ {
+		unthrottle()
+		w := verifyMFA(r, map[string]interface{}{"mfa_token": mfaToken, "code": "000000"})
+		require.Equal(t, http.StatusUnauthorized, w.Code)
+		assert.Contains(t, w.Body.String(), "Invalid MFA code")
+	}
+
+	// The attempts are stored, so another instance sharing the database sees them
+	unthrottle()
+	other := New(h.db, nil)
+	otherRouter := setupMFARouter(other, &user.ID)
+	w := verifyMFA(otherRouter, map[string]interface{}{"mfa_token": mfaToken, "code": "000000"})
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Contains(t, w.Body.String(), "Too many invalid codes")
+
+	// The pending token is revoked even for a valid recovery code
+	w = verifyMFA(otherRouter, map[string]interface{}{"mfa_token": mfaToken, "recovery_code": recoveryCodes[0]})
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Contains(t, w.Body.String(), "Invalid or expired MFA token")
+
+	// Attempts are purged once their pending token expired
+	count := func() int64 {
+		var attempts int64
+		require.NoError(t, h.db.Model(&models.LoginFailure{}).Where("scope = ?", models.LoginScopeMFAToken).Count(&attempts).Error)
+		return attempts
+	}
+	require.NoError(t, h.PurgeMFAAttempts(context.Background()))
+	assert.Equal(t, int64(1), count())
+	require.NoError(t, h.db.Model(&models.LoginFailure{}).Where("scope = ?", models.LoginScopeMFAToken).
+		Update("last_failure_at", time.Now().Add(-utils.MFATokenTTL-time.Minute)).Error)
+	require.NoError(t, h.PurgeMFAAttempts(context.Background()))
+	assert.Zero(t, count())
+}
+
+func TestMFAFailuresCountAsLoginFailures(t *testing.T) {
+	h, _ := setupDBTestHandler(t)
+	user := createTestUser(t, h, "test@example.com", models.RoleUser)
+	r := setupMFARouter(h, &user.ID)
+	secret, _ := enrollMFA(t, r)
+	ctx := context.Background()
+
+	accountFailures := func() int {
+		failures, err := h.LoginFailures.Find(ctx, map[string]string{models.LoginScopeAccount: "test@example.com"})
+		require.NoError(t, err)
+		if len(failures) == 0 {
+			return 0
+		}
+		return failures[0].Failures
+	}
+
+	// A wrong password followed by a valid one: the failure is kept until the second factor
+	w := performRequest(r, "POST", "/api/auth/login", map[string]interface{}{"email": "test@example.com", "password": "wrong-password"})
+	require.Equal(t, http.StatusUnauthorized, w.Code)
+	mfaToken := startMFALogin(t, r, "test@example.com")
+	assert.Equal(t, 1, accountFailures())
+
+	code, err := utils.TOTPCode(secret, utils.TOTPStep(time.Now()))
+	require.NoError(t, err)
+	w = verifyMFA(r, map[string]interface{}{"mfa_token": mfaToken, "code": code})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Zero(t, accountFailures())
+
+	// Wrong codes and recovery codes count against the account until it is throttled
+	mfaToken = startMFALogin(t, r, "test@example.com")
+	for _, payload := range []map[string]interface{}{
+		{"mfa_token": mfaToken, "code": "000000"},
+		{"mfa_token": mfaToken, "recovery_code": "AAAAA-AAAAA"},
+		{"mfa_token": mfaToken, "code": "000000"},
+	} {
+		w = verifyMFA(r, payload)
+		require.Equal(t, http.StatusUnauthorized, w.Code, w.Body.String())
+	}
+	assert.Equal(t, 3, accountFailures())
+
+	w = verifyMFA(r, map[string]interface{}{"mfa_token": mfaToken, "code": code})
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.NotEmpty(t, w.Header().Get("Retry-After"))
+	w = performRequest(r, "POST", "/api/auth/login", map[string]interface{}{"email": "test@example.com", "password": "Tr0ub4dor&3x"})
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+}
+
+func TestResetUserMFA(t *testing.T) {
+	h, _ := setupDBTestHandler(t)
+	user := createTestUser(t, h, "test@example.com", models.RoleUser)
+	r := setupMFARouter(h, &user.ID)
+	enrollMFA(t, r)
+
+	w := performRequest(r, "POST", "/api/admin/users/999/mfa/reset", nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	w = performRequest(r, "POST", fmt.Sprintf("/api/admin/users/%d/mfa/reset", user.ID), nil)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	// The user logs in with the password alone, and the old recovery codes are gone
+	w = performRequest(r, "POST", "/api/auth/login", map[string]interface{}{
+		"email":    "test@example.com",
+		"password": "Tr0ub4dor&3x",
+	})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	decodeTokens(t, w.Body.Bytes())
+
+	var remaining int64
+	require.NoError(t, h.db.Model(&models.MFARecoveryCode{}).Where("user_id = ?", user.ID).Count(&remaining).Error)
+	assert.Zero(t, remaining)
+
+	// The reset is attributed to the administrator
+	var entry models.SystemLog
+	require.NoError(t, h.db.Where("message = ?", "MFA reset").First(&entry).Error)
+	assert.Equal(t, &user.ID, entry.UserID)
+	assert.JSONEq(t, fmt.Sprintf(`{"admin_id": %d}`, user.ID), entry.Context)
+}
@@ -0,0 +1,696 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"html/template"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"crud-example/config"
+	"crud-example/federation"
+	"crud-example/models"
+	"crud-example/utils"
+)
+
+// oauthCodeTTL is how long an authorization code can be redeemed
+const oauthCodeTTL = time.Minute
+
+// scopeDescriptions explains each scope on the consent screen
+var scopeDescriptions = map[string]string{
+	models.PermissionUsersRead:     "List and view users",
+	models.PermissionUsersCreate:   "Create users",
+	models.PermissionUsersUpdate:   "Edit any user",
+	models.PermissionUsersDelete:   "Delete users",
+	models.PermissionUsersManage:   "Activate, deactivate and change the role of users",
+	models.PermissionProfileUpdate: "Edit your profile",
+}
+
+// consentPage is the login and consent screen shown by the authorization endpoint
+var consentPage = template.Must(template.New("consent").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>Authorize {{.ClientName}}</title>
+</head>
+<body>
+<h1>{{.ClientName}} wants to access your account</h1>
+{{if .Error}}<p role="alert"><strong>{{.Error}}</strong></p>{{end}}
+<p>Log in to allow it to:</p>
+<ul>
+{{range .Scopes}}<li>{{.}}</li>
+{{end}}</ul>
+<form method="post" action="/oauth/authorize">
+{{range $name, $value := .Params}}<input type="hidden" name="{{$name}}" value="{{$value}}">
+{{end}}<p><label>Email <input type="email" name="email" value="{{.Email}}" required autocomplete="username"></label></p>
+<p><label>Password <input type="password" name="password" required autocomplete="current-password"></label></p>
+<p><label>Authentication code (if two-factor authentication is enabled) <input type="text" name="mfa_code" autocomplete="one-time-code"></label></p>
+<p>
+<button type="submit" name="decision" value="approve">Allow</button>
+<button type="submit" name="decision" value="deny" formnovalidate>Deny</button>
+</p>
+</form>
+</body>
+</html>
+`))
+
+// oauthError is an error response of the authorization server (RFC 6749 sections 4.1.2.1 and 5.2)
+type oauthError struct {
+	status      int
+	code        string
+	description string
+}
+
+func (e *oauthError) Error() string {
+	return e.code + ": " + e.description
+}
+
+func newOAuthError(status int, code, description string) *oauthError {
+	return &oauthError{status: status, code: code, description: description}
+}
+
+// authorizeRequest is a validated authorization request
+type authorizeRequest struct {
+	client        *models.OAuthClient
+	redirectURI   string
+	scope         []string
+	state         string
+	codeChallenge string
+}
+
+// params returns the request parameters to carry through the consent form
+func (r *authorizeRequest) params() map[string]string {
+	return map[string]string{
+		"response_type":         "code",
+		"client_id":             r.client.ClientID,
+		"redirect_uri":          r.redirectURI,
+		"scope":                 strings.Join(r.scope, " "),
+		"state":                 r.state,
+		"code_challenge":        r.codeChallenge,
+		"code_challenge_method": "S256",
+	}
+}
+
+// redirect sends the user agent back to the client with the given parameters
+func (r *authorizeRequest) redirect(c *gin.Context, params url.Values) {
+	if r.state != "" {
+		params.Set("state", r.state)
+	}
+
+	separator := "?"
+	if strings.Contains(r.redirectURI, "?") {
+		separator = "&"
+	}
+	c.Redirect(http.StatusFound, r.redirectURI+separator+params.Encode())
+}
+
+// redirectError sends an error back to the client
+func (r *authorizeRequest) redirectError(c *gin.Context, err *oauthError) {
+	r.redirect(c, url.Values{"error": {err.code}, "error_description": {err.description}})
+}
+
+// parseAuthorizeRequest validates the parameters of an authorization request. Errors found
+// before the client and its redirect URI are known cannot be sent to the client and are
+// returned with a nil request; later errors are returned together with the request so that
+// they can be redirected.
+func (h *Handler) parseAuthorizeRequest(ctx context.Context, values url.Values) (*authorizeRequest, *oauthError) {
+	client, err := h.OAuthClients.FindByClientID(ctx, values.Get("client_id"))
+	if err != nil {
+		return nil, newOAuthError(http.StatusBadRequest, "invalid_client", "Unknown client")
+	}
+
+	// The redirect URI is always required and must exactly match a registered one
+	redirectURI := values.Get("redirect_uri")
+	if !client.AllowsRedirectURI(redirectURI) {
+		return nil, newOAuthError(http.StatusBadRequest, "invalid_request", "Redirect URI not registered for this client")
+	}
+
+	request := &authorizeRequest{
+		client:        client,
+		redirectURI:   redirectURI,
+		state:         values.Get("state"),
+		codeChallenge: values.Get("code_challenge"),
+	}
+
+	if values.Get("response_type") != "code" {
+		return request, newOAuthError(http.StatusBadRequest, "unsupported_response_type", "Only the code response type is supported")
+	}
+	if !client.AllowsGrant(models.GrantAuthorizationCode) {
+		return request, newOAuthError(http.StatusBadRequest, "unauthorized_client", "Client may not use the authorization code grant")
+	}
+
+	// PKCE is required for every client
+	if request.codeChallenge == "" || values.Get("code_challenge_method") != "S256" {
+		return request, newOAuthError(http.StatusBadRequest, "invalid_request", "A S256 code_challenge is required")
+	}
+
+	scope, scopeErr := requestedScope(client, values.Get("scope"))
+	if scopeErr != nil {
+		return request, scopeErr
+	}
+	request.scope = scope
+
+	return request, nil
+}
+
+// requestedScope validates a scope parameter against the client's registered scopes,
+// defaulting to all of them when it is empty
+func requestedScope(client *models.OAuthClient, scope string) ([]string, *oauthError) {
+	scopes := strings.Fields(scope)
+	if len(scopes) == 0 {
+		return client.ScopeList(), nil
+	}
+
+	for _, s := range scopes {
+		if !client.AllowsScope(s) {
+			return nil, newOAuthError(http.StatusBadRequest, "invalid_scope", "Scope not allowed for this client: "+s)
+		}
+	}
+	return scopes, nil
+}
+
+// grantedScope restricts the requested scopes to the permissions of the user
+func grantedScope(user *models.User, scopes []string) string {
+	granted := []string{}
+	for _, scope := range scopes {
+		if user.HasPermission(scope) {
+			granted = append(granted, scope)
+		}
+	}
+	return strings.Join(granted, " ")
+}
+
+// renderConsent shows the login and consent screen for an authorization request
+func renderConsent(c *gin.Context, status int, request *authorizeRequest, email, message string) {
+	descriptions := []string{}
+	for _, scope := range request.scope {
+		descriptions = append(descriptions, scopeDescriptions[scope])
+	}
+
+	// The page asks for credentials, so it must never be framed or cached
+	c.Header("X-Frame-Options", "DENY")
+	c.Header("Content-Security-Policy", "frame-ancestors 'none'")
+	c.Header("Cache-Control", "no-store")
+	c.Header("Content-Type", "text/html; charset=utf-8")
+	c.Status(status)
+	err := consentPage.Execute(c.Writer, map[string]interface{}{
+		"ClientName": request.client.Name,
+		"Scopes":     descriptions,
+		"Params":     request.params(),
+		"Email":      email,
+		"Error":      message,
+	})
+	if err != nil {
+		log.Printf("Failed to render consent page: %v", err)
+	}
+}
+
+// Authorize shows the login and consent screen of an authorization request (RFC 6749 section 4.1.1)
+func (h *Handler) Authorize(c *gin.Context) {
+	request, oauthErr := h.parseAuthorizeRequest(c.Request.Context(), c.Request.URL.Query())
+	if oauthErr != nil {
+		if request == nil {
+			c.JSON(oauthErr.status, gin.H{"error": oauthErr.code, "error_description": oauthErr.description})
+			return
+		}
+		request.redirectError(c, oauthErr)
+		return
+	}
+
+	renderConsent(c, http.StatusOK, request, "", "")
+}
+
+// AuthorizeDecision handles the consent form: it authenticates the user and, if they
+// approved the request, redirects back to the client with an authorization code
+func (h *Handler) AuthorizeDecision(c *gin.Context) {
+	if err := c.Request.ParseForm(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_request", "error_description": "Invalid form"})
+		return
+	}
+
+	request, oauthErr := h.parseAuthorizeRequest(c.Request.Context(), c.Request.PostForm)
+	if oauthErr != nil {
+		if request == nil {
+			c.JSON(oauthErr.status, gin.H{"error": oauthErr.code, "error_description": oauthErr.description})
+			return
+		}
+		request.redirectError(c, oauthErr)
+		return
+	}
+
+	if c.PostForm("decision") != "approve" {
+		request.redirectError(c, newOAuthError(http.StatusForbidden, "access_denied", "The user denied the request"))
+		return
+	}
+
+	email := c.PostForm("email")
+	user, message, status := h.authenticateConsent(c, email, c.PostForm("password"), c.PostForm("mfa_code"))
+	if user == nil {
+		renderConsent(c, status, request, email, message)
+		return
+	}
+
+	code, err := utils.GenerateRandomToken(32)
+	if err != nil {
+		request.redirectError(c, newOAuthError(http.StatusInternalServerError, "server_error", "Failed to issue authorization code"))
+		return
+	}
+
+	authorization := models.OAuthAuthorizationCode{
+		CodeHash:      utils.HashToken(code),
+		ClientID:      request.client.ClientID,
+		UserID:        user.ID,
+		RedirectURI:   request.redirectURI,
+		Scope:         grantedScope(user, request.scope),
+		CodeChallenge: request.codeChallenge,
+		ExpiresAt:     time.Now().Add(oauthCodeTTL),
+	}
+	if err := h.OAuthCodes.Create(c.Request.Context(), &authorization); err != nil {
+		request.redirectError(c, newOAuthError(http.StatusInternalServerError, "server_error", "Failed to issue authorization code"))
+		return
+	}
+
+	h.Audit.Record(c.Request.Context(), utils.AuditEvent{
+		Message:   "OAuth authorization granted",
+		UserID:    &user.ID,
+		IPAddress: c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+		Context:   map[string]interface{}{"client_id": request.client.ClientID, "scope": authorization.Scope},
+	})
+
+	request.redirect(c, url.Values{"code": {code}})
+}
+
+// authenticateConsent checks the credentials entered on the consent screen with the same
+// brute-force protection as Login. On failure it returns the message and status to show.
+func (h *Handler) authenticateConsent(c *gin.Context, email, password, mfaCode string) (*models.User, string, int) {
+	identifiers := loginIdentifiers(c, email)
+	if status, message := h.loginRefusal(c, identifiers); status != 0 {
+		return nil, message, status
+	}
+
+	user, err := h.Users.FindByEmail(c.Request.Context(), email)
+	if err != nil {
+		utils.CheckDummyPassword(password)
+		h.recordLoginFailure(c, identifiers, nil)
+		return nil, "Invalid credentials", http.StatusUnauthorized
+	}
+	if !utils.CheckPassword(password, user.Password) {
+		h.recordLoginFailure(c, identifiers, &user.ID)
+		return nil, "Invalid credentials", http.StatusUnauthorized
+	}
+
+	// Wrong second factors count as failed logins so codes cannot be guessed
+	if user.MFAEnabled {
+		ok, err := h.checkTOTP(c.Request.Context(), user.ID, mfaCode)
+		if err == nil && !ok && mfaCode != "" {
+			ok, err = h.useRecoveryCode(c.Request.Context(), user.ID, mfaCode)
+		}
+		if err != nil {
+			return nil, "Failed to verify MFA code", http.StatusInternalServerError
+		}
+		if !ok {
+			h.recordLoginFailure(c, identifiers, &user.ID)
+			return nil, "Invalid authentication code", http.StatusUnauthorized
+		}
+	}
+	h.resetLoginFailures(c.Request.Context(), identifiers)
+	h.upgradePasswordHash(c.Request.Context(), user, password)
+
+	if !user.IsActive {
+		return nil, "User account is inactive", http.StatusUnauthorized
+	}
+	if !user.IsVerified && config.Current().Account.EmailVerificationPolicy == config.VerificationLogin {
+		return nil, "Email address not verified", http.StatusForbidden
+	}
+
+	return user, "", http.StatusOK
+}
+
+// Token issues tokens for the authorization_code, client_credentials and refresh_token
+// grants (RFC 6749 sections 4.1.3, 4.4 and 6)
+func (h *Handler) Token(c *gin.Context) {
+	c.Header("Cache-Control", "no-store")
+	c.Header("Pragma", "no-cache")
+
+	client, oauthErr := h.authenticateClient(c)
+	if oauthErr != nil {
+		respondOAuthError(c, oauthErr)
+		return
+	}
+
+	grantType := c.PostForm("grant_type")
+	if grantType != models.GrantAuthorizationCode && grantType != models.GrantClientCredentials && grantType != models.GrantRefreshToken {
+		respondOAuthError(c, newOAuthError(http.StatusBadRequest, "unsupported_grant_type", "Unsupported grant type"))
+		return
+	}
+	if !client.AllowsGrant(grantType) {
+		respondOAuthError(c, newOAuthError(http.StatusBadRequest, "unauthorized_client", "Client may not use this grant type"))
+		return
+	}
+
+	switch grantType {
+	case models.GrantAuthorizationCode:
+		h.exchangeAuthorizationCode(c, client)
+	case models.GrantClientCredentials:
+		h.issueClientCredentials(c, client)
+	case models.GrantRefreshToken:
+		h.refreshClientToken(c, client)
+	}
+}
+
+// exchangeAuthorizationCode redeems a single-use authorization code
+func (h *Handler) exchangeAuthorizationCode(c *gin.Context, client *models.OAuthClient) {
+	invalidGrant := newOAuthError(http.StatusBadRequest, "invalid_grant", "Invalid or expired authorization code")
+
+	authorization, err := h.OAuthCodes.Find(c.Request.Context(), utils.HashToken(c.PostForm("code")), client.ClientID)
+	if err != nil {
+		respondOAuthError(c, invalidGrant)
+		return
+	}
+
+	// A code presented twice has leaked: revoke the tokens issued for it (RFC 6749 section 4.1.2)
+	now := time.Now()
+	used, err := h.OAuthCodes.MarkUsed(c.Request.Context(), authorization.ID)
+	if err != nil {
+		respondOAuthError(c, newOAuthError(http.StatusInternalServerError, "server_error", "Failed to redeem authorization code"))
+		return
+	}
+	if !used {
+		if authorization.SessionToken != "" {
+			if session, err := h.Sessions.FindByToken(c.Request.Context(), authorization.SessionToken); err == nil {
+				if err := h.revokeSession(c.Request.Context(), session); err != nil {
+					log.Printf("Failed to revoke session %d after authorization code reuse: %v", session.ID, err)
+				}
+			}
+		}
+		log.Printf("Authorization code reuse detected for client %s and user %d", client.ClientID, authorization.UserID)
+		respondOAuthError(c, invalidGrant)
+		return
+	}
+
+	if now.After(authorization.ExpiresAt) || c.PostForm("redirect_uri") != authorization.RedirectURI {
+		respondOAuthError(c, invalidGrant)
+		return
+	}
+	if federation.PKCEChallenge(c.PostForm("code_verifier")) != authorization.CodeChallenge {
+		respondOAuthError(c, newOAuthError(http.StatusBadRequest, "invalid_grant", "Invalid code verifier"))
+		return
+	}
+
+	user, err := h.Users.FindActiveByID(c.Request.Context(), authorization.UserID)
+	if err != nil {
+		respondOAuthError(c, newOAuthError(http.StatusBadRequest, "invalid_grant", "User not found or inactive"))
+		return
+	}
+
+	// Refresh tokens are only issued to clients allowed to use them
+	var sessionID, refreshToken string
+	if client.AllowsGrant(models.GrantRefreshToken) {
+		session, token, err := h.startSession(c, user, client.ClientID, authorization.Scope)
+		if err != nil {
+			respondOAuthError(c, newOAuthError(http.StatusInternalServerError, "server_error", "Failed to generate token"))
+			return
+		}
+		sessionID, refreshToken = session.SessionToken, token
+
+		if err := h.OAuthCodes.SetSession(c.Request.Context(), authorization.ID, sessionID); err != nil {
+			log.Printf("Failed to record session of authorization code %d: %v", authorization.ID, err)
+		}
+	}
+
+	accessToken, err := utils.GenerateClientToken(user.ID, user.Email, user.Role, sessionID, client.ClientID, authorization.Scope)
+	if err != nil {
+		respondOAuthError(c, newOAuthError(http.StatusInternalServerError, "server_error", "Failed to generate token"))
+		return
+	}
+
+	c.JSON(http.StatusOK, oauthTokenResponse(accessToken, refreshToken, authorization.Scope))
+}
+
+// issueClientCredentials issues a token acting as the client's owner, restricted to the
+// requested scopes that both the client and the owner are allowed to use
+func (h *Handler) issueClientCredentials(c *gin.Context, client *models.OAuthClient) {
+	scopes, oauthErr := requestedScope(client, c.PostForm("scope"))
+	if oauthErr != nil {
+		respondOAuthError(c, oauthErr)
+		return
+	}
+
+	owner, err := h.Users.FindActiveByID(c.Request.Context(), client.OwnerID)
+	if err != nil {
+		respondOAuthError(c, newOAuthError(http.StatusUnauthorized, "invalid_client", "Client owner not found or inactive"))
+		return
+	}
+
+	scope := grantedScope(owner, scopes)
+	accessToken, err := utils.GenerateClientToken(owner.ID, owner.Email, owner.Role, "", client.ClientID, scope)
+	if err != nil {
+		respondOAuthError(c, newOAuthError(http.StatusInternalServerError, "server_error", "Failed to generate token"))
+		return
+	}
+
+	c.JSON(http.StatusOK, oauthTokenResponse(accessToken, "", scope))
+}
+
+// refreshClientToken rotates a refresh token issued to the client. The scope may be narrowed
+// for the new access token but never widened beyond what was granted.
+func (h *Handler) refreshClientToken(c *gin.Context, client *models.OAuthClient) {
+	token := c.PostForm("refresh_token")
+
+	// The scope is checked before rotating, so a rejected request leaves the token usable
+	requested := strings.Fields(c.PostForm("scope"))
+	if len(requested) > 0 {
+		if session, ok := h.findClientSession(c.Request.Context(), client, token); ok {
+			granted := strings.Fields(session.Scope)
+			for _, s := range requested {
+				if !containsScope(granted, s) {
+					respondOAuthError(c, newOAuthError(http.StatusBadRequest, "invalid_scope", "Scope was not granted: "+s))
+					return
+				}
+			}
+		}
+	}
+
+	session, user, refreshToken, err := h.rotateRefreshToken(c, token, client.ClientID)
+	switch {
+	case errors.Is(err, errInvalidRefreshToken), errors.Is(err, errRefreshTokenExpired),
+		errors.Is(err, errRefreshTokenReuse), errors.Is(err, errRefreshUserInactive):
+		respondOAuthError(c, newOAuthError(http.StatusBadRequest, "invalid_grant", err.Error()))
+		return
+	case err != nil:
+		respondOAuthError(c, newOAuthError(http.StatusInternalServerError, "server_error", "Failed to rotate refresh token"))
+		return
+	}
+
+	scope := session.Scope
+	if len(requested) > 0 {
+		scope = strings.Join(requested, " ")
+	}
+
+	accessToken, err := utils.GenerateClientToken(user.ID, user.Email, user.Role, session.SessionToken, client.ClientID, scope)
+	if err != nil {
+		respondOAuthError(c, newOAuthError(http.StatusInternalServerError, "server_error", "Failed to generate token"))
+		return
+	}
+
+	c.JSON(http.StatusOK, oauthTokenResponse(accessToken, refreshToken, scope))
+}
+
+// Introspect reports whether a token is active and describes it (RFC 7662). Only
+// confidential clients may introspect, and refresh tokens only for the client they were issued to.
+func (h *Handler) Introspect(c *gin.Context) {
+	c.Header("Cache-Control", "no-store")
+
+	client, oauthErr := h.authenticateClient(c)
+	if oauthErr != nil {
+		respondOAuthError(c, oauthErr)
+		return
+	}
+	if !client.Confidential {
+		respondOAuthError(c, newOAuthError(http.StatusUnauthorized, "invalid_client", "Introspection requires a confidential client"))
+		return
+	}
+
+	token := c.PostForm("token")
+	inactive := gin.H{"active": false}
+
+	if claims, err := utils.ValidateToken(token); err == nil {
+		if revoked, err := h.Revocations.IsRevoked(c.Request.Context(), claims); err != nil || revoked {
+			c.JSON(http.StatusOK, inactive)
+			return
+		}
+		if _, err := h.Users.FindActiveByID(c.Request.Context(), claims.UserID); err != nil {
+			c.JSON(http.StatusOK, inactive)
+			return
+		}
+
+		response := gin.H{
+			"active":     true,
+			"token_type": "access_token",
+			"sub":        strconv.FormatUint(uint64(claims.UserID), 10),
+			"username":   claims.Email,
+			"jti":        claims.ID,
+			"exp":        claims.ExpiresAt.Unix(),
+			"iat":        claims.IssuedAt.Unix(),
+		}
+		if claims.ClientID != "" {
+			response["client_id"] = claims.ClientID
+			response["scope"] = claims.Scope
+			response["aud"] = claims.Audience
+		}
+		c.JSON(http.StatusOK, response)
+		return
+	}
+
+	session, ok := h.findClientSession(c.Request.Context(), client, token)
+	if !ok {
+		c.JSON(http.StatusOK, inactive)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"active":     true,
+		"token_type": "refresh_token",
+		"sub":        strconv.FormatUint(uint64(session.UserID), 10),
+		"client_id":  session.ClientID,
+		"scope":      session.Scope,
+		"exp":        session.ExpiresAt.Unix(),
+		"iat":        session.CreatedAt.Unix(),
+	})
+}
+
+// Revoke revokes an access or refresh token issued to the client (RFC 7009). Revoking a
+// refresh token ends its whole session. Unknown tokens are not an error.
+func (h *Handler) Revoke(c *gin.Context) {
+	client, oauthErr := h.authenticateClient(c)
+	if oauthErr != nil {
+		respondOAuthError(c, oauthErr)
+		return
+	}
+
+	token := c.PostForm("token")
+	if claims, err := utils.ValidateToken(token); err == nil {
+		if claims.ClientID == client.ClientID {
+			if err := h.Revocations.RevokeToken(c.Request.Context(), claims); err != nil {
+				respondOAuthError(c, newOAuthError(http.StatusServiceUnavailable, "server_error", "Failed to revoke token"))
+				return
+			}
+		}
+		c.Status(http.StatusOK)
+		return
+	}
+
+	if session, ok := h.findClientSession(c.Request.Context(), client, token); ok {
+		if err := h.revokeSession(c.Request.Context(), session); err != nil {
+			respondOAuthError(c, newOAuthError(http.StatusServiceUnavailable, "server_error", "Failed to revoke token"))
+			return
+		}
+	}
+	c.Status(http.StatusOK)
+}
+
+// OAuthMetadata publishes the authorization server metadata (RFC 8414)
+func (h *Handler) OAuthMetadata(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"issuer":                                appURL("", nil),
+		"authorization_endpoint":                appURL("/oauth/authorize", nil),
+		"token_endpoint":                        appURL("/oauth/token", nil),
+		"introspection_endpoint":                appURL("/oauth/introspect", nil),
+		"revocation_endpoint":                   appURL("/oauth/revoke", nil),
+		"jwks_uri":                              appURL("/.well-known/jwks.json", nil),
+		"scopes_supported":                      models.Permissions(),
+		"response_types_supported":              []string{"code"},
+		"grant_types_supported":                 []string{models.GrantAuthorizationCode, models.GrantClientCredentials, models.GrantRefreshToken},
+		"code_challenge_methods_supported":      []string{"S256"},
+		"token_endpoint_auth_methods_supported": []string{"client_secret_basic", "client_secret_post", "none"},
+	})
+}
+
+// authenticateClient identifies the client of a token, introspection or revocation request
+// using HTTP Basic credentials or the client_id and client_secret form parameters.
+// Public clients only send their client_id.
+func (h *Handler) authenticateClient(c *gin.Context) (*models.OAuthClient, *oauthError) {
+	clientID, secret, basic := c.Request.BasicAuth()
+	if basic {
+		// Credentials in the Authorization header are form-encoded (RFC 6749 section 2.3.1)
+		clientID, _ = url.QueryUnescape(clientID)
+		secret, _ = url.QueryUnescape(secret)
+	} else {
+		clientID = c.PostForm("client_id")
+		secret = c.PostForm("client_secret")
+	}
+
+	invalidClient := newOAuthError(http.StatusUnauthorized, "invalid_client", "Client authentication failed")
+	if basic {
+		c.Header("WWW-Authenticate", `Basic realm="oauth"`)
+	}
+
+	if clientID == "" {
+		return nil, invalidClient
+	}
+	client, err := h.OAuthClients.FindByClientID(c.Request.Context(), clientID)
+	if err != nil {
+		return nil, invalidClient
+	}
+
+	if client.Confidential {
+		if secret == "" || !utils.CompareTokenHash(secret, client.SecretHash) {
+			return nil, invalidClient
+		}
+	} else if secret != "" {
+		return nil, invalidClient
+	}
+
+	return client, nil
+}
+
+// findClientSession returns the active session of a refresh token issued to the client
+func (h *Handler) findClientSession(ctx context.Context, client *models.OAuthClient, token string) (*models.UserSession, bool) {
+	familyID, secret, err := utils.ParseRefreshToken(token)
+	if err != nil {
+		return nil, false
+	}
+
+	session, err := h.Sessions.FindByToken(ctx, familyID)
+	if err != nil || session.ClientID != client.ClientID {
+		return nil, false
+	}
+	if !session.IsActive || time.Now().After(session.ExpiresAt) || !utils.CompareTokenHash(secret, session.RefreshToken) {
+		return nil, false
+	}
+	return session, true
+}
+
+// respondOAuthError writes an error response of the token, introspection or revocation endpoints
+func respondOAuthError(c *gin.Context, err *oauthError) {
+	c.JSON(err.status, gin.H{"error": err.code, "error_description": err.description})
+}
+
+// oauthTokenResponse builds a successful token response (RFC 6749 section 5.1)
+func oauthTokenResponse(accessToken, refreshToken, scope string) gin.H {
+	response := gin.H{
+		"access_token": accessToken,
+		"token_type":   "Bearer",
+		"expires_in":   int(utils.AccessTokenTTL().Seconds()),
+		"scope":        scope,
+	}
+	if refreshToken != "" {
+		response["refresh_token"] = refreshToken
+	}
+	return response
+}
+
+func containsScope(scopes []string, scope string) bool {
+	for _, s := range scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,170 @@
+package handlers
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"crud-example/middleware"
+	"crud-example/models"
+	"crud-example/utils"
+)
+
+// ListOAuthClients returns the OAuth clients registered by the current user
+func (h *Handler) ListOAuthClients(c *gin.Context) {
+	user := middleware.CurrentUser(c)
+
+	clients, err := h.OAuthClients.ListByOwner(c.Request.Context(), user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get OAuth clients"})
+		return
+	}
+
+	responses := []models.OAuthClientResponse{}
+	for _, client := range clients {
+		responses = append(responses, client.ToResponse())
+	}
+
+	c.JSON(http.StatusOK, gin.H{"clients": responses})
+}
+
+// CreateOAuthClient registers a third-party application. The secret of confidential
+// clients is only returned once.
+func (h *Handler) CreateOAuthClient(c *gin.Context) {
+	user := middleware.CurrentUser(c)
+	var clientCreate models.OAuthClientCreate
+
+	// Bind JSON to struct
+	if err := c.ShouldBindJSON(&clientCreate); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data", "details": err.Error()})
+		return
+	}
+
+	// Clients can only request permissions their owner already has
+	for _, scope := range clientCreate.Scopes {
+		if !models.IsValidPermission(scope) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown scope", "details": scope})
+			return
+		}
+		if !user.HasPermission(scope) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Scope not allowed for your role", "details": scope})
+			return
+		}
+	}
+
+	grants := map[string]bool{}
+	for _, grant := range clientCreate.GrantTypes {
+		grants[grant] = true
+	}
+	if grants[models.GrantClientCredentials] && !clientCreate.Confidential {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "The client_credentials grant requires a confidential client"})
+		return
+	}
+	if grants[models.GrantRefreshToken] && !grants[models.GrantAuthorizationCode] {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "The refresh_token grant requires the authorization_code grant"})
+		return
+	}
+	if grants[models.GrantAuthorizationCode] && len(clientCreate.RedirectURIs) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "The authorization_code grant requires at least one redirect URI"})
+		return
+	}
+	for _, uri := range clientCreate.RedirectURIs {
+		if !validRedirectURI(uri) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid redirect URI", "details": uri})
+			return
+		}
+	}
+
+	clientID, err := utils.GenerateRandomToken(16)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate client ID"})
+		return
+	}
+
+	client := models.OAuthClient{
+		ClientID:     clientID,
+		Name:         clientCreate.Name,
+		OwnerID:      user.ID,
+		RedirectURIs: strings.Join(clientCreate.RedirectURIs, " "),
+		Scopes:       strings.Join(clientCreate.Scopes, " "),
+		GrantTypes:   strings.Join(clientCreate.GrantTypes, " "),
+		Confidential: clientCreate.Confidential,
+	}
+
+	var secret string
+	if client.Confidential {
+		secret, err = utils.GenerateRandomToken(32)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate client secret"})
+			return
+		}
+		client.SecretHash = utils.HashToken(secret)
+	}
+
+	if err := h.OAuthClients.Create(c.Request.Context(), &client); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create OAuth client"})
+		return
+	}
+
+	response := gin.H{
+		"message": "OAuth client created successfully",
+		"client":  client.ToResponse(),
+	}
+	if secret != "" {
+		response["message"] = "OAuth client created successfully, store the secret now: it will not be shown again"
+		response["client_secret"] = secret
+	}
+	c.JSON(http.StatusCreated, response)
+}
+
+// DeleteOAuthClient removes a client of the current user and revokes its refresh tokens.
+// Access tokens already issued to it stay valid until they expire.
+func (h *Handler) DeleteOAuthClient(c *gin.Context) {
+	user := middleware.CurrentUser(c)
+
+	// Get client ID from URL parameter
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid OAuth client ID"})
+		return
+	}
+
+	client, err := h.OAuthClients.FindByOwner(c.Request.Context(), uint(id), user.ID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "OAuth client not found"})
+		return
+	}
+
+	if err := h.OAuthClients.Delete(c.Request.Context(), client.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete OAuth client"})
+		return
+	}
+
+	if err := h.Sessions.RevokeClient(c.Request.Context(), client.ClientID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke client sessions"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "OAuth client deleted successfully"})
+}
+
+// validRedirectURI accepts absolute URIs without fragment. Plain http is only allowed
+// for loopback addresses used by native apps during development.
+func validRedirectURI(uri string) bool {
+	u, err := url.Parse(uri)
+	if err != nil || u.Scheme == "" || u.Fragment != "" {
+		return false
+	}
+
+	switch u.Scheme {
+	case "https":
+		return u.Host != ""
+	case "http":
+		host := u.Hostname()
+		return host == "localhost" || host == "127.0.0.1" || host == "::1"
+	}
+	// Private-use schemes of native apps (RFC 8252)
+	return strings.Contains(u.Scheme, ".")
+}
@@ -0,0 +1,315 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"crud-example/federation"
+	"crud-example/models"
+	"crud-example/utils"
+)
+
+const testRedirectURI = "https://app.example.com/callback"
+
+func setupOAuthRouter(h *Handler) *gin.Engine {
+	r := gin.New()
+
+	oauth := r.Group("/oauth")
+	{
+		oauth.GET("/authorize", h.Authorize)
+		oauth.POST("/authorize", h.AuthorizeDecision)
+		oauth.POST("/token", h.Token)
+		oauth.POST("/introspect", h.Introspect)
+		oauth.POST("/revoke", h.Revoke)
+	}
+	r.POST("/api/auth/refresh", h.Refresh)
+
+	return r
+}
+
+// createOAuthClient registers a client of owner and returns it with its secret, empty for
+// public clients
+func createOAuthClient(t *testing.T, h *Handler, owner models.User, confidential bool, scopes string, grants ...string) (models.OAuthClient, string) {
+	clientID, err := utils.GenerateRandomToken(16)
+	require.NoError(t, err)
+	client := models.OAuthClient{
+		ClientID:     clientID,
+		Name:         "Test App",
+		OwnerID:      owner.ID,
+		RedirectURIs: testRedirectURI,
+		Scopes:       scopes,
+		GrantTypes:   strings.Join(grants, " "),
+		Confidential: confidential,
+	}
+
+	var secret string
+	if confidential {
+		secret, err = utils.GenerateRandomToken(32)
+		require.NoError(t, err)
+		client.SecretHash = utils.HashToken(secret)
+	}
+	require.NoError(t, h.OAuthClients.Create(context.Background(), &client))
+	return client, secret
+}
+
+// postForm posts values to the router, authenticating as the client with HTTP Basic
+// credentials when secret is set and with client_id otherwise
+func postForm(r http.Handler, path string, client models.OAuthClient, secret string, values url.Values) *httptest.ResponseRecorder {
+	if secret == "" {
+		values.Set("client_id", client.ClientID)
+	}
+	req, _ := http.NewRequest("POST", path, strings.NewReader(values.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if secret != "" {
+		req.SetBasicAuth(client.ClientID, secret)
+	}
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+// authorizationCode approves an authorization request of the client on the consent screen
+// as the user with the password of createTestUser and returns the code
+func authorizationCode(t *testing.T, r http.Handler, client models.OAuthClient, email, scope, verifier string) string {
+	values := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {client.ClientID},
+		"redirect_uri":          {testRedirectURI},
+		"scope":                 {scope},
+		"state":                 {"xyz"},
+		"code_challenge":        {federation.PKCEChallenge(verifier)},
+		"code_challenge_method": {"S256"},
+		"decision":              {"approve"},
+		"email":                 {email},
+		"password":              {"Tr0ub4dor&3x"},
+	}
+	req, _ := http.NewRequest("POST", "/oauth/authorize", strings.NewReader(values.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	require.Equal(t, http.StatusFound, w.Code, w.Body.String())
+
+	location, err := url.Parse(w.Header().Get("Location"))
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(location.String(), testRedirectURI+"?"))
+	assert.Equal(t, "xyz", location.Query().Get("state"))
+	code := location.Query().Get("code")
+	require.NotEmpty(t, code, location.String())
+	return code
+}
+
+// exchangeCode redeems an authorization code at the token endpoint
+func exchangeCode(r http.Handler, client models.OAuthClient, secret, code, verifier, redirectURI string) *httptest.ResponseRecorder {
+	return postForm(r, "/oauth/token", client, secret, url.Values{
+		"grant_type":    {models.GrantAuthorizationCode},
+		"code":          {code},
+		"code_verifier": {verifier},
+		"redirect_uri":  {redirectURI},
+	})
+}
+
+// oauthTokens is a successful token response
+type oauthTokens struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	Scope        string `json:"scope"`
+}
+
+func decodeOAuthTokens(t *testing.T, w *httptest.ResponseRecorder) oauthTokens {
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var tokens oauthTokens
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &tokens))
+	require.NotEmpty(t, tokens.AccessToken)
+	return tokens
+}
+
+// assertOAuthError checks the status and error code of an OAuth error response
+func assertOAuthError(t *testing.T, w *httptest.ResponseRecorder, status int, code string) {
+	t.Helper()
+	assert.Equal(t, status, w.Code, w.Body.String())
+	var response map[string]interface{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, code, response["error"])
+}
+
+func refreshOAuth(r http.Handler, client models.OAuthClient, secret, refreshToken, scope string) *httptest.ResponseRecorder {
+	values := url.Values{"grant_type": {models.GrantRefreshToken}, "refresh_token": {refreshToken}}
+	if scope != "" {
+		values.Set("scope", scope)
+	}
+	return postForm(r, "/oauth/token", client, secret, values)
+}
+
+func TestOAuthAuthorizationCode(t *testing.T) {
+	h, _ := setupDBTestHandler(t)
+	r := setupOAuthRouter(h)
+	user := createTestUser(t, h, "test@example.com", models.RoleUser)
+	client, _ := createOAuthClient(t, h, user, false, models.PermissionProfileUpdate, models.GrantAuthorizationCode, models.GrantRefreshToken)
+	verifier, _, err := federation.NewPKCE()
+	require.NoError(t, err)
+
+	t.Run("Redirect URI not registered", func(t *testing.T) {
+		// The error is not sent to an unregistered redirect URI
+		w := performRequest(r, "GET", "/oauth/authorize?"+url.Values{
+			"response_type":         {"code"},
+			"client_id":             {client.ClientID},
+			"redirect_uri":          {"https://attacker.example.com/callback"},
+			"code_challenge":        {federation.PKCEChallenge(verifier)},
+			"code_challenge_method": {"S256"},
+		}.Encode(), nil)
+		assertOAuthError(t, w, http.StatusBadRequest, "invalid_request")
+		assert.Empty(t, w.Header().Get("Location"))
+
+		// ... and a code is only redeemed with the redirect URI it was issued for
+		code := authorizationCode(t, r, client, "test@example.com", "", verifier)
+		w = exchangeCode(r, client, "", code, verifier, "https://app.example.com/other")
+		assertOAuthError(t, w, http.StatusBadRequest, "invalid_grant")
+	})
+
+	t.Run("Wrong code verifier", func(t *testing.T) {
+		code := authorizationCode(t, r, client, "test@example.com", "", verifier)
+		w := exchangeCode(r, client, "", code, "wrong-verifier", testRedirectURI)
+		assertOAuthError(t, w, http.StatusBadRequest, "invalid_grant")
+		assert.Contains(t, w.Body.String(), "Invalid code verifier")
+
+		// The failed attempt consumed the code
+		w = exchangeCode(r, client, "", code, verifier, testRedirectURI)
+		assertOAuthError(t, w, http.StatusBadRequest, "invalid_grant")
+	})
+
+	t.Run("Success and code reuse", func(t *testing.T) {
+		code := authorizationCode(t, r, client, "test@example.com", "", verifier)
+		tokens := decodeOAuthTokens(t, exchangeCode(r, client, "", code, verifier, testRedirectURI))
+		assert.Equal(t, models.PermissionProfileUpdate, tokens.Scope)
+		require.NotEmpty(t, tokens.RefreshToken)
+
+		claims, err := utils.ValidateToken(tokens.AccessToken)
+		require.NoError(t, err)
+		assert.Equal(t, user.ID, claims.UserID)
+		assert.Equal(t, client.ClientID, claims.ClientID)
+
+		// Presenting the code again revokes the session it started
+		w := exchangeCode(r, client, "", code, verifier, testRedirectURI)
+		assertOAuthError(t, w, http.StatusBadRequest, "invalid_grant")
+		w = refreshOAuth(r, client, "", tokens.RefreshToken, "")
+		assertOAuthError(t, w, http.StatusBadRequest, "invalid_grant")
+		assert.Contains(t, w.Body.String(), errRefreshTokenExpired.Error())
+	})
+}
+
+func TestOAuthRefreshToken(t *testing.T) {
+	h, _ := setupDBTestHandler(t)
+	r := setupOAuthRouter(h)
+	user := createTestUser(t, h, "test@example.com", models.RoleUser)
+	scope := models.PermissionUsersRead + " " + models.PermissionProfileUpdate
+	client, _ := createOAuthClient(t, h, user, false, scope, models.GrantAuthorizationCode, models.GrantRefreshToken)
+	other, _ := createOAuthClient(t, h, user, false, scope, models.GrantAuthorizationCode, models.GrantRefreshToken)
+	verifier, _, err := federation.NewPKCE()
+	require.NoError(t, err)
+
+	code := authorizationCode(t, r, client, "test@example.com", models.PermissionUsersRead, verifier)
+	first := decodeOAuthTokens(t, exchangeCode(r, client, "", code, verifier, testRedirectURI))
+
+	// Refresh tokens only work for the client they were issued to
+	assertOAuthError(t, refreshOAuth(r, other, "", first.RefreshToken, ""), http.StatusBadRequest, "invalid_grant")
+	w := performRequest(r, "POST", "/api/auth/refresh", map[string]interface{}{"refresh_token": first.RefreshToken})
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	// The scope can be kept or narrowed but not widened
+	assertOAuthError(t, refreshOAuth(r, client, "", first.RefreshToken, models.PermissionProfileUpdate), http.StatusBadRequest, "invalid_scope")
+
+	second := decodeOAuthTokens(t, refreshOAuth(r, client, "", first.RefreshToken, ""))
+	assert.NotEqual(t, first.RefreshToken, second.RefreshToken)
+	assert.Equal(t, models.PermissionUsersRead, second.Scope)
+
+	// Replaying the rotated token revokes the family
+	assertOAuthError(t, refreshOAuth(r, client, "", first.RefreshToken, ""), http.StatusBadRequest, "invalid_grant")
+	assertOAuthError(t, refreshOAuth(r, client, "", second.RefreshToken, ""), http.StatusBadRequest, "invalid_grant")
+}
+
+func TestOAuthClientCredentials(t *testing.T) {
+	h, _ := setupDBTestHandler(t)
+	r := setupOAuthRouter(h)
+	owner := createTestUser(t, h, "owner@example.com", models.RoleUser)
+	// The owner lost the users:delete permission after registering the client
+	client, secret := createOAuthClient(t, h, owner, true, models.PermissionUsersRead+" "+models.PermissionUsersDelete, models.GrantClientCredentials)
+	public, _ := createOAuthClient(t, h, owner, false, models.PermissionUsersRead, models.GrantAuthorizationCode)
+
+	grant := url.Values{"grant_type": {models.GrantClientCredentials}}
+
+	tokens := decodeOAuthTokens(t, postForm(r, "/oauth/token", client, secret, grant))
+	assert.Equal(t, models.PermissionUsersRead, tokens.Scope)
+	assert.Empty(t, tokens.RefreshToken)
+	claims, err := utils.ValidateToken(tokens.AccessToken)
+	require.NoError(t, err)
+	assert.Equal(t, owner.ID, claims.UserID)
+	assert.Equal(t, client.ClientID, claims.ClientID)
+
+	assertOAuthError(t, postForm(r, "/oauth/token", client, "wrong-secret", url.Values{"grant_type": {models.GrantClientCredentials}}), http.StatusUnauthorized, "invalid_client")
+	assertOAuthError(t, postForm(r, "/oauth/token", client, secret, url.Values{"grant_type": {models.GrantClientCredentials}, "scope": {models.PermissionUsersCreate}}), http.StatusBadRequest, "invalid_scope")
+	assertOAuthError(t, postForm(r, "/oauth/token", public, "", url.Values{"grant_type": {models.GrantClientCredentials}}), http.StatusBadRequest, "unauthorized_client")
+}
+
+// introspect returns the introspection response for token
+func introspect(t *testing.T, r http.Handler, client models.OAuthClient, secret, token string) map[string]interface{} {
+	w := postForm(r, "/oauth/introspect", client, secret, url.Values{"token": {token}})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var response map[string]interface{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	return response
+}
+
+func TestOAuthIntrospectAndRevoke(t *testing.T) {
+	h, _ := setupDBTestHandler(t)
+	r := setupOAuthRouter(h)
+	user := createTestUser(t, h, "test@example.com", models.RoleUser)
+	client, secret := createOAuthClient(t, h, user, true, models.PermissionUsersRead, models.GrantAuthorizationCode, models.GrantRefreshToken)
+	other, otherSecret := createOAuthClient(t, h, user, true, models.PermissionUsersRead, models.GrantAuthorizationCode, models.GrantRefreshToken)
+	public, _ := createOAuthClient(t, h, user, false, models.PermissionUsersRead, models.GrantAuthorizationCode)
+	verifier, _, err := federation.NewPKCE()
+	require.NoError(t, err)
+
+	code := authorizationCode(t, r, client, "test@example.com", "", verifier)
+	tokens := decodeOAuthTokens(t, exchangeCode(r, client, secret, code, verifier, testRedirectURI))
+
+	// Only confidential clients may introspect
+	w := postForm(r, "/oauth/introspect", public, "", url.Values{"token": {tokens.AccessToken}})
+	assertOAuthError(t, w, http.StatusUnauthorized, "invalid_client")
+
+	response := introspect(t, r, client, secret, tokens.AccessToken)
+	assert.Equal(t, true, response["active"])
+	assert.Equal(t, "access_token", response["token_type"])
+	assert.Equal(t, client.ClientID, response["client_id"])
+	assert.Equal(t, models.PermissionUsersRead, response["scope"])
+
+	response = introspect(t, r, client, secret, tokens.RefreshToken)
+	assert.Equal(t, true, response["active"])
+	assert.Equal(t, "refresh_token", response["token_type"])
+
+	// Refresh tokens are only described to their client, and garbage is inactive
+	assert.Equal(t, false, introspect(t, r, other, otherSecret, tokens.RefreshToken)["active"])
+	assert.Equal(t, false, introspect(t, r, client, secret, "not-a-token")["active"])
+
+	// Revoking tokens of another client or unknown tokens succeeds without effect (RFC 7009)
+	assert.Equal(t, http.StatusOK, postForm(r, "/oauth/revoke", other, otherSecret, url.Values{"token": {tokens.AccessToken}}).Code)
+	assert.Equal(t, http.StatusOK, postForm(r, "/oauth/revoke", client, secret, url.Values{"token": {"not-a-token"}}).Code)
+	assert.Equal(t, true, introspect(t, r, client, secret, tokens.AccessToken)["active"])
+
+	assert.Equal(t, http.StatusOK, postForm(r, "/oauth/revoke", client, secret, url.Values{"token": {tokens.AccessToken}}).Code)
+	assert.Equal(t, false, introspect(t, r, client, secret, tokens.AccessToken)["active"])
+	assert.Equal(t, true, introspect(t, r, client, secret, tokens.RefreshToken)["active"])
+
+	// Revoking the refresh token ends the session
+	assert.Equal(t, http.StatusOK, postForm(r, "/oauth/revoke", client, secret, url.Values{"token": {tokens.RefreshToken}}).Code)
+	assert.Equal(t, false, introspect(t, r, client, secret, tokens.RefreshToken)["active"])
+	assertOAuthError(t, refreshOAuth(r, client, secret, tokens.RefreshToken, ""), http.StatusBadRequest, "invalid_grant")
+}
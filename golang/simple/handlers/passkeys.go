@@ -0,0 +1,448 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"crud-example/config"
+	"crud-example/middleware"
+	"crud-example/models"
+	"crud-example/repository"
+	"crud-example/utils"
+	"crud-example/webauthn"
+)
+
+// errChallengeNotFound is returned when a WebAuthn response answers no pending ceremony
+var errChallengeNotFound = errors.New("unknown or expired challenge")
+
+// ListPasskeys returns the passkeys of the current user
+func (h *Handler) ListPasskeys(c *gin.Context) {
+	user := middleware.CurrentUser(c)
+
+	passkeys, err := h.Passkeys.ListByUser(c.Request.Context(), user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get passkeys"})
+		return
+	}
+
+	responses := []models.PasskeyResponse{}
+	for _, passkey := range passkeys {
+		responses = append(responses, passkey.ToResponse())
+	}
+
+	c.JSON(http.StatusOK, gin.H{"passkeys": responses})
+}
+
+// BeginPasskeyRegistration returns the options for navigator.credentials.create()
+func (h *Handler) BeginPasskeyRegistration(c *gin.Context) {
+	user := middleware.CurrentUser(c)
+
+	exclude, err := h.passkeyDescriptors(c.Request.Context(), user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get passkeys"})
+		return
+	}
+
+	challenge, err := h.newPasskeyChallenge(c.Request.Context(), models.PasskeyPurposeRegister, &user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start passkey registration"})
+		return
+	}
+
+	entity := webauthn.UserEntity{ID: webauthn.UserHandle(user.ID), Name: user.Email, DisplayName: user.Name}
+	c.JSON(http.StatusOK, gin.H{"publicKey": webauthn.CurrentConfig().CreationOptions(entity, challenge, exclude)})
+}
+
+// FinishPasskeyRegistration verifies the new credential and stores it as a passkey
+func (h *Handler) FinishPasskeyRegistration(c *gin.Context) {
+	user := middleware.CurrentUser(c)
+	var request models.PasskeyRegisterRequest
+
+	// Bind JSON to struct
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data", "details": err.Error()})
+		return
+	}
+
+	pending, challenge, err := h.consumePasskeyChallenge(c.Request.Context(), request.Credential.Response.ClientDataJSON, models.PasskeyPurposeRegister)
+	if err != nil || pending.UserID == nil || *pending.UserID != user.ID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired passkey challenge"})
+		return
+	}
+
+	credential, err := webauthn.CurrentConfig().FinishRegistration(&request.Credential, challenge, false)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid passkey", "details": err.Error()})
+		return
+	}
+
+	credentialID := webauthn.Base64URL(credential.ID).String()
+	if _, err := h.Passkeys.FindByCredentialHash(c.Request.Context(), utils.HashToken(credentialID)); err == nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "Passkey already registered"})
+		return
+	}
+
+	passkey := models.Passkey{
+		UserID:         user.ID,
+		Name:           request.Name,
+		CredentialID:   credentialID,
+		CredentialHash: utils.HashToken(credentialID),
+		PublicKey:      credential.PublicKey,
+		SignCount:      credential.SignCount,
+		Transports:     strings.Join(credential.Transports, " "),
+		BackupEligible: credential.BackupEligible,
+	}
+	if err := h.Passkeys.Create(c.Request.Context(), &passkey); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to register passkey"})
+		return
+	}
+
+	h.Audit.Record(c.Request.Context(), utils.AuditEvent{
+		Level:     utils.AuditInfo,
+		Message:   "Passkey registered",
+		UserID:    &user.ID,
+		IPAddress: c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+		Context:   map[string]interface{}{"passkey_id": passkey.ID},
+	})
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "Passkey registered successfully",
+		"passkey": passkey.ToResponse(),
+	})
+}
+
+// RenamePasskey relabels a passkey of the current user
+func (h *Handler) RenamePasskey(c *gin.Context) {
+	passkey, ok := h.findOwnPasskey(c)
+	if !ok {
+		return
+	}
+
+	var request models.PasskeyRenameRequest
+
+	// Bind JSON to struct
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data", "details": err.Error()})
+		return
+	}
+
+	if err := h.Passkeys.Rename(c.Request.Context(), passkey.ID, request.Name); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update passkey"})
+		return
+	}
+	passkey.Name = request.Name
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Passkey updated successfully",
+		"passkey": passkey.ToResponse(),
+	})
+}
+
+// DeletePasskey removes a passkey of the current user, unless it is the last way left to
+// sign in to an account without a password
+func (h *Handler) DeletePasskey(c *gin.Context) {
+	user := middleware.CurrentUser(c)
+	passkey, ok := h.findOwnPasskey(c)
+	if !ok {
+		return
+	}
+
+	last, err := h.isLastSignInMethod(c.Request.Context(), &user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete passkey"})
+		return
+	}
+	if last {
+		c.JSON(http.StatusConflict, gin.H{"error": "Cannot delete the last passkey of an account without a password"})
+		return
+	}
+
+	if err := h.Passkeys.Delete(c.Request.Context(), passkey.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete passkey"})
+		return
+	}
+
+	h.Audit.Record(c.Request.Context(), utils.AuditEvent{
+		Level:     utils.AuditInfo,
+		Message:   "Passkey removed",
+		UserID:    &passkey.UserID,
+		IPAddress: c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+		Context:   map[string]interface{}{"passkey_id": passkey.ID},
+	})
+
+	c.JSON(http.StatusOK, gin.H{"message": "Passkey deleted successfully"})
+}
+
+// BeginPasskeyLogin returns the options for navigator.credentials.get() for a passwordless
+// login. No account is named: the user picks one of the passkeys stored on their device.
+func (h *Handler) BeginPasskeyLogin(c *gin.Context) {
+	challenge, err := h.newPasskeyChallenge(c.Request.Context(), models.PasskeyPurposeLogin, nil)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start passkey login"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"publicKey": webauthn.CurrentConfig().RequestOptions(challenge, nil, webauthn.VerificationRequired)})
+}
+
+// FinishPasskeyLogin signs the user in with a passkey. The authenticator must have verified
+// the user (PIN or biometrics), so the passkey counts as both factors and no MFA step follows.
+func (h *Handler) FinishPasskeyLogin(c *gin.Context) {
+	var request models.PasskeyLoginRequest
+
+	// Bind JSON to struct
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data", "details": err.Error()})
+		return
+	}
+
+	_, challenge, err := h.consumePasskeyChallenge(c.Request.Context(), request.Credential.Response.ClientDataJSON, models.PasskeyPurposeLogin)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired passkey challenge"})
+		return
+	}
+
+	credentialID := request.Credential.RawID.String()
+	passkey, err := h.Passkeys.FindByCredentialHash(c.Request.Context(), utils.HashToken(credentialID))
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid passkey"})
+		return
+	}
+
+	// Discoverable credentials name the account they were created for
+	handle := request.Credential.Response.UserHandle
+	if len(handle) > 0 && string(handle) != string(webauthn.UserHandle(passkey.UserID)) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid passkey"})
+		return
+	}
+
+	user, err := h.Users.FindByID(c.Request.Context(), passkey.UserID)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid passkey"})
+		return
+	}
+
+	if !h.verifyPasskey(c, passkey, &request.Credential, challenge, true) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid passkey"})
+		return
+	}
+
+	// Check if user is active
+	if !user.IsActive {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User account is inactive"})
+		return
+	}
+
+	// Check if email is verified when the policy requires it to log in
+	if !user.IsVerified && config.Current().Account.EmailVerificationPolicy == config.VerificationLogin {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Email address not verified"})
+		return
+	}
+
+	h.respondWithTokens(c, user)
+}
+
+// BeginPasskeyMFA returns the options for navigator.credentials.get() for using a passkey
+// instead of a TOTP code in the second login step
+func (h *Handler) BeginPasskeyMFA(c *gin.Context) {
+	var request models.PasskeyMFABeginRequest
+
+	// Bind JSON to struct
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data", "details": err.Error()})
+		return
+	}
+
+	_, user, found := h.pendingMFAUser(c, request.MFAToken)
+	if !found {
+		return
+	}
+
+	allow, err := h.passkeyDescriptors(c.Request.Context(), user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get passkeys"})
+		return
+	}
+	if len(allow) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No passkeys registered"})
+		return
+	}
+
+	challenge, err := h.newPasskeyChallenge(c.Request.Context(), models.PasskeyPurposeMFA, &user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start passkey verification"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"publicKey": webauthn.CurrentConfig().RequestOptions(challenge, allow, webauthn.VerificationPreferred)})
+}
+
+// FinishPasskeyMFA completes a login started by a user with MFA enabled with one of their
+// passkeys, like VerifyMFA does with a code
+func (h *Handler) FinishPasskeyMFA(c *gin.Context) {
+	var request models.PasskeyMFARequest
+
+	// Bind JSON to struct
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data", "details": err.Error()})
+		return
+	}
+
+	claims, user, found := h.pendingMFAUser(c, request.MFAToken)
+	if !found {
+		return
+	}
+
+	pending, challenge, err := h.consumePasskeyChallenge(c.Request.Context(), request.Credential.Response.ClientDataJSON, models.PasskeyPurposeMFA)
+	if err != nil || pending.UserID == nil || *pending.UserID != user.ID {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired passkey challenge"})
+		return
+	}
+
+	credentialID := request.Credential.RawID.String()
+	passkey, err := h.Passkeys.FindByCredentialHash(c.Request.Context(), utils.HashToken(credentialID))
+	if err != nil || passkey.UserID != user.ID {
+		h.rejectMFAAttempt(c, claims, user, "Invalid passkey")
+		return
+	}
+
+	if !h.verifyPasskey(c, passkey, &request.Credential, challenge, false) {
+		h.rejectMFAAttempt(c, claims, user, "Invalid passkey")
+		return
+	}
+
+	h.completeMFA(c, claims, user)
+}
+
+// verifyPasskey checks an assertion against a stored passkey and records the new signature
+// counter. A counter that went backwards is audited as a possibly cloned authenticator.
+func (h *Handler) verifyPasskey(c *gin.Context, passkey *models.Passkey, credential *webauthn.AssertionCredential, challenge []byte, requireUV bool) bool {
+	assertion, err := webauthn.CurrentConfig().FinishAssertion(credential, challenge, passkey.PublicKey, passkey.SignCount, requireUV)
+	if errors.Is(err, webauthn.ErrSignCountRegression) {
+		h.Audit.Record(c.Request.Context(), utils.AuditEvent{
+			Level:     utils.AuditWarning,
+			Message:   "Passkey signature counter regression",
+			UserID:    &passkey.UserID,
+			IPAddress: c.ClientIP(),
+			UserAgent: c.Request.UserAgent(),
+			Context:   map[string]interface{}{"passkey_id": passkey.ID, "stored_sign_count": passkey.SignCount},
+		})
+	}
+	if err != nil {
+		return false
+	}
+
+	now := time.Now()
+	passkey.SignCount = assertion.SignCount
+	passkey.LastUsedAt = &now
+	if err := h.Passkeys.RecordUse(c.Request.Context(), passkey.ID, assertion.SignCount, now); err != nil {
+		return false
+	}
+	return true
+}
+
+// isLastSignInMethod reports whether the user has no password, no linked identity provider
+// and a single passkey, so that removing it would lock them out
+func (h *Handler) isLastSignInMethod(ctx context.Context, user *models.User) (bool, error) {
+	if user.HasPassword() {
+		return false, nil
+	}
+
+	passkeys, err := h.Passkeys.ListByUser(ctx, user.ID)
+	if err != nil || len(passkeys) > 1 {
+		return false, err
+	}
+
+	identities, err := h.Federation.ListIdentities(ctx, user.ID)
+	if err != nil {
+		return false, err
+	}
+	return len(identities) == 0, nil
+}
+
+// passkeyDescriptors lists the user's passkeys for the allow and exclude lists of ceremony options
+func (h *Handler) passkeyDescriptors(ctx context.Context, userID uint) ([]webauthn.CredentialDescriptor, error) {
+	passkeys, err := h.Passkeys.ListByUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	descriptors := []webauthn.CredentialDescriptor{}
+	for _, passkey := range passkeys {
+		id, err := webauthn.ParseBase64URL(passkey.CredentialID)
+		if err != nil {
+			continue
+		}
+		descriptors = append(descriptors, webauthn.CredentialDescriptor{Type: "public-key", ID: id, Transports: passkey.TransportList()})
+	}
+	return descriptors, nil
+}
+
+// newPasskeyChallenge starts a ceremony and stores it until the configured timeout
+func (h *Handler) newPasskeyChallenge(ctx context.Context, purpose string, userID *uint) ([]byte, error) {
+	challenge, err := webauthn.NewChallenge()
+	if err != nil {
+		return nil, err
+	}
+
+	// Abandoned ceremonies are dropped as new ones start
+	if err := h.Passkeys.DeleteExpiredChallenges(ctx, time.Now()); err != nil {
+		return nil, err
+	}
+
+	pending := models.WebAuthnChallenge{
+		ChallengeHash: utils.HashToken(string(challenge)),
+		Purpose:       purpose,
+		UserID:        userID,
+		ExpiresAt:     time.Now().Add(webauthn.CurrentConfig().Timeout),
+	}
+	if err := h.Passkeys.CreateChallenge(ctx, &pending); err != nil {
+		return nil, err
+	}
+	return challenge, nil
+}
+
+// consumePasskeyChallenge finds the ceremony answered by a client and deletes it, so that
+// every challenge is used at most once
+func (h *Handler) consumePasskeyChallenge(ctx context.Context, clientDataJSON []byte, purpose string) (*models.WebAuthnChallenge, []byte, error) {
+	challenge, err := webauthn.ChallengeOf(clientDataJSON)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	pending, err := h.Passkeys.ConsumeChallenge(ctx, utils.HashToken(string(challenge)), purpose)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, nil, errChallengeNotFound
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	return pending, challenge, nil
+}
+
+// findOwnPasskey loads the passkey from the URL that belongs to the current user,
+// writing the error response when it cannot be found
+func (h *Handler) findOwnPasskey(c *gin.Context) (*models.Passkey, bool) {
+	user := middleware.CurrentUser(c)
+
+	// Get passkey ID from URL parameter
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid passkey ID"})
+		return nil, false
+	}
+
+	passkey, err := h.Passkeys.FindByUser(c.Request.Context(), uint(id), user.ID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Passkey not found"})
+		return nil, false
+	}
+	return passkey, true
+}
@@ -0,0 +1,312 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"crud-example/middleware"
+	"crud-example/models"
+	"crud-example/utils"
+	"crud-example/webauthn"
+)
+
+// setupPasskeyRouter adds the passkey routes, the management ones behind AuthMiddleware as in
+// main, to the token routes
+func setupPasskeyRouter(h *Handler) *gin.Engine {
+	r := setupTokensRouter(h)
+
+	auth := r.Group("/api/auth")
+	{
+		auth.POST("/passkeys/login/begin", h.BeginPasskeyLogin)
+		auth.POST("/passkeys/login/finish", h.FinishPasskeyLogin)
+		auth.POST("/mfa/passkey/begin", h.BeginPasskeyMFA)
+		auth.POST("/mfa/passkey/finish", h.FinishPasskeyMFA)
+	}
+
+	passkeys := auth.Group("/passkeys")
+	passkeys.Use(middleware.AuthMiddleware(h.Authentication()), middleware.RequireTokenAuth(), middleware.RequireNoImpersonation())
+	{
+		passkeys.GET("", h.ListPasskeys)
+		passkeys.POST("/register/begin", h.BeginPasskeyRegistration)
+		passkeys.POST("/register/finish", h.FinishPasskeyRegistration)
+		passkeys.DELETE("/:id", h.DeletePasskey)
+	}
+	return r
+}
+
+// newTestAuthenticator returns a software authenticator for the default relying party
+func newTestAuthenticator(t *testing.T) *webauthn.SoftAuthenticator {
+	cfg := webauthn.CurrentConfig()
+	authenticator, err := webauthn.NewSoftAuthenticator(cfg.RPID, cfg.Origins[0])
+	require.NoError(t, err)
+	return authenticator
+}
+
+// beginPasskeyRegistration starts a registration for the user of the access token
+func beginPasskeyRegistration(t *testing.T, r http.Handler, accessToken string) *webauthn.CreationOptions {
+	w := performAuthorizedRequest(r, "POST", "/api/auth/passkeys/register/begin", accessToken, nil)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var response struct {
+		PublicKey webauthn.CreationOptions `json:"publicKey"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	return &response.PublicKey
+}
+
+func finishPasskeyRegistration(r http.Handler, accessToken string, credential *webauthn.RegistrationCredential) *httptest.ResponseRecorder {
+	return performAuthorizedRequest(r, "POST", "/api/auth/passkeys/register/finish", accessToken, map[string]interface{}{
+		"name":       "Laptop",
+		"credential": credential,
+	})
+}
+
+// registerPasskey registers the credential of the authenticator for the user of the access token
+func registerPasskey(t *testing.T, r http.Handler, accessToken string, authenticator *webauthn.SoftAuthenticator) models.PasskeyResponse {
+	w := finishPasskeyRegistration(r, accessToken, authenticator.Create(beginPasskeyRegistration(t, r, accessToken)))
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var response struct {
+		Passkey models.PasskeyResponse `json:"passkey"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	return response.Passkey
+}
+
+// requestOptions decodes the options of a ceremony started with navigator.credentials.get()
+func requestOptions(t *testing.T, w *httptest.ResponseRecorder) *webauthn.RequestOptions {
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var response struct {
+		PublicKey webauthn.RequestOptions `json:"publicKey"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	return &response.PublicKey
+}
+
+// assertPasskey answers the options with the authenticator
+func assertPasskey(t *testing.T, authenticator *webauthn.SoftAuthenticator, options *webauthn.RequestOptions) *webauthn.AssertionCredential {
+	credential, err := authenticator.Get(options)
+	require.NoError(t, err)
+	return credential
+}
+
+// passkeyLogin signs in with the authenticator
+func passkeyLogin(t *testing.T, r http.Handler, authenticator *webauthn.SoftAuthenticator) *httptest.ResponseRecorder {
+	options := requestOptions(t, performRequest(r, "POST", "/api/auth/passkeys/login/begin", nil))
+	credential := assertPasskey(t, authenticator, options)
+	return performRequest(r, "POST", "/api/auth/passkeys/login/finish", map[string]interface{}{"credential": credential})
+}
+
+func TestPasskeyRegistration(t *testing.T) {
+	h, stores := setupTestHandler()
+	r := setupPasskeyRouter(h)
+	user := createTestUser(t, h, "test@example.com", models.RoleUser)
+	createTestUser(t, h, "other@example.com", models.RoleUser)
+	accessToken, _ := loginTestUser(t, r, "test@example.com")
+	otherToken, _ := loginTestUser(t, r, "other@example.com")
+
+	authenticator := newTestAuthenticator(t)
+	passkey := registerPasskey(t, r, accessToken, authenticator)
+	assert.Equal(t, "Laptop", passkey.Name)
+	assert.Equal(t, []string{"internal"}, passkey.Transports)
+
+	// The registered credential is excluded from the next registrations and cannot be added twice
+	options := beginPasskeyRegistration(t, r, accessToken)
+	require.Len(t, options.ExcludeCredentials, 1)
+	assert.Equal(t, authenticator.CredentialID, []byte(options.ExcludeCredentials[0].ID))
+	w := finishPasskeyRegistration(r, accessToken, authenticator.Create(options))
+	assert.Equal(t, http.StatusConflict, w.Code, w.Body.String())
+
+	// A challenge only registers a passkey for the user it was issued to, in a registration
+	w = finishPasskeyRegistration(r, accessToken, newTestAuthenticator(t).Create(beginPasskeyRegistration(t, r, otherToken)))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "Invalid or expired passkey challenge")
+
+	login := requestOptions(t, performRequest(r, "POST", "/api/auth/passkeys/login/begin", nil))
+	w = finishPasskeyRegistration(r, accessToken, newTestAuthenticator(t).Create(&webauthn.CreationOptions{Challenge: login.Challenge}))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "Invalid or expired passkey challenge")
+
+	// and only once
+	credential := newTestAuthenticator(t).Create(beginPasskeyRegistration(t, r, accessToken))
+	require.Equal(t, http.StatusCreated, finishPasskeyRegistration(r, accessToken, credential).Code)
+	w = finishPasskeyRegistration(r, accessToken, credential)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "Invalid or expired passkey challenge")
+
+	w = performAuthorizedRequest(r, "GET", "/api/auth/passkeys", accessToken, nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	var list struct {
+		Passkeys []models.PasskeyResponse `json:"passkeys"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &list))
+	assert.Len(t, list.Passkeys, 2)
+
+	registered := stores.auditEvents("Passkey registered")
+	require.Len(t, registered, 2)
+	assert.Equal(t, &user.ID, registered[0].UserID)
+	assert.JSONEq(t, fmt.Sprintf(`{"passkey_id": %d}`, passkey.ID), registered[0].Context)
+}
+
+func TestPasskeyLogin(t *testing.T) {
+	h, _ := setupTestHandler()
+	r := setupPasskeyRouter(h)
+	createTestUser(t, h, "test@example.com", models.RoleUser)
+	accessToken, _ := loginTestUser(t, r, "test@example.com")
+	authenticator := newTestAuthenticator(t)
+	registerPasskey(t, r, accessToken, authenticator)
+
+	w := passkeyLogin(t, r, authenticator)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	passkeyToken, _ := decodeTokens(t, w.Body.Bytes())
+	w = performAuthorizedRequest(r, "GET", "/api/users/me", passkeyToken, nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "test@example.com")
+
+	// The passkey replaces both factors, so the authenticator must verify the user
+	authenticator.UserVerified = false
+	assert.Equal(t, http.StatusUnauthorized, passkeyLogin(t, r, authenticator).Code)
+	authenticator.UserVerified = true
+
+	// Unknown credentials are refused
+	assert.Equal(t, http.StatusUnauthorized, passkeyLogin(t, r, newTestAuthenticator(t)).Code)
+
+	// A challenge signs in once, and only in a login
+	options := requestOptions(t, performRequest(r, "POST", "/api/auth/passkeys/login/begin", nil))
+	credential := assertPasskey(t, authenticator, options)
+	require.Equal(t, http.StatusOK, performRequest(r, "POST", "/api/auth/passkeys/login/finish", map[string]interface{}{"credential": credential}).Code)
+	w = performRequest(r, "POST", "/api/auth/passkeys/login/finish", map[string]interface{}{"credential": credential})
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Contains(t, w.Body.String(), "Invalid or expired passkey challenge")
+
+	registration := beginPasskeyRegistration(t, r, accessToken)
+	credential = assertPasskey(t, authenticator, &webauthn.RequestOptions{Challenge: registration.Challenge})
+	w = performRequest(r, "POST", "/api/auth/passkeys/login/finish", map[string]interface{}{"credential": credential})
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Contains(t, w.Body.String(), "Invalid or expired passkey challenge")
+}
+
+func TestPasskeySignCountRegression(t *testing.T) {
+	h, stores := setupTestHandler()
+	r := setupPasskeyRouter(h)
+	user := createTestUser(t, h, "test@example.com", models.RoleUser)
+	accessToken, _ := loginTestUser(t, r, "test@example.com")
+	authenticator := newTestAuthenticator(t)
+	passkey := registerPasskey(t, r, accessToken, authenticator)
+
+	require.Equal(t, http.StatusOK, passkeyLogin(t, r, authenticator).Code)
+	require.Equal(t, http.StatusOK, passkeyLogin(t, r, authenticator).Code)
+
+	// A clone replays a counter that was already used
+	authenticator.SignCount = 1
+	assert.Equal(t, http.StatusUnauthorized, passkeyLogin(t, r, authenticator).Code)
+
+	events := stores.auditEvents("Passkey signature counter regression")
+	require.Len(t, events, 1)
+	assert.Equal(t, utils.AuditWarning, events[0].Level)
+	assert.Equal(t, &user.ID, events[0].UserID)
+	assert.JSONEq(t, fmt.Sprintf(`{"passkey_id": %d, "stored_sign_count": 2}`, passkey.ID), events[0].Context)
+
+	// The stored counter is not rolled back by the refused login
+	authenticator.SignCount = 2
+	assert.Equal(t, http.StatusOK, passkeyLogin(t, r, authenticator).Code)
+}
+
+func TestPasskeyMFA(t *testing.T) {
+	h, _ := setupTestHandler()
+	r := setupPasskeyRouter(h)
+	user := createTestUser(t, h, "test@example.com", models.RoleUser)
+	other := createTestUser(t, h, "other@example.com", models.RoleUser)
+	accessToken, _ := loginTestUser(t, r, "test@example.com")
+	authenticator := newTestAuthenticator(t)
+	registerPasskey(t, r, accessToken, authenticator)
+	enrollMFA(t, setupMFARouter(h, &user.ID))
+	enrollMFA(t, setupMFARouter(h, &other.ID))
+
+	beginMFA := func(mfaToken string) *httptest.ResponseRecorder {
+		return performRequest(r, "POST", "/api/auth/mfa/passkey/begin", map[string]interface{}{"mfa_token": mfaToken})
+	}
+	finishMFA := func(mfaToken string, credential *webauthn.AssertionCredential) *httptest.ResponseRecorder {
+		return performRequest(r, "POST", "/api/auth/mfa/passkey/finish", map[string]interface{}{"mfa_token": mfaToken, "credential": credential})
+	}
+
+	// Users without passkeys answer with their TOTP codes
+	otherMFAToken := startMFALogin(t, r, "other@example.com")
+	w := beginMFA(otherMFAToken)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "No passkeys registered")
+
+	mfaToken := startMFALogin(t, r, "test@example.com")
+	options := requestOptions(t, beginMFA(mfaToken))
+	require.Len(t, options.AllowCredentials, 1)
+	assert.Equal(t, authenticator.CredentialID, []byte(options.AllowCredentials[0].ID))
+
+	// The challenge is bound to the user of the pending login
+	w = finishMFA(otherMFAToken, assertPasskey(t, authenticator, options))
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Contains(t, w.Body.String(), "Invalid or expired passkey challenge")
+
+	// Passkeys of other accounts are refused
+	options = requestOptions(t, beginMFA(mfaToken))
+	w = finishMFA(mfaToken, assertPasskey(t, newTestAuthenticator(t), options))
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Contains(t, w.Body.String(), "Invalid passkey")
+
+	options = requestOptions(t, beginMFA(mfaToken))
+	w = finishMFA(mfaToken, assertPasskey(t, authenticator, options))
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	decodeTokens(t, w.Body.Bytes())
+
+	// The pending token is single use
+	assert.Equal(t, http.StatusUnauthorized, beginMFA(mfaToken).Code)
+}
+
+func TestDeletePasskey(t *testing.T) {
+	h, stores := setupTestHandler()
+	r := setupPasskeyRouter(h)
+	user := createTestUser(t, h, "test@example.com", models.RoleUser)
+	createTestUser(t, h, "other@example.com", models.RoleUser)
+	accessToken, _ := loginTestUser(t, r, "test@example.com")
+	otherToken, _ := loginTestUser(t, r, "other@example.com")
+
+	deletePasskey := func(id uint) *httptest.ResponseRecorder {
+		return performAuthorizedRequest(r, "DELETE", fmt.Sprintf("/api/auth/passkeys/%d", id), accessToken, nil)
+	}
+
+	first := registerPasskey(t, r, accessToken, newTestAuthenticator(t))
+	assert.Equal(t, http.StatusNotFound, performAuthorizedRequest(r, "DELETE", fmt.Sprintf("/api/auth/passkeys/%d", first.ID), otherToken, nil).Code)
+	assert.Equal(t, http.StatusBadRequest, performAuthorizedRequest(r, "DELETE", "/api/auth/passkeys/abc", accessToken, nil).Code)
+
+	// With a password, the last passkey can go
+	require.Equal(t, http.StatusOK, deletePasskey(first.ID).Code)
+	assert.Equal(t, http.StatusNotFound, deletePasskey(first.ID).Code)
+
+	removed := stores.auditEvents("Passkey removed")
+	require.Len(t, removed, 1)
+	assert.Equal(t, &user.ID, removed[0].UserID)
+	assert.JSONEq(t, fmt.Sprintf(`{"passkey_id": %d}`, first.ID), removed[0].Context)
+
+	// Without one, it is the only way left to sign in
+	second := registerPasskey(t, r, accessToken, newTestAuthenticator(t))
+	replaced, err := h.Users.ReplacePassword(context.Background(), user.ID, user.Password, "")
+	require.NoError(t, err)
+	require.True(t, replaced)
+
+	w := deletePasskey(second.ID)
+	assert.Equal(t, http.StatusConflict, w.Code)
+	assert.Contains(t, w.Body.String(), "Cannot delete the last passkey")
+
+	third := registerPasskey(t, r, accessToken, newTestAuthenticator(t))
+	require.Equal(t, http.StatusOK, deletePasskey(second.ID).Code)
+	assert.Equal(t, http.StatusConflict, deletePasskey(third.ID).Code)
+
+	// A linked identity provider is another way
+	require.NoError(t, h.Federation.CreateIdentity(context.Background(), &models.FederatedIdentity{UserID: user.ID, Provider: "google", Subject: "1234"}))
+	assert.Equal(t, http.StatusOK, deletePasskey(third.ID).Code)
+	assert.Len(t, stores.auditEvents("Passkey removed"), 3)
+}
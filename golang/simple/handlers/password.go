@@ -0,0 +1,324 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"crud-example/config"
+	"crud-example/mailer"
+	"crud-example/middleware"
+	"crud-example/models"
+	"crud-example/utils"
+)
+
+// forgotPasswordMessage is returned whether or not the email is registered
+const forgotPasswordMessage = "If the email is registered, a password reset link has been sent"
+
+// ForgotPassword emails a single-use password reset link to an active user, throttled per
+// user. The response never reveals whether the email address is registered or was throttled.
+func (h *Handler) ForgotPassword(c *gin.Context) {
+	var request models.ForgotPasswordRequest
+
+	// Bind JSON to struct
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data", "details": err.Error()})
+		return
+	}
+
+	// The lookup and the email happen after responding, so the response time is the same
+	// whether or not the email is registered
+	h.inBackground(c.Request.Context(), func(ctx context.Context) {
+		user, err := h.Users.FindByEmail(ctx, request.Email)
+		if err != nil || !user.IsActive {
+			return
+		}
+
+		throttled, err := h.passwordResetThrottled(ctx, user.ID)
+		if err != nil {
+			log.Printf("Failed to check password reset throttle for user %d: %v", user.ID, err)
+			return
+		}
+		if throttled {
+			return
+		}
+
+		if err := h.sendPasswordReset(ctx, user); err != nil {
+			log.Printf("Failed to send password reset to user %d: %v", user.ID, err)
+		}
+	})
+
+	c.JSON(http.StatusAccepted, gin.H{"message": forgotPasswordMessage})
+}
+
+// passwordResetThrottled reports whether too many reset links were sent to the user in the
+// last hour (PASSWORD_RESET_MAX_PER_HOUR, default 5)
+func (h *Handler) passwordResetThrottled(ctx context.Context, userID uint) (bool, error) {
+	lastHour, err := h.PasswordResets.CountSince(ctx, userID, time.Now().Add(-time.Hour))
+	if err != nil {
+		return false, err
+	}
+	return lastHour >= int64(config.Current().Tokens.PasswordResetMaxPerHour), nil
+}
+
+// sendPasswordReset replaces any pending reset token of the user and emails the new one
+func (h *Handler) sendPasswordReset(ctx context.Context, user *models.User) error {
+	token, err := utils.GenerateRandomToken(32)
+	if err != nil {
+		return err
+	}
+
+	// Only the latest reset link stays valid. Earlier links are expired rather than deleted
+	// so that they still count towards the throttle.
+	if err := h.PasswordResets.ExpirePending(ctx, user.ID); err != nil {
+		return err
+	}
+
+	ttl := config.Current().Tokens.PasswordResetExpiration
+	resetToken := models.PasswordResetToken{
+		UserID:    user.ID,
+		TokenHash: utils.HashToken(token),
+		ExpiresAt: time.Now().Add(ttl),
+	}
+	if err := h.PasswordResets.Create(ctx, &resetToken); err != nil {
+		return err
+	}
+
+	link := appURL("/reset-password", url.Values{"token": {token}})
+	return mailer.Send(mailer.Message{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf("Hi %s,\n\nUse the following link to choose a new password. It expires in %s and can only be used once.\n\n%s\n\nIf you did not request a password reset you can ignore this email.\n",
+			user.Name, ttl, link),
+	})
+}
+
+// checkPasswordPolicy validates a new password against the password policy. personal holds
+// the user's name and email. Rejected passwords are answered with the violated rules.
+func checkPasswordPolicy(c *gin.Context, password string, personal ...string) bool {
+	violations := utils.CurrentPasswordPolicy().Check(password, personal...)
+	if len(violations) == 0 {
+		return true
+	}
+
+	c.JSON(http.StatusBadRequest, gin.H{
+		"error":      "Password does not meet the password policy",
+		"violations": violations,
+	})
+	return false
+}
+
+// passwordHistoryLimit returns how many recent passwords, the current one included, cannot
+// be reused (PASSWORD_HISTORY, default 5)
+func passwordHistoryLimit() int {
+	return config.Current().Password.History
+}
+
+// checkPasswordHistory rejects a new password matching the user's current password or one
+// of the previous ones kept in the history, answering with the same shape as policy violations
+func (h *Handler) checkPasswordHistory(c *gin.Context, user *models.User, password string) bool {
+	reused := utils.CheckPassword(password, user.Password)
+
+	if !reused {
+		history, err := h.Users.PasswordHistory(c.Request.Context(), user.ID, passwordHistoryLimit()-1)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check password history"})
+			return false
+		}
+		for _, hash := range history {
+			if utils.CheckPassword(password, hash) {
+				reused = true
+				break
+			}
+		}
+	}
+
+	if !reused {
+		return true
+	}
+	c.JSON(http.StatusBadRequest, gin.H{
+		"error": "Password does not meet the password policy",
+		"violations": []utils.PasswordViolation{{
+			Rule:    utils.RuleHistory,
+			Message: fmt.Sprintf("Password must differ from your last %d passwords", passwordHistoryLimit()),
+		}},
+	})
+	return false
+}
+
+// setPassword replaces the user's password, moving the previous hash to the password history
+// and dropping history entries that are no longer checked
+func (h *Handler) setPassword(ctx context.Context, user *models.User, password string) error {
+	hashedPassword, err := utils.HashPassword(password)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	if err := h.Users.ChangePassword(ctx, user.ID, user.Password, hashedPassword, now, passwordHistoryLimit()); err != nil {
+		return err
+	}
+
+	user.Password = hashedPassword
+	user.PasswordChangedAt = &now
+	return nil
+}
+
+// confirmPassword checks the current password of an authenticated user before a sensitive
+// change. Wrong passwords count as failed logins, so a stolen token cannot be used to guess it.
+func (h *Handler) confirmPassword(c *gin.Context, user *models.User, password string) bool {
+	identifiers := loginIdentifiers(c, user.Email)
+	if status, message := h.loginRefusal(c, identifiers); status != 0 {
+		c.JSON(status, gin.H{"error": message})
+		return false
+	}
+
+	if !utils.CheckPassword(password, user.Password) {
+		h.recordLoginFailure(c, identifiers, &user.ID)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Current password is incorrect"})
+		return false
+	}
+	h.resetLoginFailures(c.Request.Context(), identifiers)
+	return true
+}
+
+// ChangePassword changes the current user's password after checking the current one.
+// Every other session is signed out; the current one continues with the returned access token.
+func (h *Handler) ChangePassword(c *gin.Context) {
+	user := middleware.CurrentUser(c)
+	claims := c.MustGet("claims").(*utils.Claims)
+	var request models.ChangePasswordRequest
+
+	// Bind JSON to struct
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data", "details": err.Error()})
+		return
+	}
+
+	if !h.confirmPassword(c, &user, request.CurrentPassword) {
+		return
+	}
+
+	if !checkPasswordPolicy(c, request.NewPassword, user.Name, user.Email) {
+		return
+	}
+	if !h.checkPasswordHistory(c, &user, request.NewPassword) {
+		return
+	}
+
+	if err := h.setPassword(c.Request.Context(), &user, request.NewPassword); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to change password"})
+		return
+	}
+
+	if err := h.revokeOtherSessions(c.Request.Context(), user.ID, claims.SessionID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke sessions"})
+		return
+	}
+
+	// The access token used for this request was revoked with the others
+	token, err := utils.GenerateSessionToken(user.ID, user.Email, user.Role, claims.SessionID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		return
+	}
+
+	h.Audit.Record(c.Request.Context(), utils.AuditEvent{
+		Level:     utils.AuditInfo,
+		Message:   "Password changed",
+		UserID:    &user.ID,
+		IPAddress: c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+	})
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":    "Password changed successfully",
+		"token":      token,
+		"token_type": "Bearer",
+		"expires_in": int(utils.AccessTokenTTL().Seconds()),
+	})
+}
+
+// upgradePasswordHash rehashes the password of a user who just proved it when the stored
+// hash uses an outdated algorithm or parameters. Failures only postpone the upgrade.
+func (h *Handler) upgradePasswordHash(ctx context.Context, user *models.User, password string) {
+	if !utils.PasswordNeedsRehash(user.Password) {
+		return
+	}
+
+	hashedPassword, err := utils.HashPassword(password)
+	if err != nil {
+		log.Printf("Failed to rehash password of user %d: %v", user.ID, err)
+		return
+	}
+
+	// Only replace the hash that was just verified, in case the password changed meanwhile
+	replaced, err := h.Users.ReplacePassword(ctx, user.ID, user.Password, hashedPassword)
+	if err != nil {
+		log.Printf("Failed to store rehashed password of user %d: %v", user.ID, err)
+		return
+	}
+	if !replaced {
+		return
+	}
+	user.Password = hashedPassword
+}
+
+// ResetPassword sets a new password using a reset token and revokes every existing session
+func (h *Handler) ResetPassword(c *gin.Context) {
+	var request models.ResetPasswordRequest
+
+	// Bind JSON to struct
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data", "details": err.Error()})
+		return
+	}
+
+	resetToken, err := h.PasswordResets.FindUnused(c.Request.Context(), utils.HashToken(request.Token))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired reset token"})
+		return
+	}
+
+	user, err := h.Users.FindActiveByID(c.Request.Context(), resetToken.UserID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired reset token"})
+		return
+	}
+
+	// Rejected passwords leave the token usable so the user can pick another one
+	if !checkPasswordPolicy(c, request.Password, user.Name, user.Email) {
+		return
+	}
+	if !h.checkPasswordHistory(c, user, request.Password) {
+		return
+	}
+
+	// Consume the token; the condition makes concurrent uses of the same token fail
+	used, err := h.PasswordResets.MarkUsed(c.Request.Context(), resetToken.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reset password"})
+		return
+	}
+	if !used {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired reset token"})
+		return
+	}
+
+	if err := h.setPassword(c.Request.Context(), user, request.Password); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reset password"})
+		return
+	}
+
+	// Sessions opened with the old password must not survive the reset
+	if err := h.revokeUserSessions(c.Request.Context(), user.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke sessions"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Password reset successfully"})
+}
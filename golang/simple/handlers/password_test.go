@@ -0,0 +1,201 @@
+package handlers
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"crud-example/config"
+	"crud-example/mailer"
+	"crud-example/middleware"
+	"crud-example/models"
+	"crud-example/utils"
+)
+
+func setupPasswordRouter(h *Handler) *gin.Engine {
+	r := gin.New()
+
+	password := r.Group("/api/auth/password")
+	{
+		password.POST("/forgot", h.ForgotPassword)
+		password.POST("/reset", h.ResetPassword)
+	}
+
+	return r
+}
+
+// sentTo counts the emails sent to the address
+func sentTo(mail *mailer.MemoryMailer, to string) int {
+	count := 0
+	for _, msg := range mail.Messages() {
+		if msg.To == to {
+			count++
+		}
+	}
+	return count
+}
+
+func TestForgotPassword(t *testing.T) {
+	h, mail := setupDBTestHandler(t)
+	r := setupPasswordRouter(h)
+	createTestUser(t, h, "test@example.com", models.RoleUser)
+
+	forgot := func(email string) {
+		w := performRequest(r, "POST", "/api/auth/password/forgot", map[string]interface{}{"email": email})
+		require.Equal(t, http.StatusAccepted, w.Code)
+		assert.Contains(t, w.Body.String(), forgotPasswordMessage)
+		h.background.Wait()
+	}
+
+	// Unknown emails get the same answer and no email
+	forgot("unknown@example.com")
+	assert.Empty(t, mail.Messages())
+
+	forgot("test@example.com")
+	first := mailedLink(t, mail, "test@example.com").Query().Get("token")
+	require.NotEmpty(t, first)
+
+	// Five links per hour are sent, further requests are answered but dropped
+	for i := 0; i < 5; i++ {
+		forgot("test@example.com")
+	}
+	assert.Equal(t, 5, sentTo(mail, "test@example.com"))
+	last := mailedLink(t, mail, "test@example.com").Query().Get("token")
+
+	reset := func(token string) int {
+		return performRequest(r, "POST", "/api/auth/password/reset", map[string]interface{}{
+			"token":    token,
+			"password": "Correct-Horse-9-Battery",
+		}).Code
+	}
+
+	// Only the latest link works, and only once
+	assert.Equal(t, http.StatusBadRequest, reset(first))
+	assert.Equal(t, http.StatusOK, reset(last))
+	assert.Equal(t, http.StatusBadRequest, reset(last))
+}
+
+// setupChangePasswordRouter adds the password change, behind AuthMiddleware, to the token
+// routes
+func setupChangePasswordRouter(h *Handler) *gin.Engine {
+	r := setupTokensRouter(h)
+	r.PUT("/api/users/me/password", middleware.AuthMiddleware(h.Authentication()), middleware.RequireTokenAuth(), h.ChangePassword)
+	return r
+}
+
+// useBreachedPasswords makes the password policy reject the given passwords as breached
+func useBreachedPasswords(t *testing.T, passwords ...string) {
+	dir := t.TempDir()
+	for _, password := range passwords {
+		sum := sha1.Sum([]byte(password))
+		hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, hash[:5]), []byte(hash[5:]+":42\r\n"), 0o600))
+	}
+
+	policy, err := utils.PasswordPolicyFromConfig(config.Current().Password)
+	require.NoError(t, err)
+	policy.Breached = utils.NewBreachedPasswords(dir, 1)
+	utils.SetPasswordPolicy(policy)
+	t.Cleanup(func() { utils.SetPasswordPolicy(nil) })
+}
+
+// violatedRules returns the rules reported by a policy rejection
+func violatedRules(t *testing.T, body []byte) []string {
+	var response struct {
+		Violations []utils.PasswordViolation `json:"violations"`
+	}
+	require.NoError(t, json.Unmarshal(body, &response))
+	rules := []string{}
+	for _, v := range response.Violations {
+		rules = append(rules, v.Rule)
+	}
+	return rules
+}
+
+func TestChangePassword(t *testing.T) {
+	h, stores := setupTestHandler()
+	r := setupChangePasswordRouter(h)
+	user := createTestUser(t, h, "test@example.com", models.RoleUser)
+	useBreachedPasswords(t, "Breached-Pa55word!")
+
+	// Two sessions, the password is changed from the first
+	accessToken, refreshToken := loginTestUser(t, r, "test@example.com")
+	otherAccessToken, otherRefreshToken := loginTestUser(t, r, "test@example.com")
+
+	change := func(current, next string) *httptest.ResponseRecorder {
+		return performAuthorizedRequest(r, "PUT", "/api/users/me/password", accessToken, map[string]interface{}{
+			"current_password": current,
+			"new_password":     next,
+		})
+	}
+
+	tests := []struct {
+		name       string
+		current    string
+		next       string
+		wantStatus int
+		wantRules  []string
+	}{
+		{name: "Wrong current password", current: "wrong-password", next: "Correct-Horse-9-Battery", wantStatus: http.StatusUnauthorized},
+		{name: "Too short", current: "Tr0ub4dor&3x", next: "Sh0rt!", wantStatus: http.StatusBadRequest, wantRules: []string{utils.RuleMinLength}},
+		{name: "Personal information", current: "Tr0ub4dor&3x", next: "test@example.com1", wantStatus: http.StatusBadRequest, wantRules: []string{utils.RulePersonalInfo}},
+		{name: "Breached", current: "Tr0ub4dor&3x", next: "Breached-Pa55word!", wantStatus: http.StatusBadRequest, wantRules: []string{utils.RuleBreached}},
+		{name: "Current password", current: "Tr0ub4dor&3x", next: "Tr0ub4dor&3x", wantStatus: http.StatusBadRequest, wantRules: []string{utils.RuleHistory}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := change(tt.current, tt.next)
+			require.Equal(t, tt.wantStatus, w.Code, w.Body.String())
+			if tt.wantRules != nil {
+				assert.Equal(t, tt.wantRules, violatedRules(t, w.Body.Bytes()))
+			}
+		})
+	}
+
+	// Rejected changes leave the password and the sessions alone
+	assert.Equal(t, http.StatusOK, performAuthorizedRequest(r, "GET", "/api/users/me", otherAccessToken, nil).Code)
+	unchanged, err := h.Users.FindByID(context.Background(), user.ID)
+	require.NoError(t, err)
+	assert.True(t, utils.CheckPassword("Tr0ub4dor&3x", unchanged.Password))
+
+	w := change("Tr0ub4dor&3x", "Correct-Horse-9-Battery")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var response struct {
+		Token string `json:"token"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	require.NotEmpty(t, response.Token)
+
+	// The other session is closed: its access token and its refresh token are rejected
+	assert.Equal(t, http.StatusUnauthorized, performAuthorizedRequest(r, "GET", "/api/users/me", otherAccessToken, nil).Code)
+	assert.Equal(t, http.StatusUnauthorized, refresh(r, otherRefreshToken).Code)
+
+	// The current session goes on with the new access token and its refresh token
+	assert.Equal(t, http.StatusUnauthorized, performAuthorizedRequest(r, "GET", "/api/users/me", accessToken, nil).Code)
+	assert.Equal(t, http.StatusOK, performAuthorizedRequest(r, "GET", "/api/users/me", response.Token, nil).Code)
+	w = refresh(r, refreshToken)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	accessToken, _ = decodeTokens(t, w.Body.Bytes())
+
+	// The previous password is kept in the history
+	w = change("Correct-Horse-9-Battery", "Tr0ub4dor&3x")
+	require.Equal(t, http.StatusBadRequest, w.Code, w.Body.String())
+	assert.Equal(t, []string{utils.RuleHistory}, violatedRules(t, w.Body.Bytes()))
+
+	w = performRequest(r, "POST", "/api/auth/login", map[string]interface{}{"email": "test@example.com", "password": "Correct-Horse-9-Battery"})
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	changed := stores.auditEvents("Password changed")
+	require.Len(t, changed, 1)
+	assert.Equal(t, &user.ID, changed[0].UserID)
+}
@@ -0,0 +1,179 @@
+package handlers
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"crud-example/config"
+	"crud-example/middleware"
+	"crud-example/models"
+	"crud-example/utils"
+)
+
+// accountDeletionGracePeriod is how long a requested account deletion can still be cancelled
+func accountDeletionGracePeriod() time.Duration {
+	return config.Current().Account.DeletionGracePeriod
+}
+
+// GetProfile returns the current user
+func (h *Handler) GetProfile(c *gin.Context) {
+	user := middleware.CurrentUser(c)
+	c.JSON(http.StatusOK, user.ToResponse())
+}
+
+// UpdateProfile updates the current user's own account
+func (h *Handler) UpdateProfile(c *gin.Context) {
+	user := middleware.CurrentUser(c)
+	var profileUpdate models.ProfileUpdate
+
+	// Bind JSON to struct
+	if err := c.ShouldBindJSON(&profileUpdate); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data", "details": err.Error()})
+		return
+	}
+
+	emailChanged := profileUpdate.Email != nil && *profileUpdate.Email != user.Email
+	if emailChanged {
+		// Password resets go to the new address, so changing it needs the password like
+		// deleting the account does
+		if profileUpdate.CurrentPassword == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Current password is required to change the email"})
+			return
+		}
+		if !h.confirmPassword(c, &user, profileUpdate.CurrentPassword) {
+			return
+		}
+		if h.emailTaken(c.Request.Context(), *profileUpdate.Email, user.ID) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Email already registered"})
+			return
+		}
+	}
+
+	// Update user fields
+	if profileUpdate.Name != nil {
+		user.Name = *profileUpdate.Name
+	}
+	if emailChanged {
+		user.Email = *profileUpdate.Email
+		user.IsVerified = false
+	}
+	if profileUpdate.Age != nil {
+		user.Age = profileUpdate.Age
+	}
+
+	// Save changes
+	if err := h.Users.Save(c.Request.Context(), &user); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update profile"})
+		return
+	}
+
+	// A changed email address has to be verified again
+	if emailChanged {
+		if err := h.sendVerificationEmail(c.Request.Context(), &user); err != nil {
+			log.Printf("Failed to send verification email to user %d: %v", user.ID, err)
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Profile updated successfully",
+		"user":    user.ToResponse(),
+	})
+}
+
+// DeleteProfile schedules the deletion of the current user's account after confirming the
+// password. The account stays usable until the grace period ends, so it can be cancelled.
+func (h *Handler) DeleteProfile(c *gin.Context) {
+	user := middleware.CurrentUser(c)
+	var request models.AccountDeletionRequest
+
+	// Bind JSON to struct
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data", "details": err.Error()})
+		return
+	}
+
+	if !h.confirmPassword(c, &user, request.Password) {
+		return
+	}
+
+	// Repeated requests keep the original schedule
+	if user.DeletionDueAt == nil {
+		dueAt := time.Now().Add(accountDeletionGracePeriod())
+		if err := h.Users.ScheduleDeletion(c.Request.Context(), user.ID, &dueAt); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to schedule account deletion"})
+			return
+		}
+		user.DeletionDueAt = &dueAt
+
+		h.Audit.Record(c.Request.Context(), utils.AuditEvent{
+			Level:     utils.AuditInfo,
+			Message:   "Account deletion requested",
+			UserID:    &user.ID,
+			IPAddress: c.ClientIP(),
+			UserAgent: c.Request.UserAgent(),
+			Context:   map[string]interface{}{"deletion_due_at": dueAt},
+		})
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"message": "Account scheduled for deletion",
+		"user":    user.ToResponse(),
+	})
+}
+
+// CancelProfileDeletion cancels a pending deletion of the current user's account
+func (h *Handler) CancelProfileDeletion(c *gin.Context) {
+	user := middleware.CurrentUser(c)
+
+	if user.DeletionDueAt == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No account deletion pending"})
+		return
+	}
+
+	if err := h.Users.ScheduleDeletion(c.Request.Context(), user.ID, nil); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to cancel account deletion"})
+		return
+	}
+	user.DeletionDueAt = nil
+
+	h.Audit.Record(c.Request.Context(), utils.AuditEvent{
+		Level:     utils.AuditInfo,
+		Message:   "Account deletion cancelled",
+		UserID:    &user.ID,
+		IPAddress: c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+	})
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Account deletion cancelled",
+		"user":    user.ToResponse(),
+	})
+}
+
+// DeactivateDueAccounts deactivates the accounts whose deletion grace period ended and
+// revokes their tokens, the same way DeleteUser does for administrators
+func (h *Handler) DeactivateDueAccounts(ctx context.Context) error {
+	users, err := h.Users.ListDueForDeletion(ctx, time.Now())
+	if err != nil {
+		return err
+	}
+
+	for _, user := range users {
+		if err := h.Users.Deactivate(ctx, user.ID); err != nil {
+			return err
+		}
+		if err := h.revokeUserSessions(ctx, user.ID); err != nil {
+			return err
+		}
+
+		h.Audit.Record(ctx, utils.AuditEvent{
+			Level:   utils.AuditInfo,
+			Message: "Account deleted",
+			UserID:  &user.ID,
+		})
+	}
+	return nil
+}
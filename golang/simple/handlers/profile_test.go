@@ -0,0 +1,166 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"crud-example/models"
+)
+
+// setupProfileRouter serves the profile endpoints, authenticating them as the user with userID
+func setupProfileRouter(h *Handler, userID uint) *gin.Engine {
+	r := gin.New()
+
+	r.POST("/api/auth/login", h.Login)
+
+	current := func(c *gin.Context) {
+		user, err := h.Users.FindByID(c.Request.Context(), userID)
+		if err != nil {
+			c.AbortWithStatus(http.StatusUnauthorized)
+			return
+		}
+		c.Set("user", *user)
+		c.Next()
+	}
+	profile := r.Group("/api/users/me", current)
+	{
+		profile.PATCH("", h.UpdateProfile)
+		profile.DELETE("", h.DeleteProfile)
+		profile.POST("/deletion/cancel", h.CancelProfileDeletion)
+	}
+
+	return r
+}
+
+func TestUpdateProfileEmail(t *testing.T) {
+	h, mail := setupDBTestHandler(t)
+	user := createTestUser(t, h, "test@example.com", models.RoleUser)
+	user.IsVerified = true
+	require.NoError(t, h.Users.Save(context.Background(), &user))
+	r := setupProfileRouter(h, user.ID)
+
+	// Other fields change without the password
+	w := performRequest(r, "PATCH", "/api/users/me", map[string]interface{}{"name": "New Name"})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	tests := []struct {
+		name          string
+		payload       map[string]interface{}
+		expectedCode  int
+		expectedError string
+	}{
+		{
+			name:          "Missing password",
+			payload:       map[string]interface{}{"email": "new@example.com"},
+			expectedCode:  http.StatusBadRequest,
+			expectedError: "Current password is required",
+		},
+		{
+			name:          "Wrong password",
+			payload:       map[string]interface{}{"email": "new@example.com", "current_password": "wrong-password"},
+			expectedCode:  http.StatusUnauthorized,
+			expectedError: "Current password is incorrect",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := performRequest(r, "PATCH", "/api/users/me", tt.payload)
+			assert.Equal(t, tt.expectedCode, w.Code)
+			assert.Contains(t, w.Body.String(), tt.expectedError)
+		})
+	}
+	assert.Empty(t, mail.Messages())
+
+	w = performRequest(r, "PATCH", "/api/users/me", map[string]interface{}{"email": "new@example.com", "current_password": "Tr0ub4dor&3x"})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	// The new address has to be verified again
+	updated, err := h.Users.FindByID(context.Background(), user.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "new@example.com", updated.Email)
+	assert.Equal(t, "New Name", updated.Name)
+	assert.False(t, updated.IsVerified)
+	assert.Equal(t, 1, sentTo(mail, "new@example.com"))
+}
+
+func TestDeleteProfile(t *testing.T) {
+	h, _ := setupDBTestHandler(t)
+	user := createTestUser(t, h, "test@example.com", models.RoleUser)
+	r := setupProfileRouter(h, user.ID)
+
+	w := performRequest(r, "POST", "/api/users/me/deletion/cancel", nil)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "No account deletion pending")
+
+	w = performRequest(r, "DELETE", "/api/users/me", map[string]interface{}{"password": "wrong-password"})
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	dueAt := func(body []byte) *time.Time {
+		var response struct {
+			User models.UserResponse `json:"user"`
+		}
+		require.NoError(t, json.Unmarshal(body, &response))
+		return response.User.DeletionDueAt
+	}
+
+	w = performRequest(r, "DELETE", "/api/users/me", map[string]interface{}{"password": "Tr0ub4dor&3x"})
+	require.Equal(t, http.StatusAccepted, w.Code, w.Body.String())
+	scheduled := dueAt(w.Body.Bytes())
+	require.NotNil(t, scheduled)
+	assert.WithinDuration(t, time.Now().Add(accountDeletionGracePeriod()), *scheduled, time.Minute)
+
+	// Repeated requests keep the original schedule
+	w = performRequest(r, "DELETE", "/api/users/me", map[string]interface{}{"password": "Tr0ub4dor&3x"})
+	require.Equal(t, http.StatusAccepted, w.Code, w.Body.String())
+	assert.True(t, scheduled.Equal(*dueAt(w.Body.Bytes())))
+
+	w = performRequest(r, "POST", "/api/users/me/deletion/cancel", nil)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Nil(t, dueAt(w.Body.Bytes()))
+
+	cancelled, err := h.Users.FindByID(context.Background(), user.ID)
+	require.NoError(t, err)
+	assert.Nil(t, cancelled.DeletionDueAt)
+}
+
+func TestDeactivateDueAccounts(t *testing.T) {
+	h, _ := setupDBTestHandler(t)
+	due := createTestUser(t, h, "due@example.com", models.RoleUser)
+	pending := createTestUser(t, h, "pending@example.com", models.RoleUser)
+	r := setupProfileRouter(h, due.ID)
+	loginTestUser(t, r, "due@example.com")
+	loginTestUser(t, r, "pending@example.com")
+
+	ctx := context.Background()
+	past, future := time.Now().Add(-time.Minute), time.Now().Add(time.Hour)
+	require.NoError(t, h.Users.ScheduleDeletion(ctx, due.ID, &past))
+	require.NoError(t, h.Users.ScheduleDeletion(ctx, pending.ID, &future))
+
+	require.NoError(t, h.DeactivateDueAccounts(ctx))
+
+	activeSessions := func(userID uint) int {
+		active, err := h.Sessions.ListActive(ctx, userID)
+		require.NoError(t, err)
+		return len(active)
+	}
+
+	// Only the account whose grace period ended is deactivated and signed out
+	deactivated, err := h.Users.FindByID(ctx, due.ID)
+	require.NoError(t, err)
+	assert.False(t, deactivated.IsActive)
+	assert.Nil(t, deactivated.DeletionDueAt)
+	assert.Zero(t, activeSessions(due.ID))
+
+	kept, err := h.Users.FindByID(ctx, pending.ID)
+	require.NoError(t, err)
+	assert.True(t, kept.IsActive)
+	assert.NotNil(t, kept.DeletionDueAt)
+	assert.Equal(t, 1, activeSessions(pending.ID))
+}
@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"crud-example/middleware"
+	"crud-example/models"
+	"crud-example/utils"
+)
+
+// ListSessions returns the active sessions (signed-in devices and authorized applications)
+// of the current user, most recently used first
+func (h *Handler) ListSessions(c *gin.Context) {
+	user := middleware.CurrentUser(c)
+	claims := c.MustGet("claims").(*utils.Claims)
+
+	sessions, err := h.Sessions.ListActive(c.Request.Context(), user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get sessions"})
+		return
+	}
+
+	responses := []models.UserSessionResponse{}
+	for _, session := range sessions {
+		response := session.ToResponse()
+		response.Current = session.SessionToken == claims.SessionID
+
+		// Include recent activity that has not been written yet
+		if seen, ok := h.SessionTracker.LastSeen(session.SessionToken); ok && (response.LastSeenAt == nil || seen.After(*response.LastSeenAt)) {
+			response.LastSeenAt = &seen
+		}
+		responses = append(responses, response)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"sessions": responses})
+}
+
+// RevokeSession signs out one session of the current user. Access tokens bound to it are
+// rejected from then on and its refresh token can no longer be used.
+func (h *Handler) RevokeSession(c *gin.Context) {
+	user := middleware.CurrentUser(c)
+	claims := c.MustGet("claims").(*utils.Claims)
+
+	// Get session ID from URL parameter
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid session ID"})
+		return
+	}
+
+	session, err := h.Sessions.FindActiveByUser(c.Request.Context(), uint(id), user.ID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Session not found"})
+		return
+	}
+
+	if err := h.revokeSession(c.Request.Context(), session); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke session"})
+		return
+	}
+
+	h.Audit.Record(c.Request.Context(), utils.AuditEvent{
+		Level:     utils.AuditInfo,
+		Message:   "Session revoked",
+		UserID:    &user.ID,
+		IPAddress: c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+		Context: map[string]interface{}{
+			"session_id": session.ID,
+			"current":    session.SessionToken == claims.SessionID,
+		},
+	})
+
+	c.JSON(http.StatusOK, gin.H{"message": "Session revoked successfully"})
+}
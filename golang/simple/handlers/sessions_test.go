@@ -0,0 +1,119 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"crud-example/middleware"
+	"crud-example/models"
+)
+
+// setupSessionsRouter adds the session routes, behind AuthMiddleware as in main, to the
+// token routes
+func setupSessionsRouter(h *Handler) *gin.Engine {
+	r := setupTokensRouter(h)
+	sessions := r.Group("/api/users/me/sessions")
+	sessions.Use(middleware.AuthMiddleware(h.Authentication()), middleware.RequireTokenAuth())
+	{
+		sessions.GET("", h.ListSessions)
+		sessions.DELETE("/:id", h.RevokeSession)
+	}
+	return r
+}
+
+// listSessions returns the sessions listed with the access token
+func listSessions(t *testing.T, r http.Handler, accessToken string) []models.UserSessionResponse {
+	w := performAuthorizedRequest(r, "GET", "/api/users/me/sessions", accessToken, nil)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var response struct {
+		Sessions []models.UserSessionResponse `json:"sessions"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	return response.Sessions
+}
+
+// currentSession returns the session flagged as the one of the request
+func currentSession(t *testing.T, sessions []models.UserSessionResponse) models.UserSessionResponse {
+	var current []models.UserSessionResponse
+	for _, session := range sessions {
+		if session.Current {
+			current = append(current, session)
+		}
+	}
+	require.Len(t, current, 1)
+	return current[0]
+}
+
+func TestListSessions(t *testing.T) {
+	h, _ := setupTestHandler()
+	r := setupSessionsRouter(h)
+	createTestUser(t, h, "test@example.com", models.RoleUser)
+	createTestUser(t, h, "other@example.com", models.RoleUser)
+
+	firstToken, _ := loginTestUser(t, r, "test@example.com")
+	secondToken, _ := loginTestUser(t, r, "test@example.com")
+	loginTestUser(t, r, "other@example.com")
+
+	// Only the user's sessions are listed, with the one of the request flagged
+	first := listSessions(t, r, firstToken)
+	require.Len(t, first, 2)
+	second := listSessions(t, r, secondToken)
+	require.Len(t, second, 2)
+	firstCurrent, secondCurrent := currentSession(t, first), currentSession(t, second)
+	assert.NotEqual(t, firstCurrent.ID, secondCurrent.ID)
+
+	// Activity is reported before it is written to the sessions
+	assert.NotNil(t, firstCurrent.LastSeenAt)
+}
+
+func TestRevokeSession(t *testing.T) {
+	h, stores := setupTestHandler()
+	r := setupSessionsRouter(h)
+	user := createTestUser(t, h, "test@example.com", models.RoleUser)
+	createTestUser(t, h, "other@example.com", models.RoleUser)
+
+	accessToken, refreshToken := loginTestUser(t, r, "test@example.com")
+	otherDeviceToken, otherDeviceRefreshToken := loginTestUser(t, r, "test@example.com")
+	otherUserToken, _ := loginTestUser(t, r, "other@example.com")
+
+	current := currentSession(t, listSessions(t, r, accessToken))
+	otherDevice := currentSession(t, listSessions(t, r, otherDeviceToken))
+	otherUser := currentSession(t, listSessions(t, r, otherUserToken))
+
+	revoke := func(accessToken string, id uint) int {
+		return performAuthorizedRequest(r, "DELETE", fmt.Sprintf("/api/users/me/sessions/%d", id), accessToken, nil).Code
+	}
+
+	// Sessions of other users are not found
+	assert.Equal(t, http.StatusNotFound, revoke(accessToken, otherUser.ID))
+	assert.Len(t, listSessions(t, r, otherUserToken), 1)
+	assert.Equal(t, http.StatusBadRequest, performAuthorizedRequest(r, "DELETE", "/api/users/me/sessions/abc", accessToken, nil).Code)
+
+	// The revoked session is signed out: its access token and its refresh token are rejected
+	require.Equal(t, http.StatusOK, revoke(accessToken, otherDevice.ID))
+	assert.Equal(t, http.StatusUnauthorized, performAuthorizedRequest(r, "GET", "/api/users/me", otherDeviceToken, nil).Code)
+	assert.Equal(t, http.StatusUnauthorized, refresh(r, otherDeviceRefreshToken).Code)
+	assert.Equal(t, http.StatusNotFound, revoke(accessToken, otherDevice.ID))
+
+	// The other sessions go on
+	sessions := listSessions(t, r, accessToken)
+	require.Len(t, sessions, 1)
+	assert.Equal(t, current.ID, sessions[0].ID)
+	assert.Equal(t, http.StatusOK, performAuthorizedRequest(r, "GET", "/api/users/me", otherUserToken, nil).Code)
+
+	// The current session can be revoked too
+	require.Equal(t, http.StatusOK, revoke(accessToken, current.ID))
+	assert.Equal(t, http.StatusUnauthorized, performAuthorizedRequest(r, "GET", "/api/users/me", accessToken, nil).Code)
+	assert.Equal(t, http.StatusUnauthorized, refresh(r, refreshToken).Code)
+
+	revoked := stores.auditEvents("Session revoked")
+	require.Len(t, revoked, 2)
+	assert.Equal(t, &user.ID, revoked[0].UserID)
+	assert.JSONEq(t, fmt.Sprintf(`{"session_id": %d, "current": false}`, otherDevice.ID), revoked[0].Context)
+	assert.JSONEq(t, fmt.Sprintf(`{"session_id": %d, "current": true}`, current.ID), revoked[1].Context)
+}
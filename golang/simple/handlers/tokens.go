@@ -0,0 +1,233 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"crud-example/config"
+	"crud-example/middleware"
+	"crud-example/models"
+	"crud-example/utils"
+)
+
+// issueTokens starts a new session for the user and returns an access token and a refresh token
+func (h *Handler) issueTokens(c *gin.Context, user *models.User) (string, string, error) {
+	session, refreshToken, err := h.startSession(c, user, "", "")
+	if err != nil {
+		return "", "", err
+	}
+
+	accessToken, err := utils.GenerateSessionToken(user.ID, user.Email, user.Role, session.SessionToken)
+	if err != nil {
+		return "", "", err
+	}
+
+	return accessToken, refreshToken, nil
+}
+
+// startSession creates a refresh token family for the user, optionally on behalf of an
+// OAuth client with the granted scope, and returns it with its first refresh token
+func (h *Handler) startSession(c *gin.Context, user *models.User, clientID, scope string) (*models.UserSession, string, error) {
+	familyID, err := utils.GenerateRandomToken(32)
+	if err != nil {
+		return nil, "", err
+	}
+
+	refreshToken, refreshHash, err := utils.NewRefreshToken(familyID)
+	if err != nil {
+		return nil, "", err
+	}
+
+	now := time.Now()
+	session := models.UserSession{
+		UserID:       user.ID,
+		SessionToken: familyID,
+		RefreshToken: refreshHash,
+		ExpiresAt:    now.Add(utils.RefreshTokenTTL()),
+		IPAddress:    c.ClientIP(),
+		UserAgent:    c.Request.UserAgent(),
+		ClientID:     clientID,
+		Scope:        scope,
+		IsActive:     true,
+		LastSeenAt:   &now,
+	}
+	if err := h.Sessions.Create(c.Request.Context(), &session); err != nil {
+		return nil, "", err
+	}
+
+	return &session, refreshToken, nil
+}
+
+// Errors returned by rotateRefreshToken
+var (
+	errInvalidRefreshToken = errors.New("invalid refresh token")
+	errRefreshTokenExpired = errors.New("refresh token expired or revoked")
+	errRefreshTokenReuse   = errors.New("refresh token reuse detected")
+	errRefreshUserInactive = errors.New("user not found or inactive")
+)
+
+// rotateRefreshToken validates a refresh token issued to clientID (empty for first-party
+// sessions) and replaces it with a new one of the same family. It returns the session,
+// its user and the new refresh token.
+func (h *Handler) rotateRefreshToken(c *gin.Context, token, clientID string) (*models.UserSession, *models.User, string, error) {
+	familyID, secret, err := utils.ParseRefreshToken(token)
+	if err != nil {
+		return nil, nil, "", errInvalidRefreshToken
+	}
+
+	// Find the session (token family); refresh tokens only work for the client they were issued to
+	session, err := h.Sessions.FindByToken(c.Request.Context(), familyID)
+	if err != nil || session.ClientID != clientID {
+		return nil, nil, "", errInvalidRefreshToken
+	}
+
+	if !session.IsActive || time.Now().After(session.ExpiresAt) {
+		return nil, nil, "", errRefreshTokenExpired
+	}
+
+	// A token of this family that is no longer current was presented: it has already
+	// been rotated, so either the client or an attacker is replaying it. Revoke the family.
+	if !utils.CompareTokenHash(secret, session.RefreshToken) {
+		if err := h.revokeSession(c.Request.Context(), session); err != nil {
+			log.Printf("Failed to revoke session %d after refresh token reuse: %v", session.ID, err)
+		}
+		log.Printf("Refresh token reuse detected for user %d, session %d revoked", session.UserID, session.ID)
+		return nil, nil, "", errRefreshTokenReuse
+	}
+
+	// Get user from database
+	user, err := h.Users.FindActiveByID(c.Request.Context(), session.UserID)
+	if err != nil {
+		return nil, nil, "", errRefreshUserInactive
+	}
+
+	// Rotate the refresh token. The update only succeeds if the stored hash is still
+	// the one we just checked, so two concurrent refreshes cannot both win.
+	refreshToken, refreshHash, err := utils.NewRefreshToken(familyID)
+	if err != nil {
+		return nil, nil, "", err
+	}
+
+	rotated, err := h.Sessions.Rotate(c.Request.Context(), session.ID, session.RefreshToken, refreshHash,
+		time.Now().Add(utils.RefreshTokenTTL()), c.ClientIP(), c.Request.UserAgent())
+	if err != nil {
+		return nil, nil, "", err
+	}
+	if !rotated {
+		if err := h.revokeSession(c.Request.Context(), session); err != nil {
+			log.Printf("Failed to revoke session %d after refresh token reuse: %v", session.ID, err)
+		}
+		log.Printf("Concurrent refresh token use detected for user %d, session %d revoked", session.UserID, session.ID)
+		return nil, nil, "", errRefreshTokenReuse
+	}
+
+	return session, user, refreshToken, nil
+}
+
+// completeLogin responds to a successful first-factor login, whether with a password, an
+// identity provider or a sign-in link: users with MFA get a pending token that must be
+// exchanged with a code at /mfa/verify, everyone else gets a token pair
+func (h *Handler) completeLogin(c *gin.Context, user *models.User) {
+	// Check if email is verified when the policy requires it to log in
+	if !user.IsVerified && config.Current().Account.EmailVerificationPolicy == config.VerificationLogin {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Email address not verified"})
+		return
+	}
+
+	if user.MFAEnabled {
+		mfaToken, err := utils.GenerateMFAToken(user.ID, user.Email)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"message":      "MFA verification required",
+			"mfa_required": true,
+			"mfa_token":    mfaToken,
+			"expires_in":   int(utils.MFATokenTTL.Seconds()),
+		})
+		return
+	}
+
+	h.respondWithTokens(c, user)
+}
+
+// respondWithTokens finishes a login once every required factor has been checked
+func (h *Handler) respondWithTokens(c *gin.Context, user *models.User) {
+	// Generate tokens
+	token, refreshToken, err := h.issueTokens(c, user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		return
+	}
+
+	response := tokenResponse(token, refreshToken)
+	response["message"] = "Login successful"
+	response["user"] = user.ToResponse()
+
+	// Let the client know the user has to enrol before using the API
+	if required, err := h.Settings.RoleRequiresMFA(c.Request.Context(), user.Role); err == nil && required {
+		response["mfa_enrollment_required"] = true
+	}
+
+	// ... or change an expired password
+	if user.PasswordExpired(middleware.PasswordMaxAge()) {
+		response["password_change_required"] = true
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// revokeSession deactivates a session, invalidating every refresh token of its family
+func (h *Handler) revokeSession(ctx context.Context, session *models.UserSession) error {
+	if err := h.Sessions.Revoke(ctx, session.ID); err != nil {
+		return err
+	}
+
+	// Access tokens bound to the session stop working at once on this instance
+	h.SessionTracker.Forget(session.SessionToken)
+	return nil
+}
+
+// revokeUserSessions revokes every access token and refresh token family of a user
+func (h *Handler) revokeUserSessions(ctx context.Context, userID uint) error {
+	if err := h.Revocations.RevokeUser(ctx, userID, time.Now()); err != nil {
+		return err
+	}
+	if err := h.Sessions.RevokeUser(ctx, userID, ""); err != nil {
+		return err
+	}
+
+	// Access tokens issued earlier in the current second escape the revocation, so their
+	// sessions must stop being answered from the cache at once
+	h.SessionTracker.ForgetUser(userID, "")
+	return nil
+}
+
+// revokeOtherSessions revokes every session of the user except keepSessionID, together with
+// the access tokens issued so far
+func (h *Handler) revokeOtherSessions(ctx context.Context, userID uint, keepSessionID string) error {
+	if err := h.Revocations.RevokeUser(ctx, userID, time.Now()); err != nil {
+		return err
+	}
+	if err := h.Sessions.RevokeUser(ctx, userID, keepSessionID); err != nil {
+		return err
+	}
+	h.SessionTracker.ForgetUser(userID, keepSessionID)
+	return nil
+}
+
+// tokenResponse builds the token fields shared by every endpoint that issues tokens
+func tokenResponse(accessToken, refreshToken string) gin.H {
+	return gin.H{
+		"token":         accessToken,
+		"refresh_token": refreshToken,
+		"token_type":    "Bearer",
+		"expires_in":    int(utils.AccessTokenTTL().Seconds()),
+	}
+}
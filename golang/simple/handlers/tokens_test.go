@@ -0,0 +1,118 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+	"crud-example/middleware"
+	"crud-example/models"
+)
+
+func setupTokensRouter(h *Handler) *gin.Engine {
+	r := gin.New()
+
+	api := r.Group("/api")
+	auth := api.Group("/auth")
+	{
+		auth.POST("/login", h.Login)
+		auth.POST("/refresh", h.Refresh)
+	}
+	api.GET("/users/me", middleware.AuthMiddleware(h.Authentication()), h.GetProfile)
+
+	return r
+}
+
+// loginTestUser logs in with the password of createTestUser and returns the token pair
+func loginTestUser(t *testing.T, r http.Handler, email string) (string, string) {
+	w := performRequest(r, "POST", "/api/auth/login", map[string]interface{}{
+		"email":    email,
+		"password": "Tr0ub4dor&3x",
+	})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	return decodeTokens(t, w.Body.Bytes())
+}
+
+func decodeTokens(t *testing.T, body []byte) (string, string) {
+	var response struct {
+		Token        string `json:"token"`
+		RefreshToken string `json:"refresh_token"`
+	}
+	require.NoError(t, json.Unmarshal(body, &response))
+	require.NotEmpty(t, response.Token)
+	require.NotEmpty(t, response.RefreshToken)
+	return response.Token, response.RefreshToken
+}
+
+func refresh(r http.Handler, refreshToken string) *httptest.ResponseRecorder {
+	return performRequest(r, "POST", "/api/auth/refresh", map[string]interface{}{"refresh_token": refreshToken})
+}
+
+func TestRefreshRotation(t *testing.T) {
+	h, _ := setupDBTestHandler(t)
+	r := setupTokensRouter(h)
+	createTestUser(t, h, "test@example.com", models.RoleUser)
+	_, first := loginTestUser(t, r, "test@example.com")
+
+	// Each refresh returns a new refresh token of the same family
+	w := refresh(r, first)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	token, second := decodeTokens(t, w.Body.Bytes())
+	assert.NotEqual(t, first, second)
+	assert.Equal(t, http.StatusOK, performAuthorizedRequest(r, "GET", "/api/users/me", token, nil).Code)
+
+	w = refresh(r, second)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	token, third := decodeTokens(t, w.Body.Bytes())
+
+	// Replaying a rotated token revokes the whole family, including the current token
+	w = refresh(r, first)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Contains(t, w.Body.String(), "Refresh token reuse detected")
+
+	w = refresh(r, third)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Contains(t, w.Body.String(), "Refresh token expired or revoked")
+
+	// ... and the access tokens bound to it
+	assert.Equal(t, http.StatusUnauthorized, performAuthorizedRequest(r, "GET", "/api/users/me", token, nil).Code)
+
+	// Tokens that are not refresh tokens of a session are rejected
+	for _, invalid := range []string{"not-a-token", "unknown.secret"} {
+		assert.Equal(t, http.StatusUnauthorized, refresh(r, invalid).Code, invalid)
+	}
+}
+
+func TestRefreshConcurrent(t *testing.T) {
+	h, _ := setupDBTestHandler(t)
+	r := setupTokensRouter(h)
+	user := createTestUser(t, h, "test@example.com", models.RoleUser)
+	_, refreshToken := loginTestUser(t, r, "test@example.com")
+
+	// Another instance rotates the token between this refresh reading the session and
+	// updating it, so the update matches no row
+	raced := false
+	require.NoError(t, h.db.Callback().Update().Before("gorm:update").Register("test:race", func(db *gorm.DB) {
+		if raced || db.Statement.Table != "user_sessions" {
+			return
+		}
+		raced = true
+		db.Statement.ConnPool.ExecContext(db.Statement.Context, "UPDATE user_sessions SET refresh_token = ? WHERE user_id = ?", "rotated elsewhere", user.ID)
+	}))
+
+	w := refresh(r, refreshToken)
+	assert.True(t, raced)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Contains(t, w.Body.String(), "Refresh token reuse detected")
+
+	// The losing refresh revoked the family
+	active, err := h.Sessions.ListActive(context.Background(), user.ID)
+	require.NoError(t, err)
+	assert.Empty(t, active)
+}
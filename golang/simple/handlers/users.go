@@ -1,17 +1,19 @@
 package handlers
 
 import (
+	"context"
+	"log"
 	"net/http"
 	"strconv"
 
 	"github.com/gin-gonic/gin"
-	"crud-example/config"
+	"crud-example/middleware"
 	"crud-example/models"
 	"crud-example/utils"
 )
 
 // GetUsers handles getting all users with pagination
-func GetUsers(c *gin.Context) {
+func (h *Handler) GetUsers(c *gin.Context) {
 	// Get pagination parameters
 	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
 	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "10"))
@@ -26,16 +28,9 @@ func GetUsers(c *gin.Context) {
 
 	offset := (page - 1) * limit
 
-	// Get total count
-	var total int64
-	if err := config.DB.Model(&models.User{}).Where("is_active = ?", true).Count(&total).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get users count"})
-		return
-	}
-
-	// Get users
-	var users []models.User
-	if err := config.DB.Where("is_active = ?", true).Offset(offset).Limit(limit).Find(&users).Error; err != nil {
+	// Get users and total count
+	users, total, err := h.Users.ListActive(c.Request.Context(), offset, limit)
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get users"})
 		return
 	}
@@ -61,7 +56,7 @@ func GetUsers(c *gin.Context) {
 }
 
 // GetUser handles getting a user by ID
-func GetUser(c *gin.Context) {
+func (h *Handler) GetUser(c *gin.Context) {
 	// Get user ID from URL parameter
 	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
 	if err != nil {
@@ -70,8 +65,8 @@ func GetUser(c *gin.Context) {
 	}
 
 	// Get user from database
-	var user models.User
-	if err := config.DB.Where("id = ? AND is_active = ?", id, true).First(&user).Error; err != nil {
+	user, err := h.Users.FindActiveByID(c.Request.Context(), uint(id))
+	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
 		return
 	}
@@ -80,7 +75,7 @@ func GetUser(c *gin.Context) {
 }
 
 // CreateUser handles creating a new user
-func CreateUser(c *gin.Context) {
+func (h *Handler) CreateUser(c *gin.Context) {
 	var userCreate models.UserCreate
 
 	// Bind JSON to struct
@@ -90,12 +85,15 @@ func CreateUser(c *gin.Context) {
 	}
 
 	// Check if user already exists
-	var existingUser models.User
-	if err := config.DB.Where("email = ?", userCreate.Email).First(&existingUser).Error; err == nil {
+	if h.emailTaken(c.Request.Context(), userCreate.Email, 0) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Email already registered"})
 		return
 	}
 
+	if !checkPasswordPolicy(c, userCreate.Password, userCreate.Name, userCreate.Email) {
+		return
+	}
+
 	// Hash password
 	hashedPassword, err := utils.HashPassword(userCreate.Password)
 	if err != nil {
@@ -110,9 +108,13 @@ func CreateUser(c *gin.Context) {
 		Password: hashedPassword,
 		Age:      userCreate.Age,
 		IsActive: true,
+		Role:     userCreate.Role,
+	}
+	if user.Role == "" {
+		user.Role = models.RoleUser
 	}
 
-	if err := config.DB.Create(&user).Error; err != nil {
+	if err := h.Users.Create(c.Request.Context(), &user); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create user"})
 		return
 	}
@@ -124,7 +126,7 @@ func CreateUser(c *gin.Context) {
 }
 
 // UpdateUser handles updating a user
-func UpdateUser(c *gin.Context) {
+func (h *Handler) UpdateUser(c *gin.Context) {
 	// Get user ID from URL parameter
 	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
 	if err != nil {
@@ -140,28 +142,68 @@ func UpdateUser(c *gin.Context) {
 		return
 	}
 
+	// Users may only edit themselves unless their role allows editing anyone
+	currentUser := middleware.CurrentUser(c)
+	permission := models.PermissionUsersUpdate
+	if uint(id) == currentUser.ID {
+		permission = models.PermissionProfileUpdate
+	}
+	if !middleware.HasPermission(c, permission) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Insufficient permissions"})
+		return
+	}
+
+	// Account status and roles can only be changed by managers
+	if (userUpdate.IsActive != nil || userUpdate.Role != nil) && !middleware.HasPermission(c, models.PermissionUsersManage) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Insufficient permissions to change account status or role"})
+		return
+	}
+
 	// Get user from database
-	var user models.User
-	if err := config.DB.First(&user, id).Error; err != nil {
+	user, err := h.Users.FindByID(c.Request.Context(), uint(id))
+	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
 		return
 	}
 
-	// Check if email already exists (if updating email)
-	if userUpdate.Email != nil && *userUpdate.Email != user.Email {
-		var existingUser models.User
-		if err := config.DB.Where("email = ? AND id != ?", *userUpdate.Email, id).First(&existingUser).Error; err == nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Email already registered"})
+	// Without users:manage, other managers cannot be edited and the email of other users,
+	// which receives their password resets, cannot be changed
+	if user.ID != currentUser.ID && !middleware.HasPermission(c, models.PermissionUsersManage) {
+		if user.HasPermission(models.PermissionUsersManage) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Insufficient permissions to edit this user"})
+			return
+		}
+		if userUpdate.Email != nil && *userUpdate.Email != user.Email {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Insufficient permissions to change the email of another user"})
+			return
+		}
+	}
+
+	// Users changing their own email confirm it with their password, as in UpdateProfile
+	if user.ID == currentUser.ID && userUpdate.Email != nil && *userUpdate.Email != user.Email {
+		if userUpdate.CurrentPassword == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Current password is required to change the email"})
+			return
+		}
+		if !h.confirmPassword(c, user, userUpdate.CurrentPassword) {
 			return
 		}
 	}
 
+	// Check if email already exists (if updating email)
+	if userUpdate.Email != nil && *userUpdate.Email != user.Email && h.emailTaken(c.Request.Context(), *userUpdate.Email, user.ID) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Email already registered"})
+		return
+	}
+
 	// Update user fields
 	if userUpdate.Name != nil {
 		user.Name = *userUpdate.Name
 	}
-	if userUpdate.Email != nil {
+	emailChanged := userUpdate.Email != nil && *userUpdate.Email != user.Email
+	if emailChanged {
 		user.Email = *userUpdate.Email
+		user.IsVerified = false
 	}
 	if userUpdate.Age != nil {
 		user.Age = userUpdate.Age
@@ -169,13 +211,31 @@ func UpdateUser(c *gin.Context) {
 	if userUpdate.IsActive != nil {
 		user.IsActive = *userUpdate.IsActive
 	}
+	if userUpdate.Role != nil {
+		user.Role = *userUpdate.Role
+	}
 
 	// Save changes
-	if err := config.DB.Save(&user).Error; err != nil {
+	if err := h.Users.Save(c.Request.Context(), user); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update user"})
 		return
 	}
 
+	// A changed email address has to be verified again
+	if emailChanged {
+		if err := h.sendVerificationEmail(c.Request.Context(), user); err != nil {
+			log.Printf("Failed to send verification email to user %d: %v", user.ID, err)
+		}
+	}
+
+	// Deactivated users lose every outstanding token
+	if userUpdate.IsActive != nil && !*userUpdate.IsActive {
+		if err := h.revokeUserSessions(c.Request.Context(), user.ID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke user tokens"})
+			return
+		}
+	}
+
 	c.JSON(http.StatusOK, gin.H{
 		"message": "User updated successfully",
 		"user":    user.ToResponse(),
@@ -183,7 +243,7 @@ func UpdateUser(c *gin.Context) {
 }
 
 // DeleteUser handles soft deleting a user
-func DeleteUser(c *gin.Context) {
+func (h *Handler) DeleteUser(c *gin.Context) {
 	// Get user ID from URL parameter
 	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
 	if err != nil {
@@ -192,21 +252,33 @@ func DeleteUser(c *gin.Context) {
 	}
 
 	// Get user from database
-	var user models.User
-	if err := config.DB.First(&user, id).Error; err != nil {
+	user, err := h.Users.FindByID(c.Request.Context(), uint(id))
+	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
 		return
 	}
 
 	// Soft delete (set is_active to false)
 	user.IsActive = false
-	if err := config.DB.Save(&user).Error; err != nil {
+	if err := h.Users.Save(c.Request.Context(), user); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete user"})
 		return
 	}
 
+	// Revoke every outstanding token of the deactivated user
+	if err := h.revokeUserSessions(c.Request.Context(), user.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke user tokens"})
+		return
+	}
+
 	c.JSON(http.StatusOK, gin.H{
 		"message": "User deleted successfully",
 		"user":    user.ToResponse(),
 	})
-} 
\ No newline at end of file
+}
+
+// emailTaken reports whether another user already registered the email address
+func (h *Handler) emailTaken(ctx context.Context, email string, userID uint) bool {
+	taken, err := h.Users.EmailTaken(ctx, email, userID)
+	return err == nil && taken
+}
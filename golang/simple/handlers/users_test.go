@@ -1,121 +1,103 @@
 package handlers
 
 import (
-	"bytes"
+	"context"
 	"encoding/json"
 	"net/http"
-	"net/http/httptest"
 	"strconv"
 	"testing"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
-	"gorm.io/driver/sqlite"
-	"gorm.io/gorm"
-	"crud-example/config"
+	"github.com/stretchr/testify/require"
 	"crud-example/models"
 	"crud-example/utils"
 )
 
-func setupTestDB() *gorm.DB {
-	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
-	if err != nil {
-		panic("Failed to connect to test database")
-	}
-	
-	// Auto migrate
-	db.AutoMigrate(&models.User{})
-	
-	return db
-}
+// setupUsersRouter registers the user routes behind a stand-in for AuthMiddleware that
+// authenticates every request as currentUser
+func setupUsersRouter(h *Handler, currentUser models.User) *gin.Engine {
+	r := gin.New()
 
-func setupTestRouter() *gin.Engine {
-	gin.SetMode(gin.TestMode)
-	r := gin.Default()
-	
-	// Set test database
-	testDB := setupTestDB()
-	config.SetDB(testDB)
-	
 	// Setup routes
 	api := r.Group("/api")
 	users := api.Group("/users")
-	users.Use(middleware.AuthMiddleware())
+	users.Use(func(c *gin.Context) {
+		c.Set("user", currentUser)
+		c.Next()
+	})
 	{
-		users.GET("/", GetUsers)
-		users.GET("/:id", GetUser)
-		users.POST("/", CreateUser)
-		users.PUT("/:id", UpdateUser)
-		users.DELETE("/:id", DeleteUser)
+		users.GET("/", h.GetUsers)
+		users.GET("/:id", h.GetUser)
+		users.POST("/", h.CreateUser)
+		users.PUT("/:id", h.UpdateUser)
+		users.DELETE("/:id", h.DeleteUser)
 	}
-	
+
 	return r
 }
 
-func createTestUser() (models.User, string) {
-	db := config.GetDB()
-	
-	// Create a test user
-	hashedPassword, _ := utils.HashPassword("password123")
+func createTestUser(t *testing.T, h *Handler, email, role string) models.User {
+	hashedPassword, err := utils.HashPassword("Tr0ub4dor&3x")
+	require.NoError(t, err)
+
 	user := models.User{
-		Username: "testuser",
-		Email:    "test@example.com",
+		Name:     "Test User",
+		Email:    email,
 		Password: hashedPassword,
+		IsActive: true,
+		Role:     role,
 	}
-	
-	db.Create(&user)
-	
-	// Generate JWT token
-	token, _ := utils.GenerateJWT(user.ID)
-	
-	return user, token
+	require.NoError(t, h.Users.Create(context.Background(), &user))
+	return user
+}
+
+func userPath(id uint) string {
+	return "/api/users/" + strconv.FormatUint(uint64(id), 10)
 }
 
 func TestGetUsers(t *testing.T) {
-	r := setupTestRouter()
-	
-	// Create test users
-	_, token := createTestUser()
-	
-	req, _ := http.NewRequest("GET", "/api/users/", nil)
-	req.Header.Set("Authorization", "Bearer "+token)
-	
-	w := httptest.NewRecorder()
-	r.ServeHTTP(w, req)
-	
+	h, _ := setupTestHandler()
+	admin := createTestUser(t, h, "admin@example.com", models.RoleAdmin)
+	createTestUser(t, h, "test@example.com", models.RoleUser)
+	r := setupUsersRouter(h, admin)
+
+	w := performRequest(r, "GET", "/api/users/?limit=1", nil)
+
 	assert.Equal(t, http.StatusOK, w.Code)
-	
-	var response map[string]interface{}
+
+	var response models.PaginatedResponse
 	err := json.Unmarshal(w.Body.Bytes(), &response)
 	assert.NoError(t, err)
-	assert.Contains(t, response, "users")
-	assert.Contains(t, response, "total")
+	assert.Len(t, response.Data, 1)
+	assert.Equal(t, int64(2), response.Pagination.Total)
+	assert.Equal(t, 2, response.Pagination.Pages)
 }
 
 func TestGetUser(t *testing.T) {
-	r := setupTestRouter()
-	
-	user, token := createTestUser()
-	
-	req, _ := http.NewRequest("GET", "/api/users/"+strconv.FormatUint(uint64(user.ID), 10), nil)
-	req.Header.Set("Authorization", "Bearer "+token)
-	
-	w := httptest.NewRecorder()
-	r.ServeHTTP(w, req)
-	
+	h, _ := setupTestHandler()
+	user := createTestUser(t, h, "test@example.com", models.RoleUser)
+	r := setupUsersRouter(h, user)
+
+	w := performRequest(r, "GET", userPath(user.ID), nil)
+
 	assert.Equal(t, http.StatusOK, w.Code)
-	
-	var response map[string]interface{}
+
+	var response models.UserResponse
 	err := json.Unmarshal(w.Body.Bytes(), &response)
 	assert.NoError(t, err)
-	assert.Contains(t, response, "user")
+	assert.Equal(t, user.Email, response.Email)
+
+	w = performRequest(r, "GET", userPath(user.ID+1), nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
 }
 
 func TestCreateUser(t *testing.T) {
-	r := setupTestRouter()
-	
-	_, token := createTestUser()
-	
+	h, _ := setupTestHandler()
+	admin := createTestUser(t, h, "admin@example.com", models.RoleAdmin)
+	r := setupUsersRouter(h, admin)
+
 	tests := []struct {
 		name       string
 		payload    map[string]interface{}
@@ -125,37 +107,41 @@ func TestCreateUser(t *testing.T) {
 		{
 			name: "Valid user creation",
 			payload: map[string]interface{}{
-				"username": "newuser",
+				"name":     "New User",
 				"email":    "newuser@example.com",
-				"password": "password123",
+				"password": "Tr0ub4dor&3x",
 			},
 			wantStatus: http.StatusCreated,
 			wantError:  false,
 		},
+		{
+			name: "Email already registered",
+			payload: map[string]interface{}{
+				"name":     "New User",
+				"email":    "newuser@example.com",
+				"password": "Tr0ub4dor&3x",
+			},
+			wantStatus: http.StatusBadRequest,
+			wantError:  true,
+		},
 		{
 			name: "Invalid email",
 			payload: map[string]interface{}{
-				"username": "newuser",
+				"name":     "New User",
 				"email":    "invalid-email",
-				"password": "password123",
+				"password": "Tr0ub4dor&3x",
 			},
 			wantStatus: http.StatusBadRequest,
 			wantError:  true,
 		},
 	}
-	
+
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			jsonData, _ := json.Marshal(tt.payload)
-			req, _ := http.NewRequest("POST", "/api/users/", bytes.NewBuffer(jsonData))
-			req.Header.Set("Content-Type", "application/json")
-			req.Header.Set("Authorization", "Bearer "+token)
-			
-			w := httptest.NewRecorder()
-			r.ServeHTTP(w, req)
-			
+			w := performRequest(r, "POST", "/api/users/", tt.payload)
+
 			assert.Equal(t, tt.wantStatus, w.Code)
-			
+
 			if !tt.wantError {
 				var response map[string]interface{}
 				err := json.Unmarshal(w.Body.Bytes(), &response)
@@ -167,47 +153,83 @@ func TestCreateUser(t *testing.T) {
 }
 
 func TestUpdateUser(t *testing.T) {
-	r := setupTestRouter()
-	
-	user, token := createTestUser()
-	
+	h, stores := setupTestHandler()
+	user := createTestUser(t, h, "test@example.com", models.RoleUser)
+	other := createTestUser(t, h, "other@example.com", models.RoleUser)
+	r := setupUsersRouter(h, user)
+
 	tests := []struct {
 		name       string
+		id         uint
 		payload    map[string]interface{}
 		wantStatus int
 		wantError  bool
 	}{
 		{
 			name: "Valid user update",
+			id:   user.ID,
 			payload: map[string]interface{}{
-				"username": "updateduser",
-				"email":    "updated@example.com",
+				"name":             "Updated User",
+				"email":            "updated@example.com",
+				"current_password": "Tr0ub4dor&3x",
 			},
 			wantStatus: http.StatusOK,
 			wantError:  false,
 		},
+		{
+			name: "Own email without the current password",
+			id:   user.ID,
+			payload: map[string]interface{}{
+				"email": "unconfirmed@example.com",
+			},
+			wantStatus: http.StatusBadRequest,
+			wantError:  true,
+		},
+		{
+			name: "Own email with a wrong current password",
+			id:   user.ID,
+			payload: map[string]interface{}{
+				"email":            "unconfirmed@example.com",
+				"current_password": "wrong-password",
+			},
+			wantStatus: http.StatusUnauthorized,
+			wantError:  true,
+		},
 		{
 			name: "Invalid email",
+			id:   user.ID,
 			payload: map[string]interface{}{
 				"email": "invalid-email",
 			},
 			wantStatus: http.StatusBadRequest,
 			wantError:  true,
 		},
+		{
+			name: "Email already registered",
+			id:   user.ID,
+			payload: map[string]interface{}{
+				"email": "other@example.com",
+			},
+			wantStatus: http.StatusBadRequest,
+			wantError:  true,
+		},
+		{
+			name: "Another user",
+			id:   other.ID,
+			payload: map[string]interface{}{
+				"name": "Updated User",
+			},
+			wantStatus: http.StatusForbidden,
+			wantError:  true,
+		},
 	}
-	
+
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			jsonData, _ := json.Marshal(tt.payload)
-			req, _ := http.NewRequest("PUT", "/api/users/"+strconv.FormatUint(uint64(user.ID), 10), bytes.NewBuffer(jsonData))
-			req.Header.Set("Content-Type", "application/json")
-			req.Header.Set("Authorization", "Bearer "+token)
-			
-			w := httptest.NewRecorder()
-			r.ServeHTTP(w, req)
-			
+			w := performRequest(r, "PUT", userPath(tt.id), tt.payload)
+
 			assert.Equal(t, tt.wantStatus, w.Code)
-			
+
 			if !tt.wantError {
 				var response map[string]interface{}
 				err := json.Unmarshal(w.Body.Bytes(), &response)
@@ -216,23 +238,74 @@ func TestUpdateUser(t *testing.T) {
 			}
 		})
 	}
+
+	// The changed email address has to be verified again
+	updated, err := h.Users.FindByID(context.Background(), user.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "Updated User", updated.Name)
+	assert.Equal(t, "updated@example.com", updated.Email)
+	assert.False(t, updated.IsVerified)
+	_, sent := stores.mail.Last("updated@example.com")
+	assert.True(t, sent)
+}
+
+func TestUpdateUserAsModerator(t *testing.T) {
+	h, _ := setupTestHandler()
+	moderator := createTestUser(t, h, "moderator@example.com", models.RoleModerator)
+	user := createTestUser(t, h, "user@example.com", models.RoleUser)
+	admin := createTestUser(t, h, "admin@example.com", models.RoleAdmin)
+	r := setupUsersRouter(h, moderator)
+
+	tests := []struct {
+		name       string
+		id         uint
+		payload    map[string]interface{}
+		wantStatus int
+	}{
+		{name: "Name of another user", id: user.ID, payload: map[string]interface{}{"name": "Renamed"}, wantStatus: http.StatusOK},
+		{name: "Email of another user", id: user.ID, payload: map[string]interface{}{"email": "mine@example.com"}, wantStatus: http.StatusForbidden},
+		{name: "Role of another user", id: user.ID, payload: map[string]interface{}{"role": models.RoleAdmin}, wantStatus: http.StatusForbidden},
+		{name: "Deactivate another user", id: user.ID, payload: map[string]interface{}{"is_active": false}, wantStatus: http.StatusForbidden},
+		{name: "Administrator", id: admin.ID, payload: map[string]interface{}{"name": "Renamed"}, wantStatus: http.StatusForbidden},
+		{name: "Own email", id: moderator.ID, payload: map[string]interface{}{"email": "mod@example.com", "current_password": "Tr0ub4dor&3x"}, wantStatus: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := performRequest(r, "PUT", userPath(tt.id), tt.payload)
+			assert.Equal(t, tt.wantStatus, w.Code, w.Body.String())
+		})
+	}
+
+	updated, err := h.Users.FindByID(context.Background(), user.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "Renamed", updated.Name)
+	assert.Equal(t, "user@example.com", updated.Email)
+	assert.True(t, updated.IsActive)
 }
 
 func TestDeleteUser(t *testing.T) {
-	r := setupTestRouter()
-	
-	user, token := createTestUser()
-	
-	req, _ := http.NewRequest("DELETE", "/api/users/"+strconv.FormatUint(uint64(user.ID), 10), nil)
-	req.Header.Set("Authorization", "Bearer "+token)
-	
-	w := httptest.NewRecorder()
-	r.ServeHTTP(w, req)
-	
+	h, stores := setupTestHandler()
+	admin := createTestUser(t, h, "admin@example.com", models.RoleAdmin)
+	user := createTestUser(t, h, "test@example.com", models.RoleUser)
+	r := setupUsersRouter(h, admin)
+
+	session := models.UserSession{UserID: user.ID, SessionToken: "family", IsActive: true, ExpiresAt: time.Now().Add(time.Hour)}
+	require.NoError(t, h.Sessions.Create(context.Background(), &session))
+
+	w := performRequest(r, "DELETE", userPath(user.ID), nil)
+
 	assert.Equal(t, http.StatusOK, w.Code)
-	
+
 	var response map[string]interface{}
 	err := json.Unmarshal(w.Body.Bytes(), &response)
 	assert.NoError(t, err)
 	assert.Contains(t, response, "message")
-} 
\ No newline at end of file
+
+	// The user is deactivated and loses every session and token
+	_, err = h.Users.FindActiveByID(context.Background(), user.ID)
+	assert.Error(t, err)
+	assert.False(t, stores.sessions.All(user.ID)[0].IsActive)
+	_, err = stores.revocations.FindUser(context.Background(), user.ID)
+	assert.NoError(t, err)
+}
@@ -0,0 +1,144 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"crud-example/config"
+	"crud-example/mailer"
+	"crud-example/models"
+	"crud-example/utils"
+)
+
+// resendVerificationMessage is returned whether or not an email was actually sent
+const resendVerificationMessage = "If the email is registered and not yet verified, a verification link has been sent"
+
+// maxVerificationEmailsPerHour caps verification emails per user
+const maxVerificationEmailsPerHour = 5
+
+// sendVerificationEmail emails a link proving ownership of the user's current email address
+func (h *Handler) sendVerificationEmail(ctx context.Context, user *models.User) error {
+	token, err := utils.GenerateRandomToken(32)
+	if err != nil {
+		return err
+	}
+
+	ttl := config.Current().Tokens.EmailVerificationExpiration
+	verification := models.EmailVerificationToken{
+		UserID:    user.ID,
+		Email:     user.Email,
+		TokenHash: utils.HashToken(token),
+		ExpiresAt: time.Now().Add(ttl),
+	}
+	if err := h.Verifications.Create(ctx, &verification); err != nil {
+		return err
+	}
+
+	link := appURL("/api/auth/verify", url.Values{"token": {token}})
+	return mailer.Send(mailer.Message{
+		To:      user.Email,
+		Subject: "Verify your email address",
+		Body: fmt.Sprintf("Hi %s,\n\nPlease confirm your email address by opening the following link. It expires in %s.\n\n%s\n",
+			user.Name, ttl, link),
+	})
+}
+
+// VerifyEmail marks the user's email address as verified using the token from the verification email
+func (h *Handler) VerifyEmail(c *gin.Context) {
+	token := c.Query("token")
+	if token == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Verification token required"})
+		return
+	}
+
+	verification, err := h.Verifications.FindUnused(c.Request.Context(), utils.HashToken(token))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired verification token"})
+		return
+	}
+
+	// The token only proves ownership of the address it was sent to
+	user, err := h.Users.FindByID(c.Request.Context(), verification.UserID)
+	if err != nil || user.Email != verification.Email {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired verification token"})
+		return
+	}
+
+	used, err := h.Verifications.MarkUsed(c.Request.Context(), verification.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify email"})
+		return
+	}
+	if !used {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired verification token"})
+		return
+	}
+
+	user.IsVerified = true
+	if err := h.Users.Save(c.Request.Context(), user); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify email"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Email verified successfully"})
+}
+
+// ResendVerification sends a new verification email, throttled per user.
+// The response never reveals whether the email is registered or was throttled.
+func (h *Handler) ResendVerification(c *gin.Context) {
+	var request models.ResendVerificationRequest
+
+	// Bind JSON to struct
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data", "details": err.Error()})
+		return
+	}
+
+	// The lookup and the email happen after responding, so the response time is the same
+	// whether or not the email is registered
+	h.inBackground(c.Request.Context(), func(ctx context.Context) {
+		user, err := h.Users.FindByEmail(ctx, request.Email)
+		if err != nil || !user.IsActive || user.IsVerified {
+			return
+		}
+
+		throttled, err := h.verificationThrottled(ctx, user.ID)
+		if err != nil {
+			log.Printf("Failed to check verification throttle for user %d: %v", user.ID, err)
+			return
+		}
+		if throttled {
+			return
+		}
+
+		if err := h.sendVerificationEmail(ctx, user); err != nil {
+			log.Printf("Failed to send verification email to user %d: %v", user.ID, err)
+		}
+	})
+
+	c.JSON(http.StatusAccepted, gin.H{"message": resendVerificationMessage})
+}
+
+// verificationThrottled reports whether the user received a verification email too recently
+func (h *Handler) verificationThrottled(ctx context.Context, userID uint) (bool, error) {
+	interval := config.Current().Tokens.EmailVerificationResendInterval
+
+	recent, err := h.Verifications.CountSince(ctx, userID, time.Now().Add(-interval))
+	if err != nil {
+		return false, err
+	}
+	if recent > 0 {
+		return true, nil
+	}
+
+	lastHour, err := h.Verifications.CountSince(ctx, userID, time.Now().Add(-time.Hour))
+	if err != nil {
+		return false, err
+	}
+	return lastHour >= maxVerificationEmailsPerHour, nil
+}
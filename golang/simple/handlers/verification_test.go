@@ -0,0 +1,150 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"crud-example/config"
+	"crud-example/middleware"
+	"crud-example/models"
+)
+
+func setupVerificationRouter(h *Handler) *gin.Engine {
+	r := gin.New()
+
+	auth := r.Group("/api/auth")
+	{
+		auth.POST("/register", h.Register)
+		auth.POST("/login", h.Login)
+		auth.GET("/verify", h.VerifyEmail)
+		auth.POST("/verify/resend", h.ResendVerification)
+	}
+
+	return r
+}
+
+// registerTestUser registers an unverified user with the password of createTestUser
+func registerTestUser(t *testing.T, r http.Handler, email string) {
+	w := performRequest(r, "POST", "/api/auth/register", map[string]interface{}{
+		"name":     "Test User",
+		"email":    email,
+		"password": "Tr0ub4dor&3x",
+	})
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+}
+
+func TestVerifyEmail(t *testing.T) {
+	h, stores := setupTestHandler()
+	r := setupVerificationRouter(h)
+	registerTestUser(t, r, "test@example.com")
+	link := mailedLink(t, stores.mail, "test@example.com")
+	assert.Equal(t, "/api/auth/verify", link.Path)
+
+	assert.Equal(t, http.StatusBadRequest, performRequest(r, "GET", "/api/auth/verify", nil).Code)
+	assert.Equal(t, http.StatusBadRequest, performRequest(r, "GET", "/api/auth/verify?token=unknown", nil).Code)
+
+	w := performRequest(r, "GET", link.RequestURI(), nil)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	user, err := stores.users.FindByEmail(context.Background(), "test@example.com")
+	require.NoError(t, err)
+	assert.True(t, user.IsVerified)
+
+	// Links are single use
+	assert.Equal(t, http.StatusBadRequest, performRequest(r, "GET", link.RequestURI(), nil).Code)
+
+	// A link only verifies the address it was sent to
+	registerTestUser(t, r, "other@example.com")
+	link = mailedLink(t, stores.mail, "other@example.com")
+	other, err := stores.users.FindByEmail(context.Background(), "other@example.com")
+	require.NoError(t, err)
+	other.Email = "changed@example.com"
+	require.NoError(t, stores.users.Save(context.Background(), other))
+
+	assert.Equal(t, http.StatusBadRequest, performRequest(r, "GET", link.RequestURI(), nil).Code)
+	other, err = stores.users.FindByID(context.Background(), other.ID)
+	require.NoError(t, err)
+	assert.False(t, other.IsVerified)
+}
+
+func TestResendVerification(t *testing.T) {
+	h, stores := setupTestHandler()
+	r := setupVerificationRouter(h)
+	registerTestUser(t, r, "test@example.com")
+	verified := createTestUser(t, h, "verified@example.com", models.RoleUser)
+	verified.IsVerified = true
+	require.NoError(t, stores.users.Save(context.Background(), &verified))
+
+	resend := func(email string) {
+		w := performRequest(r, "POST", "/api/auth/verify/resend", map[string]interface{}{"email": email})
+		require.Equal(t, http.StatusAccepted, w.Code)
+		assert.Contains(t, w.Body.String(), resendVerificationMessage)
+		h.background.Wait()
+	}
+
+	// The registration email was sent less than EMAIL_VERIFICATION_RESEND_INTERVAL ago
+	resend("test@example.com")
+	assert.Len(t, stores.verifications.All(), 1)
+
+	// Past the interval, up to five emails per hour are sent
+	t.Setenv("EMAIL_VERIFICATION_RESEND_INTERVAL", "1ns")
+	for i := 0; i < 5; i++ {
+		resend("test@example.com")
+	}
+	assert.Len(t, stores.verifications.All(), maxVerificationEmailsPerHour)
+
+	// Unknown and already verified addresses get the same answer and no email
+	resend("unknown@example.com")
+	resend("verified@example.com")
+	assert.Len(t, stores.verifications.All(), maxVerificationEmailsPerHour)
+	_, sent := stores.mail.Last("verified@example.com")
+	assert.False(t, sent)
+}
+
+func TestEmailVerificationPolicy(t *testing.T) {
+	tests := []struct {
+		policy      string
+		loginStatus int
+		apiStatus   int
+	}{
+		{policy: config.VerificationOptional, loginStatus: http.StatusOK, apiStatus: http.StatusOK},
+		{policy: config.VerificationAPI, loginStatus: http.StatusOK, apiStatus: http.StatusForbidden},
+		{policy: config.VerificationLogin, loginStatus: http.StatusForbidden, apiStatus: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.policy, func(t *testing.T) {
+			t.Setenv("EMAIL_VERIFICATION_POLICY", tt.policy)
+			h, stores := setupTestHandler()
+			r := setupVerificationRouter(h)
+			registerTestUser(t, r, "test@example.com")
+			user, err := stores.users.FindByEmail(context.Background(), "test@example.com")
+			require.NoError(t, err)
+
+			r.GET("/api/users/me", func(c *gin.Context) {
+				c.Set("user", *user)
+				c.Next()
+			}, middleware.RequireVerifiedEmail(), h.GetProfile)
+
+			w := performRequest(r, "POST", "/api/auth/login", map[string]interface{}{
+				"email":    "test@example.com",
+				"password": "Tr0ub4dor&3x",
+			})
+			assert.Equal(t, tt.loginStatus, w.Code, w.Body.String())
+			assert.Equal(t, tt.apiStatus, performRequest(r, "GET", "/api/users/me", nil).Code)
+
+			// Verified users are never stopped
+			user.IsVerified = true
+			require.NoError(t, stores.users.Save(context.Background(), user))
+			w = performRequest(r, "POST", "/api/auth/login", map[string]interface{}{
+				"email":    "test@example.com",
+				"password": "Tr0ub4dor&3x",
+			})
+			assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+			assert.Equal(t, http.StatusOK, performRequest(r, "GET", "/api/users/me", nil).Code)
+		})
+	}
+}
@@ -0,0 +1,172 @@
+package mailer
+
+import (
+	"fmt"
+	"log"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"crud-example/config"
+)
+
+// Message is an email to be delivered
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer delivers emails
+type Mailer interface {
+	Send(msg Message) error
+}
+
+var (
+	mu      sync.RWMutex
+	current Mailer = LogMailer{}
+)
+
+// SetMailer replaces the mailer used by Send
+func SetMailer(m Mailer) {
+	mu.Lock()
+	current = m
+	mu.Unlock()
+}
+
+// Current returns the mailer used by Send
+func Current() Mailer {
+	mu.RLock()
+	defer mu.RUnlock()
+	return current
+}
+
+// Send delivers msg with the current mailer
+func Send(msg Message) error {
+	return Current().Send(msg)
+}
+
+// FromConfig builds the mailer selected by MAILER:
+//   - log (default): writes emails to the application log
+//   - file: writes one .eml file per email into MAILER_DIR (default "mail")
+//   - smtp: delivers through SMTP_HOST:SMTP_PORT with SMTP_USER/SMTP_PASSWORD (or
+//     SMTP_PASSWORD_FILE)
+func FromConfig(cfg config.MailConfig) (Mailer, error) {
+	switch cfg.Driver {
+	case config.MailerLog:
+		return LogMailer{}, nil
+	case config.MailerFile:
+		return FileMailer{Dir: cfg.Dir}, nil
+	case config.MailerSMTP:
+		return SMTPMailer{
+			Host:     cfg.SMTPHost,
+			Port:     strconv.Itoa(cfg.SMTPPort),
+			Username: cfg.SMTPUser,
+			Password: cfg.SMTPPassword,
+			From:     cfg.From,
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown MAILER %q", cfg.Driver)
+	}
+}
+
+// LogMailer writes emails to the application log, for local development
+type LogMailer struct{}
+
+// Send logs the email
+func (LogMailer) Send(msg Message) error {
+	log.Printf("📧 Email to %s: %s\n%s", msg.To, msg.Subject, msg.Body)
+	return nil
+}
+
+// FileMailer writes each email to a file in Dir, for local development and tests
+type FileMailer struct {
+	Dir string
+}
+
+// Send writes the email to a new file
+func (m FileMailer) Send(msg Message) error {
+	if err := os.MkdirAll(m.Dir, 0o755); err != nil {
+		return err
+	}
+
+	name := fmt.Sprintf("%d-%s.eml", time.Now().UnixNano(), sanitize(msg.To))
+	return os.WriteFile(filepath.Join(m.Dir, name), []byte(format("", msg)), 0o600)
+}
+
+// MemoryMailer keeps sent emails in memory so tests can inspect them
+type MemoryMailer struct {
+	mu       sync.Mutex
+	messages []Message
+}
+
+// Send records the email
+func (m *MemoryMailer) Send(msg Message) error {
+	m.mu.Lock()
+	m.messages = append(m.messages, msg)
+	m.mu.Unlock()
+	return nil
+}
+
+// Messages returns every email sent so far
+func (m *MemoryMailer) Messages() []Message {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]Message(nil), m.messages...)
+}
+
+// Last returns the most recent email sent to the address
+func (m *MemoryMailer) Last(to string) (Message, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i := len(m.messages) - 1; i >= 0; i-- {
+		if m.messages[i].To == to {
+			return m.messages[i], true
+		}
+	}
+	return Message{}, false
+}
+
+// SMTPMailer delivers emails through an SMTP server
+type SMTPMailer struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+	From     string
+}
+
+// Send delivers the email
+func (m SMTPMailer) Send(msg Message) error {
+	var auth smtp.Auth
+	if m.Username != "" {
+		auth = smtp.PlainAuth("", m.Username, m.Password, m.Host)
+	}
+	return smtp.SendMail(m.Host+":"+m.Port, auth, m.From, []string{msg.To}, []byte(format(m.From, msg)))
+}
+
+// format renders msg as a plain text RFC 5322 message
+func format(from string, msg Message) string {
+	var b strings.Builder
+	if from != "" {
+		fmt.Fprintf(&b, "From: %s\r\n", from)
+	}
+	fmt.Fprintf(&b, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&b, "Subject: %s\r\n", msg.Subject)
+	b.WriteString("Content-Type: text/plain; charset=UTF-8\r\n\r\n")
+	b.WriteString(msg.Body)
+	return b.String()
+}
+
+func sanitize(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '/' || r == '\\' || r == '\r' || r == '\n' {
+			return '_'
+		}
+		return r
+	}, s)
+}
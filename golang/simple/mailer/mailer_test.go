@@ -0,0 +1,45 @@
+package mailer
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileMailer(t *testing.T) {
+	dir := t.TempDir()
+	m := FileMailer{Dir: dir}
+
+	err := m.Send(Message{To: "test@example.com", Subject: "Hello", Body: "Body text"})
+	require.NoError(t, err)
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.eml"))
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+
+	data, err := os.ReadFile(files[0])
+	require.NoError(t, err)
+	assert.Contains(t, string(data), "To: test@example.com")
+	assert.Contains(t, string(data), "Subject: Hello")
+	assert.Contains(t, string(data), "Body text")
+}
+
+func TestMemoryMailer(t *testing.T) {
+	m := &MemoryMailer{}
+	SetMailer(m)
+	defer SetMailer(LogMailer{})
+
+	require.NoError(t, Send(Message{To: "a@example.com", Subject: "first"}))
+	require.NoError(t, Send(Message{To: "b@example.com", Subject: "second"}))
+	require.NoError(t, Send(Message{To: "a@example.com", Subject: "third"}))
+
+	assert.Len(t, m.Messages(), 3)
+	last, ok := m.Last("a@example.com")
+	assert.True(t, ok)
+	assert.Equal(t, "third", last.Subject)
+	_, ok = m.Last("c@example.com")
+	assert.False(t, ok)
+}
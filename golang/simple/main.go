@@ -1,15 +1,25 @@
 package main
 
 import (
+	"context"
+	"fmt"
+	"io"
 	"log"
 	"os"
+	"path/filepath"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/joho/godotenv"
 	"crud-example/config"
+	"crud-example/federation"
 	"crud-example/handlers"
+	"crud-example/mailer"
 	"crud-example/middleware"
+	"crud-example/migrations"
 	"crud-example/models"
+	"crud-example/utils"
+	"crud-example/webauthn"
 )
 
 func main() {
@@ -18,24 +28,179 @@ func main() {
 		log.Println("No .env file found, using system environment variables")
 	}
 
+	// Load the configuration from the defaults, the config file, the environment and the
+	// flags before the subcommand
+	cfg, args, cfgErr := config.Load(os.Args[1:])
+	if cfg == nil {
+		os.Exit(2)
+	}
+
+	// Subcommands that do not start the server
+	if len(args) > 0 && args[0] == "calibrate-hash" {
+		if err := runCalibrateHash(args[1:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	if len(args) > 0 && args[0] == "config" {
+		if err := runConfig(cfg, cfgErr, args[1:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	if cfgErr != nil {
+		log.Fatalf("Invalid configuration:\n%v", cfgErr)
+	}
+	config.Set(cfg)
+	if err := setupLog(cfg.Log); err != nil {
+		log.Fatal("Failed to open log file:", err)
+	}
+
+	if len(args) > 0 && args[0] == "migrate" {
+		if err := runMigrate(cfg, args[1:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	// Configure password hashing; existing hashes are upgraded as users log in
+	hasher, err := utils.PasswordHasherFromConfig(cfg.Password)
+	if err != nil {
+		log.Fatal("Failed to configure password hashing:", err)
+	}
+	utils.SetPasswordHasher(hasher)
+
+	// Load the password policy; an unreadable breached password list stops the server
+	policy, err := utils.PasswordPolicyFromConfig(cfg.Password)
+	if err != nil {
+		log.Fatal("Failed to configure password policy:", err)
+	}
+	utils.SetPasswordPolicy(policy)
+
 	// Initialize database
-	db, err := config.InitDB()
+	db, err := config.InitDB(cfg)
 	if err != nil {
 		log.Fatal("Failed to connect to database:", err)
 	}
 
-	// Auto migrate database
-	if err := db.AutoMigrate(&models.User{}); err != nil {
-		log.Fatal("Failed to migrate database:", err)
+	// Apply pending migrations; the advisory lock lets a single instance migrate at a time
+	if cfg.Database.MigrateOnStart {
+		migrator, err := migrations.New(db)
+		if err != nil {
+			log.Fatal("Failed to load migrations:", err)
+		}
+		applied, err := migrator.Up(context.Background())
+		if err != nil {
+			log.Fatal("Failed to migrate database:", err)
+		}
+		for _, migration := range applied {
+			log.Printf("Applied migration %d_%s", migration.Version, migration.Name)
+		}
+	}
+
+	// Development only: let GORM sync the tables with the models
+	if cfg.Database.AutoMigrate {
+		log.Println("⚠️  DB_AUTO_MIGRATE is enabled, use versioned migrations outside development")
+		if err := migrations.AutoMigrate(db); err != nil {
+			log.Fatal("Failed to auto-migrate database:", err)
+		}
+	}
+
+	// Open the read replicas and keep checking their health; reads fall back to the primary
+	// while no replica is healthy
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	replicas, err := config.OpenReplicas(ctx, cfg, db)
+	cancel()
+	if err != nil {
+		log.Fatal("Failed to open read replicas:", err)
+	}
+	if cfg.Database.Replicas != "" {
+		go func() {
+			for range time.Tick(cfg.Database.ReplicaCheckInterval) {
+				ctx, cancel := context.WithTimeout(context.Background(), cfg.Database.ReplicaCheckInterval)
+				replicas.Check(ctx)
+				cancel()
+			}
+		}()
+	}
+
+	// Handlers and the authentication middleware share the repositories backed by db
+	h := handlers.New(db, replicas)
+	authenticate := middleware.AuthMiddleware(h.Authentication())
+
+	// Configure email delivery
+	m, err := mailer.FromConfig(cfg.Mail)
+	if err != nil {
+		log.Fatal("Failed to configure mailer:", err)
+	}
+	mailer.SetMailer(m)
+
+	// Configure the relying party for passkeys, named after the MFA issuer by default
+	rpName := cfg.WebAuthn.RPName
+	if rpName == "" {
+		rpName = cfg.MFA.Issuer
 	}
+	relyingParty, err := webauthn.NewConfig(cfg.Server.AppURL, cfg.WebAuthn.RPID, rpName, cfg.WebAuthn.Origins, cfg.WebAuthn.Timeout)
+	if err != nil {
+		log.Fatal("Failed to configure passkeys:", err)
+	}
+	webauthn.SetConfig(relyingParty)
+
+	// Register external identity providers for social login
+	federation.RegisterFromConfig(cfg.OIDC, cfg.Server.AppURL)
+
+	// Periodically drop expired token revocations and MFA attempts, and close accounts whose
+	// deletion is due
+	go func() {
+		for range time.Tick(10 * time.Minute) {
+			ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+			if err := h.Revocations.Purge(ctx); err != nil {
+				log.Println("Failed to purge token revocations:", err)
+			}
+			if err := h.PurgeMFAAttempts(ctx); err != nil {
+				log.Println("Failed to purge MFA attempts:", err)
+			}
+			if err := h.DeactivateDueAccounts(ctx); err != nil {
+				log.Println("Failed to deactivate deleted accounts:", err)
+			}
+			cancel()
+		}
+	}()
+
+	// Write the coalesced last-seen times of sessions
+	go func() {
+		for range time.Tick(cfg.Sessions.LastSeenInterval) {
+			ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+			if err := h.SessionTracker.Flush(ctx); err != nil {
+				log.Println("Failed to update session activity:", err)
+			}
+			cancel()
+		}
+	}()
 
 	// Set Gin mode
-	if os.Getenv("GIN_MODE") == "release" {
-		gin.SetMode(gin.ReleaseMode)
+	gin.SetMode(cfg.Server.GinMode)
+
+	// Load JWT signing keys
+	keyRing, err := utils.LoadKeyRing(cfg.JWT, gin.Mode() == gin.ReleaseMode)
+	if err != nil {
+		log.Fatal("Failed to load JWT keys:", err)
+	}
+	utils.SetKeyRing(keyRing)
+
+	// Create router; the access log is only written up to the info level
+	r := gin.New()
+	if cfg.Log.Level == config.LogDebug || cfg.Log.Level == config.LogInfo {
+		r.Use(gin.Logger())
 	}
+	r.Use(gin.Recovery())
 
-	// Create router
-	r := gin.Default()
+	// Bound every request, and the database queries it runs, to REQUEST_TIMEOUT
+	r.Use(middleware.Deadline(cfg.Server.RequestTimeout))
+
+	// Let the reads of GET requests go to the read replicas
+	r.Use(middleware.ReadRouting())
 
 	// CORS middleware
 	r.Use(middleware.CORS())
@@ -44,9 +209,24 @@ func main() {
 	r.GET("/health", func(c *gin.Context) {
 		c.JSON(200, gin.H{
 			"status":      "OK",
-			"environment": os.Getenv("ENVIRONMENT"),
+			"environment": cfg.Server.Environment,
 		})
 	})
+	r.GET("/health/db", middleware.Deadline(2*time.Second), h.DatabaseHealth)
+
+	// Public keys for verifying access tokens
+	r.GET("/.well-known/jwks.json", h.JWKS)
+	r.GET("/.well-known/oauth-authorization-server", h.OAuthMetadata)
+
+	// OAuth2 authorization server for third-party applications
+	oauth := r.Group("/oauth")
+	{
+		oauth.GET("/authorize", h.Authorize)
+		oauth.POST("/authorize", h.AuthorizeDecision)
+		oauth.POST("/token", h.Token)
+		oauth.POST("/introspect", middleware.Deadline(5*time.Second), h.Introspect)
+		oauth.POST("/revoke", h.Revoke)
+	}
 
 	// API routes
 	api := r.Group("/api")
@@ -54,30 +234,133 @@ func main() {
 		// Auth routes (no authentication required)
 		auth := api.Group("/auth")
 		{
-			auth.POST("/register", handlers.Register)
-			auth.POST("/login", handlers.Login)
+			auth.POST("/register", h.Register)
+			auth.POST("/login", h.Login)
+			auth.POST("/refresh", h.Refresh)
+			auth.POST("/logout", authenticate, middleware.RequireTokenAuth(), h.Logout)
+			auth.POST("/logout-all", authenticate, middleware.RequireTokenAuth(), middleware.RequireNoImpersonation(), h.LogoutAll)
+			auth.POST("/impersonation/stop", authenticate, h.StopImpersonation)
+			auth.POST("/password/forgot", h.ForgotPassword)
+			auth.POST("/password/reset", h.ResetPassword)
+			auth.GET("/verify", h.VerifyEmail)
+			auth.POST("/verify/resend", h.ResendVerification)
+			auth.POST("/mfa/verify", h.VerifyMFA)
+			auth.POST("/magic-link", h.RequestMagicLink)
+			auth.GET("/magic-link/callback", h.MagicLinkCallback)
+			auth.POST("/passkeys/login/begin", h.BeginPasskeyLogin)
+			auth.POST("/passkeys/login/finish", h.FinishPasskeyLogin)
+			auth.POST("/mfa/passkey/begin", h.BeginPasskeyMFA)
+			auth.POST("/mfa/passkey/finish", h.FinishPasskeyMFA)
+
+			// MFA management (authentication required)
+			mfa := auth.Group("/mfa")
+			mfa.Use(authenticate, middleware.RequireTokenAuth(), middleware.RequireNoImpersonation())
+			{
+				mfa.POST("/enroll", h.EnrollMFA)
+				mfa.POST("/confirm", h.ConfirmMFA)
+				mfa.POST("/disable", h.DisableMFA)
+			}
+
+			// Passkey management (user token required)
+			passkeys := auth.Group("/passkeys")
+			passkeys.Use(authenticate, middleware.RequireTokenAuth(), middleware.RequireNoImpersonation())
+			{
+				passkeys.GET("", h.ListPasskeys)
+				passkeys.POST("/register/begin", h.BeginPasskeyRegistration)
+				passkeys.POST("/register/finish", h.FinishPasskeyRegistration)
+				passkeys.PATCH("/:id", h.RenamePasskey)
+				passkeys.DELETE("/:id", h.DeletePasskey)
+			}
+
+			// Personal API keys (user token required)
+			apiKeys := auth.Group("/api-keys")
+			apiKeys.Use(authenticate, middleware.RequireTokenAuth(), middleware.RequireNoImpersonation())
+			{
+				apiKeys.GET("", h.ListAPIKeys)
+				apiKeys.POST("", h.CreateAPIKey)
+				apiKeys.PATCH("/:id", h.UpdateAPIKey)
+				apiKeys.DELETE("/:id", h.RevokeAPIKey)
+			}
+
+			// OAuth clients registered by the user (user token required)
+			oauthClients := auth.Group("/oauth-clients")
+			oauthClients.Use(authenticate, middleware.RequireTokenAuth(), middleware.RequireNoImpersonation())
+			{
+				oauthClients.GET("", h.ListOAuthClients)
+				oauthClients.POST("", h.CreateOAuthClient)
+				oauthClients.DELETE("/:id", h.DeleteOAuthClient)
+			}
+
+			// Social login through external OpenID Connect providers
+			oidc := auth.Group("/oidc")
+			{
+				oidc.GET("", h.ListIdentityProviders)
+				oidc.GET("/:provider/login", h.OIDCLogin)
+				oidc.GET("/:provider/callback", h.OIDCCallback)
+				oidc.POST("/:provider/link", authenticate, middleware.RequireTokenAuth(), middleware.RequireNoImpersonation(), h.LinkIdentity)
+			}
+
+			// Linked external identities (user token required)
+			identities := auth.Group("/identities")
+			identities.Use(authenticate, middleware.RequireTokenAuth(), middleware.RequireNoImpersonation())
+			{
+				identities.GET("", h.ListIdentities)
+				identities.DELETE("/:provider", h.UnlinkIdentity)
+			}
 		}
 
 		// User routes (authentication required)
+		// Own password (reachable with an expired password)
+		api.PUT("/users/me/password", authenticate, middleware.RequireTokenAuth(), middleware.RequireNoImpersonation(), h.ChangePassword)
+
 		users := api.Group("/users")
-		users.Use(middleware.AuthMiddleware())
+		users.Use(authenticate, middleware.RequireVerifiedEmail(), middleware.RequireMFA(h.Settings), middleware.RequirePasswordRotation())
 		{
-			users.GET("/", handlers.GetUsers)
-			users.GET("/:id", handlers.GetUser)
-			users.POST("/", handlers.CreateUser)
-			users.PUT("/:id", handlers.UpdateUser)
-			users.DELETE("/:id", handlers.DeleteUser)
+			users.GET("/me", h.GetProfile)
+			users.PATCH("/me", middleware.RequireNoImpersonation(), middleware.RequirePermission(models.PermissionProfileUpdate), h.UpdateProfile)
+			users.DELETE("/me", middleware.RequireTokenAuth(), middleware.RequireNoImpersonation(), middleware.RequirePermission(models.PermissionProfileUpdate), h.DeleteProfile)
+			users.POST("/me/cancel-deletion", middleware.RequireNoImpersonation(), middleware.RequirePermission(models.PermissionProfileUpdate), h.CancelProfileDeletion)
+			users.GET("/me/sessions", middleware.RequireTokenAuth(), h.ListSessions)
+			users.DELETE("/me/sessions/:id", middleware.RequireTokenAuth(), middleware.RequireNoImpersonation(), h.RevokeSession)
+			users.GET("/", middleware.RequirePermission(models.PermissionUsersRead), h.GetUsers)
+			users.GET("/:id", middleware.RequirePermission(models.PermissionUsersRead), h.GetUser)
+			users.POST("/", middleware.RequirePermission(models.PermissionUsersCreate), h.CreateUser)
+			users.PUT("/:id", middleware.RequireNoImpersonation(), h.UpdateUser)
+			users.DELETE("/:id", middleware.RequirePermission(models.PermissionUsersDelete), h.DeleteUser)
 		}
-	}
 
-	// Get port from environment or use default
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8080"
+		// Admin routes
+		admin := api.Group("/admin")
+		admin.Use(authenticate, middleware.RequireMFA(h.Settings), middleware.RequirePasswordRotation(), middleware.RequireRole(models.RoleAdmin))
+		{
+			admin.GET("/mfa/policy", h.GetMFAPolicy)
+			admin.PUT("/mfa/policy", h.UpdateMFAPolicy)
+			admin.POST("/users/:id/mfa/reset", h.ResetUserMFA)
+			admin.POST("/users/:id/unlock", h.UnlockUser)
+			admin.POST("/users/:id/impersonate", middleware.RequireTokenAuth(), h.StartImpersonation)
+		}
 	}
 
-	log.Printf("🚀 Server starting on port %s", port)
-	if err := r.Run(":" + port); err != nil {
+	log.Printf("🚀 Server starting on port %d", cfg.Server.Port)
+	if err := r.Run(fmt.Sprintf(":%d", cfg.Server.Port)); err != nil {
 		log.Fatal("Failed to start server:", err)
 	}
-} 
\ No newline at end of file
+} 
+
+// setupLog also writes the application and access logs to the configured file
+func setupLog(cfg config.LogConfig) error {
+	if cfg.File == "" {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(cfg.File), 0o755); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(cfg.File, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	log.SetOutput(io.MultiWriter(os.Stderr, file))
+	gin.DefaultWriter = io.MultiWriter(os.Stdout, file)
+	gin.DefaultErrorWriter = io.MultiWriter(os.Stderr, file)
+	return nil
+}
@@ -0,0 +1,66 @@
+package middleware
+
+import (
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"crud-example/utils"
+)
+
+// apiKeyUsageInterval coalesces last-used updates so busy keys do not write on every request
+const apiKeyUsageInterval = time.Minute
+
+// authenticateAPIKey authenticates the request with a personal API key, setting the
+// user, the key and its scopes in context
+func authenticateAPIKey(c *gin.Context, auth Authentication, rawKey string) {
+	publicID, secret, err := utils.ParseAPIKey(rawKey)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid API key"})
+		c.Abort()
+		return
+	}
+
+	key, err := auth.APIKeys.FindActiveByPublicID(c.Request.Context(), publicID)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid API key"})
+		c.Abort()
+		return
+	}
+
+	if !utils.CompareTokenHash(secret, key.KeyHash) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid API key"})
+		c.Abort()
+		return
+	}
+
+	now := time.Now()
+	if key.ExpiresAt != nil && now.After(*key.ExpiresAt) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "API key has expired"})
+		c.Abort()
+		return
+	}
+
+	// Get user from database
+	user, err := auth.Users.FindActiveByID(c.Request.Context(), key.UserID)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found or inactive"})
+		c.Abort()
+		return
+	}
+
+	// Record usage
+	ip := c.ClientIP()
+	if key.LastUsedAt == nil || now.Sub(*key.LastUsedAt) > apiKeyUsageInterval || key.LastUsedIP != ip {
+		if err := auth.APIKeys.RecordUsage(c.Request.Context(), key.ID, now, ip); err != nil {
+			log.Printf("Failed to record usage of API key %d: %v", key.ID, err)
+		}
+	}
+
+	// Set user, key and scopes in context
+	setCurrentUser(c, *user)
+	c.Set("api_key", *key)
+	c.Set("scopes", key.ScopeList())
+	c.Next()
+}
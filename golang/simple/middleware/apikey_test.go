@@ -0,0 +1,92 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"crud-example/models"
+	"crud-example/repository"
+	"crud-example/utils"
+)
+
+func TestAPIKeyAuthentication(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	ctx := context.Background()
+
+	users := repository.NewMemoryUserRepository()
+	user := &models.User{Name: "Machine", Email: "machine@example.com", IsActive: true, Role: models.RoleUser}
+	require.NoError(t, users.Create(ctx, user))
+	keys := repository.NewMemoryAPIKeyRepository()
+
+	// createKey stores an API key of the user and returns its secret form
+	createKey := func(scopes string, expiresAt, revokedAt *time.Time) string {
+		key, publicID, hash, err := utils.GenerateAPIKey()
+		require.NoError(t, err)
+		require.NoError(t, keys.Create(ctx, &models.APIKey{
+			UserID:    user.ID,
+			Name:      "ci",
+			PublicID:  publicID,
+			KeyHash:   hash,
+			Scopes:    scopes,
+			ExpiresAt: expiresAt,
+			RevokedAt: revokedAt,
+		}))
+		return key
+	}
+	past, future := time.Now().Add(-time.Hour), time.Now().Add(time.Hour)
+	unscoped := createKey("", &future, nil)
+	readOnly := createKey(models.PermissionUsersRead, nil, nil)
+	expired := createKey("", &past, nil)
+	revoked := createKey("", nil, &past)
+
+	r := gin.New()
+	r.Use(AuthMiddleware(Authentication{Users: users, APIKeys: keys}))
+	r.GET("/users", RequirePermission(models.PermissionUsersRead), func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"user_id": CurrentUser(c).ID})
+	})
+	r.PATCH("/users/me", RequirePermission(models.PermissionProfileUpdate), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	tests := []struct {
+		name          string
+		method        string
+		path          string
+		authorization string
+		wantStatus    int
+	}{
+		{name: "Valid key", method: http.MethodGet, path: "/users", authorization: "ApiKey " + unscoped, wantStatus: http.StatusOK},
+		{name: "Unscoped key uses every permission of its owner", method: http.MethodPatch, path: "/users/me", authorization: "ApiKey " + unscoped, wantStatus: http.StatusOK},
+		{name: "Scope allows", method: http.MethodGet, path: "/users", authorization: "ApiKey " + readOnly, wantStatus: http.StatusOK},
+		{name: "Scope forbids", method: http.MethodPatch, path: "/users/me", authorization: "ApiKey " + readOnly, wantStatus: http.StatusForbidden},
+		{name: "Expired key", method: http.MethodGet, path: "/users", authorization: "ApiKey " + expired, wantStatus: http.StatusUnauthorized},
+		{name: "Revoked key", method: http.MethodGet, path: "/users", authorization: "ApiKey " + revoked, wantStatus: http.StatusUnauthorized},
+		{name: "Wrong secret", method: http.MethodGet, path: "/users", authorization: "ApiKey " + unscoped + "x", wantStatus: http.StatusUnauthorized},
+		{name: "Malformed key", method: http.MethodGet, path: "/users", authorization: "ApiKey not-a-key", wantStatus: http.StatusUnauthorized},
+		{name: "Key sent as a bearer token", method: http.MethodGet, path: "/users", authorization: "Bearer " + unscoped, wantStatus: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			req.Header.Set("Authorization", tt.authorization)
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			assert.Equal(t, tt.wantStatus, w.Code, w.Body.String())
+		})
+	}
+
+	// Usage of the key is recorded
+	publicID, _, err := utils.ParseAPIKey(unscoped)
+	require.NoError(t, err)
+	key, err := keys.FindActiveByPublicID(ctx, publicID)
+	require.NoError(t, err)
+	require.NotNil(t, key.LastUsedAt)
+	assert.NotEmpty(t, key.LastUsedIP)
+}
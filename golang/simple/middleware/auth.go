@@ -5,13 +5,22 @@ import (
 	"strings"
 
 	"github.com/gin-gonic/gin"
-	"crud-example/config"
-	"crud-example/models"
+	"crud-example/repository"
 	"crud-example/utils"
 )
 
-// AuthMiddleware validates JWT token and sets user in context
-func AuthMiddleware() gin.HandlerFunc {
+// Authentication holds the stores AuthMiddleware checks credentials against
+type Authentication struct {
+	Users       repository.UserRepository
+	APIKeys     repository.APIKeyRepository
+	Revocations *utils.RevocationStore
+	Sessions    *utils.SessionTracker
+	Audit       *utils.AuditLog
+}
+
+// AuthMiddleware validates a JWT token ("Bearer <token>") or a personal API key
+// ("ApiKey <key>") and sets the user, loaded from auth.Users, in context
+func AuthMiddleware(auth Authentication) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// Get Authorization header
 		authHeader := c.GetHeader("Authorization")
@@ -21,14 +30,19 @@ func AuthMiddleware() gin.HandlerFunc {
 			return
 		}
 
-		// Check if header starts with "Bearer "
+		// Check if header starts with "Bearer " or "ApiKey "
 		tokenParts := strings.Split(authHeader, " ")
-		if len(tokenParts) != 2 || tokenParts[0] != "Bearer" {
+		if len(tokenParts) != 2 || (tokenParts[0] != "Bearer" && tokenParts[0] != "ApiKey") {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid authorization header format"})
 			c.Abort()
 			return
 		}
 
+		if tokenParts[0] == "ApiKey" {
+			authenticateAPIKey(c, auth, tokenParts[1])
+			return
+		}
+
 		tokenString := tokenParts[1]
 
 		// Validate token
@@ -39,16 +53,59 @@ func AuthMiddleware() gin.HandlerFunc {
 			return
 		}
 
+		// Reject revoked tokens
+		revoked, err := auth.Revocations.IsRevoked(c.Request.Context(), claims)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check token status"})
+			c.Abort()
+			return
+		}
+		if revoked {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Token has been revoked"})
+			c.Abort()
+			return
+		}
+
+		// Reject tokens bound to a session that was revoked or expired
+		if claims.SessionID != "" {
+			active, err := auth.Sessions.IsActive(c.Request.Context(), claims.UserID, claims.SessionID)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check session status"})
+				c.Abort()
+				return
+			}
+			if !active {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "Session has been revoked"})
+				c.Abort()
+				return
+			}
+			auth.Sessions.Touch(claims.SessionID)
+		}
+
 		// Get user from database
-		var user models.User
-		if err := config.DB.Where("id = ? AND is_active = ?", claims.UserID, true).First(&user).Error; err != nil {
+		user, err := auth.Users.FindActiveByID(c.Request.Context(), claims.UserID)
+		if err != nil {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found or inactive"})
 			c.Abort()
 			return
 		}
 
-		// Set user in context
-		c.Set("user", user)
+		// Impersonation tokens stay valid only while the administrator may impersonate
+		if claims.Impersonated() {
+			if !authorizeImpersonation(c, auth.Users, claims) {
+				return
+			}
+			defer auditImpersonatedRequest(c, auth.Audit, claims)
+		}
+
+		// Set user and token claims in context
+		setCurrentUser(c, *user)
+		c.Set("claims", claims)
+
+		// Tokens issued to OAuth clients are restricted to the granted scopes
+		if claims.ClientID != "" {
+			c.Set("scopes", claims.ScopeList())
+		}
 		c.Next()
 	}
 }
@@ -57,8 +114,9 @@ func AuthMiddleware() gin.HandlerFunc {
 func CORS() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		c.Header("Access-Control-Allow-Origin", "*")
-		c.Header("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
+		c.Header("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
 		c.Header("Access-Control-Allow-Headers", "Origin, Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization")
+		c.Header("Access-Control-Expose-Headers", HeaderImpersonatorID+", "+HeaderImpersonatorEmail)
 
 		if c.Request.Method == "OPTIONS" {
 			c.AbortWithStatus(http.StatusNoContent)
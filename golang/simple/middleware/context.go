@@ -0,0 +1,34 @@
+package middleware
+
+import (
+	"github.com/gin-gonic/gin"
+	"crud-example/models"
+)
+
+// userKey is the context key AuthMiddleware stores the authenticated user under
+const userKey = "user"
+
+// CurrentUser returns the user authenticated by AuthMiddleware. Like c.MustGet it panics
+// when no user is set, so it must only be used on routes behind AuthMiddleware.
+func CurrentUser(c *gin.Context) models.User {
+	user, ok := LookupUser(c)
+	if !ok {
+		panic("middleware: no authenticated user in context")
+	}
+	return user
+}
+
+// LookupUser returns the authenticated user, if any
+func LookupUser(c *gin.Context) (models.User, bool) {
+	value, ok := c.Get(userKey)
+	if !ok {
+		return models.User{}, false
+	}
+	user, ok := value.(models.User)
+	return user, ok
+}
+
+// setCurrentUser stores the authenticated user in the context
+func setCurrentUser(c *gin.Context, user models.User) {
+	c.Set(userKey, user)
+}
@@ -0,0 +1,25 @@
+package middleware
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"crud-example/models"
+)
+
+func TestCurrentUser(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+
+	_, ok := LookupUser(c)
+	assert.False(t, ok)
+	assert.Panics(t, func() { CurrentUser(c) })
+
+	setCurrentUser(c, models.User{ID: 7, Email: "me@example.com"})
+	user, ok := LookupUser(c)
+	assert.True(t, ok)
+	assert.Equal(t, uint(7), user.ID)
+	assert.Equal(t, "me@example.com", CurrentUser(c).Email)
+}
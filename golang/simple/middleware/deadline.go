@@ -0,0 +1,32 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Deadline bounds the request context to d. Handlers pass that context to their database
+// queries, so a slow query is cancelled once the deadline passes, as is any query of a
+// request whose client has disconnected. A route can only shorten the deadline set for its
+// group. When the handler gives up without responding, the client gets a 503.
+func Deadline(d time.Duration) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), d)
+		defer cancel()
+		c.Request = c.Request.WithContext(ctx)
+
+		c.Next()
+
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			log.Printf("Request %s %s exceeded its %s deadline", c.Request.Method, c.FullPath(), d)
+			if !c.Writer.Written() {
+				c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{"error": "Request timed out"})
+			}
+		}
+	}
+}
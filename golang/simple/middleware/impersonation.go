@@ -0,0 +1,67 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"crud-example/models"
+	"crud-example/repository"
+	"crud-example/utils"
+)
+
+// Response headers marking requests made with an impersonation token, so clients can show a banner
+const (
+	HeaderImpersonatorID    = "X-Impersonator-Id"
+	HeaderImpersonatorEmail = "X-Impersonator-Email"
+)
+
+// authorizeImpersonation checks that the administrator in the act claim of an impersonation
+// token is still an active administrator and marks the response, writing the error response
+// otherwise
+func authorizeImpersonation(c *gin.Context, users repository.UserRepository, claims *utils.Claims) bool {
+	actor, err := users.FindActiveByID(c.Request.Context(), claims.Actor.UserID)
+	if err != nil || actor.Role != models.RoleAdmin {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Impersonating administrator not found or no longer allowed"})
+		c.Abort()
+		return false
+	}
+
+	c.Header(HeaderImpersonatorID, strconv.FormatUint(uint64(actor.ID), 10))
+	c.Header(HeaderImpersonatorEmail, actor.Email)
+	return true
+}
+
+// auditImpersonatedRequest records a request made with an impersonation token once it has
+// been handled, so it can be attributed to both the administrator and the user
+func auditImpersonatedRequest(c *gin.Context, audit *utils.AuditLog, claims *utils.Claims) {
+	audit.Record(c.Request.Context(), utils.AuditEvent{
+		Level:     utils.AuditInfo,
+		Message:   "Impersonated request",
+		UserID:    &claims.UserID,
+		IPAddress: c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+		Context: map[string]interface{}{
+			"admin_id": claims.Actor.UserID,
+			"method":   c.Request.Method,
+			"path":     c.Request.URL.Path,
+			"status":   c.Writer.Status(),
+		},
+	})
+}
+
+// RequireNoImpersonation rejects sensitive operations, such as changing credentials or
+// deleting the account, when the request is made with an impersonation token.
+// It must run after AuthMiddleware.
+func RequireNoImpersonation() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		value, _ := c.Get("claims")
+		if claims, ok := value.(*utils.Claims); ok && claims.Impersonated() {
+			c.JSON(http.StatusForbidden, gin.H{"error": "This operation is not allowed while impersonating a user", "impersonation": true})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
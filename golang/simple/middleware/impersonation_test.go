@@ -0,0 +1,44 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"crud-example/utils"
+)
+
+func TestRequireNoImpersonation(t *testing.T) {
+	tests := []struct {
+		name       string
+		claims     *utils.Claims
+		wantStatus int
+	}{
+		{name: "User token", claims: &utils.Claims{UserID: 2}, wantStatus: http.StatusOK},
+		{name: "Impersonation token", claims: &utils.Claims{UserID: 2, Actor: &utils.Actor{UserID: 1}}, wantStatus: http.StatusForbidden},
+		{name: "API key", claims: nil, wantStatus: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gin.SetMode(gin.TestMode)
+			r := gin.New()
+			r.GET("/", func(c *gin.Context) {
+				if tt.claims != nil {
+					c.Set("claims", tt.claims)
+				}
+				c.Next()
+			}, RequireNoImpersonation(), func(c *gin.Context) {
+				c.Status(http.StatusOK)
+			})
+
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", "/", nil)
+			r.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.wantStatus, w.Code)
+		})
+	}
+}
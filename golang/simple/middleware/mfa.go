@@ -0,0 +1,32 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"crud-example/utils"
+)
+
+// RequireMFA rejects users whose role requires MFA but who have not enrolled yet.
+// The policy is read from settings. It must run after AuthMiddleware.
+func RequireMFA(settings *utils.Settings) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user := CurrentUser(c)
+
+		if !user.MFAEnabled {
+			required, err := settings.RoleRequiresMFA(c.Request.Context(), user.Role)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check MFA policy"})
+				c.Abort()
+				return
+			}
+			if required {
+				c.JSON(http.StatusForbidden, gin.H{"error": "MFA enrollment required"})
+				c.Abort()
+				return
+			}
+		}
+
+		c.Next()
+	}
+}
@@ -0,0 +1,35 @@
+package middleware
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"crud-example/config"
+	"crud-example/utils"
+)
+
+// PasswordMaxAge returns how long a password may be used before it must be changed
+// (PASSWORD_MAX_AGE); zero, the default, disables forced rotation
+func PasswordMaxAge() time.Duration {
+	return config.Current().Password.MaxAge
+}
+
+// RequirePasswordRotation rejects password sessions of users whose password is older than
+// PasswordMaxAge until they change it. API keys and OAuth client tokens are not affected.
+// It must run after AuthMiddleware.
+func RequirePasswordRotation() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user := CurrentUser(c)
+
+		value, ok := c.Get("claims")
+		claims, _ := value.(*utils.Claims)
+		if ok && claims != nil && claims.ClientID == "" && user.PasswordExpired(PasswordMaxAge()) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Password expired, please change it", "password_change_required": true})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
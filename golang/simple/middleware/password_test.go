@@ -0,0 +1,57 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"crud-example/models"
+	"crud-example/utils"
+)
+
+func TestRequirePasswordRotation(t *testing.T) {
+	old := time.Now().Add(-100 * 24 * time.Hour)
+	recent := time.Now().Add(-time.Hour)
+
+	tests := []struct {
+		name       string
+		maxAge     string
+		changedAt  *time.Time
+		claims     *utils.Claims
+		wantStatus int
+	}{
+		{name: "Rotation disabled", maxAge: "", changedAt: &old, claims: &utils.Claims{}, wantStatus: http.StatusOK},
+		{name: "Recent password", maxAge: "720h", changedAt: &recent, claims: &utils.Claims{}, wantStatus: http.StatusOK},
+		{name: "Expired password", maxAge: "720h", changedAt: &old, claims: &utils.Claims{}, wantStatus: http.StatusForbidden},
+		{name: "Never changed falls back to creation", maxAge: "720h", changedAt: nil, claims: &utils.Claims{}, wantStatus: http.StatusForbidden},
+		{name: "OAuth client token", maxAge: "720h", changedAt: &old, claims: &utils.Claims{ClientID: "client"}, wantStatus: http.StatusOK},
+		{name: "API key", maxAge: "720h", changedAt: &old, claims: nil, wantStatus: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("PASSWORD_MAX_AGE", tt.maxAge)
+
+			gin.SetMode(gin.TestMode)
+			r := gin.New()
+			r.GET("/", func(c *gin.Context) {
+				c.Set("user", models.User{ID: 1, CreatedAt: old, PasswordChangedAt: tt.changedAt})
+				if tt.claims != nil {
+					c.Set("claims", tt.claims)
+				}
+				c.Next()
+			}, RequirePasswordRotation(), func(c *gin.Context) {
+				c.Status(http.StatusOK)
+			})
+
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", "/", nil)
+			r.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.wantStatus, w.Code)
+		})
+	}
+}
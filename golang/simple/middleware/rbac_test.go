@@ -0,0 +1,107 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"crud-example/models"
+)
+
+func setupRBACRouter(role string, guard gin.HandlerFunc) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/", func(c *gin.Context) {
+		c.Set("user", models.User{ID: 1, Role: role})
+		c.Next()
+	}, guard, func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+	return r
+}
+
+func TestRequireRole(t *testing.T) {
+	tests := []struct {
+		name       string
+		role       string
+		wantStatus int
+	}{
+		{name: "Allowed role", role: models.RoleAdmin, wantStatus: http.StatusOK},
+		{name: "Other allowed role", role: models.RoleModerator, wantStatus: http.StatusOK},
+		{name: "Forbidden role", role: models.RoleUser, wantStatus: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := setupRBACRouter(tt.role, RequireRole(models.RoleAdmin, models.RoleModerator))
+
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", "/", nil)
+			r.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.wantStatus, w.Code)
+		})
+	}
+}
+
+func TestRequirePermission(t *testing.T) {
+	tests := []struct {
+		name        string
+		role        string
+		permissions []string
+		wantStatus  int
+	}{
+		{name: "User can read", role: models.RoleUser, permissions: []string{models.PermissionUsersRead}, wantStatus: http.StatusOK},
+		{name: "User cannot delete", role: models.RoleUser, permissions: []string{models.PermissionUsersDelete}, wantStatus: http.StatusForbidden},
+		{name: "Admin has all", role: models.RoleAdmin, permissions: []string{models.PermissionUsersCreate, models.PermissionUsersManage}, wantStatus: http.StatusOK},
+		{name: "Unknown role", role: "guest", permissions: []string{models.PermissionUsersRead}, wantStatus: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := setupRBACRouter(tt.role, RequirePermission(tt.permissions...))
+
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", "/", nil)
+			r.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.wantStatus, w.Code)
+		})
+	}
+}
+
+func TestRequirePermissionWithScopes(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name       string
+		scopes     []string
+		wantStatus int
+	}{
+		{name: "Unrestricted key", scopes: nil, wantStatus: http.StatusOK},
+		{name: "Scope granted", scopes: []string{models.PermissionUsersRead}, wantStatus: http.StatusOK},
+		{name: "Scope missing", scopes: []string{models.PermissionProfileUpdate}, wantStatus: http.StatusForbidden},
+		{name: "Client token without scopes", scopes: []string{}, wantStatus: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := gin.New()
+			r.GET("/", func(c *gin.Context) {
+				c.Set("user", models.User{ID: 1, Role: models.RoleAdmin})
+				c.Set("scopes", tt.scopes)
+				c.Next()
+			}, RequirePermission(models.PermissionUsersRead), func(c *gin.Context) {
+				c.Status(http.StatusOK)
+			})
+
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", "/", nil)
+			r.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.wantStatus, w.Code)
+		})
+	}
+}
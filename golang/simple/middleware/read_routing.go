@@ -0,0 +1,25 @@
+package middleware
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"crud-example/config"
+)
+
+// ReadPrimaryHeader forces every read of a request to the primary database, for clients that
+// must see a write made by a previous request
+const ReadPrimaryHeader = "X-Read-Primary"
+
+// ReadRouting lets the reads of GET and HEAD requests go to the read replicas, see
+// config.Replicas. Other methods read from the primary, so that a record read before being
+// updated is never stale, as do requests sent with "X-Read-Primary: true".
+func ReadRouting() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		safe := c.Request.Method == http.MethodGet || c.Request.Method == http.MethodHead
+		primary := !safe || strings.EqualFold(c.GetHeader(ReadPrimaryHeader), "true")
+		c.Request = c.Request.WithContext(config.WithReadRouting(c.Request.Context(), primary))
+		c.Next()
+	}
+}
@@ -0,0 +1,47 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"crud-example/config"
+)
+
+func TestReadRouting(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(ReadRouting())
+
+	var primary bool
+	record := func(c *gin.Context) {
+		primary = config.PrimaryReads(c.Request.Context())
+		c.Status(http.StatusNoContent)
+	}
+	r.GET("/users", record)
+	r.PUT("/users", record)
+
+	tests := []struct {
+		name        string
+		method      string
+		header      string
+		wantPrimary bool
+	}{
+		{name: "GET reads from replicas", method: http.MethodGet, wantPrimary: false},
+		{name: "PUT reads from primary", method: http.MethodPut, wantPrimary: true},
+		{name: "Header forces primary", method: http.MethodGet, header: "true", wantPrimary: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/users", nil)
+			if tt.header != "" {
+				req.Header.Set(ReadPrimaryHeader, tt.header)
+			}
+			r.ServeHTTP(httptest.NewRecorder(), req)
+			assert.Equal(t, tt.wantPrimary, primary)
+		})
+	}
+}
@@ -0,0 +1,24 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"crud-example/utils"
+)
+
+// RequireTokenAuth rejects requests authenticated with an API key or with a token issued
+// to an OAuth client, for operations that must not be reachable by machine clients or
+// third-party applications, such as managing API keys. It must run after AuthMiddleware.
+func RequireTokenAuth() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		value, ok := c.Get("claims")
+		if claims, isClaims := value.(*utils.Claims); !ok || !isClaims || claims.ClientID != "" {
+			c.JSON(http.StatusForbidden, gin.H{"error": "This operation requires a user token"})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
@@ -0,0 +1,24 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"crud-example/config"
+)
+
+// RequireVerifiedEmail rejects users whose email is not verified unless the
+// email verification policy allows it. It must run after AuthMiddleware.
+func RequireVerifiedEmail() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user := CurrentUser(c)
+
+		if !user.IsVerified && config.Current().Account.EmailVerificationPolicy != config.VerificationOptional {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Email address not verified"})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
@@ -0,0 +1,56 @@
+package migrations
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// ErrEmptyName is returned by Create when nothing is left of the name after normalisation
+var ErrEmptyName = errors.New("migration name is empty")
+
+var invalidNameChars = regexp.MustCompile(`[^a-z0-9]+`)
+
+// Create writes an empty up and down file for a new migration into the directory of every
+// dialect under dir, numbered after the newest migration found there, and returns their paths
+func Create(dir, name string) ([]string, error) {
+	name = strings.Trim(invalidNameChars.ReplaceAllString(strings.ToLower(name), "_"), "_")
+	if name == "" {
+		return nil, ErrEmptyName
+	}
+
+	version := int64(1)
+	for _, dialect := range Dialects {
+		if err := os.MkdirAll(filepath.Join(dir, dialect), 0o755); err != nil {
+			return nil, err
+		}
+		existing, err := Load(os.DirFS(filepath.Join(dir, dialect)))
+		if err != nil {
+			return nil, err
+		}
+		if len(existing) > 0 && existing[len(existing)-1].Version >= version {
+			version = existing[len(existing)-1].Version + 1
+		}
+	}
+
+	base := fmt.Sprintf("%04d_%s", version, name)
+	up := fmt.Sprintf("-- %s: schema change\n", base)
+	down := fmt.Sprintf("-- %s: revert the schema change\n", base)
+
+	var paths []string
+	for _, dialect := range Dialects {
+		upPath := filepath.Join(dir, dialect, base+".up.sql")
+		downPath := filepath.Join(dir, dialect, base+".down.sql")
+		if err := os.WriteFile(upPath, []byte(up), 0o644); err != nil {
+			return nil, err
+		}
+		if err := os.WriteFile(downPath, []byte(down), 0o644); err != nil {
+			return nil, err
+		}
+		paths = append(paths, upPath, downPath)
+	}
+	return paths, nil
+}
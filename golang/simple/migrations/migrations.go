@@ -0,0 +1,316 @@
+// Package migrations applies the versioned SQL migrations embedded in the binary. Each
+// migration is a pair of files in sql/<dialect>/ named <version>_<name>.up.sql and
+// <version>_<name>.down.sql; applied versions are recorded in the schema_migrations table.
+// Every dialect has its own copy of each migration, with the same version and name.
+package migrations
+
+import (
+	"context"
+	"embed"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"crud-example/models"
+)
+
+//go:embed sql/*/*.sql
+var embedded embed.FS
+
+// Dialects lists the databases with migrations, named as their GORM dialector
+var Dialects = []string{"postgres", "mysql", "sqlite"}
+
+// lockID identifies the lock held while migrating, so that only one instance migrates when
+// several start at once
+const lockID int64 = 7_311_402_115
+
+// dialect holds the SQL that differs between databases
+type dialect struct {
+	// lock and unlock take and release the migration lock, blocking until it is free
+	lock   string
+	unlock string
+	// createTable creates schema_migrations if it does not exist
+	createTable string
+}
+
+var dialects = map[string]dialect{
+	"postgres": {
+		lock:   fmt.Sprintf("SELECT pg_advisory_lock(%d)", lockID),
+		unlock: fmt.Sprintf("SELECT pg_advisory_unlock(%d)", lockID),
+		createTable: `CREATE TABLE IF NOT EXISTS schema_migrations (
+			version bigint PRIMARY KEY,
+			name varchar(255) NOT NULL,
+			applied_at timestamptz NOT NULL
+		)`,
+	},
+	"mysql": {
+		lock:   fmt.Sprintf("SELECT GET_LOCK('migrations_%d', -1)", lockID),
+		unlock: fmt.Sprintf("SELECT RELEASE_LOCK('migrations_%d')", lockID),
+		createTable: `CREATE TABLE IF NOT EXISTS schema_migrations (
+			version bigint PRIMARY KEY,
+			name varchar(255) NOT NULL,
+			applied_at datetime(3) NOT NULL
+		)`,
+	},
+	// SQLite allows a single writer per database file, so it needs no migration lock
+	"sqlite": {
+		createTable: `CREATE TABLE IF NOT EXISTS schema_migrations (
+			version integer PRIMARY KEY,
+			name text NOT NULL,
+			applied_at datetime NOT NULL
+		)`,
+	},
+}
+
+var fileName = regexp.MustCompile(`^(\d+)_([a-z0-9_]+)\.(up|down)\.sql$`)
+
+// Migration is a schema change with the SQL to apply and to roll it back
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+}
+
+// Status is the state of a migration in the database
+type Status struct {
+	Version   int64
+	Name      string
+	AppliedAt *time.Time
+	// Missing is set for versions recorded in the database without a migration in the binary
+	Missing bool
+}
+
+// appliedMigration is a row of schema_migrations
+type appliedMigration struct {
+	Version   int64 `gorm:"primaryKey;autoIncrement:false"`
+	Name      string
+	AppliedAt time.Time
+}
+
+func (appliedMigration) TableName() string {
+	return "schema_migrations"
+}
+
+// Load reads the migrations of fsys, sorted by version. Every version needs both an up and
+// a down file; files not ending in .sql are ignored.
+func Load(fsys fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := map[int64]*Migration{}
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".sql") {
+			continue
+		}
+		match := fileName.FindStringSubmatch(entry.Name())
+		if match == nil {
+			return nil, fmt.Errorf("invalid migration file name %q", entry.Name())
+		}
+
+		version, err := strconv.ParseInt(match[1], 10, 64)
+		if err != nil || version <= 0 {
+			return nil, fmt.Errorf("invalid migration version in %q", entry.Name())
+		}
+		content, err := fs.ReadFile(fsys, entry.Name())
+		if err != nil {
+			return nil, err
+		}
+
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = migration
+		} else if migration.Name != match[2] {
+			return nil, fmt.Errorf("migration version %d is used by %q and %q", version, migration.Name, match[2])
+		}
+		if match[3] == "up" {
+			migration.Up = string(content)
+		} else {
+			migration.Down = string(content)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		if migration.Up == "" || migration.Down == "" {
+			return nil, fmt.Errorf("migration %d_%s needs both an up and a down file", migration.Version, migration.Name)
+		}
+		migrations = append(migrations, *migration)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// Embedded returns the migrations of dialectName compiled into the binary
+func Embedded(dialectName string) ([]Migration, error) {
+	if _, ok := dialects[dialectName]; !ok {
+		return nil, fmt.Errorf("no migrations for database %q", dialectName)
+	}
+	sqlFiles, err := fs.Sub(embedded, "sql/"+dialectName)
+	if err != nil {
+		return nil, err
+	}
+	return Load(sqlFiles)
+}
+
+// Migrator applies migrations to a database
+type Migrator struct {
+	db         *gorm.DB
+	dialect    dialect
+	migrations []Migration
+}
+
+// New returns a Migrator applying the embedded migrations for the database of db
+func New(db *gorm.DB) (*Migrator, error) {
+	name := db.Dialector.Name()
+	migrations, err := Embedded(name)
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{db: db, dialect: dialects[name], migrations: migrations}, nil
+}
+
+// Up applies every pending migration in order, each in its own transaction, and returns
+// the migrations applied. MySQL commits DDL statements implicitly, so a migration failing
+// halfway there leaves its earlier statements applied.
+func (m *Migrator) Up(ctx context.Context) ([]Migration, error) {
+	var applied []Migration
+	err := m.withLock(ctx, func(conn *gorm.DB) error {
+		versions, err := appliedVersions(conn)
+		if err != nil {
+			return err
+		}
+
+		for _, migration := range m.migrations {
+			if _, ok := versions[migration.Version]; ok {
+				continue
+			}
+			err := conn.Transaction(func(tx *gorm.DB) error {
+				if err := tx.Exec(migration.Up).Error; err != nil {
+					return err
+				}
+				return tx.Create(&appliedMigration{Version: migration.Version, Name: migration.Name, AppliedAt: time.Now()}).Error
+			})
+			if err != nil {
+				return fmt.Errorf("migration %d_%s failed: %w", migration.Version, migration.Name, err)
+			}
+			applied = append(applied, migration)
+		}
+		return nil
+	})
+	return applied, err
+}
+
+// Down rolls back the last steps applied migrations, newest first, and returns them
+func (m *Migrator) Down(ctx context.Context, steps int) ([]Migration, error) {
+	var rolledBack []Migration
+	err := m.withLock(ctx, func(conn *gorm.DB) error {
+		versions, err := appliedVersions(conn)
+		if err != nil {
+			return err
+		}
+
+		for i := len(m.migrations) - 1; i >= 0 && len(rolledBack) < steps; i-- {
+			migration := m.migrations[i]
+			if _, ok := versions[migration.Version]; !ok {
+				continue
+			}
+			err := conn.Transaction(func(tx *gorm.DB) error {
+				if err := tx.Exec(migration.Down).Error; err != nil {
+					return err
+				}
+				return tx.Delete(&appliedMigration{}, migration.Version).Error
+			})
+			if err != nil {
+				return fmt.Errorf("rollback of migration %d_%s failed: %w", migration.Version, migration.Name, err)
+			}
+			rolledBack = append(rolledBack, migration)
+		}
+		return nil
+	})
+	return rolledBack, err
+}
+
+// Status returns every known migration with the time it was applied, if it was
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	var statuses []Status
+	err := m.withLock(ctx, func(conn *gorm.DB) error {
+		versions, err := appliedVersions(conn)
+		if err != nil {
+			return err
+		}
+
+		for _, migration := range m.migrations {
+			status := Status{Version: migration.Version, Name: migration.Name}
+			if applied, ok := versions[migration.Version]; ok {
+				status.AppliedAt = &applied.AppliedAt
+				delete(versions, migration.Version)
+			}
+			statuses = append(statuses, status)
+		}
+		for _, applied := range versions {
+			appliedAt := applied.AppliedAt
+			statuses = append(statuses, Status{Version: applied.Version, Name: applied.Name, AppliedAt: &appliedAt, Missing: true})
+		}
+		sort.Slice(statuses, func(i, j int) bool { return statuses[i].Version < statuses[j].Version })
+		return nil
+	})
+	return statuses, err
+}
+
+// withLock runs fn on a single connection holding the migration lock, after making sure
+// the schema_migrations table exists
+func (m *Migrator) withLock(ctx context.Context, fn func(conn *gorm.DB) error) error {
+	return m.db.WithContext(ctx).Connection(func(conn *gorm.DB) error {
+		if m.dialect.lock != "" {
+			if err := conn.Exec(m.dialect.lock).Error; err != nil {
+				return fmt.Errorf("failed to acquire migration lock: %w", err)
+			}
+			defer conn.Exec(m.dialect.unlock)
+		}
+
+		if err := conn.Exec(m.dialect.createTable).Error; err != nil {
+			return err
+		}
+		return fn(conn)
+	})
+}
+
+// appliedVersions returns the rows of schema_migrations by version
+func appliedVersions(conn *gorm.DB) (map[int64]appliedMigration, error) {
+	var rows []appliedMigration
+	if err := conn.Order("version").Find(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	versions := make(map[int64]appliedMigration, len(rows))
+	for _, row := range rows {
+		versions[row.Version] = row
+	}
+	return versions, nil
+}
+
+// AutoMigrate creates and alters tables to match the models. It is meant for development
+// only: it cannot drop or rename columns and is not recorded in schema_migrations.
+func AutoMigrate(db *gorm.DB) error {
+	return db.AutoMigrate(Models()...)
+}
+
+// Models returns every model stored in the database
+func Models() []interface{} {
+	return []interface{}{
+		&models.User{}, &models.UserSession{}, &models.RevokedToken{}, &models.UserTokenRevocation{},
+		&models.PasswordResetToken{}, &models.EmailVerificationToken{}, &models.UserMFA{}, &models.MFARecoveryCode{},
+		&models.SystemConfig{}, &models.SystemLog{}, &models.LoginFailure{}, &models.APIKey{},
+		&models.FederatedIdentity{}, &models.FederationState{}, &models.OAuthClient{}, &models.OAuthAuthorizationCode{},
+		&models.MagicLinkToken{}, &models.PasswordHistory{}, &models.Passkey{}, &models.WebAuthnChallenge{},
+	}
+}
@@ -0,0 +1,142 @@
+package migrations
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm/schema"
+)
+
+func TestLoad(t *testing.T) {
+	tests := []struct {
+		name     string
+		files    fstest.MapFS
+		versions []int64
+		wantErr  string
+	}{
+		{
+			name: "Sorted by version",
+			files: fstest.MapFS{
+				"0002_add_index.up.sql":   {Data: []byte("CREATE INDEX ...")},
+				"0002_add_index.down.sql": {Data: []byte("DROP INDEX ...")},
+				"0001_initial.up.sql":     {Data: []byte("CREATE TABLE ...")},
+				"0001_initial.down.sql":   {Data: []byte("DROP TABLE ...")},
+				"README.md":               {Data: []byte("ignored")},
+			},
+			versions: []int64{1, 2},
+		},
+		{
+			name: "Missing down file",
+			files: fstest.MapFS{
+				"0001_initial.up.sql": {Data: []byte("CREATE TABLE ...")},
+			},
+			wantErr: "needs both an up and a down file",
+		},
+		{
+			name: "Duplicate version",
+			files: fstest.MapFS{
+				"0001_initial.up.sql": {Data: []byte("CREATE TABLE ...")},
+				"0001_other.down.sql": {Data: []byte("DROP TABLE ...")},
+			},
+			wantErr: "is used by",
+		},
+		{
+			name: "Invalid name",
+			files: fstest.MapFS{
+				"initial.up.sql": {Data: []byte("CREATE TABLE ...")},
+			},
+			wantErr: "invalid migration file name",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			migrations, err := Load(tt.files)
+			if tt.wantErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.wantErr)
+				return
+			}
+
+			require.NoError(t, err)
+			var versions []int64
+			for _, migration := range migrations {
+				versions = append(versions, migration.Version)
+			}
+			assert.Equal(t, tt.versions, versions)
+		})
+	}
+}
+
+func TestEmbeddedInitialSchemaCoversModels(t *testing.T) {
+	for _, dialect := range Dialects {
+		t.Run(dialect, func(t *testing.T) {
+			migrations, err := Embedded(dialect)
+			require.NoError(t, err)
+			require.NotEmpty(t, migrations)
+
+			var up strings.Builder
+			for _, migration := range migrations {
+				up.WriteString(migration.Up)
+			}
+
+			// Every table AutoMigrate would create is created by a migration
+			for _, model := range Models() {
+				s, err := schema.Parse(model, &sync.Map{}, schema.NamingStrategy{})
+				require.NoError(t, err)
+				assert.Contains(t, up.String(), "CREATE TABLE IF NOT EXISTS "+s.Table+" (")
+			}
+		})
+	}
+}
+
+func TestEmbeddedDialectsMatch(t *testing.T) {
+	postgres, err := Embedded("postgres")
+	require.NoError(t, err)
+
+	// Every dialect has the same migrations, so a version means the same change everywhere
+	for _, dialect := range Dialects {
+		migrations, err := Embedded(dialect)
+		require.NoError(t, err)
+		require.Len(t, migrations, len(postgres), dialect)
+		for i, migration := range migrations {
+			assert.Equal(t, postgres[i].Version, migration.Version, dialect)
+			assert.Equal(t, postgres[i].Name, migration.Name, dialect)
+		}
+	}
+
+	_, err = Embedded("oracle")
+	assert.Error(t, err)
+}
+
+func TestCreate(t *testing.T) {
+	dir := t.TempDir()
+
+	paths, err := Create(dir, "Add users phone")
+	require.NoError(t, err)
+	require.Len(t, paths, 2*len(Dialects))
+	for _, path := range paths {
+		assert.FileExists(t, path)
+	}
+	assert.Equal(t, filepath.Join(dir, "postgres", "0001_add_users_phone.up.sql"), paths[0])
+
+	// Versions continue from the newest migration of any dialect
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "mysql", "0005_mysql_only.up.sql"), []byte("--"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "mysql", "0005_mysql_only.down.sql"), []byte("--"), 0o644))
+	paths, err = Create(dir, "drop-legacy columns!")
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(dir, "postgres", "0006_drop_legacy_columns.up.sql"), paths[0])
+
+	migrations, err := Load(os.DirFS(filepath.Join(dir, "sqlite")))
+	require.NoError(t, err)
+	assert.Len(t, migrations, 2)
+
+	_, err = Create(dir, "--")
+	assert.ErrorIs(t, err, ErrEmptyName)
+}
@@ -0,0 +1,296 @@
+-- Initial schema, as created by AutoMigrate before versioned migrations were introduced.
+-- Statements are idempotent so databases created by AutoMigrate can adopt this migration.
+
+CREATE TABLE IF NOT EXISTS users (
+    id bigint unsigned AUTO_INCREMENT,
+    name varchar(50) NOT NULL,
+    email varchar(255) NOT NULL,
+    password varchar(255) NOT NULL,
+    age bigint,
+    is_active boolean DEFAULT true,
+    is_verified boolean NOT NULL DEFAULT false,
+    mfa_enabled boolean NOT NULL DEFAULT false,
+    role varchar(20) NOT NULL DEFAULT 'user',
+    password_changed_at datetime(3),
+    deletion_due_at datetime(3),
+    created_at datetime(3),
+    updated_at datetime(3),
+    deleted_at datetime(3),
+    PRIMARY KEY (id),
+    INDEX idx_users_deleted_at (deleted_at),
+    INDEX idx_users_deletion_due_at (deletion_due_at),
+    UNIQUE INDEX idx_users_email (email),
+    INDEX idx_users_role (role)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE IF NOT EXISTS user_sessions (
+    id bigint unsigned AUTO_INCREMENT,
+    user_id bigint unsigned NOT NULL,
+    session_token varchar(255) NOT NULL,
+    refresh_token varchar(255),
+    expires_at datetime(3) NOT NULL,
+    ip_address varchar(45),
+    user_agent longtext,
+    client_id varchar(64) NOT NULL DEFAULT '',
+    scope varchar(255) NOT NULL DEFAULT '',
+    is_active boolean DEFAULT true,
+    revoked_at datetime(3),
+    last_seen_at datetime(3),
+    created_at datetime(3),
+    updated_at datetime(3),
+    PRIMARY KEY (id),
+    INDEX idx_user_sessions_client_id (client_id),
+    INDEX idx_user_sessions_expires_at (expires_at),
+    INDEX idx_user_sessions_is_active (is_active),
+    UNIQUE INDEX idx_user_sessions_refresh_token (refresh_token),
+    UNIQUE INDEX idx_user_sessions_session_token (session_token),
+    INDEX idx_user_sessions_user_id (user_id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE IF NOT EXISTS revoked_tokens (
+    id bigint unsigned AUTO_INCREMENT,
+    jti varchar(64) NOT NULL,
+    user_id bigint unsigned NOT NULL,
+    expires_at datetime(3) NOT NULL,
+    created_at datetime(3),
+    PRIMARY KEY (id),
+    INDEX idx_revoked_tokens_expires_at (expires_at),
+    UNIQUE INDEX idx_revoked_tokens_jti (jti),
+    INDEX idx_revoked_tokens_user_id (user_id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE IF NOT EXISTS user_token_revocations (
+    user_id bigint unsigned,
+    revoked_before datetime(3) NOT NULL,
+    updated_at datetime(3),
+    PRIMARY KEY (user_id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE IF NOT EXISTS password_reset_tokens (
+    id bigint unsigned AUTO_INCREMENT,
+    user_id bigint unsigned NOT NULL,
+    token_hash varchar(64) NOT NULL,
+    expires_at datetime(3) NOT NULL,
+    used_at datetime(3),
+    created_at datetime(3),
+    PRIMARY KEY (id),
+    UNIQUE INDEX idx_password_reset_tokens_token_hash (token_hash),
+    INDEX idx_password_reset_tokens_user_id (user_id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE IF NOT EXISTS email_verification_tokens (
+    id bigint unsigned AUTO_INCREMENT,
+    user_id bigint unsigned NOT NULL,
+    email varchar(255) NOT NULL,
+    token_hash varchar(64) NOT NULL,
+    expires_at datetime(3) NOT NULL,
+    used_at datetime(3),
+    created_at datetime(3),
+    PRIMARY KEY (id),
+    INDEX idx_email_verification_tokens_created_at (created_at),
+    UNIQUE INDEX idx_email_verification_tokens_token_hash (token_hash),
+    INDEX idx_email_verification_tokens_user_id (user_id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE IF NOT EXISTS user_mfa (
+    user_id bigint unsigned,
+    secret varchar(64) NOT NULL,
+    enabled boolean NOT NULL DEFAULT false,
+    last_used_step bigint NOT NULL DEFAULT 0,
+    confirmed_at datetime(3),
+    created_at datetime(3),
+    updated_at datetime(3),
+    PRIMARY KEY (user_id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE IF NOT EXISTS mfa_recovery_codes (
+    id bigint unsigned AUTO_INCREMENT,
+    user_id bigint unsigned NOT NULL,
+    code_hash varchar(64) NOT NULL,
+    used_at datetime(3),
+    created_at datetime(3),
+    PRIMARY KEY (id),
+    INDEX idx_mfa_recovery_codes_code_hash (code_hash),
+    INDEX idx_mfa_recovery_codes_user_id (user_id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE IF NOT EXISTS system_config (
+    id bigint unsigned AUTO_INCREMENT,
+    config_key varchar(100) NOT NULL,
+    config_value longtext,
+    config_type varchar(20) DEFAULT 'string',
+    description longtext,
+    is_public boolean DEFAULT false,
+    created_at datetime(3),
+    updated_at datetime(3),
+    PRIMARY KEY (id),
+    UNIQUE INDEX idx_system_config_config_key (config_key)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE IF NOT EXISTS system_logs (
+    id bigint unsigned AUTO_INCREMENT,
+    level varchar(20) NOT NULL,
+    message longtext NOT NULL,
+    context text,
+    user_id bigint unsigned,
+    ip_address varchar(45),
+    user_agent longtext,
+    created_at datetime(3),
+    PRIMARY KEY (id),
+    INDEX idx_system_logs_created_at (created_at),
+    INDEX idx_system_logs_level (level),
+    INDEX idx_system_logs_user_id (user_id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE IF NOT EXISTS login_failures (
+    id bigint unsigned AUTO_INCREMENT,
+    scope varchar(20) NOT NULL,
+    identifier varchar(255) NOT NULL,
+    failures bigint NOT NULL DEFAULT 0,
+    last_failure_at datetime(3),
+    next_attempt_at datetime(3),
+    locked_until datetime(3),
+    updated_at datetime(3),
+    PRIMARY KEY (id),
+    UNIQUE INDEX idx_login_failures_scope_identifier (scope, identifier)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE IF NOT EXISTS api_keys (
+    id bigint unsigned AUTO_INCREMENT,
+    user_id bigint unsigned NOT NULL,
+    name varchar(100) NOT NULL,
+    public_id varchar(32) NOT NULL,
+    key_hash varchar(64) NOT NULL,
+    scopes varchar(255),
+    expires_at datetime(3),
+    last_used_at datetime(3),
+    last_used_ip varchar(45),
+    revoked_at datetime(3),
+    created_at datetime(3),
+    updated_at datetime(3),
+    PRIMARY KEY (id),
+    UNIQUE INDEX idx_api_keys_public_id (public_id),
+    INDEX idx_api_keys_user_id (user_id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE IF NOT EXISTS federated_identities (
+    id bigint unsigned AUTO_INCREMENT,
+    user_id bigint unsigned NOT NULL,
+    provider varchar(50) NOT NULL,
+    subject varchar(255) NOT NULL,
+    email varchar(255),
+    last_login_at datetime(3),
+    created_at datetime(3),
+    PRIMARY KEY (id),
+    INDEX idx_federated_identities_user_id (user_id),
+    UNIQUE INDEX idx_federated_provider_subject (provider, subject)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE IF NOT EXISTS federation_states (
+    id bigint unsigned AUTO_INCREMENT,
+    state_hash varchar(64) NOT NULL,
+    provider varchar(50) NOT NULL,
+    nonce varchar(64) NOT NULL,
+    code_verifier varchar(64) NOT NULL,
+    user_id bigint unsigned,
+    expires_at datetime(3) NOT NULL,
+    created_at datetime(3),
+    PRIMARY KEY (id),
+    INDEX idx_federation_states_expires_at (expires_at),
+    UNIQUE INDEX idx_federation_states_state_hash (state_hash)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE IF NOT EXISTS o_auth_clients (
+    id bigint unsigned AUTO_INCREMENT,
+    client_id varchar(64) NOT NULL,
+    secret_hash varchar(64),
+    name varchar(100) NOT NULL,
+    owner_id bigint unsigned NOT NULL,
+    redirect_uris text,
+    scopes varchar(255) NOT NULL,
+    grant_types varchar(100) NOT NULL,
+    confidential boolean NOT NULL DEFAULT false,
+    created_at datetime(3),
+    updated_at datetime(3),
+    deleted_at datetime(3),
+    PRIMARY KEY (id),
+    UNIQUE INDEX idx_o_auth_clients_client_id (client_id),
+    INDEX idx_o_auth_clients_deleted_at (deleted_at),
+    INDEX idx_o_auth_clients_owner_id (owner_id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE IF NOT EXISTS o_auth_authorization_codes (
+    id bigint unsigned AUTO_INCREMENT,
+    code_hash varchar(64) NOT NULL,
+    client_id varchar(64) NOT NULL,
+    user_id bigint unsigned NOT NULL,
+    redirect_uri text NOT NULL,
+    scope varchar(255),
+    code_challenge varchar(64) NOT NULL,
+    session_token varchar(255),
+    expires_at datetime(3) NOT NULL,
+    used_at datetime(3),
+    created_at datetime(3),
+    PRIMARY KEY (id),
+    INDEX idx_o_auth_authorization_codes_client_id (client_id),
+    UNIQUE INDEX idx_o_auth_authorization_codes_code_hash (code_hash),
+    INDEX idx_o_auth_authorization_codes_expires_at (expires_at),
+    INDEX idx_o_auth_authorization_codes_user_id (user_id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE IF NOT EXISTS magic_link_tokens (
+    id bigint unsigned AUTO_INCREMENT,
+    user_id bigint unsigned NOT NULL,
+    email varchar(255) NOT NULL,
+    token_hash varchar(64) NOT NULL,
+    nonce_hash varchar(64) NOT NULL,
+    expires_at datetime(3) NOT NULL,
+    used_at datetime(3),
+    created_at datetime(3),
+    PRIMARY KEY (id),
+    INDEX idx_magic_link_tokens_created_at (created_at),
+    INDEX idx_magic_link_tokens_email (email),
+    UNIQUE INDEX idx_magic_link_tokens_token_hash (token_hash),
+    INDEX idx_magic_link_tokens_user_id (user_id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE IF NOT EXISTS password_history (
+    id bigint unsigned AUTO_INCREMENT,
+    user_id bigint unsigned NOT NULL,
+    password_hash varchar(255) NOT NULL,
+    created_at datetime(3),
+    PRIMARY KEY (id),
+    INDEX idx_password_history_created_at (created_at),
+    INDEX idx_password_history_user_id (user_id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE IF NOT EXISTS passkeys (
+    id bigint unsigned AUTO_INCREMENT,
+    user_id bigint unsigned NOT NULL,
+    name varchar(100) NOT NULL,
+    credential_id text NOT NULL,
+    credential_hash varchar(64) NOT NULL,
+    public_key longblob NOT NULL,
+    sign_count int unsigned NOT NULL DEFAULT 0,
+    transports varchar(255) NOT NULL DEFAULT '',
+    backup_eligible boolean NOT NULL DEFAULT false,
+    last_used_at datetime(3),
+    created_at datetime(3),
+    updated_at datetime(3),
+    PRIMARY KEY (id),
+    UNIQUE INDEX idx_passkeys_credential_hash (credential_hash),
+    INDEX idx_passkeys_user_id (user_id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE IF NOT EXISTS web_authn_challenges (
+    id bigint unsigned AUTO_INCREMENT,
+    challenge_hash varchar(64) NOT NULL,
+    purpose varchar(20) NOT NULL,
+    user_id bigint unsigned,
+    expires_at datetime(3) NOT NULL,
+    created_at datetime(3),
+    PRIMARY KEY (id),
+    UNIQUE INDEX idx_web_authn_challenges_challenge_hash (challenge_hash),
+    INDEX idx_web_authn_challenges_expires_at (expires_at),
+    INDEX idx_web_authn_challenges_user_id (user_id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
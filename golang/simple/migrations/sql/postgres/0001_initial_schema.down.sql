@@ -0,0 +1,22 @@
+-- Drops every table of the initial schema
+
+DROP TABLE IF EXISTS web_authn_challenges;
+DROP TABLE IF EXISTS passkeys;
+DROP TABLE IF EXISTS password_history;
+DROP TABLE IF EXISTS magic_link_tokens;
+DROP TABLE IF EXISTS o_auth_authorization_codes;
+DROP TABLE IF EXISTS o_auth_clients;
+DROP TABLE IF EXISTS federation_states;
+DROP TABLE IF EXISTS federated_identities;
+DROP TABLE IF EXISTS api_keys;
+DROP TABLE IF EXISTS login_failures;
+DROP TABLE IF EXISTS system_logs;
+DROP TABLE IF EXISTS system_config;
+DROP TABLE IF EXISTS mfa_recovery_codes;
+DROP TABLE IF EXISTS user_mfa;
+DROP TABLE IF EXISTS email_verification_tokens;
+DROP TABLE IF EXISTS password_reset_tokens;
+DROP TABLE IF EXISTS user_token_revocations;
+DROP TABLE IF EXISTS revoked_tokens;
+DROP TABLE IF EXISTS user_sessions;
+DROP TABLE IF EXISTS users;
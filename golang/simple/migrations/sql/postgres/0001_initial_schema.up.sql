@@ -0,0 +1,296 @@
+-- Initial schema, as created by AutoMigrate before versioned migrations were introduced.
+-- Statements are idempotent so databases created by AutoMigrate can adopt this migration.
+
+CREATE TABLE IF NOT EXISTS users (
+    id bigserial,
+    name varchar(50) NOT NULL,
+    email varchar(255) NOT NULL,
+    password varchar(255) NOT NULL,
+    age bigint,
+    is_active boolean DEFAULT true,
+    is_verified boolean NOT NULL DEFAULT false,
+    mfa_enabled boolean NOT NULL DEFAULT false,
+    role varchar(20) NOT NULL DEFAULT 'user',
+    password_changed_at timestamptz,
+    deletion_due_at timestamptz,
+    created_at timestamptz,
+    updated_at timestamptz,
+    deleted_at timestamptz,
+    PRIMARY KEY (id)
+);
+CREATE INDEX IF NOT EXISTS idx_users_deleted_at ON users (deleted_at);
+CREATE INDEX IF NOT EXISTS idx_users_deletion_due_at ON users (deletion_due_at);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_email ON users (email);
+CREATE INDEX IF NOT EXISTS idx_users_role ON users (role);
+
+CREATE TABLE IF NOT EXISTS user_sessions (
+    id bigserial,
+    user_id bigint NOT NULL,
+    session_token varchar(255) NOT NULL,
+    refresh_token varchar(255),
+    expires_at timestamptz NOT NULL,
+    ip_address varchar(45),
+    user_agent text,
+    client_id varchar(64) NOT NULL DEFAULT '',
+    scope varchar(255) NOT NULL DEFAULT '',
+    is_active boolean DEFAULT true,
+    revoked_at timestamptz,
+    last_seen_at timestamptz,
+    created_at timestamptz,
+    updated_at timestamptz,
+    PRIMARY KEY (id)
+);
+CREATE INDEX IF NOT EXISTS idx_user_sessions_client_id ON user_sessions (client_id);
+CREATE INDEX IF NOT EXISTS idx_user_sessions_expires_at ON user_sessions (expires_at);
+CREATE INDEX IF NOT EXISTS idx_user_sessions_is_active ON user_sessions (is_active);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_user_sessions_refresh_token ON user_sessions (refresh_token);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_user_sessions_session_token ON user_sessions (session_token);
+CREATE INDEX IF NOT EXISTS idx_user_sessions_user_id ON user_sessions (user_id);
+
+CREATE TABLE IF NOT EXISTS revoked_tokens (
+    id bigserial,
+    jti varchar(64) NOT NULL,
+    user_id bigint NOT NULL,
+    expires_at timestamptz NOT NULL,
+    created_at timestamptz,
+    PRIMARY KEY (id)
+);
+CREATE INDEX IF NOT EXISTS idx_revoked_tokens_expires_at ON revoked_tokens (expires_at);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_revoked_tokens_jti ON revoked_tokens (jti);
+CREATE INDEX IF NOT EXISTS idx_revoked_tokens_user_id ON revoked_tokens (user_id);
+
+CREATE TABLE IF NOT EXISTS user_token_revocations (
+    user_id bigint,
+    revoked_before timestamptz NOT NULL,
+    updated_at timestamptz,
+    PRIMARY KEY (user_id)
+);
+
+CREATE TABLE IF NOT EXISTS password_reset_tokens (
+    id bigserial,
+    user_id bigint NOT NULL,
+    token_hash varchar(64) NOT NULL,
+    expires_at timestamptz NOT NULL,
+    used_at timestamptz,
+    created_at timestamptz,
+    PRIMARY KEY (id)
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_password_reset_tokens_token_hash ON password_reset_tokens (token_hash);
+CREATE INDEX IF NOT EXISTS idx_password_reset_tokens_user_id ON password_reset_tokens (user_id);
+
+CREATE TABLE IF NOT EXISTS email_verification_tokens (
+    id bigserial,
+    user_id bigint NOT NULL,
+    email varchar(255) NOT NULL,
+    token_hash varchar(64) NOT NULL,
+    expires_at timestamptz NOT NULL,
+    used_at timestamptz,
+    created_at timestamptz,
+    PRIMARY KEY (id)
+);
+CREATE INDEX IF NOT EXISTS idx_email_verification_tokens_created_at ON email_verification_tokens (created_at);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_email_verification_tokens_token_hash ON email_verification_tokens (token_hash);
+CREATE INDEX IF NOT EXISTS idx_email_verification_tokens_user_id ON email_verification_tokens (user_id);
+
+CREATE TABLE IF NOT EXISTS user_mfa (
+    user_id bigint,
+    secret varchar(64) NOT NULL,
+    enabled boolean NOT NULL DEFAULT false,
+    last_used_step bigint NOT NULL DEFAULT 0,
+    confirmed_at timestamptz,
+    created_at timestamptz,
+    updated_at timestamptz,
+    PRIMARY KEY (user_id)
+);
+
+CREATE TABLE IF NOT EXISTS mfa_recovery_codes (
+    id bigserial,
+    user_id bigint NOT NULL,
+    code_hash varchar(64) NOT NULL,
+    used_at timestamptz,
+    created_at timestamptz,
+    PRIMARY KEY (id)
+);
+CREATE INDEX IF NOT EXISTS idx_mfa_recovery_codes_code_hash ON mfa_recovery_codes (code_hash);
+CREATE INDEX IF NOT EXISTS idx_mfa_recovery_codes_user_id ON mfa_recovery_codes (user_id);
+
+CREATE TABLE IF NOT EXISTS system_config (
+    id bigserial,
+    config_key varchar(100) NOT NULL,
+    config_value text,
+    config_type varchar(20) DEFAULT 'string',
+    description text,
+    is_public boolean DEFAULT false,
+    created_at timestamptz,
+    updated_at timestamptz,
+    PRIMARY KEY (id)
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_system_config_config_key ON system_config (config_key);
+
+CREATE TABLE IF NOT EXISTS system_logs (
+    id bigserial,
+    level varchar(20) NOT NULL,
+    message text NOT NULL,
+    context text,
+    user_id bigint,
+    ip_address varchar(45),
+    user_agent text,
+    created_at timestamptz,
+    PRIMARY KEY (id)
+);
+CREATE INDEX IF NOT EXISTS idx_system_logs_created_at ON system_logs (created_at);
+CREATE INDEX IF NOT EXISTS idx_system_logs_level ON system_logs (level);
+CREATE INDEX IF NOT EXISTS idx_system_logs_user_id ON system_logs (user_id);
+
+CREATE TABLE IF NOT EXISTS login_failures (
+    id bigserial,
+    scope varchar(20) NOT NULL,
+    identifier varchar(255) NOT NULL,
+    failures bigint NOT NULL DEFAULT 0,
+    last_failure_at timestamptz,
+    next_attempt_at timestamptz,
+    locked_until timestamptz,
+    updated_at timestamptz,
+    PRIMARY KEY (id)
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_login_failures_scope_identifier ON login_failures (scope, identifier);
+
+CREATE TABLE IF NOT EXISTS api_keys (
+    id bigserial,
+    user_id bigint NOT NULL,
+    name varchar(100) NOT NULL,
+    public_id varchar(32) NOT NULL,
+    key_hash varchar(64) NOT NULL,
+    scopes varchar(255),
+    expires_at timestamptz,
+    last_used_at timestamptz,
+    last_used_ip varchar(45),
+    revoked_at timestamptz,
+    created_at timestamptz,
+    updated_at timestamptz,
+    PRIMARY KEY (id)
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_api_keys_public_id ON api_keys (public_id);
+CREATE INDEX IF NOT EXISTS idx_api_keys_user_id ON api_keys (user_id);
+
+CREATE TABLE IF NOT EXISTS federated_identities (
+    id bigserial,
+    user_id bigint NOT NULL,
+    provider varchar(50) NOT NULL,
+    subject varchar(255) NOT NULL,
+    email varchar(255),
+    last_login_at timestamptz,
+    created_at timestamptz,
+    PRIMARY KEY (id)
+);
+CREATE INDEX IF NOT EXISTS idx_federated_identities_user_id ON federated_identities (user_id);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_federated_provider_subject ON federated_identities (provider, subject);
+
+CREATE TABLE IF NOT EXISTS federation_states (
+    id bigserial,
+    state_hash varchar(64) NOT NULL,
+    provider varchar(50) NOT NULL,
+    nonce varchar(64) NOT NULL,
+    code_verifier varchar(64) NOT NULL,
+    user_id bigint,
+    expires_at timestamptz NOT NULL,
+    created_at timestamptz,
+    PRIMARY KEY (id)
+);
+CREATE INDEX IF NOT EXISTS idx_federation_states_expires_at ON federation_states (expires_at);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_federation_states_state_hash ON federation_states (state_hash);
+
+CREATE TABLE IF NOT EXISTS o_auth_clients (
+    id bigserial,
+    client_id varchar(64) NOT NULL,
+    secret_hash varchar(64),
+    name varchar(100) NOT NULL,
+    owner_id bigint NOT NULL,
+    redirect_uris text,
+    scopes varchar(255) NOT NULL,
+    grant_types varchar(100) NOT NULL,
+    confidential boolean NOT NULL DEFAULT false,
+    created_at timestamptz,
+    updated_at timestamptz,
+    deleted_at timestamptz,
+    PRIMARY KEY (id)
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_o_auth_clients_client_id ON o_auth_clients (client_id);
+CREATE INDEX IF NOT EXISTS idx_o_auth_clients_deleted_at ON o_auth_clients (deleted_at);
+CREATE INDEX IF NOT EXISTS idx_o_auth_clients_owner_id ON o_auth_clients (owner_id);
+
+CREATE TABLE IF NOT EXISTS o_auth_authorization_codes (
+    id bigserial,
+    code_hash varchar(64) NOT NULL,
+    client_id varchar(64) NOT NULL,
+    user_id bigint NOT NULL,
+    redirect_uri text NOT NULL,
+    scope varchar(255),
+    code_challenge varchar(64) NOT NULL,
+    session_token varchar(255),
+    expires_at timestamptz NOT NULL,
+    used_at timestamptz,
+    created_at timestamptz,
+    PRIMARY KEY (id)
+);
+CREATE INDEX IF NOT EXISTS idx_o_auth_authorization_codes_client_id ON o_auth_authorization_codes (client_id);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_o_auth_authorization_codes_code_hash ON o_auth_authorization_codes (code_hash);
+CREATE INDEX IF NOT EXISTS idx_o_auth_authorization_codes_expires_at ON o_auth_authorization_codes (expires_at);
+CREATE INDEX IF NOT EXISTS idx_o_auth_authorization_codes_user_id ON o_auth_authorization_codes (user_id);
+
+CREATE TABLE IF NOT EXISTS magic_link_tokens (
+    id bigserial,
+    user_id bigint NOT NULL,
+    email varchar(255) NOT NULL,
+    token_hash varchar(64) NOT NULL,
+    nonce_hash varchar(64) NOT NULL,
+    expires_at timestamptz NOT NULL,
+    used_at timestamptz,
+    created_at timestamptz,
+    PRIMARY KEY (id)
+);
+CREATE INDEX IF NOT EXISTS idx_magic_link_tokens_created_at ON magic_link_tokens (created_at);
+CREATE INDEX IF NOT EXISTS idx_magic_link_tokens_email ON magic_link_tokens (email);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_magic_link_tokens_token_hash ON magic_link_tokens (token_hash);
+CREATE INDEX IF NOT EXISTS idx_magic_link_tokens_user_id ON magic_link_tokens (user_id);
+
+CREATE TABLE IF NOT EXISTS password_history (
+    id bigserial,
+    user_id bigint NOT NULL,
+    password_hash varchar(255) NOT NULL,
+    created_at timestamptz,
+    PRIMARY KEY (id)
+);
+CREATE INDEX IF NOT EXISTS idx_password_history_created_at ON password_history (created_at);
+CREATE INDEX IF NOT EXISTS idx_password_history_user_id ON password_history (user_id);
+
+CREATE TABLE IF NOT EXISTS passkeys (
+    id bigserial,
+    user_id bigint NOT NULL,
+    name varchar(100) NOT NULL,
+    credential_id text NOT NULL,
+    credential_hash varchar(64) NOT NULL,
+    public_key bytea NOT NULL,
+    sign_count bigint NOT NULL DEFAULT 0,
+    transports varchar(255) NOT NULL DEFAULT '',
+    backup_eligible boolean NOT NULL DEFAULT false,
+    last_used_at timestamptz,
+    created_at timestamptz,
+    updated_at timestamptz,
+    PRIMARY KEY (id)
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_passkeys_credential_hash ON passkeys (credential_hash);
+CREATE INDEX IF NOT EXISTS idx_passkeys_user_id ON passkeys (user_id);
+
+CREATE TABLE IF NOT EXISTS web_authn_challenges (
+    id bigserial,
+    challenge_hash varchar(64) NOT NULL,
+    purpose varchar(20) NOT NULL,
+    user_id bigint,
+    expires_at timestamptz NOT NULL,
+    created_at timestamptz,
+    PRIMARY KEY (id)
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_web_authn_challenges_challenge_hash ON web_authn_challenges (challenge_hash);
+CREATE INDEX IF NOT EXISTS idx_web_authn_challenges_expires_at ON web_authn_challenges (expires_at);
+CREATE INDEX IF NOT EXISTS idx_web_authn_challenges_user_id ON web_authn_challenges (user_id);
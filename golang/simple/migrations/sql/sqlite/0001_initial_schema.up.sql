@@ -0,0 +1,278 @@
+-- Initial schema, as created by AutoMigrate before versioned migrations were introduced.
+-- Statements are idempotent so databases created by AutoMigrate can adopt this migration.
+
+CREATE TABLE IF NOT EXISTS users (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    name text NOT NULL,
+    email text NOT NULL,
+    password text NOT NULL,
+    age integer,
+    is_active numeric DEFAULT true,
+    is_verified numeric NOT NULL DEFAULT false,
+    mfa_enabled numeric NOT NULL DEFAULT false,
+    role text NOT NULL DEFAULT 'user',
+    password_changed_at datetime,
+    deletion_due_at datetime,
+    created_at datetime,
+    updated_at datetime,
+    deleted_at datetime
+);
+CREATE INDEX IF NOT EXISTS idx_users_deleted_at ON users (deleted_at);
+CREATE INDEX IF NOT EXISTS idx_users_deletion_due_at ON users (deletion_due_at);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_email ON users (email);
+CREATE INDEX IF NOT EXISTS idx_users_role ON users (role);
+
+CREATE TABLE IF NOT EXISTS user_sessions (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    user_id integer NOT NULL,
+    session_token text NOT NULL,
+    refresh_token text,
+    expires_at datetime NOT NULL,
+    ip_address text,
+    user_agent text,
+    client_id text NOT NULL DEFAULT '',
+    scope text NOT NULL DEFAULT '',
+    is_active numeric DEFAULT true,
+    revoked_at datetime,
+    last_seen_at datetime,
+    created_at datetime,
+    updated_at datetime
+);
+CREATE INDEX IF NOT EXISTS idx_user_sessions_client_id ON user_sessions (client_id);
+CREATE INDEX IF NOT EXISTS idx_user_sessions_expires_at ON user_sessions (expires_at);
+CREATE INDEX IF NOT EXISTS idx_user_sessions_is_active ON user_sessions (is_active);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_user_sessions_refresh_token ON user_sessions (refresh_token);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_user_sessions_session_token ON user_sessions (session_token);
+CREATE INDEX IF NOT EXISTS idx_user_sessions_user_id ON user_sessions (user_id);
+
+CREATE TABLE IF NOT EXISTS revoked_tokens (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    jti text NOT NULL,
+    user_id integer NOT NULL,
+    expires_at datetime NOT NULL,
+    created_at datetime
+);
+CREATE INDEX IF NOT EXISTS idx_revoked_tokens_expires_at ON revoked_tokens (expires_at);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_revoked_tokens_jti ON revoked_tokens (jti);
+CREATE INDEX IF NOT EXISTS idx_revoked_tokens_user_id ON revoked_tokens (user_id);
+
+CREATE TABLE IF NOT EXISTS user_token_revocations (
+    user_id integer,
+    revoked_before datetime NOT NULL,
+    updated_at datetime,
+    PRIMARY KEY (user_id)
+);
+
+CREATE TABLE IF NOT EXISTS password_reset_tokens (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    user_id integer NOT NULL,
+    token_hash text NOT NULL,
+    expires_at datetime NOT NULL,
+    used_at datetime,
+    created_at datetime
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_password_reset_tokens_token_hash ON password_reset_tokens (token_hash);
+CREATE INDEX IF NOT EXISTS idx_password_reset_tokens_user_id ON password_reset_tokens (user_id);
+
+CREATE TABLE IF NOT EXISTS email_verification_tokens (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    user_id integer NOT NULL,
+    email text NOT NULL,
+    token_hash text NOT NULL,
+    expires_at datetime NOT NULL,
+    used_at datetime,
+    created_at datetime
+);
+CREATE INDEX IF NOT EXISTS idx_email_verification_tokens_created_at ON email_verification_tokens (created_at);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_email_verification_tokens_token_hash ON email_verification_tokens (token_hash);
+CREATE INDEX IF NOT EXISTS idx_email_verification_tokens_user_id ON email_verification_tokens (user_id);
+
+CREATE TABLE IF NOT EXISTS user_mfa (
+    user_id integer,
+    secret text NOT NULL,
+    enabled numeric NOT NULL DEFAULT false,
+    last_used_step integer NOT NULL DEFAULT 0,
+    confirmed_at datetime,
+    created_at datetime,
+    updated_at datetime,
+    PRIMARY KEY (user_id)
+);
+
+CREATE TABLE IF NOT EXISTS mfa_recovery_codes (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    user_id integer NOT NULL,
+    code_hash text NOT NULL,
+    used_at datetime,
+    created_at datetime
+);
+CREATE INDEX IF NOT EXISTS idx_mfa_recovery_codes_code_hash ON mfa_recovery_codes (code_hash);
+CREATE INDEX IF NOT EXISTS idx_mfa_recovery_codes_user_id ON mfa_recovery_codes (user_id);
+
+CREATE TABLE IF NOT EXISTS system_config (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    config_key text NOT NULL,
+    config_value text,
+    config_type text DEFAULT 'string',
+    description text,
+    is_public numeric DEFAULT false,
+    created_at datetime,
+    updated_at datetime
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_system_config_config_key ON system_config (config_key);
+
+CREATE TABLE IF NOT EXISTS system_logs (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    level text NOT NULL,
+    message text NOT NULL,
+    context text,
+    user_id integer,
+    ip_address text,
+    user_agent text,
+    created_at datetime
+);
+CREATE INDEX IF NOT EXISTS idx_system_logs_created_at ON system_logs (created_at);
+CREATE INDEX IF NOT EXISTS idx_system_logs_level ON system_logs (level);
+CREATE INDEX IF NOT EXISTS idx_system_logs_user_id ON system_logs (user_id);
+
+CREATE TABLE IF NOT EXISTS login_failures (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    scope text NOT NULL,
+    identifier text NOT NULL,
+    failures integer NOT NULL DEFAULT 0,
+    last_failure_at datetime,
+    next_attempt_at datetime,
+    locked_until datetime,
+    updated_at datetime
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_login_failures_scope_identifier ON login_failures (scope, identifier);
+
+CREATE TABLE IF NOT EXISTS api_keys (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    user_id integer NOT NULL,
+    name text NOT NULL,
+    public_id text NOT NULL,
+    key_hash text NOT NULL,
+    scopes text,
+    expires_at datetime,
+    last_used_at datetime,
+    last_used_ip text,
+    revoked_at datetime,
+    created_at datetime,
+    updated_at datetime
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_api_keys_public_id ON api_keys (public_id);
+CREATE INDEX IF NOT EXISTS idx_api_keys_user_id ON api_keys (user_id);
+
+CREATE TABLE IF NOT EXISTS federated_identities (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    user_id integer NOT NULL,
+    provider text NOT NULL,
+    subject text NOT NULL,
+    email text,
+    last_login_at datetime,
+    created_at datetime
+);
+CREATE INDEX IF NOT EXISTS idx_federated_identities_user_id ON federated_identities (user_id);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_federated_provider_subject ON federated_identities (provider, subject);
+
+CREATE TABLE IF NOT EXISTS federation_states (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    state_hash text NOT NULL,
+    provider text NOT NULL,
+    nonce text NOT NULL,
+    code_verifier text NOT NULL,
+    user_id integer,
+    expires_at datetime NOT NULL,
+    created_at datetime
+);
+CREATE INDEX IF NOT EXISTS idx_federation_states_expires_at ON federation_states (expires_at);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_federation_states_state_hash ON federation_states (state_hash);
+
+CREATE TABLE IF NOT EXISTS o_auth_clients (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    client_id text NOT NULL,
+    secret_hash text,
+    name text NOT NULL,
+    owner_id integer NOT NULL,
+    redirect_uris text,
+    scopes text NOT NULL,
+    grant_types text NOT NULL,
+    confidential numeric NOT NULL DEFAULT false,
+    created_at datetime,
+    updated_at datetime,
+    deleted_at datetime
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_o_auth_clients_client_id ON o_auth_clients (client_id);
+CREATE INDEX IF NOT EXISTS idx_o_auth_clients_deleted_at ON o_auth_clients (deleted_at);
+CREATE INDEX IF NOT EXISTS idx_o_auth_clients_owner_id ON o_auth_clients (owner_id);
+
+CREATE TABLE IF NOT EXISTS o_auth_authorization_codes (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    code_hash text NOT NULL,
+    client_id text NOT NULL,
+    user_id integer NOT NULL,
+    redirect_uri text NOT NULL,
+    scope text,
+    code_challenge text NOT NULL,
+    session_token text,
+    expires_at datetime NOT NULL,
+    used_at datetime,
+    created_at datetime
+);
+CREATE INDEX IF NOT EXISTS idx_o_auth_authorization_codes_client_id ON o_auth_authorization_codes (client_id);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_o_auth_authorization_codes_code_hash ON o_auth_authorization_codes (code_hash);
+CREATE INDEX IF NOT EXISTS idx_o_auth_authorization_codes_expires_at ON o_auth_authorization_codes (expires_at);
+CREATE INDEX IF NOT EXISTS idx_o_auth_authorization_codes_user_id ON o_auth_authorization_codes (user_id);
+
+CREATE TABLE IF NOT EXISTS magic_link_tokens (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    user_id integer NOT NULL,
+    email text NOT NULL,
+    token_hash text NOT NULL,
+    nonce_hash text NOT NULL,
+    expires_at datetime NOT NULL,
+    used_at datetime,
+    created_at datetime
+);
+CREATE INDEX IF NOT EXISTS idx_magic_link_tokens_created_at ON magic_link_tokens (created_at);
+CREATE INDEX IF NOT EXISTS idx_magic_link_tokens_email ON magic_link_tokens (email);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_magic_link_tokens_token_hash ON magic_link_tokens (token_hash);
+CREATE INDEX IF NOT EXISTS idx_magic_link_tokens_user_id ON magic_link_tokens (user_id);
+
+CREATE TABLE IF NOT EXISTS password_history (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    user_id integer NOT NULL,
+    password_hash text NOT NULL,
+    created_at datetime
+);
+CREATE INDEX IF NOT EXISTS idx_password_history_created_at ON password_history (created_at);
+CREATE INDEX IF NOT EXISTS idx_password_history_user_id ON password_history (user_id);
+
+CREATE TABLE IF NOT EXISTS passkeys (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    user_id integer NOT NULL,
+    name text NOT NULL,
+    credential_id text NOT NULL,
+    credential_hash text NOT NULL,
+    public_key blob NOT NULL,
+    sign_count integer NOT NULL DEFAULT 0,
+    transports text NOT NULL DEFAULT '',
+    backup_eligible numeric NOT NULL DEFAULT false,
+    last_used_at datetime,
+    created_at datetime,
+    updated_at datetime
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_passkeys_credential_hash ON passkeys (credential_hash);
+CREATE INDEX IF NOT EXISTS idx_passkeys_user_id ON passkeys (user_id);
+
+CREATE TABLE IF NOT EXISTS web_authn_challenges (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    challenge_hash text NOT NULL,
+    purpose text NOT NULL,
+    user_id integer,
+    expires_at datetime NOT NULL,
+    created_at datetime
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_web_authn_challenges_challenge_hash ON web_authn_challenges (challenge_hash);
+CREATE INDEX IF NOT EXISTS idx_web_authn_challenges_expires_at ON web_authn_challenges (expires_at);
+CREATE INDEX IF NOT EXISTS idx_web_authn_challenges_user_id ON web_authn_challenges (user_id);
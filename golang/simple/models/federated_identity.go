@@ -0,0 +1,29 @@
+package models
+
+import (
+	"time"
+)
+
+// FederatedIdentity links a user to an account at an external identity provider
+type FederatedIdentity struct {
+	ID          uint       `json:"id" gorm:"primaryKey"`
+	UserID      uint       `json:"-" gorm:"not null;index"`
+	Provider    string     `json:"provider" gorm:"size:50;not null;uniqueIndex:idx_federated_provider_subject"`
+	Subject     string     `json:"-" gorm:"size:255;not null;uniqueIndex:idx_federated_provider_subject"`
+	Email       string     `json:"email" gorm:"size:255"`
+	LastLoginAt *time.Time `json:"last_login_at"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+// FederationState is the server side of an authorization request to an identity provider.
+// UserID is set when the request links a provider to an already authenticated user.
+type FederationState struct {
+	ID           uint      `json:"id" gorm:"primaryKey"`
+	StateHash    string    `json:"-" gorm:"size:64;uniqueIndex;not null"`
+	Provider     string    `json:"provider" gorm:"size:50;not null"`
+	Nonce        string    `json:"-" gorm:"size:64;not null"`
+	CodeVerifier string    `json:"-" gorm:"size:64;not null"`
+	UserID       *uint     `json:"-"`
+	ExpiresAt    time.Time `json:"expires_at" gorm:"not null;index"`
+	CreatedAt    time.Time `json:"created_at"`
+}
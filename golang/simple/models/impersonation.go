@@ -0,0 +1,6 @@
+package models
+
+// ImpersonationRequest represents an administrator's request to act as another user
+type ImpersonationRequest struct {
+	Reason string `json:"reason" binding:"required,min=3,max=255"`
+}
@@ -0,0 +1,25 @@
+package models
+
+import (
+	"time"
+)
+
+// Login failure scopes
+const (
+	LoginScopeAccount  = "account"
+	LoginScopeIP       = "ip"
+	LoginScopeMFAToken = "mfa_token"
+)
+
+// LoginFailure tracks failed login attempts for an account (by email) or a client IP, and
+// wrong second factors for a pending MFA token (by jti)
+type LoginFailure struct {
+	ID            uint       `json:"id" gorm:"primaryKey"`
+	Scope         string     `json:"scope" gorm:"size:20;not null;uniqueIndex:idx_login_failures_scope_identifier"`
+	Identifier    string     `json:"identifier" gorm:"size:255;not null;uniqueIndex:idx_login_failures_scope_identifier"`
+	Failures      int        `json:"failures" gorm:"not null;default:0"`
+	LastFailureAt time.Time  `json:"last_failure_at"`
+	NextAttemptAt time.Time  `json:"next_attempt_at"`
+	LockedUntil   *time.Time `json:"locked_until"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+}
@@ -0,0 +1,23 @@
+package models
+
+import (
+	"time"
+)
+
+// MagicLinkToken stores the hash of a single-use sign-in link and of the nonce cookie
+// that binds it to the browser that requested it
+type MagicLinkToken struct {
+	ID        uint       `json:"id" gorm:"primaryKey"`
+	UserID    uint       `json:"user_id" gorm:"not null;index"`
+	Email     string     `json:"email" gorm:"size:255;not null;index"`
+	TokenHash string     `json:"-" gorm:"size:64;uniqueIndex;not null"`
+	NonceHash string     `json:"-" gorm:"size:64;not null"`
+	ExpiresAt time.Time  `json:"expires_at" gorm:"not null"`
+	UsedAt    *time.Time `json:"used_at"`
+	CreatedAt time.Time  `json:"created_at" gorm:"index"`
+}
+
+// MagicLinkRequest represents a request for a sign-in link
+type MagicLinkRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
@@ -0,0 +1,54 @@
+package models
+
+import (
+	"time"
+)
+
+// UserMFA holds the TOTP secret of a user. Enabled stays false until the
+// enrolment has been confirmed with a first valid code.
+type UserMFA struct {
+	UserID       uint       `json:"user_id" gorm:"primaryKey;autoIncrement:false"`
+	Secret       string     `json:"-" gorm:"size:64;not null"`
+	Enabled      bool       `json:"enabled" gorm:"not null;default:false"`
+	LastUsedStep int64      `json:"-" gorm:"not null;default:0"`
+	ConfirmedAt  *time.Time `json:"confirmed_at"`
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+}
+
+// TableName keeps the table name singular
+func (UserMFA) TableName() string {
+	return "user_mfa"
+}
+
+// MFARecoveryCode stores the hash of a one-time recovery code
+type MFARecoveryCode struct {
+	ID        uint       `json:"id" gorm:"primaryKey"`
+	UserID    uint       `json:"user_id" gorm:"not null;index"`
+	CodeHash  string     `json:"-" gorm:"size:64;not null;index"`
+	UsedAt    *time.Time `json:"used_at"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// MFACodeRequest represents a request carrying a TOTP code
+type MFACodeRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+// MFADisableRequest represents the confirmation needed to turn MFA off
+type MFADisableRequest struct {
+	Password string `json:"password" binding:"required"`
+	Code     string `json:"code" binding:"required"`
+}
+
+// MFAVerifyRequest represents the second login step: either a TOTP code or a recovery code
+type MFAVerifyRequest struct {
+	MFAToken     string `json:"mfa_token" binding:"required"`
+	Code         string `json:"code" binding:"required_without=RecoveryCode"`
+	RecoveryCode string `json:"recovery_code" binding:"required_without=Code"`
+}
+
+// MFAPolicy lists the roles that must use MFA
+type MFAPolicy struct {
+	Roles []string `json:"roles" binding:"dive,oneof=user admin moderator"`
+}
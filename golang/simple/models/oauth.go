@@ -0,0 +1,130 @@
+package models
+
+import (
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// OAuth grant types supported by the token endpoint
+const (
+	GrantAuthorizationCode = "authorization_code"
+	GrantClientCredentials = "client_credentials"
+	GrantRefreshToken      = "refresh_token"
+)
+
+// OAuthClient is a third-party application allowed to obtain tokens for this API.
+// Scopes are the permissions it may request; confidential clients authenticate with a secret.
+type OAuthClient struct {
+	ID           uint           `json:"id" gorm:"primaryKey"`
+	ClientID     string         `json:"client_id" gorm:"size:64;uniqueIndex;not null"`
+	SecretHash   string         `json:"-" gorm:"size:64"`
+	Name         string         `json:"name" gorm:"size:100;not null"`
+	OwnerID      uint           `json:"-" gorm:"not null;index"`
+	RedirectURIs string         `json:"-" gorm:"type:text"`
+	Scopes       string         `json:"-" gorm:"size:255;not null"`
+	GrantTypes   string         `json:"-" gorm:"size:100;not null"`
+	Confidential bool           `json:"confidential" gorm:"not null;default:false"`
+	CreatedAt    time.Time      `json:"created_at"`
+	UpdatedAt    time.Time      `json:"updated_at"`
+	DeletedAt    gorm.DeletedAt `json:"-" gorm:"index"`
+}
+
+// RedirectURIList returns the registered redirect URIs
+func (c *OAuthClient) RedirectURIList() []string {
+	return splitList(c.RedirectURIs, " ")
+}
+
+// ScopeList returns the scopes the client may request
+func (c *OAuthClient) ScopeList() []string {
+	return splitList(c.Scopes, " ")
+}
+
+// GrantTypeList returns the grant types the client may use
+func (c *OAuthClient) GrantTypeList() []string {
+	return splitList(c.GrantTypes, " ")
+}
+
+// AllowsRedirectURI reports whether uri exactly matches a registered redirect URI
+func (c *OAuthClient) AllowsRedirectURI(uri string) bool {
+	return containsValue(c.RedirectURIList(), uri)
+}
+
+// AllowsGrant reports whether the client may use a grant type
+func (c *OAuthClient) AllowsGrant(grantType string) bool {
+	return containsValue(c.GrantTypeList(), grantType)
+}
+
+// AllowsScope reports whether the client may request a scope
+func (c *OAuthClient) AllowsScope(scope string) bool {
+	return containsValue(c.ScopeList(), scope)
+}
+
+// OAuthClientResponse represents a client returned in responses, without its secret
+type OAuthClientResponse struct {
+	ID           uint      `json:"id"`
+	ClientID     string    `json:"client_id"`
+	Name         string    `json:"name"`
+	RedirectURIs []string  `json:"redirect_uris"`
+	Scopes       []string  `json:"scopes"`
+	GrantTypes   []string  `json:"grant_types"`
+	Confidential bool      `json:"confidential"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// ToResponse converts OAuthClient to OAuthClientResponse
+func (c *OAuthClient) ToResponse() OAuthClientResponse {
+	return OAuthClientResponse{
+		ID:           c.ID,
+		ClientID:     c.ClientID,
+		Name:         c.Name,
+		RedirectURIs: c.RedirectURIList(),
+		Scopes:       c.ScopeList(),
+		GrantTypes:   c.GrantTypeList(),
+		Confidential: c.Confidential,
+		CreatedAt:    c.CreatedAt,
+	}
+}
+
+// OAuthClientCreate represents the data needed to register a client
+type OAuthClientCreate struct {
+	Name         string   `json:"name" binding:"required,min=1,max=100"`
+	RedirectURIs []string `json:"redirect_uris"`
+	Scopes       []string `json:"scopes" binding:"required,min=1"`
+	GrantTypes   []string `json:"grant_types" binding:"required,min=1,dive,oneof=authorization_code client_credentials refresh_token"`
+	Confidential bool     `json:"confidential"`
+}
+
+// OAuthAuthorizationCode stores the hash of a single-use authorization code together with
+// the request it was issued for. SessionToken is the session started when the code was
+// redeemed, revoked if the code is ever presented again.
+type OAuthAuthorizationCode struct {
+	ID            uint       `json:"id" gorm:"primaryKey"`
+	CodeHash      string     `json:"-" gorm:"size:64;uniqueIndex;not null"`
+	ClientID      string     `json:"client_id" gorm:"size:64;not null;index"`
+	UserID        uint       `json:"user_id" gorm:"not null;index"`
+	RedirectURI   string     `json:"redirect_uri" gorm:"type:text;not null"`
+	Scope         string     `json:"scope" gorm:"size:255"`
+	CodeChallenge string     `json:"-" gorm:"size:64;not null"`
+	SessionToken  string     `json:"-" gorm:"size:255"`
+	ExpiresAt     time.Time  `json:"expires_at" gorm:"not null;index"`
+	UsedAt        *time.Time `json:"used_at"`
+	CreatedAt     time.Time  `json:"created_at"`
+}
+
+func splitList(value, separator string) []string {
+	if value == "" {
+		return []string{}
+	}
+	return strings.Split(value, separator)
+}
+
+func containsValue(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,99 @@
+package models
+
+import (
+	"strings"
+	"time"
+
+	"crud-example/webauthn"
+)
+
+// Purposes of a pending WebAuthn ceremony
+const (
+	PasskeyPurposeRegister = "register"
+	PasskeyPurposeLogin    = "login"
+	PasskeyPurposeMFA      = "mfa"
+)
+
+// Passkey is a WebAuthn credential of a user, usable to sign in without a password or as
+// a second factor. CredentialID holds the unpadded base64url credential ID, which can be
+// too long to index, so lookups go through CredentialHash. PublicKey is the COSE key and
+// SignCount the last signature counter seen, to detect cloned authenticators.
+type Passkey struct {
+	ID             uint       `json:"id" gorm:"primaryKey"`
+	UserID         uint       `json:"user_id" gorm:"not null;index"`
+	Name           string     `json:"name" gorm:"size:100;not null"`
+	CredentialID   string     `json:"-" gorm:"type:text;not null"`
+	CredentialHash string     `json:"-" gorm:"size:64;uniqueIndex;not null"`
+	PublicKey      []byte     `json:"-" gorm:"not null"`
+	SignCount      uint32     `json:"sign_count" gorm:"not null;default:0"`
+	Transports     string     `json:"transports" gorm:"size:255;not null;default:''"`
+	BackupEligible bool       `json:"backup_eligible" gorm:"not null;default:false"`
+	LastUsedAt     *time.Time `json:"last_used_at"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+}
+
+// PasskeyResponse represents a passkey in the list of the user's passkeys
+type PasskeyResponse struct {
+	ID             uint       `json:"id"`
+	Name           string     `json:"name"`
+	Transports     []string   `json:"transports"`
+	BackupEligible bool       `json:"backup_eligible"`
+	LastUsedAt     *time.Time `json:"last_used_at"`
+	CreatedAt      time.Time  `json:"created_at"`
+}
+
+// ToResponse converts Passkey to PasskeyResponse
+func (p *Passkey) ToResponse() PasskeyResponse {
+	return PasskeyResponse{
+		ID:             p.ID,
+		Name:           p.Name,
+		Transports:     p.TransportList(),
+		BackupEligible: p.BackupEligible,
+		LastUsedAt:     p.LastUsedAt,
+		CreatedAt:      p.CreatedAt,
+	}
+}
+
+// TransportList returns the transports the authenticator reported
+func (p *Passkey) TransportList() []string {
+	return append([]string{}, strings.Fields(p.Transports)...)
+}
+
+// WebAuthnChallenge is a pending WebAuthn ceremony, found by the hash of the challenge the
+// client answers. UserID is empty for passwordless logins, where the user is not known yet.
+type WebAuthnChallenge struct {
+	ID            uint      `json:"id" gorm:"primaryKey"`
+	ChallengeHash string    `json:"-" gorm:"size:64;uniqueIndex;not null"`
+	Purpose       string    `json:"purpose" gorm:"size:20;not null"`
+	UserID        *uint     `json:"user_id" gorm:"index"`
+	ExpiresAt     time.Time `json:"expires_at" gorm:"not null;index"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// PasskeyRegisterRequest completes the registration of a passkey
+type PasskeyRegisterRequest struct {
+	Name       string                          `json:"name" binding:"required,max=100"`
+	Credential webauthn.RegistrationCredential `json:"credential"`
+}
+
+// PasskeyRenameRequest represents the data needed to rename a passkey
+type PasskeyRenameRequest struct {
+	Name string `json:"name" binding:"required,max=100"`
+}
+
+// PasskeyLoginRequest completes a passwordless login with a passkey
+type PasskeyLoginRequest struct {
+	Credential webauthn.AssertionCredential `json:"credential"`
+}
+
+// PasskeyMFABeginRequest starts the second login step with a passkey
+type PasskeyMFABeginRequest struct {
+	MFAToken string `json:"mfa_token" binding:"required"`
+}
+
+// PasskeyMFARequest completes the second login step with a passkey
+type PasskeyMFARequest struct {
+	MFAToken   string                       `json:"mfa_token" binding:"required"`
+	Credential webauthn.AssertionCredential `json:"credential"`
+}
@@ -0,0 +1,24 @@
+package models
+
+import (
+	"time"
+)
+
+// PasswordHistory stores the hashes of the passwords a user has set, so recent ones cannot be reused
+type PasswordHistory struct {
+	ID           uint      `json:"id" gorm:"primaryKey"`
+	UserID       uint      `json:"user_id" gorm:"not null;index"`
+	PasswordHash string    `json:"-" gorm:"size:255;not null"`
+	CreatedAt    time.Time `json:"created_at" gorm:"index"`
+}
+
+// TableName keeps the table name singular
+func (PasswordHistory) TableName() string {
+	return "password_history"
+}
+
+// ChangePasswordRequest represents the data needed to change the current user's password
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password" binding:"required"`
+	NewPassword     string `json:"new_password" binding:"required"`
+}
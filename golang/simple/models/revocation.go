@@ -0,0 +1,22 @@
+package models
+
+import (
+	"time"
+)
+
+// RevokedToken records an access token that was revoked before it expired
+type RevokedToken struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	JTI       string    `json:"jti" gorm:"size:64;uniqueIndex;not null"`
+	UserID    uint      `json:"user_id" gorm:"not null;index"`
+	ExpiresAt time.Time `json:"expires_at" gorm:"not null;index"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// UserTokenRevocation records that every token issued to a user before
+// RevokedBefore, a whole second, is no longer valid ("log out everywhere")
+type UserTokenRevocation struct {
+	UserID        uint      `json:"user_id" gorm:"primaryKey;autoIncrement:false"`
+	RevokedBefore time.Time `json:"revoked_before" gorm:"not null"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
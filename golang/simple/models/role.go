@@ -0,0 +1,82 @@
+package models
+
+// Roles available to users, matching the role ENUM of the SQL schema
+const (
+	RoleUser      = "user"
+	RoleAdmin     = "admin"
+	RoleModerator = "moderator"
+)
+
+// Permissions checked by RequirePermission
+const (
+	PermissionUsersRead   = "users:read"
+	PermissionUsersCreate = "users:create"
+	PermissionUsersUpdate = "users:update"
+	PermissionUsersDelete = "users:delete"
+	PermissionUsersManage = "users:manage"
+	// PermissionProfileUpdate allows users to edit their own account
+	PermissionProfileUpdate = "profile:update"
+)
+
+// rolePermissions maps each role to the permissions it grants.
+// users:update allows editing the name and age of other users, profile:update only
+// yourself, and users:manage allows changing account status, roles and the email of
+// other users, and editing other managers. Moderators can clean up profiles without
+// being able to take over or lock out accounts.
+var rolePermissions = map[string][]string{
+	RoleUser:      {PermissionUsersRead, PermissionProfileUpdate},
+	RoleModerator: {PermissionUsersRead, PermissionProfileUpdate, PermissionUsersUpdate},
+	RoleAdmin: {
+		PermissionUsersRead,
+		PermissionProfileUpdate,
+		PermissionUsersCreate,
+		PermissionUsersUpdate,
+		PermissionUsersDelete,
+		PermissionUsersManage,
+	},
+}
+
+// Permissions returns every known permission in a stable order
+func Permissions() []string {
+	return []string{
+		PermissionUsersRead,
+		PermissionUsersCreate,
+		PermissionUsersUpdate,
+		PermissionUsersDelete,
+		PermissionUsersManage,
+		PermissionProfileUpdate,
+	}
+}
+
+// IsValidPermission reports whether permission is a known permission
+func IsValidPermission(permission string) bool {
+	for _, permissions := range rolePermissions {
+		for _, p := range permissions {
+			if p == permission {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// IsValidRole reports whether role is a known role
+func IsValidRole(role string) bool {
+	_, ok := rolePermissions[role]
+	return ok
+}
+
+// HasPermission reports whether role grants permission
+func HasPermission(role, permission string) bool {
+	for _, p := range rolePermissions[role] {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// HasPermission reports whether the user's role grants permission
+func (u *User) HasPermission(permission string) bool {
+	return HasPermission(u.Role, permission)
+}
@@ -0,0 +1,56 @@
+package models
+
+import (
+	"time"
+)
+
+// UserSession represents a refresh token family stored in the user_sessions table.
+// SessionToken identifies the family and RefreshToken holds the hash of the
+// only refresh token of the family that is currently valid. Sessions started through
+// the OAuth authorization server carry the client and the scope that was granted.
+type UserSession struct {
+	ID           uint       `json:"id" gorm:"primaryKey"`
+	UserID       uint       `json:"user_id" gorm:"not null;index"`
+	SessionToken string     `json:"-" gorm:"size:255;uniqueIndex;not null"`
+	RefreshToken string     `json:"-" gorm:"size:255;uniqueIndex"`
+	ExpiresAt    time.Time  `json:"expires_at" gorm:"not null;index"`
+	IPAddress    string     `json:"ip_address" gorm:"size:45"`
+	UserAgent    string     `json:"user_agent"`
+	ClientID     string     `json:"client_id" gorm:"size:64;not null;default:'';index"`
+	Scope        string     `json:"scope" gorm:"size:255;not null;default:''"`
+	IsActive     bool       `json:"is_active" gorm:"default:true;index"`
+	RevokedAt    *time.Time `json:"revoked_at"`
+	LastSeenAt   *time.Time `json:"last_seen_at"`
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+}
+
+// UserSessionResponse represents a session in the list of the user's devices
+type UserSessionResponse struct {
+	ID         uint       `json:"id"`
+	IPAddress  string     `json:"ip_address"`
+	UserAgent  string     `json:"user_agent"`
+	ClientID   string     `json:"client_id,omitempty"`
+	Current    bool       `json:"current"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastSeenAt *time.Time `json:"last_seen_at"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+}
+
+// ToResponse converts UserSession to UserSessionResponse
+func (s *UserSession) ToResponse() UserSessionResponse {
+	return UserSessionResponse{
+		ID:         s.ID,
+		IPAddress:  s.IPAddress,
+		UserAgent:  s.UserAgent,
+		ClientID:   s.ClientID,
+		CreatedAt:  s.CreatedAt,
+		LastSeenAt: s.LastSeenAt,
+		ExpiresAt:  s.ExpiresAt,
+	}
+}
+
+// RefreshRequest represents the payload for rotating a refresh token
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+}
@@ -0,0 +1,22 @@
+package models
+
+import (
+	"time"
+)
+
+// SystemConfig is a runtime setting stored in the system_config table
+type SystemConfig struct {
+	ID          uint      `json:"id" gorm:"primaryKey"`
+	ConfigKey   string    `json:"config_key" gorm:"size:100;uniqueIndex;not null"`
+	ConfigValue string    `json:"config_value"`
+	ConfigType  string    `json:"config_type" gorm:"size:20;default:string"`
+	Description string    `json:"description"`
+	IsPublic    bool      `json:"is_public" gorm:"default:false"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// TableName matches the table defined in sql/database/schema.sql
+func (SystemConfig) TableName() string {
+	return "system_config"
+}
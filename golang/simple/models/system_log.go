@@ -0,0 +1,17 @@
+package models
+
+import (
+	"time"
+)
+
+// SystemLog is an audit event stored in the system_logs table
+type SystemLog struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	Level     string    `json:"level" gorm:"size:20;not null;index"`
+	Message   string    `json:"message" gorm:"not null"`
+	Context   string    `json:"context" gorm:"type:text"`
+	UserID    *uint     `json:"user_id" gorm:"index"`
+	IPAddress string    `json:"ip_address" gorm:"size:45"`
+	UserAgent string    `json:"user_agent"`
+	CreatedAt time.Time `json:"created_at" gorm:"index"`
+}
@@ -7,23 +7,31 @@ import (
 )
 
 type User struct {
-	ID        uint           `json:"id" gorm:"primaryKey"`
-	Name      string         `json:"name" gorm:"size:50;not null" validate:"required,min=2,max=50"`
-	Email     string         `json:"email" gorm:"size:255;uniqueIndex;not null" validate:"required,email"`
-	Password  string         `json:"-" gorm:"size:255;not null" validate:"required,min=6"`
-	Age       *int           `json:"age" validate:"omitempty,min=18,max=120"`
-	IsActive  bool           `json:"is_active" gorm:"default:true"`
-	CreatedAt time.Time      `json:"created_at"`
-	UpdatedAt time.Time      `json:"updated_at"`
-	DeletedAt gorm.DeletedAt `json:"-" gorm:"index"`
+	ID                uint           `json:"id" gorm:"primaryKey"`
+	Name              string         `json:"name" gorm:"size:50;not null" validate:"required,min=2,max=50"`
+	Email             string         `json:"email" gorm:"size:255;uniqueIndex;not null" validate:"required,email"`
+	Password          string         `json:"-" gorm:"size:255;not null" validate:"required,min=6"`
+	Age               *int           `json:"age" validate:"omitempty,min=18,max=120"`
+	IsActive          bool           `json:"is_active" gorm:"default:true"`
+	IsVerified        bool           `json:"is_verified" gorm:"not null;default:false"`
+	MFAEnabled        bool           `json:"mfa_enabled" gorm:"not null;default:false"`
+	Role              string         `json:"role" gorm:"size:20;not null;default:user;index"`
+	PasswordChangedAt *time.Time     `json:"password_changed_at"`
+	DeletionDueAt     *time.Time     `json:"deletion_due_at" gorm:"index"`
+	CreatedAt         time.Time      `json:"created_at"`
+	UpdatedAt         time.Time      `json:"updated_at"`
+	DeletedAt         gorm.DeletedAt `json:"-" gorm:"index"`
 }
 
-// UserCreate represents the data needed to create a user
+// UserCreate represents the data needed to create a user. The password is checked
+// against the password policy by the handlers.
 type UserCreate struct {
 	Name     string `json:"name" binding:"required,min=2,max=50"`
 	Email    string `json:"email" binding:"required,email"`
-	Password string `json:"password" binding:"required,min=6"`
+	Password string `json:"password" binding:"required"`
 	Age      *int   `json:"age" binding:"omitempty,min=18,max=120"`
+	// Role is only honoured by CreateUser; self-registration always creates regular users
+	Role string `json:"role" binding:"omitempty,oneof=user admin moderator"`
 }
 
 // UserUpdate represents the data needed to update a user
@@ -32,6 +40,23 @@ type UserUpdate struct {
 	Email    *string `json:"email" binding:"omitempty,email"`
 	Age      *int    `json:"age" binding:"omitempty,min=18,max=120"`
 	IsActive *bool   `json:"is_active"`
+	Role     *string `json:"role" binding:"omitempty,oneof=user admin moderator"`
+	// CurrentPassword confirms a change of the user's own email, as in ProfileUpdate
+	CurrentPassword string `json:"current_password"`
+}
+
+// ProfileUpdate represents the changes users can make to their own account
+type ProfileUpdate struct {
+	Name  *string `json:"name" binding:"omitempty,min=2,max=50"`
+	Email *string `json:"email" binding:"omitempty,email"`
+	Age   *int    `json:"age" binding:"omitempty,min=18,max=120"`
+	// CurrentPassword confirms a change of email, which is enough to take over the account
+	CurrentPassword string `json:"current_password"`
+}
+
+// AccountDeletionRequest confirms the deletion of the user's own account
+type AccountDeletionRequest struct {
+	Password string `json:"password" binding:"required"`
 }
 
 // UserLogin represents login credentials
@@ -42,25 +67,35 @@ type UserLogin struct {
 
 // UserResponse represents the user data returned in responses
 type UserResponse struct {
-	ID        uint      `json:"id"`
-	Name      string    `json:"name"`
-	Email     string    `json:"email"`
-	Age       *int      `json:"age"`
-	IsActive  bool      `json:"is_active"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
+	ID         uint      `json:"id"`
+	Name       string    `json:"name"`
+	Email      string    `json:"email"`
+	Age        *int      `json:"age"`
+	IsActive   bool      `json:"is_active"`
+	IsVerified bool      `json:"is_verified"`
+	MFAEnabled bool      `json:"mfa_enabled"`
+	Role       string    `json:"role"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+	// DeletionDueAt is set while a requested account deletion is pending
+	DeletionDueAt *time.Time `json:"deletion_due_at,omitempty"`
 }
 
 // ToResponse converts User to UserResponse
 func (u *User) ToResponse() UserResponse {
 	return UserResponse{
-		ID:        u.ID,
-		Name:      u.Name,
-		Email:     u.Email,
-		Age:       u.Age,
-		IsActive:  u.IsActive,
-		CreatedAt: u.CreatedAt,
-		UpdatedAt: u.UpdatedAt,
+		ID:         u.ID,
+		Name:       u.Name,
+		Email:      u.Email,
+		Age:        u.Age,
+		IsActive:   u.IsActive,
+		IsVerified: u.IsVerified,
+		MFAEnabled: u.MFAEnabled,
+		Role:       u.Role,
+		CreatedAt:  u.CreatedAt,
+		UpdatedAt:  u.UpdatedAt,
+
+		DeletionDueAt: u.DeletionDueAt,
 	}
 }
 
@@ -72,8 +107,27 @@ type PaginatedResponse struct {
 
 // Pagination represents pagination metadata
 type Pagination struct {
-	Page  int `json:"page"`
-	Limit int `json:"limit"`
+	Page  int   `json:"page"`
+	Limit int   `json:"limit"`
 	Total int64 `json:"total"`
 	Pages int   `json:"pages"`
-} 
\ No newline at end of file
+}
+
+// HasPassword reports whether the user can log in with a password. Accounts created through
+// an identity provider have none until the user sets one through a password reset.
+func (u *User) HasPassword() bool {
+	return u.Password != ""
+}
+
+// PasswordExpired reports whether the password is older than maxAge. Accounts that never
+// changed their password count from their creation; a zero maxAge disables expiry.
+func (u *User) PasswordExpired(maxAge time.Duration) bool {
+	if maxAge <= 0 {
+		return false
+	}
+	changedAt := u.CreatedAt
+	if u.PasswordChangedAt != nil {
+		changedAt = *u.PasswordChangedAt
+	}
+	return time.Since(changedAt) > maxAge
+}
@@ -0,0 +1,78 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+	"crud-example/models"
+)
+
+// APIKeyRepository stores personal API keys
+type APIKeyRepository interface {
+	// ListByUser returns the keys of a user, newest first
+	ListByUser(ctx context.Context, userID uint) ([]models.APIKey, error)
+	// Create inserts a new key
+	Create(ctx context.Context, key *models.APIKey) error
+	// FindByUser returns the key with the given ID if it belongs to the user
+	FindByUser(ctx context.Context, id, userID uint) (*models.APIKey, error)
+	// FindActiveByPublicID returns the key with the given public ID unless it was revoked
+	FindActiveByPublicID(ctx context.Context, publicID string) (*models.APIKey, error)
+	// Rename changes the label of a key
+	Rename(ctx context.Context, id uint, name string) error
+	// Revoke revokes a key at the given time unless it was already revoked
+	Revoke(ctx context.Context, id uint, at time.Time) error
+	// RecordUsage records when and from which address a key was last used
+	RecordUsage(ctx context.Context, id uint, at time.Time, ip string) error
+}
+
+// gormAPIKeyRepository is the APIKeyRepository backed by the database
+type gormAPIKeyRepository struct {
+	db *gorm.DB
+}
+
+// NewAPIKeyRepository returns an APIKeyRepository backed by db
+func NewAPIKeyRepository(db *gorm.DB) APIKeyRepository {
+	return &gormAPIKeyRepository{db: db}
+}
+
+func (r *gormAPIKeyRepository) ListByUser(ctx context.Context, userID uint) ([]models.APIKey, error) {
+	var keys []models.APIKey
+	err := r.db.WithContext(ctx).Where("user_id = ?", userID).Order("created_at DESC, id DESC").Find(&keys).Error
+	return keys, err
+}
+
+func (r *gormAPIKeyRepository) Create(ctx context.Context, key *models.APIKey) error {
+	return translate(r.db.WithContext(ctx).Create(key).Error)
+}
+
+func (r *gormAPIKeyRepository) FindByUser(ctx context.Context, id, userID uint) (*models.APIKey, error) {
+	var key models.APIKey
+	if err := r.db.WithContext(ctx).Where("id = ? AND user_id = ?", id, userID).First(&key).Error; err != nil {
+		return nil, translate(err)
+	}
+	return &key, nil
+}
+
+func (r *gormAPIKeyRepository) FindActiveByPublicID(ctx context.Context, publicID string) (*models.APIKey, error) {
+	var key models.APIKey
+	if err := r.db.WithContext(ctx).Where("public_id = ? AND revoked_at IS NULL", publicID).First(&key).Error; err != nil {
+		return nil, translate(err)
+	}
+	return &key, nil
+}
+
+func (r *gormAPIKeyRepository) Rename(ctx context.Context, id uint, name string) error {
+	return r.db.WithContext(ctx).Model(&models.APIKey{}).Where("id = ?", id).Update("name", name).Error
+}
+
+func (r *gormAPIKeyRepository) Revoke(ctx context.Context, id uint, at time.Time) error {
+	return r.db.WithContext(ctx).Model(&models.APIKey{}).
+		Where("id = ? AND revoked_at IS NULL", id).
+		Update("revoked_at", at).Error
+}
+
+func (r *gormAPIKeyRepository) RecordUsage(ctx context.Context, id uint, at time.Time, ip string) error {
+	return r.db.WithContext(ctx).Model(&models.APIKey{}).Where("id = ?", id).
+		Updates(map[string]interface{}{"last_used_at": at, "last_used_ip": ip}).Error
+}
@@ -0,0 +1,28 @@
+package repository
+
+import (
+	"context"
+
+	"gorm.io/gorm"
+	"crud-example/models"
+)
+
+// AuditRepository stores audit events
+type AuditRepository interface {
+	// Create inserts an audit event
+	Create(ctx context.Context, entry *models.SystemLog) error
+}
+
+// gormAuditRepository is the AuditRepository backed by the database
+type gormAuditRepository struct {
+	db *gorm.DB
+}
+
+// NewAuditRepository returns an AuditRepository backed by db
+func NewAuditRepository(db *gorm.DB) AuditRepository {
+	return &gormAuditRepository{db: db}
+}
+
+func (r *gormAuditRepository) Create(ctx context.Context, entry *models.SystemLog) error {
+	return r.db.WithContext(ctx).Create(entry).Error
+}
@@ -0,0 +1,136 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"crud-example/models"
+)
+
+// FederationRepository stores the pending authorization requests to identity providers and
+// the external identities linked to users
+type FederationRepository interface {
+	// CreateState inserts a pending authorization request
+	CreateState(ctx context.Context, state *models.FederationState) error
+	// ConsumeState deletes the unexpired request with the given state hash for the provider
+	// and returns it; a request can only be consumed once
+	ConsumeState(ctx context.Context, stateHash, provider string) (*models.FederationState, error)
+	// DeleteExpiredStates drops the requests that expired before the given time
+	DeleteExpiredStates(ctx context.Context, before time.Time) error
+
+	// ListIdentities returns the identities linked to a user, oldest first
+	ListIdentities(ctx context.Context, userID uint) ([]models.FederatedIdentity, error)
+	// FindIdentity returns the identity with the given subject at the provider
+	FindIdentity(ctx context.Context, provider, subject string) (*models.FederatedIdentity, error)
+	// CreateIdentity links an identity to its user
+	CreateIdentity(ctx context.Context, identity *models.FederatedIdentity) error
+	// TouchIdentity records a login with an identity
+	TouchIdentity(ctx context.Context, id uint, at time.Time) error
+	// DeleteIdentity unlinks the identity of a user at the provider and reports whether
+	// one was linked
+	DeleteIdentity(ctx context.Context, userID uint, provider string) (bool, error)
+	// LinkByEmail links identity, in one transaction, to the user registered with the email
+	// address ignoring case, or to a new user built by create when there is none. accept
+	// may refuse to link an existing user. It returns the linked user.
+	LinkByEmail(ctx context.Context, email string, identity *models.FederatedIdentity, accept func(*models.User) error, create func() (*models.User, error)) (*models.User, error)
+}
+
+// gormFederationRepository is the FederationRepository backed by the database
+type gormFederationRepository struct {
+	db *gorm.DB
+}
+
+// NewFederationRepository returns a FederationRepository backed by db
+func NewFederationRepository(db *gorm.DB) FederationRepository {
+	return &gormFederationRepository{db: db}
+}
+
+func (r *gormFederationRepository) CreateState(ctx context.Context, state *models.FederationState) error {
+	return translate(r.db.WithContext(ctx).Create(state).Error)
+}
+
+func (r *gormFederationRepository) ConsumeState(ctx context.Context, stateHash, provider string) (*models.FederationState, error) {
+	var state models.FederationState
+	err := r.db.WithContext(ctx).Where("state_hash = ? AND provider = ? AND expires_at > ?", stateHash, provider, time.Now()).
+		First(&state).Error
+	if err != nil {
+		return nil, translate(err)
+	}
+
+	// Of concurrent callbacks, only the one that deletes the request gets it
+	result := r.db.WithContext(ctx).Delete(&models.FederationState{}, state.ID)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, ErrNotFound
+	}
+	return &state, nil
+}
+
+func (r *gormFederationRepository) DeleteExpiredStates(ctx context.Context, before time.Time) error {
+	return r.db.WithContext(ctx).Where("expires_at < ?", before).Delete(&models.FederationState{}).Error
+}
+
+func (r *gormFederationRepository) ListIdentities(ctx context.Context, userID uint) ([]models.FederatedIdentity, error) {
+	var identities []models.FederatedIdentity
+	err := r.db.WithContext(ctx).Where("user_id = ?", userID).Order("created_at, id").Find(&identities).Error
+	return identities, err
+}
+
+func (r *gormFederationRepository) FindIdentity(ctx context.Context, provider, subject string) (*models.FederatedIdentity, error) {
+	var identity models.FederatedIdentity
+	if err := r.db.WithContext(ctx).Where("provider = ? AND subject = ?", provider, subject).First(&identity).Error; err != nil {
+		return nil, translate(err)
+	}
+	return &identity, nil
+}
+
+func (r *gormFederationRepository) CreateIdentity(ctx context.Context, identity *models.FederatedIdentity) error {
+	return translate(r.db.WithContext(ctx).Create(identity).Error)
+}
+
+func (r *gormFederationRepository) TouchIdentity(ctx context.Context, id uint, at time.Time) error {
+	return r.db.WithContext(ctx).Model(&models.FederatedIdentity{}).Where("id = ?", id).Update("last_login_at", at).Error
+}
+
+func (r *gormFederationRepository) DeleteIdentity(ctx context.Context, userID uint, provider string) (bool, error) {
+	result := r.db.WithContext(ctx).Where("user_id = ? AND provider = ?", userID, provider).Delete(&models.FederatedIdentity{})
+	return result.RowsAffected > 0, result.Error
+}
+
+func (r *gormFederationRepository) LinkByEmail(ctx context.Context, email string, identity *models.FederatedIdentity, accept func(*models.User) error, create func() (*models.User, error)) (*models.User, error) {
+	var user *models.User
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var existing models.User
+		err := tx.Where("LOWER(email) = ?", strings.ToLower(email)).First(&existing).Error
+		switch {
+		case err == nil:
+			if err := accept(&existing); err != nil {
+				return err
+			}
+			user = &existing
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			created, err := create()
+			if err != nil {
+				return err
+			}
+			if err := tx.Create(created).Error; err != nil {
+				return err
+			}
+			user = created
+		default:
+			return err
+		}
+
+		identity.UserID = user.ID
+		return tx.Create(identity).Error
+	})
+	if err != nil {
+		return nil, translate(err)
+	}
+	return user, nil
+}
@@ -0,0 +1,75 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"crud-example/models"
+)
+
+// LoginFailureRepository stores the failed login attempts used for lockouts
+type LoginFailureRepository interface {
+	// Find returns the failures recorded for any of the scope to identifier pairs
+	Find(ctx context.Context, identifiers map[string]string) ([]models.LoginFailure, error)
+	// Record loads the failure of a scope and identifier, or a new one, applies update
+	// and stores the result atomically
+	Record(ctx context.Context, scope, identifier string, update func(*models.LoginFailure)) error
+	// Delete forgets the failures of a scope and identifier
+	Delete(ctx context.Context, scope, identifier string) error
+	// DeleteBefore forgets the failures of a scope whose last failure happened before the time
+	DeleteBefore(ctx context.Context, scope string, before time.Time) error
+}
+
+// gormLoginFailureRepository is the LoginFailureRepository backed by the database
+type gormLoginFailureRepository struct {
+	db *gorm.DB
+}
+
+// NewLoginFailureRepository returns a LoginFailureRepository backed by db
+func NewLoginFailureRepository(db *gorm.DB) LoginFailureRepository {
+	return &gormLoginFailureRepository{db: db}
+}
+
+func (r *gormLoginFailureRepository) Find(ctx context.Context, identifiers map[string]string) ([]models.LoginFailure, error) {
+	var failures []models.LoginFailure
+	if len(identifiers) == 0 {
+		return failures, nil
+	}
+
+	var conditions []string
+	var args []interface{}
+	for scope, identifier := range identifiers {
+		conditions = append(conditions, "(scope = ? AND identifier = ?)")
+		args = append(args, scope, identifier)
+	}
+	err := r.db.WithContext(ctx).Where(strings.Join(conditions, " OR "), args...).Find(&failures).Error
+	return failures, err
+}
+
+func (r *gormLoginFailureRepository) Record(ctx context.Context, scope, identifier string, update func(*models.LoginFailure)) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var failure models.LoginFailure
+		err := tx.Where("scope = ? AND identifier = ?", scope, identifier).First(&failure).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			failure = models.LoginFailure{Scope: scope, Identifier: identifier}
+		} else if err != nil {
+			return err
+		}
+
+		update(&failure)
+		return tx.Save(&failure).Error
+	})
+}
+
+func (r *gormLoginFailureRepository) Delete(ctx context.Context, scope, identifier string) error {
+	return r.db.WithContext(ctx).Where("scope = ? AND identifier = ?", scope, identifier).
+		Delete(&models.LoginFailure{}).Error
+}
+
+func (r *gormLoginFailureRepository) DeleteBefore(ctx context.Context, scope string, before time.Time) error {
+	return r.db.WithContext(ctx).Where("scope = ? AND last_failure_at < ?", scope, before).
+		Delete(&models.LoginFailure{}).Error
+}
@@ -0,0 +1,59 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+	"crud-example/models"
+)
+
+// MagicLinkRepository stores the tokens sent in sign-in links
+type MagicLinkRepository interface {
+	// Create inserts a new sign-in link
+	Create(ctx context.Context, link *models.MagicLinkToken) error
+	// FindUnused returns the link with the given token hash if it was neither used nor has expired
+	FindUnused(ctx context.Context, tokenHash string) (*models.MagicLinkToken, error)
+	// MarkUsed consumes a link and reports whether it was still unused
+	MarkUsed(ctx context.Context, id uint) (bool, error)
+	// CountSince counts the links sent to an email address after since
+	CountSince(ctx context.Context, email string, since time.Time) (int64, error)
+}
+
+// gormMagicLinkRepository is the MagicLinkRepository backed by the database
+type gormMagicLinkRepository struct {
+	db *gorm.DB
+}
+
+// NewMagicLinkRepository returns a MagicLinkRepository backed by db
+func NewMagicLinkRepository(db *gorm.DB) MagicLinkRepository {
+	return &gormMagicLinkRepository{db: db}
+}
+
+func (r *gormMagicLinkRepository) Create(ctx context.Context, link *models.MagicLinkToken) error {
+	return translate(r.db.WithContext(ctx).Create(link).Error)
+}
+
+func (r *gormMagicLinkRepository) FindUnused(ctx context.Context, tokenHash string) (*models.MagicLinkToken, error) {
+	var link models.MagicLinkToken
+	err := r.db.WithContext(ctx).Where("token_hash = ? AND used_at IS NULL AND expires_at > ?", tokenHash, time.Now()).First(&link).Error
+	if err != nil {
+		return nil, translate(err)
+	}
+	return &link, nil
+}
+
+func (r *gormMagicLinkRepository) MarkUsed(ctx context.Context, id uint) (bool, error) {
+	result := r.db.WithContext(ctx).Model(&models.MagicLinkToken{}).
+		Where("id = ? AND used_at IS NULL", id).
+		Update("used_at", time.Now())
+	return result.RowsAffected > 0, result.Error
+}
+
+func (r *gormMagicLinkRepository) CountSince(ctx context.Context, email string, since time.Time) (int64, error) {
+	var count int64
+	err := r.db.WithContext(ctx).Model(&models.MagicLinkToken{}).
+		Where("email = ? AND created_at > ?", email, since).
+		Count(&count).Error
+	return count, err
+}
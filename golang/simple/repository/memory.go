@@ -0,0 +1,1422 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"crud-example/models"
+)
+
+// MemoryUserRepository is a UserRepository kept in memory, for tests
+type MemoryUserRepository struct {
+	mu      sync.Mutex
+	nextID  uint
+	users   map[uint]models.User
+	history map[uint][]string
+}
+
+// NewMemoryUserRepository returns an empty MemoryUserRepository
+func NewMemoryUserRepository() *MemoryUserRepository {
+	return &MemoryUserRepository{users: map[uint]models.User{}, history: map[uint][]string{}}
+}
+
+func (r *MemoryUserRepository) FindByID(ctx context.Context, id uint) (*models.User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	user, ok := r.users[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &user, nil
+}
+
+func (r *MemoryUserRepository) FindActiveByID(ctx context.Context, id uint) (*models.User, error) {
+	user, err := r.FindByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if !user.IsActive {
+		return nil, ErrNotFound
+	}
+	return user, nil
+}
+
+func (r *MemoryUserRepository) FindByEmail(ctx context.Context, email string) (*models.User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, user := range r.users {
+		if user.Email == email {
+			return &user, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (r *MemoryUserRepository) FindByEmailFold(ctx context.Context, email string) (*models.User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, user := range r.users {
+		if strings.EqualFold(user.Email, email) {
+			return &user, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (r *MemoryUserRepository) EmailTaken(ctx context.Context, email string, exceptID uint) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.emailTaken(email, exceptID), nil
+}
+
+func (r *MemoryUserRepository) emailTaken(email string, exceptID uint) bool {
+	for id, user := range r.users {
+		if id != exceptID && user.Email == email {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *MemoryUserRepository) ListActive(ctx context.Context, offset, limit int) ([]models.User, int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var active []models.User
+	for _, user := range r.users {
+		if user.IsActive {
+			active = append(active, user)
+		}
+	}
+	sort.Slice(active, func(i, j int) bool { return active[i].ID < active[j].ID })
+
+	total := int64(len(active))
+	if offset >= len(active) {
+		return []models.User{}, total, nil
+	}
+	end := offset + limit
+	if end > len(active) {
+		end = len(active)
+	}
+	return active[offset:end], total, nil
+}
+
+func (r *MemoryUserRepository) Create(ctx context.Context, user *models.User) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.emailTaken(user.Email, 0) {
+		return ErrDuplicate
+	}
+
+	r.nextID++
+	now := time.Now()
+	user.ID = r.nextID
+	user.CreatedAt = now
+	user.UpdatedAt = now
+	r.users[user.ID] = *user
+	return nil
+}
+
+func (r *MemoryUserRepository) Save(ctx context.Context, user *models.User) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.users[user.ID]; !ok {
+		return ErrNotFound
+	}
+	if r.emailTaken(user.Email, user.ID) {
+		return ErrDuplicate
+	}
+
+	user.UpdatedAt = time.Now()
+	r.users[user.ID] = *user
+	return nil
+}
+
+func (r *MemoryUserRepository) ReplacePassword(ctx context.Context, id uint, oldHash, newHash string) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	user, ok := r.users[id]
+	if !ok || user.Password != oldHash {
+		return false, nil
+	}
+	user.Password = newHash
+	r.users[id] = user
+	return true, nil
+}
+
+func (r *MemoryUserRepository) ChangePassword(ctx context.Context, id uint, oldHash, newHash string, changedAt time.Time, keepHistory int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	user, ok := r.users[id]
+	if !ok {
+		return ErrNotFound
+	}
+	user.Password = newHash
+	user.PasswordChangedAt = &changedAt
+	r.users[id] = user
+
+	history := r.history[id]
+	if oldHash != "" {
+		history = append([]string{oldHash}, history...)
+	}
+	if len(history) > keepHistory {
+		history = history[:keepHistory]
+	}
+	r.history[id] = history
+	return nil
+}
+
+func (r *MemoryUserRepository) PasswordHistory(ctx context.Context, userID uint, limit int) ([]string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	history := r.history[userID]
+	if len(history) > limit {
+		history = history[:limit]
+	}
+	return append([]string{}, history...), nil
+}
+
+func (r *MemoryUserRepository) ScheduleDeletion(ctx context.Context, id uint, dueAt *time.Time) error {
+	return r.update(id, func(user *models.User) { user.DeletionDueAt = dueAt })
+}
+
+func (r *MemoryUserRepository) ListDueForDeletion(ctx context.Context, before time.Time) ([]models.User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var due []models.User
+	for _, user := range r.users {
+		if user.IsActive && user.DeletionDueAt != nil && !user.DeletionDueAt.After(before) {
+			due = append(due, user)
+		}
+	}
+	sort.Slice(due, func(i, j int) bool { return due[i].ID < due[j].ID })
+	return due, nil
+}
+
+func (r *MemoryUserRepository) Deactivate(ctx context.Context, id uint) error {
+	return r.update(id, func(user *models.User) {
+		user.IsActive = false
+		user.DeletionDueAt = nil
+	})
+}
+
+// update changes the stored copy of a user
+func (r *MemoryUserRepository) update(id uint, change func(*models.User)) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	user, ok := r.users[id]
+	if !ok {
+		return ErrNotFound
+	}
+	change(&user)
+	user.UpdatedAt = time.Now()
+	r.users[id] = user
+	return nil
+}
+
+// MemorySessionRepository is a SessionRepository kept in memory, for tests
+type MemorySessionRepository struct {
+	mu       sync.Mutex
+	nextID   uint
+	sessions map[uint]models.UserSession
+}
+
+// NewMemorySessionRepository returns an empty MemorySessionRepository
+func NewMemorySessionRepository() *MemorySessionRepository {
+	return &MemorySessionRepository{sessions: map[uint]models.UserSession{}}
+}
+
+// All returns the stored sessions of a user
+func (r *MemorySessionRepository) All(userID uint) []models.UserSession {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var sessions []models.UserSession
+	for _, session := range r.sessions {
+		if session.UserID == userID {
+			sessions = append(sessions, session)
+		}
+	}
+	sort.Slice(sessions, func(i, j int) bool { return sessions[i].ID < sessions[j].ID })
+	return sessions
+}
+
+func (r *MemorySessionRepository) Create(ctx context.Context, session *models.UserSession) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.nextID++
+	session.ID = r.nextID
+	session.CreatedAt = time.Now()
+	r.sessions[session.ID] = *session
+	return nil
+}
+
+func (r *MemorySessionRepository) Revoke(ctx context.Context, id uint) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if session, ok := r.sessions[id]; ok {
+		r.sessions[id] = revoked(session)
+	}
+	return nil
+}
+
+func (r *MemorySessionRepository) RevokeUser(ctx context.Context, userID uint, keep string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for id, session := range r.sessions {
+		if session.UserID == userID && session.IsActive && (keep == "" || session.SessionToken != keep) {
+			r.sessions[id] = revoked(session)
+		}
+	}
+	return nil
+}
+
+func (r *MemorySessionRepository) RevokeClient(ctx context.Context, clientID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for id, session := range r.sessions {
+		if session.ClientID == clientID && session.IsActive {
+			r.sessions[id] = revoked(session)
+		}
+	}
+	return nil
+}
+
+func (r *MemorySessionRepository) FindByToken(ctx context.Context, sessionToken string) (*models.UserSession, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, session := range r.sessions {
+		if session.SessionToken == sessionToken {
+			return &session, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (r *MemorySessionRepository) FindActiveByUser(ctx context.Context, id, userID uint) (*models.UserSession, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	session, ok := r.sessions[id]
+	if !ok || session.UserID != userID || !session.IsActive {
+		return nil, ErrNotFound
+	}
+	return &session, nil
+}
+
+func (r *MemorySessionRepository) ListActive(ctx context.Context, userID uint) ([]models.UserSession, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	var active []models.UserSession
+	for _, session := range r.sessions {
+		if session.UserID == userID && session.IsActive && session.ExpiresAt.After(now) {
+			active = append(active, session)
+		}
+	}
+	lastSeen := func(session models.UserSession) time.Time {
+		if session.LastSeenAt == nil {
+			return time.Time{}
+		}
+		return *session.LastSeenAt
+	}
+	sort.Slice(active, func(i, j int) bool {
+		if a, b := lastSeen(active[i]), lastSeen(active[j]); !a.Equal(b) {
+			return a.After(b)
+		}
+		return active[i].ID > active[j].ID
+	})
+	return active, nil
+}
+
+func (r *MemorySessionRepository) Rotate(ctx context.Context, id uint, oldHash, newHash string, expiresAt time.Time, ipAddress, userAgent string) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	session, ok := r.sessions[id]
+	if !ok || session.RefreshToken != oldHash || !session.IsActive {
+		return false, nil
+	}
+	session.RefreshToken = newHash
+	session.ExpiresAt = expiresAt
+	session.IPAddress = ipAddress
+	session.UserAgent = userAgent
+	r.sessions[id] = session
+	return true, nil
+}
+
+func (r *MemorySessionRepository) TouchLastSeen(ctx context.Context, sessionToken string, seen time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for id, session := range r.sessions {
+		if session.SessionToken == sessionToken && (session.LastSeenAt == nil || session.LastSeenAt.Before(seen)) {
+			session.LastSeenAt = &seen
+			r.sessions[id] = session
+		}
+	}
+	return nil
+}
+
+func revoked(session models.UserSession) models.UserSession {
+	now := time.Now()
+	session.IsActive = false
+	session.RevokedAt = &now
+	return session
+}
+
+// MemoryLoginFailureRepository is a LoginFailureRepository kept in memory, for tests
+type MemoryLoginFailureRepository struct {
+	mu       sync.Mutex
+	nextID   uint
+	failures map[[2]string]models.LoginFailure
+}
+
+// NewMemoryLoginFailureRepository returns an empty MemoryLoginFailureRepository
+func NewMemoryLoginFailureRepository() *MemoryLoginFailureRepository {
+	return &MemoryLoginFailureRepository{failures: map[[2]string]models.LoginFailure{}}
+}
+
+func (r *MemoryLoginFailureRepository) Find(ctx context.Context, identifiers map[string]string) ([]models.LoginFailure, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	failures := []models.LoginFailure{}
+	for scope, identifier := range identifiers {
+		if failure, ok := r.failures[[2]string{scope, identifier}]; ok {
+			failures = append(failures, failure)
+		}
+	}
+	return failures, nil
+}
+
+func (r *MemoryLoginFailureRepository) Record(ctx context.Context, scope, identifier string, update func(*models.LoginFailure)) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key := [2]string{scope, identifier}
+	failure, ok := r.failures[key]
+	if !ok {
+		r.nextID++
+		failure = models.LoginFailure{ID: r.nextID, Scope: scope, Identifier: identifier}
+	}
+
+	update(&failure)
+	failure.UpdatedAt = time.Now()
+	r.failures[key] = failure
+	return nil
+}
+
+func (r *MemoryLoginFailureRepository) Delete(ctx context.Context, scope, identifier string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.failures, [2]string{scope, identifier})
+	return nil
+}
+
+func (r *MemoryLoginFailureRepository) DeleteBefore(ctx context.Context, scope string, before time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for key, failure := range r.failures {
+		if failure.Scope == scope && failure.LastFailureAt.Before(before) {
+			delete(r.failures, key)
+		}
+	}
+	return nil
+}
+
+// MemoryVerificationTokenRepository is a VerificationTokenRepository kept in memory, for tests
+type MemoryVerificationTokenRepository struct {
+	mu     sync.Mutex
+	tokens []models.EmailVerificationToken
+}
+
+// NewMemoryVerificationTokenRepository returns an empty MemoryVerificationTokenRepository
+func NewMemoryVerificationTokenRepository() *MemoryVerificationTokenRepository {
+	return &MemoryVerificationTokenRepository{}
+}
+
+// All returns the stored verification tokens
+func (r *MemoryVerificationTokenRepository) All() []models.EmailVerificationToken {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]models.EmailVerificationToken{}, r.tokens...)
+}
+
+func (r *MemoryVerificationTokenRepository) Create(ctx context.Context, token *models.EmailVerificationToken) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	token.ID = uint(len(r.tokens) + 1)
+	token.CreatedAt = time.Now()
+	r.tokens = append(r.tokens, *token)
+	return nil
+}
+
+func (r *MemoryVerificationTokenRepository) FindUnused(ctx context.Context, tokenHash string) (*models.EmailVerificationToken, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	for _, token := range r.tokens {
+		if token.TokenHash == tokenHash && token.UsedAt == nil && token.ExpiresAt.After(now) {
+			return &token, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (r *MemoryVerificationTokenRepository) MarkUsed(ctx context.Context, id uint) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i := range r.tokens {
+		if r.tokens[i].ID == id && r.tokens[i].UsedAt == nil {
+			now := time.Now()
+			r.tokens[i].UsedAt = &now
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (r *MemoryVerificationTokenRepository) CountSince(ctx context.Context, userID uint, since time.Time) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var count int64
+	for _, token := range r.tokens {
+		if token.UserID == userID && token.CreatedAt.After(since) {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// MemoryAPIKeyRepository is an APIKeyRepository kept in memory, for tests
+type MemoryAPIKeyRepository struct {
+	mu   sync.Mutex
+	keys []models.APIKey
+}
+
+// NewMemoryAPIKeyRepository returns an empty MemoryAPIKeyRepository
+func NewMemoryAPIKeyRepository() *MemoryAPIKeyRepository {
+	return &MemoryAPIKeyRepository{}
+}
+
+func (r *MemoryAPIKeyRepository) ListByUser(ctx context.Context, userID uint) ([]models.APIKey, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	keys := []models.APIKey{}
+	for i := len(r.keys) - 1; i >= 0; i-- {
+		if r.keys[i].UserID == userID {
+			keys = append(keys, r.keys[i])
+		}
+	}
+	return keys, nil
+}
+
+func (r *MemoryAPIKeyRepository) Create(ctx context.Context, key *models.APIKey) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, existing := range r.keys {
+		if existing.PublicID == key.PublicID {
+			return ErrDuplicate
+		}
+	}
+	now := time.Now()
+	key.ID = uint(len(r.keys) + 1)
+	key.CreatedAt = now
+	key.UpdatedAt = now
+	r.keys = append(r.keys, *key)
+	return nil
+}
+
+func (r *MemoryAPIKeyRepository) FindByUser(ctx context.Context, id, userID uint) (*models.APIKey, error) {
+	return r.find(func(key *models.APIKey) bool { return key.ID == id && key.UserID == userID })
+}
+
+func (r *MemoryAPIKeyRepository) FindActiveByPublicID(ctx context.Context, publicID string) (*models.APIKey, error) {
+	return r.find(func(key *models.APIKey) bool { return key.PublicID == publicID && key.RevokedAt == nil })
+}
+
+func (r *MemoryAPIKeyRepository) Rename(ctx context.Context, id uint, name string) error {
+	return r.update(id, func(key *models.APIKey) { key.Name = name })
+}
+
+func (r *MemoryAPIKeyRepository) Revoke(ctx context.Context, id uint, at time.Time) error {
+	return r.update(id, func(key *models.APIKey) {
+		if key.RevokedAt == nil {
+			key.RevokedAt = &at
+		}
+	})
+}
+
+func (r *MemoryAPIKeyRepository) RecordUsage(ctx context.Context, id uint, at time.Time, ip string) error {
+	return r.update(id, func(key *models.APIKey) {
+		key.LastUsedAt = &at
+		key.LastUsedIP = ip
+	})
+}
+
+func (r *MemoryAPIKeyRepository) find(match func(*models.APIKey) bool) (*models.APIKey, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, key := range r.keys {
+		if match(&key) {
+			return &key, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (r *MemoryAPIKeyRepository) update(id uint, change func(*models.APIKey)) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i := range r.keys {
+		if r.keys[i].ID == id {
+			change(&r.keys[i])
+			r.keys[i].UpdatedAt = time.Now()
+		}
+	}
+	return nil
+}
+
+// MemoryRevocationRepository is a RevocationRepository kept in memory, for tests
+type MemoryRevocationRepository struct {
+	mu     sync.Mutex
+	tokens map[string]models.RevokedToken
+	users  map[uint]models.UserTokenRevocation
+}
+
+// NewMemoryRevocationRepository returns an empty MemoryRevocationRepository
+func NewMemoryRevocationRepository() *MemoryRevocationRepository {
+	return &MemoryRevocationRepository{
+		tokens: map[string]models.RevokedToken{},
+		users:  map[uint]models.UserTokenRevocation{},
+	}
+}
+
+func (r *MemoryRevocationRepository) RevokeToken(ctx context.Context, token *models.RevokedToken) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.tokens[token.JTI]; !ok {
+		token.ID = uint(len(r.tokens) + 1)
+		token.CreatedAt = time.Now()
+		r.tokens[token.JTI] = *token
+	}
+	return nil
+}
+
+func (r *MemoryRevocationRepository) FindToken(ctx context.Context, jti string) (*models.RevokedToken, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	token, ok := r.tokens[jti]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &token, nil
+}
+
+func (r *MemoryRevocationRepository) DeleteExpiredTokens(ctx context.Context, before time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for jti, token := range r.tokens {
+		if token.ExpiresAt.Before(before) {
+			delete(r.tokens, jti)
+		}
+	}
+	return nil
+}
+
+func (r *MemoryRevocationRepository) RevokeUser(ctx context.Context, revocation *models.UserTokenRevocation) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	revocation.UpdatedAt = time.Now()
+	r.users[revocation.UserID] = *revocation
+	return nil
+}
+
+func (r *MemoryRevocationRepository) FindUser(ctx context.Context, userID uint) (*models.UserTokenRevocation, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	revocation, ok := r.users[userID]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &revocation, nil
+}
+
+// MemoryAuditRepository is an AuditRepository kept in memory, for tests
+type MemoryAuditRepository struct {
+	mu      sync.Mutex
+	entries []models.SystemLog
+}
+
+// NewMemoryAuditRepository returns an empty MemoryAuditRepository
+func NewMemoryAuditRepository() *MemoryAuditRepository {
+	return &MemoryAuditRepository{}
+}
+
+// All returns the stored audit events, oldest first
+func (r *MemoryAuditRepository) All() []models.SystemLog {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]models.SystemLog{}, r.entries...)
+}
+
+func (r *MemoryAuditRepository) Create(ctx context.Context, entry *models.SystemLog) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	entry.ID = uint(len(r.entries) + 1)
+	entry.CreatedAt = time.Now()
+	r.entries = append(r.entries, *entry)
+	return nil
+}
+
+// MemorySettingRepository is a SettingRepository kept in memory, for tests
+type MemorySettingRepository struct {
+	mu       sync.Mutex
+	settings map[string]models.SystemConfig
+}
+
+// NewMemorySettingRepository returns an empty MemorySettingRepository
+func NewMemorySettingRepository() *MemorySettingRepository {
+	return &MemorySettingRepository{settings: map[string]models.SystemConfig{}}
+}
+
+func (r *MemorySettingRepository) Find(ctx context.Context, key string) (*models.SystemConfig, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	setting, ok := r.settings[key]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &setting, nil
+}
+
+func (r *MemorySettingRepository) Save(ctx context.Context, setting *models.SystemConfig) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	if existing, ok := r.settings[setting.ConfigKey]; ok {
+		existing.ConfigValue = setting.ConfigValue
+		existing.UpdatedAt = now
+		r.settings[setting.ConfigKey] = existing
+		return nil
+	}
+	setting.ID = uint(len(r.settings) + 1)
+	setting.CreatedAt = now
+	setting.UpdatedAt = now
+	r.settings[setting.ConfigKey] = *setting
+	return nil
+}
+
+// MemoryPasswordResetTokenRepository is a PasswordResetTokenRepository kept in memory, for tests
+type MemoryPasswordResetTokenRepository struct {
+	mu     sync.Mutex
+	tokens []models.PasswordResetToken
+}
+
+// NewMemoryPasswordResetTokenRepository returns an empty MemoryPasswordResetTokenRepository
+func NewMemoryPasswordResetTokenRepository() *MemoryPasswordResetTokenRepository {
+	return &MemoryPasswordResetTokenRepository{}
+}
+
+func (r *MemoryPasswordResetTokenRepository) Create(ctx context.Context, token *models.PasswordResetToken) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	token.ID = uint(len(r.tokens) + 1)
+	token.CreatedAt = time.Now()
+	r.tokens = append(r.tokens, *token)
+	return nil
+}
+
+func (r *MemoryPasswordResetTokenRepository) ExpirePending(ctx context.Context, userID uint) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	for i := range r.tokens {
+		if r.tokens[i].UserID == userID && r.tokens[i].UsedAt == nil && r.tokens[i].ExpiresAt.After(now) {
+			r.tokens[i].ExpiresAt = now
+		}
+	}
+	return nil
+}
+
+func (r *MemoryPasswordResetTokenRepository) FindUnused(ctx context.Context, tokenHash string) (*models.PasswordResetToken, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	for _, token := range r.tokens {
+		if token.TokenHash == tokenHash && token.UsedAt == nil && token.ExpiresAt.After(now) {
+			return &token, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (r *MemoryPasswordResetTokenRepository) MarkUsed(ctx context.Context, id uint) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i := range r.tokens {
+		if r.tokens[i].ID == id && r.tokens[i].UsedAt == nil {
+			now := time.Now()
+			r.tokens[i].UsedAt = &now
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (r *MemoryPasswordResetTokenRepository) CountSince(ctx context.Context, userID uint, since time.Time) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var count int64
+	for _, token := range r.tokens {
+		if token.UserID == userID && token.CreatedAt.After(since) {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// MemoryMagicLinkRepository is a MagicLinkRepository kept in memory, for tests
+type MemoryMagicLinkRepository struct {
+	mu    sync.Mutex
+	links []models.MagicLinkToken
+}
+
+// NewMemoryMagicLinkRepository returns an empty MemoryMagicLinkRepository
+func NewMemoryMagicLinkRepository() *MemoryMagicLinkRepository {
+	return &MemoryMagicLinkRepository{}
+}
+
+func (r *MemoryMagicLinkRepository) Create(ctx context.Context, link *models.MagicLinkToken) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	link.ID = uint(len(r.links) + 1)
+	link.CreatedAt = time.Now()
+	r.links = append(r.links, *link)
+	return nil
+}
+
+func (r *MemoryMagicLinkRepository) FindUnused(ctx context.Context, tokenHash string) (*models.MagicLinkToken, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	for _, link := range r.links {
+		if link.TokenHash == tokenHash && link.UsedAt == nil && link.ExpiresAt.After(now) {
+			return &link, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (r *MemoryMagicLinkRepository) MarkUsed(ctx context.Context, id uint) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i := range r.links {
+		if r.links[i].ID == id && r.links[i].UsedAt == nil {
+			now := time.Now()
+			r.links[i].UsedAt = &now
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (r *MemoryMagicLinkRepository) CountSince(ctx context.Context, email string, since time.Time) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var count int64
+	for _, link := range r.links {
+		if link.Email == email && link.CreatedAt.After(since) {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// MemoryOAuthClientRepository is an OAuthClientRepository kept in memory, for tests
+type MemoryOAuthClientRepository struct {
+	mu      sync.Mutex
+	nextID  uint
+	clients []models.OAuthClient
+}
+
+// NewMemoryOAuthClientRepository returns an empty MemoryOAuthClientRepository
+func NewMemoryOAuthClientRepository() *MemoryOAuthClientRepository {
+	return &MemoryOAuthClientRepository{}
+}
+
+func (r *MemoryOAuthClientRepository) ListByOwner(ctx context.Context, ownerID uint) ([]models.OAuthClient, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	clients := []models.OAuthClient{}
+	for i := len(r.clients) - 1; i >= 0; i-- {
+		if r.clients[i].OwnerID == ownerID {
+			clients = append(clients, r.clients[i])
+		}
+	}
+	return clients, nil
+}
+
+func (r *MemoryOAuthClientRepository) Create(ctx context.Context, client *models.OAuthClient) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, existing := range r.clients {
+		if existing.ClientID == client.ClientID {
+			return ErrDuplicate
+		}
+	}
+	r.nextID++
+	now := time.Now()
+	client.ID = r.nextID
+	client.CreatedAt = now
+	client.UpdatedAt = now
+	r.clients = append(r.clients, *client)
+	return nil
+}
+
+func (r *MemoryOAuthClientRepository) FindByOwner(ctx context.Context, id, ownerID uint) (*models.OAuthClient, error) {
+	return r.find(func(client *models.OAuthClient) bool { return client.ID == id && client.OwnerID == ownerID })
+}
+
+func (r *MemoryOAuthClientRepository) FindByClientID(ctx context.Context, clientID string) (*models.OAuthClient, error) {
+	return r.find(func(client *models.OAuthClient) bool { return client.ClientID == clientID })
+}
+
+func (r *MemoryOAuthClientRepository) Delete(ctx context.Context, id uint) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i := range r.clients {
+		if r.clients[i].ID == id {
+			r.clients = append(r.clients[:i], r.clients[i+1:]...)
+			return nil
+		}
+	}
+	return nil
+}
+
+func (r *MemoryOAuthClientRepository) find(match func(*models.OAuthClient) bool) (*models.OAuthClient, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, client := range r.clients {
+		if match(&client) {
+			return &client, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+// MemoryOAuthCodeRepository is an OAuthCodeRepository kept in memory, for tests
+type MemoryOAuthCodeRepository struct {
+	mu    sync.Mutex
+	codes []models.OAuthAuthorizationCode
+}
+
+// NewMemoryOAuthCodeRepository returns an empty MemoryOAuthCodeRepository
+func NewMemoryOAuthCodeRepository() *MemoryOAuthCodeRepository {
+	return &MemoryOAuthCodeRepository{}
+}
+
+func (r *MemoryOAuthCodeRepository) Create(ctx context.Context, code *models.OAuthAuthorizationCode) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	code.ID = uint(len(r.codes) + 1)
+	code.CreatedAt = time.Now()
+	r.codes = append(r.codes, *code)
+	return nil
+}
+
+func (r *MemoryOAuthCodeRepository) Find(ctx context.Context, codeHash, clientID string) (*models.OAuthAuthorizationCode, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, code := range r.codes {
+		if code.CodeHash == codeHash && code.ClientID == clientID {
+			return &code, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (r *MemoryOAuthCodeRepository) MarkUsed(ctx context.Context, id uint) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i := range r.codes {
+		if r.codes[i].ID == id && r.codes[i].UsedAt == nil {
+			now := time.Now()
+			r.codes[i].UsedAt = &now
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (r *MemoryOAuthCodeRepository) SetSession(ctx context.Context, id uint, sessionToken string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i := range r.codes {
+		if r.codes[i].ID == id {
+			r.codes[i].SessionToken = sessionToken
+		}
+	}
+	return nil
+}
+
+// MemoryFederationRepository is a FederationRepository kept in memory, for tests. New users
+// are created in users.
+type MemoryFederationRepository struct {
+	users *MemoryUserRepository
+
+	mu         sync.Mutex
+	nextID     uint
+	states     []models.FederationState
+	identities []models.FederatedIdentity
+}
+
+// NewMemoryFederationRepository returns an empty MemoryFederationRepository linking identities
+// to the users in users
+func NewMemoryFederationRepository(users *MemoryUserRepository) *MemoryFederationRepository {
+	return &MemoryFederationRepository{users: users}
+}
+
+func (r *MemoryFederationRepository) CreateState(ctx context.Context, state *models.FederationState) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.nextID++
+	state.ID = r.nextID
+	state.CreatedAt = time.Now()
+	r.states = append(r.states, *state)
+	return nil
+}
+
+func (r *MemoryFederationRepository) ConsumeState(ctx context.Context, stateHash, provider string) (*models.FederationState, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	for i, state := range r.states {
+		if state.StateHash == stateHash && state.Provider == provider && state.ExpiresAt.After(now) {
+			r.states = append(r.states[:i], r.states[i+1:]...)
+			return &state, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (r *MemoryFederationRepository) DeleteExpiredStates(ctx context.Context, before time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	kept := r.states[:0]
+	for _, state := range r.states {
+		if !state.ExpiresAt.Before(before) {
+			kept = append(kept, state)
+		}
+	}
+	r.states = kept
+	return nil
+}
+
+func (r *MemoryFederationRepository) ListIdentities(ctx context.Context, userID uint) ([]models.FederatedIdentity, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	identities := []models.FederatedIdentity{}
+	for _, identity := range r.identities {
+		if identity.UserID == userID {
+			identities = append(identities, identity)
+		}
+	}
+	return identities, nil
+}
+
+func (r *MemoryFederationRepository) FindIdentity(ctx context.Context, provider, subject string) (*models.FederatedIdentity, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, identity := range r.identities {
+		if identity.Provider == provider && identity.Subject == subject {
+			return &identity, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (r *MemoryFederationRepository) CreateIdentity(ctx context.Context, identity *models.FederatedIdentity) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.createIdentity(identity)
+}
+
+func (r *MemoryFederationRepository) createIdentity(identity *models.FederatedIdentity) error {
+	for _, existing := range r.identities {
+		if existing.Provider == identity.Provider && existing.Subject == identity.Subject {
+			return ErrDuplicate
+		}
+	}
+	r.nextID++
+	identity.ID = r.nextID
+	identity.CreatedAt = time.Now()
+	r.identities = append(r.identities, *identity)
+	return nil
+}
+
+func (r *MemoryFederationRepository) TouchIdentity(ctx context.Context, id uint, at time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i := range r.identities {
+		if r.identities[i].ID == id {
+			r.identities[i].LastLoginAt = &at
+		}
+	}
+	return nil
+}
+
+func (r *MemoryFederationRepository) DeleteIdentity(ctx context.Context, userID uint, provider string) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i, identity := range r.identities {
+		if identity.UserID == userID && identity.Provider == provider {
+			r.identities = append(r.identities[:i], r.identities[i+1:]...)
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (r *MemoryFederationRepository) LinkByEmail(ctx context.Context, email string, identity *models.FederatedIdentity, accept func(*models.User) error, create func() (*models.User, error)) (*models.User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	user, err := r.users.FindByEmailFold(ctx, email)
+	switch {
+	case err == nil:
+		if err := accept(user); err != nil {
+			return nil, err
+		}
+	case errors.Is(err, ErrNotFound):
+		if user, err = create(); err != nil {
+			return nil, err
+		}
+		if err := r.users.Create(ctx, user); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, err
+	}
+
+	identity.UserID = user.ID
+	if err := r.createIdentity(identity); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// MemoryMFARepository is an MFARepository kept in memory, for tests. The MFA flag is kept
+// on the users in users.
+type MemoryMFARepository struct {
+	users *MemoryUserRepository
+
+	mu       sync.Mutex
+	secrets  map[uint]models.UserMFA
+	recovery map[uint][]models.MFARecoveryCode
+}
+
+// NewMemoryMFARepository returns an empty MemoryMFARepository for the users in users
+func NewMemoryMFARepository(users *MemoryUserRepository) *MemoryMFARepository {
+	return &MemoryMFARepository{
+		users:    users,
+		secrets:  map[uint]models.UserMFA{},
+		recovery: map[uint][]models.MFARecoveryCode{},
+	}
+}
+
+func (r *MemoryMFARepository) SaveSecret(ctx context.Context, mfa *models.UserMFA) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	if existing, ok := r.secrets[mfa.UserID]; ok {
+		mfa.CreatedAt = existing.CreatedAt
+	} else {
+		mfa.CreatedAt = now
+	}
+	mfa.UpdatedAt = now
+	r.secrets[mfa.UserID] = *mfa
+	return nil
+}
+
+func (r *MemoryMFARepository) FindPending(ctx context.Context, userID uint) (*models.UserMFA, error) {
+	return r.find(userID, false)
+}
+
+func (r *MemoryMFARepository) FindEnabled(ctx context.Context, userID uint) (*models.UserMFA, error) {
+	return r.find(userID, true)
+}
+
+func (r *MemoryMFARepository) find(userID uint, enabled bool) (*models.UserMFA, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	mfa, ok := r.secrets[userID]
+	if !ok || mfa.Enabled != enabled {
+		return nil, ErrNotFound
+	}
+	return &mfa, nil
+}
+
+func (r *MemoryMFARepository) Enable(ctx context.Context, userID uint, step int64, recoveryHashes []string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	mfa, ok := r.secrets[userID]
+	if !ok {
+		return ErrNotFound
+	}
+	now := time.Now()
+	mfa.Enabled = true
+	mfa.LastUsedStep = step
+	mfa.ConfirmedAt = &now
+	r.secrets[userID] = mfa
+
+	codes := []models.MFARecoveryCode{}
+	for _, hash := range recoveryHashes {
+		codes = append(codes, models.MFARecoveryCode{UserID: userID, CodeHash: hash, CreatedAt: now})
+	}
+	r.recovery[userID] = codes
+	return r.users.update(userID, func(user *models.User) { user.MFAEnabled = true })
+}
+
+func (r *MemoryMFARepository) UseStep(ctx context.Context, userID uint, step int64) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	mfa, ok := r.secrets[userID]
+	if !ok || mfa.LastUsedStep >= step {
+		return false, nil
+	}
+	mfa.LastUsedStep = step
+	r.secrets[userID] = mfa
+	return true, nil
+}
+
+func (r *MemoryMFARepository) UseRecoveryCode(ctx context.Context, userID uint, codeHash string) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	codes := r.recovery[userID]
+	for i := range codes {
+		if codes[i].CodeHash == codeHash && codes[i].UsedAt == nil {
+			now := time.Now()
+			codes[i].UsedAt = &now
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (r *MemoryMFARepository) Remove(ctx context.Context, userID uint) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.secrets, userID)
+	delete(r.recovery, userID)
+	return r.users.update(userID, func(user *models.User) { user.MFAEnabled = false })
+}
+
+// MemoryPasskeyRepository is a PasskeyRepository kept in memory, for tests
+type MemoryPasskeyRepository struct {
+	mu         sync.Mutex
+	nextID     uint
+	passkeys   []models.Passkey
+	challenges []models.WebAuthnChallenge
+}
+
+// NewMemoryPasskeyRepository returns an empty MemoryPasskeyRepository
+func NewMemoryPasskeyRepository() *MemoryPasskeyRepository {
+	return &MemoryPasskeyRepository{}
+}
+
+func (r *MemoryPasskeyRepository) ListByUser(ctx context.Context, userID uint) ([]models.Passkey, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	passkeys := []models.Passkey{}
+	for i := len(r.passkeys) - 1; i >= 0; i-- {
+		if r.passkeys[i].UserID == userID {
+			passkeys = append(passkeys, r.passkeys[i])
+		}
+	}
+	return passkeys, nil
+}
+
+func (r *MemoryPasskeyRepository) Create(ctx context.Context, passkey *models.Passkey) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, existing := range r.passkeys {
+		if existing.CredentialHash == passkey.CredentialHash {
+			return ErrDuplicate
+		}
+	}
+	r.nextID++
+	now := time.Now()
+	passkey.ID = r.nextID
+	passkey.CreatedAt = now
+	passkey.UpdatedAt = now
+	r.passkeys = append(r.passkeys, *passkey)
+	return nil
+}
+
+func (r *MemoryPasskeyRepository) FindByCredentialHash(ctx context.Context, credentialHash string) (*models.Passkey, error) {
+	return r.find(func(passkey *models.Passkey) bool { return passkey.CredentialHash == credentialHash })
+}
+
+func (r *MemoryPasskeyRepository) FindByUser(ctx context.Context, id, userID uint) (*models.Passkey, error) {
+	return r.find(func(passkey *models.Passkey) bool { return passkey.ID == id && passkey.UserID == userID })
+}
+
+func (r *MemoryPasskeyRepository) Rename(ctx context.Context, id uint, name string) error {
+	return r.update(id, func(passkey *models.Passkey) { passkey.Name = name })
+}
+
+func (r *MemoryPasskeyRepository) RecordUse(ctx context.Context, id uint, signCount uint32, at time.Time) error {
+	return r.update(id, func(passkey *models.Passkey) {
+		passkey.SignCount = signCount
+		passkey.LastUsedAt = &at
+	})
+}
+
+func (r *MemoryPasskeyRepository) Delete(ctx context.Context, id uint) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i := range r.passkeys {
+		if r.passkeys[i].ID == id {
+			r.passkeys = append(r.passkeys[:i], r.passkeys[i+1:]...)
+			return nil
+		}
+	}
+	return nil
+}
+
+func (r *MemoryPasskeyRepository) CreateChallenge(ctx context.Context, challenge *models.WebAuthnChallenge) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.nextID++
+	challenge.ID = r.nextID
+	challenge.CreatedAt = time.Now()
+	r.challenges = append(r.challenges, *challenge)
+	return nil
+}
+
+func (r *MemoryPasskeyRepository) ConsumeChallenge(ctx context.Context, challengeHash, purpose string) (*models.WebAuthnChallenge, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	for i, challenge := range r.challenges {
+		if challenge.ChallengeHash == challengeHash && challenge.Purpose == purpose && challenge.ExpiresAt.After(now) {
+			r.challenges = append(r.challenges[:i], r.challenges[i+1:]...)
+			return &challenge, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (r *MemoryPasskeyRepository) DeleteExpiredChallenges(ctx context.Context, before time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	kept := r.challenges[:0]
+	for _, challenge := range r.challenges {
+		if !challenge.ExpiresAt.Before(before) {
+			kept = append(kept, challenge)
+		}
+	}
+	r.challenges = kept
+	return nil
+}
+
+func (r *MemoryPasskeyRepository) find(match func(*models.Passkey) bool) (*models.Passkey, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, passkey := range r.passkeys {
+		if match(&passkey) {
+			return &passkey, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (r *MemoryPasskeyRepository) update(id uint, change func(*models.Passkey)) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i := range r.passkeys {
+		if r.passkeys[i].ID == id {
+			change(&r.passkeys[i])
+			r.passkeys[i].UpdatedAt = time.Now()
+		}
+	}
+	return nil
+}
@@ -0,0 +1,38 @@
+package repository
+
+import (
+	"testing"
+)
+
+func TestMemoryUserRepository(t *testing.T) {
+	testUserRepository(t, NewMemoryUserRepository())
+}
+
+func TestMemorySessionRepository(t *testing.T) {
+	sessions := NewMemorySessionRepository()
+	testSessionRepository(t, sessions, func(userID uint) map[string]bool {
+		active := map[string]bool{}
+		for _, session := range sessions.All(userID) {
+			active[session.SessionToken] = session.IsActive
+		}
+		return active
+	})
+}
+
+func TestMemoryVerificationTokenRepository(t *testing.T) {
+	testVerificationTokenRepository(t, NewMemoryVerificationTokenRepository())
+}
+
+func TestMemoryMFARepository(t *testing.T) {
+	users := NewMemoryUserRepository()
+	testMFARepository(t, NewMemoryMFARepository(users), users)
+}
+
+func TestMemoryPasskeyRepository(t *testing.T) {
+	testPasskeyRepository(t, NewMemoryPasskeyRepository())
+}
+
+func TestMemoryFederationRepository(t *testing.T) {
+	users := NewMemoryUserRepository()
+	testFederationRepository(t, NewMemoryFederationRepository(users), users)
+}
@@ -0,0 +1,105 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+	"crud-example/models"
+)
+
+// MFARepository stores TOTP secrets and recovery codes, and keeps the MFA flag of users in
+// step with them
+type MFARepository interface {
+	// SaveSecret starts an enrolment, replacing any unconfirmed secret of the user
+	SaveSecret(ctx context.Context, mfa *models.UserMFA) error
+	// FindPending returns the unconfirmed enrolment of a user
+	FindPending(ctx context.Context, userID uint) (*models.UserMFA, error)
+	// FindEnabled returns the confirmed enrolment of a user
+	FindEnabled(ctx context.Context, userID uint) (*models.UserMFA, error)
+	// Enable confirms the enrolment of a user with the time step of its first code, replaces
+	// the recovery codes with the given hashes and turns MFA on for the user
+	Enable(ctx context.Context, userID uint, step int64, recoveryHashes []string) error
+	// UseStep records the time step of an accepted code only if it is later than the last
+	// one, and reports whether it was
+	UseStep(ctx context.Context, userID uint, step int64) (bool, error)
+	// UseRecoveryCode consumes an unused recovery code and reports whether there was one
+	UseRecoveryCode(ctx context.Context, userID uint, codeHash string) (bool, error)
+	// Remove deletes the secret and recovery codes of a user and turns MFA off
+	Remove(ctx context.Context, userID uint) error
+}
+
+// gormMFARepository is the MFARepository backed by the database
+type gormMFARepository struct {
+	db *gorm.DB
+}
+
+// NewMFARepository returns an MFARepository backed by db
+func NewMFARepository(db *gorm.DB) MFARepository {
+	return &gormMFARepository{db: db}
+}
+
+func (r *gormMFARepository) SaveSecret(ctx context.Context, mfa *models.UserMFA) error {
+	return r.db.WithContext(ctx).Save(mfa).Error
+}
+
+func (r *gormMFARepository) FindPending(ctx context.Context, userID uint) (*models.UserMFA, error) {
+	return r.find(ctx, userID, false)
+}
+
+func (r *gormMFARepository) FindEnabled(ctx context.Context, userID uint) (*models.UserMFA, error) {
+	return r.find(ctx, userID, true)
+}
+
+func (r *gormMFARepository) find(ctx context.Context, userID uint, enabled bool) (*models.UserMFA, error) {
+	var mfa models.UserMFA
+	if err := r.db.WithContext(ctx).Where("user_id = ? AND enabled = ?", userID, enabled).First(&mfa).Error; err != nil {
+		return nil, translate(err)
+	}
+	return &mfa, nil
+}
+
+func (r *gormMFARepository) Enable(ctx context.Context, userID uint, step int64, recoveryHashes []string) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&models.UserMFA{}).Where("user_id = ?", userID).
+			Updates(map[string]interface{}{"enabled": true, "last_used_step": step, "confirmed_at": time.Now()}).Error
+		if err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", userID).Delete(&models.MFARecoveryCode{}).Error; err != nil {
+			return err
+		}
+		for _, hash := range recoveryHashes {
+			if err := tx.Create(&models.MFARecoveryCode{UserID: userID, CodeHash: hash}).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Model(&models.User{}).Where("id = ?", userID).Update("mfa_enabled", true).Error
+	})
+}
+
+func (r *gormMFARepository) UseStep(ctx context.Context, userID uint, step int64) (bool, error) {
+	result := r.db.WithContext(ctx).Model(&models.UserMFA{}).
+		Where("user_id = ? AND last_used_step < ?", userID, step).
+		Update("last_used_step", step)
+	return result.RowsAffected == 1, result.Error
+}
+
+func (r *gormMFARepository) UseRecoveryCode(ctx context.Context, userID uint, codeHash string) (bool, error) {
+	result := r.db.WithContext(ctx).Model(&models.MFARecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userID, codeHash).
+		Update("used_at", time.Now())
+	return result.RowsAffected > 0, result.Error
+}
+
+func (r *gormMFARepository) Remove(ctx context.Context, userID uint) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", userID).Delete(&models.UserMFA{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", userID).Delete(&models.MFARecoveryCode{}).Error; err != nil {
+			return err
+		}
+		return tx.Model(&models.User{}).Where("id = ?", userID).Update("mfa_enabled", false).Error
+	})
+}
@@ -0,0 +1,108 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+	"crud-example/models"
+)
+
+// OAuthClientRepository stores the applications registered with the authorization server
+type OAuthClientRepository interface {
+	// ListByOwner returns the clients registered by a user, newest first
+	ListByOwner(ctx context.Context, ownerID uint) ([]models.OAuthClient, error)
+	// Create inserts a new client
+	Create(ctx context.Context, client *models.OAuthClient) error
+	// FindByOwner returns the client with the given ID if it was registered by the user
+	FindByOwner(ctx context.Context, id, ownerID uint) (*models.OAuthClient, error)
+	// FindByClientID returns the client with the given public client ID
+	FindByClientID(ctx context.Context, clientID string) (*models.OAuthClient, error)
+	// Delete removes a client
+	Delete(ctx context.Context, id uint) error
+}
+
+// gormOAuthClientRepository is the OAuthClientRepository backed by the database
+type gormOAuthClientRepository struct {
+	db *gorm.DB
+}
+
+// NewOAuthClientRepository returns an OAuthClientRepository backed by db
+func NewOAuthClientRepository(db *gorm.DB) OAuthClientRepository {
+	return &gormOAuthClientRepository{db: db}
+}
+
+func (r *gormOAuthClientRepository) ListByOwner(ctx context.Context, ownerID uint) ([]models.OAuthClient, error) {
+	var clients []models.OAuthClient
+	err := r.db.WithContext(ctx).Where("owner_id = ?", ownerID).Order("created_at DESC, id DESC").Find(&clients).Error
+	return clients, err
+}
+
+func (r *gormOAuthClientRepository) Create(ctx context.Context, client *models.OAuthClient) error {
+	return translate(r.db.WithContext(ctx).Create(client).Error)
+}
+
+func (r *gormOAuthClientRepository) FindByOwner(ctx context.Context, id, ownerID uint) (*models.OAuthClient, error) {
+	var client models.OAuthClient
+	if err := r.db.WithContext(ctx).Where("id = ? AND owner_id = ?", id, ownerID).First(&client).Error; err != nil {
+		return nil, translate(err)
+	}
+	return &client, nil
+}
+
+func (r *gormOAuthClientRepository) FindByClientID(ctx context.Context, clientID string) (*models.OAuthClient, error) {
+	var client models.OAuthClient
+	if err := r.db.WithContext(ctx).Where("client_id = ?", clientID).First(&client).Error; err != nil {
+		return nil, translate(err)
+	}
+	return &client, nil
+}
+
+func (r *gormOAuthClientRepository) Delete(ctx context.Context, id uint) error {
+	return r.db.WithContext(ctx).Delete(&models.OAuthClient{}, id).Error
+}
+
+// OAuthCodeRepository stores authorization codes
+type OAuthCodeRepository interface {
+	// Create inserts a new authorization code
+	Create(ctx context.Context, code *models.OAuthAuthorizationCode) error
+	// Find returns the code with the given hash issued to the client, used or not
+	Find(ctx context.Context, codeHash, clientID string) (*models.OAuthAuthorizationCode, error)
+	// MarkUsed redeems a code and reports whether it was still unused
+	MarkUsed(ctx context.Context, id uint) (bool, error)
+	// SetSession records the session started when a code was redeemed
+	SetSession(ctx context.Context, id uint, sessionToken string) error
+}
+
+// gormOAuthCodeRepository is the OAuthCodeRepository backed by the database
+type gormOAuthCodeRepository struct {
+	db *gorm.DB
+}
+
+// NewOAuthCodeRepository returns an OAuthCodeRepository backed by db
+func NewOAuthCodeRepository(db *gorm.DB) OAuthCodeRepository {
+	return &gormOAuthCodeRepository{db: db}
+}
+
+func (r *gormOAuthCodeRepository) Create(ctx context.Context, code *models.OAuthAuthorizationCode) error {
+	return translate(r.db.WithContext(ctx).Create(code).Error)
+}
+
+func (r *gormOAuthCodeRepository) Find(ctx context.Context, codeHash, clientID string) (*models.OAuthAuthorizationCode, error) {
+	var code models.OAuthAuthorizationCode
+	if err := r.db.WithContext(ctx).Where("code_hash = ? AND client_id = ?", codeHash, clientID).First(&code).Error; err != nil {
+		return nil, translate(err)
+	}
+	return &code, nil
+}
+
+func (r *gormOAuthCodeRepository) MarkUsed(ctx context.Context, id uint) (bool, error) {
+	result := r.db.WithContext(ctx).Model(&models.OAuthAuthorizationCode{}).
+		Where("id = ? AND used_at IS NULL", id).
+		Update("used_at", time.Now())
+	return result.RowsAffected > 0, result.Error
+}
+
+func (r *gormOAuthCodeRepository) SetSession(ctx context.Context, id uint, sessionToken string) error {
+	return r.db.WithContext(ctx).Model(&models.OAuthAuthorizationCode{}).Where("id = ?", id).Update("session_token", sessionToken).Error
+}
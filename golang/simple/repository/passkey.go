@@ -0,0 +1,111 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+	"crud-example/models"
+)
+
+// PasskeyRepository stores passkeys and the challenges of WebAuthn ceremonies in progress
+type PasskeyRepository interface {
+	// ListByUser returns the passkeys of a user, newest first
+	ListByUser(ctx context.Context, userID uint) ([]models.Passkey, error)
+	// Create inserts a new passkey
+	Create(ctx context.Context, passkey *models.Passkey) error
+	// FindByCredentialHash returns the passkey whose credential ID has the given hash
+	FindByCredentialHash(ctx context.Context, credentialHash string) (*models.Passkey, error)
+	// FindByUser returns the passkey with the given ID if it belongs to the user
+	FindByUser(ctx context.Context, id, userID uint) (*models.Passkey, error)
+	// Rename changes the label of a passkey
+	Rename(ctx context.Context, id uint, name string) error
+	// RecordUse records the signature counter of a successful assertion
+	RecordUse(ctx context.Context, id uint, signCount uint32, at time.Time) error
+	// Delete removes a passkey
+	Delete(ctx context.Context, id uint) error
+
+	// CreateChallenge stores the challenge of a ceremony that was started
+	CreateChallenge(ctx context.Context, challenge *models.WebAuthnChallenge) error
+	// ConsumeChallenge deletes the unexpired challenge with the given hash for the purpose and
+	// returns it; a challenge can only be consumed once
+	ConsumeChallenge(ctx context.Context, challengeHash, purpose string) (*models.WebAuthnChallenge, error)
+	// DeleteExpiredChallenges drops the challenges that expired before the given time
+	DeleteExpiredChallenges(ctx context.Context, before time.Time) error
+}
+
+// gormPasskeyRepository is the PasskeyRepository backed by the database
+type gormPasskeyRepository struct {
+	db *gorm.DB
+}
+
+// NewPasskeyRepository returns a PasskeyRepository backed by db
+func NewPasskeyRepository(db *gorm.DB) PasskeyRepository {
+	return &gormPasskeyRepository{db: db}
+}
+
+func (r *gormPasskeyRepository) ListByUser(ctx context.Context, userID uint) ([]models.Passkey, error) {
+	var passkeys []models.Passkey
+	err := r.db.WithContext(ctx).Where("user_id = ?", userID).Order("created_at DESC, id DESC").Find(&passkeys).Error
+	return passkeys, err
+}
+
+func (r *gormPasskeyRepository) Create(ctx context.Context, passkey *models.Passkey) error {
+	return translate(r.db.WithContext(ctx).Create(passkey).Error)
+}
+
+func (r *gormPasskeyRepository) FindByCredentialHash(ctx context.Context, credentialHash string) (*models.Passkey, error) {
+	var passkey models.Passkey
+	if err := r.db.WithContext(ctx).Where("credential_hash = ?", credentialHash).First(&passkey).Error; err != nil {
+		return nil, translate(err)
+	}
+	return &passkey, nil
+}
+
+func (r *gormPasskeyRepository) FindByUser(ctx context.Context, id, userID uint) (*models.Passkey, error) {
+	var passkey models.Passkey
+	if err := r.db.WithContext(ctx).Where("id = ? AND user_id = ?", id, userID).First(&passkey).Error; err != nil {
+		return nil, translate(err)
+	}
+	return &passkey, nil
+}
+
+func (r *gormPasskeyRepository) Rename(ctx context.Context, id uint, name string) error {
+	return r.db.WithContext(ctx).Model(&models.Passkey{}).Where("id = ?", id).Update("name", name).Error
+}
+
+func (r *gormPasskeyRepository) RecordUse(ctx context.Context, id uint, signCount uint32, at time.Time) error {
+	return r.db.WithContext(ctx).Model(&models.Passkey{}).Where("id = ?", id).
+		Updates(map[string]interface{}{"sign_count": signCount, "last_used_at": at}).Error
+}
+
+func (r *gormPasskeyRepository) Delete(ctx context.Context, id uint) error {
+	return r.db.WithContext(ctx).Delete(&models.Passkey{}, id).Error
+}
+
+func (r *gormPasskeyRepository) CreateChallenge(ctx context.Context, challenge *models.WebAuthnChallenge) error {
+	return translate(r.db.WithContext(ctx).Create(challenge).Error)
+}
+
+func (r *gormPasskeyRepository) ConsumeChallenge(ctx context.Context, challengeHash, purpose string) (*models.WebAuthnChallenge, error) {
+	var challenge models.WebAuthnChallenge
+	err := r.db.WithContext(ctx).Where("challenge_hash = ? AND purpose = ? AND expires_at > ?", challengeHash, purpose, time.Now()).
+		First(&challenge).Error
+	if err != nil {
+		return nil, translate(err)
+	}
+
+	// Of concurrent responses, only the one that deletes the challenge gets it
+	result := r.db.WithContext(ctx).Delete(&models.WebAuthnChallenge{}, challenge.ID)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, ErrNotFound
+	}
+	return &challenge, nil
+}
+
+func (r *gormPasskeyRepository) DeleteExpiredChallenges(ctx context.Context, before time.Time) error {
+	return r.db.WithContext(ctx).Where("expires_at < ?", before).Delete(&models.WebAuthnChallenge{}).Error
+}
@@ -0,0 +1,69 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+	"crud-example/models"
+)
+
+// PasswordResetTokenRepository stores the tokens sent in password reset links
+type PasswordResetTokenRepository interface {
+	// Create inserts a new reset token
+	Create(ctx context.Context, token *models.PasswordResetToken) error
+	// ExpirePending expires the unused tokens of a user that are still valid, keeping them
+	// so that they count towards CountSince
+	ExpirePending(ctx context.Context, userID uint) error
+	// FindUnused returns the token with the given hash if it was neither used nor has expired
+	FindUnused(ctx context.Context, tokenHash string) (*models.PasswordResetToken, error)
+	// MarkUsed consumes a token and reports whether it was still unused
+	MarkUsed(ctx context.Context, id uint) (bool, error)
+	// CountSince counts the tokens created for a user after since
+	CountSince(ctx context.Context, userID uint, since time.Time) (int64, error)
+}
+
+// gormPasswordResetTokenRepository is the PasswordResetTokenRepository backed by the database
+type gormPasswordResetTokenRepository struct {
+	db *gorm.DB
+}
+
+// NewPasswordResetTokenRepository returns a PasswordResetTokenRepository backed by db
+func NewPasswordResetTokenRepository(db *gorm.DB) PasswordResetTokenRepository {
+	return &gormPasswordResetTokenRepository{db: db}
+}
+
+func (r *gormPasswordResetTokenRepository) Create(ctx context.Context, token *models.PasswordResetToken) error {
+	return translate(r.db.WithContext(ctx).Create(token).Error)
+}
+
+func (r *gormPasswordResetTokenRepository) ExpirePending(ctx context.Context, userID uint) error {
+	now := time.Now()
+	return r.db.WithContext(ctx).Model(&models.PasswordResetToken{}).
+		Where("user_id = ? AND used_at IS NULL AND expires_at > ?", userID, now).
+		Update("expires_at", now).Error
+}
+
+func (r *gormPasswordResetTokenRepository) FindUnused(ctx context.Context, tokenHash string) (*models.PasswordResetToken, error) {
+	var token models.PasswordResetToken
+	err := r.db.WithContext(ctx).Where("token_hash = ? AND used_at IS NULL AND expires_at > ?", tokenHash, time.Now()).First(&token).Error
+	if err != nil {
+		return nil, translate(err)
+	}
+	return &token, nil
+}
+
+func (r *gormPasswordResetTokenRepository) MarkUsed(ctx context.Context, id uint) (bool, error) {
+	result := r.db.WithContext(ctx).Model(&models.PasswordResetToken{}).
+		Where("id = ? AND used_at IS NULL", id).
+		Update("used_at", time.Now())
+	return result.RowsAffected > 0, result.Error
+}
+
+func (r *gormPasswordResetTokenRepository) CountSince(ctx context.Context, userID uint, since time.Time) (int64, error) {
+	var count int64
+	err := r.db.WithContext(ctx).Model(&models.PasswordResetToken{}).
+		Where("user_id = ? AND created_at > ?", userID, since).
+		Count(&count).Error
+	return count, err
+}
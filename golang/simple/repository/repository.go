@@ -0,0 +1,33 @@
+// Package repository provides data access for the handlers. Every repository has a GORM
+// implementation used by the application and an in-memory implementation used in tests.
+package repository
+
+import (
+	"context"
+	"errors"
+
+	"gorm.io/gorm"
+)
+
+// ErrNotFound is returned when no record matches the lookup
+var ErrNotFound = errors.New("record not found")
+
+// ErrDuplicate is returned when a unique field is already taken
+var ErrDuplicate = errors.New("duplicate record")
+
+// ReadRouter chooses the database for reads that tolerate replication lag, see
+// config.Replicas
+type ReadRouter interface {
+	Reader(ctx context.Context) *gorm.DB
+}
+
+// translate maps GORM errors to the repository errors
+func translate(err error) error {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return ErrNotFound
+	case errors.Is(err, gorm.ErrDuplicatedKey):
+		return ErrDuplicate
+	}
+	return err
+}
@@ -0,0 +1,316 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"crud-example/models"
+)
+
+// testUserRepository checks the behaviour every UserRepository implementation shares
+func testUserRepository(t *testing.T, users UserRepository) {
+	ctx := context.Background()
+
+	alice := models.User{Name: "Alice", Email: "alice@example.com", Password: "hash", IsActive: true}
+	bob := models.User{Name: "Bob", Email: "bob@example.com", IsActive: true}
+	carol := models.User{Name: "Carol", Email: "carol@example.com", IsActive: true}
+	for _, user := range []*models.User{&alice, &bob, &carol} {
+		require.NoError(t, users.Create(ctx, user))
+	}
+	assert.NotZero(t, alice.ID)
+	assert.NotEqual(t, alice.ID, bob.ID)
+
+	bob.IsActive = false
+	require.NoError(t, users.Save(ctx, &bob))
+
+	// Email addresses are unique
+	assert.ErrorIs(t, users.Create(ctx, &models.User{Name: "Other", Email: "alice@example.com"}), ErrDuplicate)
+	taken, err := users.EmailTaken(ctx, "alice@example.com", bob.ID)
+	require.NoError(t, err)
+	assert.True(t, taken)
+	taken, err = users.EmailTaken(ctx, "alice@example.com", alice.ID)
+	require.NoError(t, err)
+	assert.False(t, taken)
+
+	// Inactive users are only found by ID
+	_, err = users.FindActiveByID(ctx, bob.ID)
+	assert.ErrorIs(t, err, ErrNotFound)
+	found, err := users.FindByID(ctx, bob.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "Bob", found.Name)
+
+	page, total, err := users.ListActive(ctx, 1, 10)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), total)
+	require.Len(t, page, 1)
+	assert.Equal(t, carol.ID, page[0].ID)
+
+	// Returned users are copies
+	found, err = users.FindByEmail(ctx, "carol@example.com")
+	require.NoError(t, err)
+	found.Name = "Changed"
+	found, _ = users.FindByID(ctx, carol.ID)
+	assert.Equal(t, "Carol", found.Name)
+
+	// Passwords are only replaced if unchanged
+	replaced, err := users.ReplacePassword(ctx, alice.ID, "other", "new")
+	require.NoError(t, err)
+	assert.False(t, replaced)
+	replaced, err = users.ReplacePassword(ctx, alice.ID, "hash", "new")
+	require.NoError(t, err)
+	assert.True(t, replaced)
+
+	// Changed passwords move to the history, which only keeps the latest entries
+	for _, change := range [][2]string{{"new", "second"}, {"second", "third"}, {"third", "fourth"}} {
+		require.NoError(t, users.ChangePassword(ctx, alice.ID, change[0], change[1], time.Now(), 2))
+	}
+	history, err := users.PasswordHistory(ctx, alice.ID, 10)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"third", "second"}, history)
+	history, err = users.PasswordHistory(ctx, alice.ID, 1)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"third"}, history)
+	found, err = users.FindByEmailFold(ctx, "ALICE@example.com")
+	require.NoError(t, err)
+	assert.Equal(t, "fourth", found.Password)
+	assert.NotNil(t, found.PasswordChangedAt)
+
+	// Accounts are deactivated once their deletion is due
+	past, future := time.Now().Add(-time.Minute), time.Now().Add(time.Hour)
+	require.NoError(t, users.ScheduleDeletion(ctx, alice.ID, &future))
+	require.NoError(t, users.ScheduleDeletion(ctx, carol.ID, &past))
+	due, err := users.ListDueForDeletion(ctx, time.Now())
+	require.NoError(t, err)
+	require.Len(t, due, 1)
+	assert.Equal(t, carol.ID, due[0].ID)
+	require.NoError(t, users.Deactivate(ctx, carol.ID))
+	found, err = users.FindByID(ctx, carol.ID)
+	require.NoError(t, err)
+	assert.False(t, found.IsActive)
+	assert.Nil(t, found.DeletionDueAt)
+}
+
+// testSessionRepository checks the behaviour every SessionRepository implementation shares.
+// active returns whether each session of a user, by token, is active.
+func testSessionRepository(t *testing.T, sessions SessionRepository, active func(userID uint) map[string]bool) {
+	ctx := context.Background()
+
+	// Refresh tokens are unique, so every session gets its own
+	for _, token := range []string{"a", "b", "c"} {
+		session := &models.UserSession{UserID: 1, SessionToken: token, RefreshToken: "refresh-" + token, IsActive: true}
+		require.NoError(t, sessions.Create(ctx, session))
+	}
+	require.NoError(t, sessions.Create(ctx, &models.UserSession{UserID: 2, SessionToken: "d", RefreshToken: "refresh-d", IsActive: true}))
+
+	require.NoError(t, sessions.RevokeUser(ctx, 1, "b"))
+
+	assert.Equal(t, map[string]bool{"a": false, "b": true, "c": false}, active(1))
+	assert.Equal(t, map[string]bool{"d": true}, active(2))
+
+	// Refresh tokens are only rotated from the current one
+	current, err := sessions.FindByToken(ctx, "b")
+	require.NoError(t, err)
+	rotated, err := sessions.Rotate(ctx, current.ID, "refresh-b", "refresh-b2", time.Now().Add(time.Hour), "127.0.0.1", "test")
+	require.NoError(t, err)
+	assert.True(t, rotated)
+	rotated, err = sessions.Rotate(ctx, current.ID, "refresh-b", "refresh-b3", time.Now().Add(time.Hour), "127.0.0.1", "test")
+	require.NoError(t, err)
+	assert.False(t, rotated)
+	current, err = sessions.FindActiveByUser(ctx, current.ID, 1)
+	require.NoError(t, err)
+	assert.Equal(t, "refresh-b2", current.RefreshToken)
+	_, err = sessions.FindActiveByUser(ctx, current.ID, 2)
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	// Only unexpired active sessions are listed, and last use never moves backwards
+	seen := time.Now().Truncate(time.Second)
+	require.NoError(t, sessions.TouchLastSeen(ctx, "b", seen))
+	require.NoError(t, sessions.TouchLastSeen(ctx, "b", seen.Add(-time.Minute)))
+	listed, err := sessions.ListActive(ctx, 1)
+	require.NoError(t, err)
+	require.Len(t, listed, 1)
+	assert.Equal(t, "b", listed[0].SessionToken)
+	require.NotNil(t, listed[0].LastSeenAt)
+	assert.True(t, seen.Equal(*listed[0].LastSeenAt))
+}
+
+// testVerificationTokenRepository checks the behaviour every VerificationTokenRepository
+// implementation shares
+func testVerificationTokenRepository(t *testing.T, tokens VerificationTokenRepository) {
+	ctx := context.Background()
+	start := time.Now().Add(-time.Second)
+
+	valid := &models.EmailVerificationToken{UserID: 1, Email: "a@example.com", TokenHash: "valid", ExpiresAt: time.Now().Add(time.Hour)}
+	require.NoError(t, tokens.Create(ctx, valid))
+	require.NoError(t, tokens.Create(ctx, &models.EmailVerificationToken{UserID: 1, Email: "a@example.com", TokenHash: "expired", ExpiresAt: time.Now().Add(-time.Minute)}))
+	require.NoError(t, tokens.Create(ctx, &models.EmailVerificationToken{UserID: 2, Email: "b@example.com", TokenHash: "other", ExpiresAt: time.Now().Add(time.Hour)}))
+
+	found, err := tokens.FindUnused(ctx, "valid")
+	require.NoError(t, err)
+	assert.Equal(t, valid.ID, found.ID)
+	assert.Equal(t, "a@example.com", found.Email)
+
+	_, err = tokens.FindUnused(ctx, "expired")
+	assert.ErrorIs(t, err, ErrNotFound)
+	_, err = tokens.FindUnused(ctx, "unknown")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	// A token is consumed once
+	used, err := tokens.MarkUsed(ctx, valid.ID)
+	require.NoError(t, err)
+	assert.True(t, used)
+	used, err = tokens.MarkUsed(ctx, valid.ID)
+	require.NoError(t, err)
+	assert.False(t, used)
+	_, err = tokens.FindUnused(ctx, "valid")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	count, err := tokens.CountSince(ctx, 1, start)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), count)
+	count, err = tokens.CountSince(ctx, 1, time.Now().Add(time.Minute))
+	require.NoError(t, err)
+	assert.Zero(t, count)
+}
+
+// testMFARepository checks the behaviour every MFARepository implementation shares. users
+// must hold the users the MFA flag is kept for.
+func testMFARepository(t *testing.T, mfa MFARepository, users UserRepository) {
+	ctx := context.Background()
+	user := models.User{Name: "Alice", Email: "alice@example.com", IsActive: true}
+	require.NoError(t, users.Create(ctx, &user))
+
+	require.NoError(t, mfa.SaveSecret(ctx, &models.UserMFA{UserID: user.ID, Secret: "first"}))
+	require.NoError(t, mfa.SaveSecret(ctx, &models.UserMFA{UserID: user.ID, Secret: "second"}))
+	pending, err := mfa.FindPending(ctx, user.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "second", pending.Secret)
+	_, err = mfa.FindEnabled(ctx, user.ID)
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	require.NoError(t, mfa.Enable(ctx, user.ID, 10, []string{"code-1", "code-2"}))
+	enabled, err := mfa.FindEnabled(ctx, user.ID)
+	require.NoError(t, err)
+	assert.Equal(t, int64(10), enabled.LastUsedStep)
+	found, err := users.FindByID(ctx, user.ID)
+	require.NoError(t, err)
+	assert.True(t, found.MFAEnabled)
+
+	// Time steps and recovery codes can only be used once
+	used, err := mfa.UseStep(ctx, user.ID, 10)
+	require.NoError(t, err)
+	assert.False(t, used)
+	used, err = mfa.UseStep(ctx, user.ID, 11)
+	require.NoError(t, err)
+	assert.True(t, used)
+	used, err = mfa.UseRecoveryCode(ctx, user.ID, "code-1")
+	require.NoError(t, err)
+	assert.True(t, used)
+	used, err = mfa.UseRecoveryCode(ctx, user.ID, "code-1")
+	require.NoError(t, err)
+	assert.False(t, used)
+
+	require.NoError(t, mfa.Remove(ctx, user.ID))
+	_, err = mfa.FindEnabled(ctx, user.ID)
+	assert.ErrorIs(t, err, ErrNotFound)
+	used, err = mfa.UseRecoveryCode(ctx, user.ID, "code-2")
+	require.NoError(t, err)
+	assert.False(t, used)
+	found, err = users.FindByID(ctx, user.ID)
+	require.NoError(t, err)
+	assert.False(t, found.MFAEnabled)
+}
+
+// testPasskeyRepository checks the behaviour every PasskeyRepository implementation shares
+func testPasskeyRepository(t *testing.T, passkeys PasskeyRepository) {
+	ctx := context.Background()
+
+	passkey := models.Passkey{UserID: 1, Name: "Laptop", CredentialID: "credential", CredentialHash: "credential-hash", PublicKey: []byte("key")}
+	require.NoError(t, passkeys.Create(ctx, &passkey))
+	assert.ErrorIs(t, passkeys.Create(ctx, &models.Passkey{UserID: 2, Name: "Copy", CredentialID: "credential", CredentialHash: "credential-hash", PublicKey: []byte("key")}), ErrDuplicate)
+
+	_, err := passkeys.FindByUser(ctx, passkey.ID, 2)
+	assert.ErrorIs(t, err, ErrNotFound)
+	require.NoError(t, passkeys.RecordUse(ctx, passkey.ID, 7, time.Now()))
+	found, err := passkeys.FindByCredentialHash(ctx, "credential-hash")
+	require.NoError(t, err)
+	assert.Equal(t, uint32(7), found.SignCount)
+	assert.NotNil(t, found.LastUsedAt)
+
+	// Challenges are consumed once, for the ceremony they were issued for
+	require.NoError(t, passkeys.CreateChallenge(ctx, &models.WebAuthnChallenge{ChallengeHash: "valid", Purpose: "login", ExpiresAt: time.Now().Add(time.Minute)}))
+	require.NoError(t, passkeys.CreateChallenge(ctx, &models.WebAuthnChallenge{ChallengeHash: "expired", Purpose: "login", ExpiresAt: time.Now().Add(-time.Minute)}))
+	_, err = passkeys.ConsumeChallenge(ctx, "valid", "register")
+	assert.ErrorIs(t, err, ErrNotFound)
+	_, err = passkeys.ConsumeChallenge(ctx, "expired", "login")
+	assert.ErrorIs(t, err, ErrNotFound)
+	challenge, err := passkeys.ConsumeChallenge(ctx, "valid", "login")
+	require.NoError(t, err)
+	assert.Equal(t, "login", challenge.Purpose)
+	_, err = passkeys.ConsumeChallenge(ctx, "valid", "login")
+	assert.ErrorIs(t, err, ErrNotFound)
+	require.NoError(t, passkeys.DeleteExpiredChallenges(ctx, time.Now()))
+
+	require.NoError(t, passkeys.Delete(ctx, passkey.ID))
+	listed, err := passkeys.ListByUser(ctx, 1)
+	require.NoError(t, err)
+	assert.Empty(t, listed)
+}
+
+// testFederationRepository checks the behaviour every FederationRepository implementation
+// shares. users must be the store the federation repository creates users in.
+func testFederationRepository(t *testing.T, federation FederationRepository, users UserRepository) {
+	ctx := context.Background()
+
+	// Authorization requests are consumed once, by the provider they were sent to
+	require.NoError(t, federation.CreateState(ctx, &models.FederationState{StateHash: "state", Provider: "google", Nonce: "nonce", CodeVerifier: "verifier", ExpiresAt: time.Now().Add(time.Minute)}))
+	_, err := federation.ConsumeState(ctx, "state", "github")
+	assert.ErrorIs(t, err, ErrNotFound)
+	state, err := federation.ConsumeState(ctx, "state", "google")
+	require.NoError(t, err)
+	assert.Equal(t, "nonce", state.Nonce)
+	_, err = federation.ConsumeState(ctx, "state", "google")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	existing := models.User{Name: "Alice", Email: "alice@example.com", IsActive: true}
+	require.NoError(t, users.Create(ctx, &existing))
+	accept := func(*models.User) error { return nil }
+	create := func() (*models.User, error) {
+		return &models.User{Name: "Bob", Email: "bob@example.com", IsActive: true}, nil
+	}
+
+	// Identities link to the user with the same email ignoring case, or to a new user
+	linked, err := federation.LinkByEmail(ctx, "ALICE@example.com", &models.FederatedIdentity{Provider: "google", Subject: "1"}, accept, create)
+	require.NoError(t, err)
+	assert.Equal(t, existing.ID, linked.ID)
+	created, err := federation.LinkByEmail(ctx, "bob@example.com", &models.FederatedIdentity{Provider: "google", Subject: "2"}, accept, create)
+	require.NoError(t, err)
+	assert.NotEqual(t, existing.ID, created.ID)
+	_, err = users.FindByEmail(ctx, "bob@example.com")
+	require.NoError(t, err)
+
+	// A refused link leaves nothing behind
+	refused := errors.New("refused")
+	_, err = federation.LinkByEmail(ctx, "alice@example.com", &models.FederatedIdentity{Provider: "github", Subject: "1"}, func(*models.User) error { return refused }, create)
+	assert.ErrorIs(t, err, refused)
+	_, err = federation.FindIdentity(ctx, "github", "1")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	identity, err := federation.FindIdentity(ctx, "google", "1")
+	require.NoError(t, err)
+	assert.Equal(t, existing.ID, identity.UserID)
+	identities, err := federation.ListIdentities(ctx, existing.ID)
+	require.NoError(t, err)
+	assert.Len(t, identities, 1)
+
+	deleted, err := federation.DeleteIdentity(ctx, existing.ID, "google")
+	require.NoError(t, err)
+	assert.True(t, deleted)
+	deleted, err = federation.DeleteIdentity(ctx, existing.ID, "google")
+	require.NoError(t, err)
+	assert.False(t, deleted)
+}
@@ -0,0 +1,66 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"crud-example/models"
+)
+
+// RevocationRepository stores revoked access tokens and the per-user revocations of every
+// token issued before a time
+type RevocationRepository interface {
+	// RevokeToken records a revoked token; revoking it again is not an error
+	RevokeToken(ctx context.Context, token *models.RevokedToken) error
+	// FindToken returns the revocation of the token with the given jti
+	FindToken(ctx context.Context, jti string) (*models.RevokedToken, error)
+	// DeleteExpiredTokens drops the revocations of tokens that expired before the given time
+	DeleteExpiredTokens(ctx context.Context, before time.Time) error
+	// RevokeUser creates or replaces the revocation of a user's tokens
+	RevokeUser(ctx context.Context, revocation *models.UserTokenRevocation) error
+	// FindUser returns the revocation of a user's tokens
+	FindUser(ctx context.Context, userID uint) (*models.UserTokenRevocation, error)
+}
+
+// gormRevocationRepository is the RevocationRepository backed by the database
+type gormRevocationRepository struct {
+	db *gorm.DB
+}
+
+// NewRevocationRepository returns a RevocationRepository backed by db
+func NewRevocationRepository(db *gorm.DB) RevocationRepository {
+	return &gormRevocationRepository{db: db}
+}
+
+func (r *gormRevocationRepository) RevokeToken(ctx context.Context, token *models.RevokedToken) error {
+	return r.db.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(token).Error
+}
+
+func (r *gormRevocationRepository) FindToken(ctx context.Context, jti string) (*models.RevokedToken, error) {
+	var token models.RevokedToken
+	if err := r.db.WithContext(ctx).Where("jti = ?", jti).First(&token).Error; err != nil {
+		return nil, translate(err)
+	}
+	return &token, nil
+}
+
+func (r *gormRevocationRepository) DeleteExpiredTokens(ctx context.Context, before time.Time) error {
+	return r.db.WithContext(ctx).Where("expires_at < ?", before).Delete(&models.RevokedToken{}).Error
+}
+
+func (r *gormRevocationRepository) RevokeUser(ctx context.Context, revocation *models.UserTokenRevocation) error {
+	return r.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"revoked_before", "updated_at"}),
+	}).Create(revocation).Error
+}
+
+func (r *gormRevocationRepository) FindUser(ctx context.Context, userID uint) (*models.UserTokenRevocation, error) {
+	var revocation models.UserTokenRevocation
+	if err := r.db.WithContext(ctx).Where("user_id = ?", userID).First(&revocation).Error; err != nil {
+		return nil, translate(err)
+	}
+	return &revocation, nil
+}
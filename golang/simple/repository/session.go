@@ -0,0 +1,112 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+	"crud-example/models"
+)
+
+// SessionRepository stores sessions, the refresh token families issued at login
+type SessionRepository interface {
+	// Create inserts a new session
+	Create(ctx context.Context, session *models.UserSession) error
+	// Revoke deactivates a session
+	Revoke(ctx context.Context, id uint) error
+	// RevokeUser deactivates every active session of a user except the one whose session
+	// token is keep; an empty keep revokes them all
+	RevokeUser(ctx context.Context, userID uint, keep string) error
+	// RevokeClient deactivates every active session started by an OAuth client
+	RevokeClient(ctx context.Context, clientID string) error
+	// FindByToken returns the session identified by a session token, active or not
+	FindByToken(ctx context.Context, sessionToken string) (*models.UserSession, error)
+	// FindActiveByUser returns the session with the given ID if it belongs to the user and
+	// has not been revoked
+	FindActiveByUser(ctx context.Context, id, userID uint) (*models.UserSession, error)
+	// ListActive returns the sessions of a user that are neither revoked nor expired, most
+	// recently used first
+	ListActive(ctx context.Context, userID uint) ([]models.UserSession, error)
+	// Rotate replaces the refresh token hash of an active session only if it is still
+	// oldHash, extending the session, and reports whether it did
+	Rotate(ctx context.Context, id uint, oldHash, newHash string, expiresAt time.Time, ipAddress, userAgent string) (bool, error)
+	// TouchLastSeen records when a session was last used, unless a later time was already
+	// recorded
+	TouchLastSeen(ctx context.Context, sessionToken string, seen time.Time) error
+}
+
+// gormSessionRepository is the SessionRepository backed by the database
+type gormSessionRepository struct {
+	db *gorm.DB
+}
+
+// NewSessionRepository returns a SessionRepository backed by db
+func NewSessionRepository(db *gorm.DB) SessionRepository {
+	return &gormSessionRepository{db: db}
+}
+
+func (r *gormSessionRepository) Create(ctx context.Context, session *models.UserSession) error {
+	return translate(r.db.WithContext(ctx).Create(session).Error)
+}
+
+func (r *gormSessionRepository) Revoke(ctx context.Context, id uint) error {
+	return r.db.WithContext(ctx).Model(&models.UserSession{}).
+		Where("id = ?", id).
+		Updates(map[string]interface{}{"is_active": false, "revoked_at": time.Now()}).Error
+}
+
+func (r *gormSessionRepository) RevokeUser(ctx context.Context, userID uint, keep string) error {
+	query := r.db.WithContext(ctx).Model(&models.UserSession{}).Where("user_id = ? AND is_active = ?", userID, true)
+	if keep != "" {
+		query = query.Where("session_token <> ?", keep)
+	}
+	return query.Updates(map[string]interface{}{"is_active": false, "revoked_at": time.Now()}).Error
+}
+
+func (r *gormSessionRepository) RevokeClient(ctx context.Context, clientID string) error {
+	return r.db.WithContext(ctx).Model(&models.UserSession{}).
+		Where("client_id = ? AND is_active = ?", clientID, true).
+		Updates(map[string]interface{}{"is_active": false, "revoked_at": time.Now()}).Error
+}
+
+func (r *gormSessionRepository) FindByToken(ctx context.Context, sessionToken string) (*models.UserSession, error) {
+	var session models.UserSession
+	if err := r.db.WithContext(ctx).Where("session_token = ?", sessionToken).First(&session).Error; err != nil {
+		return nil, translate(err)
+	}
+	return &session, nil
+}
+
+func (r *gormSessionRepository) FindActiveByUser(ctx context.Context, id, userID uint) (*models.UserSession, error) {
+	var session models.UserSession
+	if err := r.db.WithContext(ctx).Where("id = ? AND user_id = ? AND is_active = ?", id, userID, true).First(&session).Error; err != nil {
+		return nil, translate(err)
+	}
+	return &session, nil
+}
+
+func (r *gormSessionRepository) ListActive(ctx context.Context, userID uint) ([]models.UserSession, error) {
+	var sessions []models.UserSession
+	err := r.db.WithContext(ctx).Where("user_id = ? AND is_active = ? AND expires_at > ?", userID, true, time.Now()).
+		Order("last_seen_at DESC, created_at DESC").
+		Find(&sessions).Error
+	return sessions, err
+}
+
+func (r *gormSessionRepository) Rotate(ctx context.Context, id uint, oldHash, newHash string, expiresAt time.Time, ipAddress, userAgent string) (bool, error) {
+	result := r.db.WithContext(ctx).Model(&models.UserSession{}).
+		Where("id = ? AND refresh_token = ? AND is_active = ?", id, oldHash, true).
+		Updates(map[string]interface{}{
+			"refresh_token": newHash,
+			"expires_at":    expiresAt,
+			"ip_address":    ipAddress,
+			"user_agent":    userAgent,
+		})
+	return result.RowsAffected > 0, result.Error
+}
+
+func (r *gormSessionRepository) TouchLastSeen(ctx context.Context, sessionToken string, seen time.Time) error {
+	return r.db.WithContext(ctx).Model(&models.UserSession{}).
+		Where("session_token = ? AND (last_seen_at IS NULL OR last_seen_at < ?)", sessionToken, seen).
+		Update("last_seen_at", seen).Error
+}
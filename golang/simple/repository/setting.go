@@ -0,0 +1,42 @@
+package repository
+
+import (
+	"context"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"crud-example/models"
+)
+
+// SettingRepository stores the runtime settings of system_config
+type SettingRepository interface {
+	// Find returns the setting with the given key
+	Find(ctx context.Context, key string) (*models.SystemConfig, error)
+	// Save creates a setting or updates the value of an existing one
+	Save(ctx context.Context, setting *models.SystemConfig) error
+}
+
+// gormSettingRepository is the SettingRepository backed by the database
+type gormSettingRepository struct {
+	db *gorm.DB
+}
+
+// NewSettingRepository returns a SettingRepository backed by db
+func NewSettingRepository(db *gorm.DB) SettingRepository {
+	return &gormSettingRepository{db: db}
+}
+
+func (r *gormSettingRepository) Find(ctx context.Context, key string) (*models.SystemConfig, error) {
+	var setting models.SystemConfig
+	if err := r.db.WithContext(ctx).Where("config_key = ?", key).First(&setting).Error; err != nil {
+		return nil, translate(err)
+	}
+	return &setting, nil
+}
+
+func (r *gormSettingRepository) Save(ctx context.Context, setting *models.SystemConfig) error {
+	return r.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "config_key"}},
+		DoUpdates: clause.AssignmentColumns([]string{"config_value", "updated_at"}),
+	}).Create(setting).Error
+}
@@ -0,0 +1,44 @@
+package repository
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"crud-example/dbtest"
+	"crud-example/models"
+)
+
+func TestSQLiteUserRepository(t *testing.T) {
+	testUserRepository(t, NewUserRepository(dbtest.Open(t), nil))
+}
+
+func TestSQLiteSessionRepository(t *testing.T) {
+	db := dbtest.Open(t)
+	testSessionRepository(t, NewSessionRepository(db), func(userID uint) map[string]bool {
+		var sessions []models.UserSession
+		require.NoError(t, db.Where("user_id = ?", userID).Find(&sessions).Error)
+		active := map[string]bool{}
+		for _, session := range sessions {
+			active[session.SessionToken] = session.IsActive
+		}
+		return active
+	})
+}
+
+func TestSQLiteVerificationTokenRepository(t *testing.T) {
+	testVerificationTokenRepository(t, NewVerificationTokenRepository(dbtest.Open(t)))
+}
+
+func TestSQLiteMFARepository(t *testing.T) {
+	db := dbtest.Open(t)
+	testMFARepository(t, NewMFARepository(db), NewUserRepository(db, nil))
+}
+
+func TestSQLitePasskeyRepository(t *testing.T) {
+	testPasskeyRepository(t, NewPasskeyRepository(dbtest.Open(t)))
+}
+
+func TestSQLiteFederationRepository(t *testing.T) {
+	db := dbtest.Open(t)
+	testFederationRepository(t, NewFederationRepository(db), NewUserRepository(db, nil))
+}
@@ -0,0 +1,196 @@
+package repository
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"crud-example/models"
+)
+
+// UserRepository stores user accounts
+type UserRepository interface {
+	// FindByID returns the user with the given ID, active or not
+	FindByID(ctx context.Context, id uint) (*models.User, error)
+	// FindActiveByID returns the user with the given ID if the account is active
+	FindActiveByID(ctx context.Context, id uint) (*models.User, error)
+	// FindByEmail returns the user registered with the email address, active or not
+	FindByEmail(ctx context.Context, email string) (*models.User, error)
+	// FindByEmailFold is FindByEmail ignoring case
+	FindByEmailFold(ctx context.Context, email string) (*models.User, error)
+	// EmailTaken reports whether a user other than exceptID registered the email address
+	EmailTaken(ctx context.Context, email string, exceptID uint) (bool, error)
+	// ListActive returns a page of active users and the total number of active users
+	ListActive(ctx context.Context, offset, limit int) ([]models.User, int64, error)
+	// Create inserts a new user, setting its ID and timestamps
+	Create(ctx context.Context, user *models.User) error
+	// Save updates every field of an existing user
+	Save(ctx context.Context, user *models.User) error
+	// ReplacePassword sets a new password hash only if the stored one is still oldHash
+	// and reports whether it did
+	ReplacePassword(ctx context.Context, id uint, oldHash, newHash string) (bool, error)
+	// ChangePassword sets a new password hash changed at the given time, moving oldHash, if
+	// any, to the password history and keeping only the latest keepHistory entries there
+	ChangePassword(ctx context.Context, id uint, oldHash, newHash string, changedAt time.Time, keepHistory int) error
+	// PasswordHistory returns the latest limit previous password hashes of a user, newest first
+	PasswordHistory(ctx context.Context, userID uint, limit int) ([]string, error)
+	// ScheduleDeletion sets or, with a nil dueAt, clears the time the account is deleted
+	ScheduleDeletion(ctx context.Context, id uint, dueAt *time.Time) error
+	// ListDueForDeletion returns the active users whose deletion was due before the given time
+	ListDueForDeletion(ctx context.Context, before time.Time) ([]models.User, error)
+	// Deactivate deactivates a user, cancelling any scheduled deletion
+	Deactivate(ctx context.Context, id uint) error
+}
+
+// gormUserRepository is the UserRepository backed by the database. Lookups by ID and listings
+// run on the database chosen by reads; lookups by email, which guard registration and login,
+// and writes always use db.
+type gormUserRepository struct {
+	db    *gorm.DB
+	reads ReadRouter
+}
+
+// NewUserRepository returns a UserRepository backed by db, reading through reads when it is
+// not nil
+func NewUserRepository(db *gorm.DB, reads ReadRouter) UserRepository {
+	return &gormUserRepository{db: db, reads: reads}
+}
+
+// read runs query on the database chosen by reads. A query that fails or finds nothing on a
+// replica runs again on the primary, so a user created moments ago is found despite lag.
+func (r *gormUserRepository) read(ctx context.Context, query func(db *gorm.DB) error) error {
+	db := r.db
+	if r.reads != nil {
+		db = r.reads.Reader(ctx)
+	}
+	err := query(db.WithContext(ctx))
+	if err != nil && db != r.db && ctx.Err() == nil {
+		err = query(r.db.WithContext(ctx))
+	}
+	return err
+}
+
+func (r *gormUserRepository) FindByID(ctx context.Context, id uint) (*models.User, error) {
+	var user models.User
+	err := r.read(ctx, func(db *gorm.DB) error {
+		return db.First(&user, id).Error
+	})
+	if err != nil {
+		return nil, translate(err)
+	}
+	return &user, nil
+}
+
+func (r *gormUserRepository) FindActiveByID(ctx context.Context, id uint) (*models.User, error) {
+	var user models.User
+	err := r.read(ctx, func(db *gorm.DB) error {
+		return db.Where("id = ? AND is_active = ?", id, true).First(&user).Error
+	})
+	if err != nil {
+		return nil, translate(err)
+	}
+	return &user, nil
+}
+
+func (r *gormUserRepository) FindByEmail(ctx context.Context, email string) (*models.User, error) {
+	var user models.User
+	if err := r.db.WithContext(ctx).Where("email = ?", email).First(&user).Error; err != nil {
+		return nil, translate(err)
+	}
+	return &user, nil
+}
+
+func (r *gormUserRepository) FindByEmailFold(ctx context.Context, email string) (*models.User, error) {
+	var user models.User
+	if err := r.db.WithContext(ctx).Where("LOWER(email) = ?", strings.ToLower(email)).First(&user).Error; err != nil {
+		return nil, translate(err)
+	}
+	return &user, nil
+}
+
+func (r *gormUserRepository) EmailTaken(ctx context.Context, email string, exceptID uint) (bool, error) {
+	var count int64
+	err := r.db.WithContext(ctx).Model(&models.User{}).Where("email = ? AND id != ?", email, exceptID).Count(&count).Error
+	return count > 0, err
+}
+
+func (r *gormUserRepository) ListActive(ctx context.Context, offset, limit int) ([]models.User, int64, error) {
+	var total int64
+	var users []models.User
+	err := r.read(ctx, func(db *gorm.DB) error {
+		if err := db.Model(&models.User{}).Where("is_active = ?", true).Count(&total).Error; err != nil {
+			return err
+		}
+		return db.Where("is_active = ?", true).Order("id").Offset(offset).Limit(limit).Find(&users).Error
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	return users, total, nil
+}
+
+func (r *gormUserRepository) Create(ctx context.Context, user *models.User) error {
+	return translate(r.db.WithContext(ctx).Create(user).Error)
+}
+
+func (r *gormUserRepository) Save(ctx context.Context, user *models.User) error {
+	return translate(r.db.WithContext(ctx).Save(user).Error)
+}
+
+func (r *gormUserRepository) ReplacePassword(ctx context.Context, id uint, oldHash, newHash string) (bool, error) {
+	result := r.db.WithContext(ctx).Model(&models.User{}).
+		Where("id = ? AND password = ?", id, oldHash).
+		Update("password", newHash)
+	return result.RowsAffected > 0, result.Error
+}
+
+func (r *gormUserRepository) ChangePassword(ctx context.Context, id uint, oldHash, newHash string, changedAt time.Time, keepHistory int) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if oldHash != "" {
+			if err := tx.Create(&models.PasswordHistory{UserID: id, PasswordHash: oldHash}).Error; err != nil {
+				return err
+			}
+		}
+
+		err := tx.Model(&models.User{}).Where("id = ?", id).
+			Updates(map[string]interface{}{"password": newHash, "password_changed_at": changedAt}).Error
+		if err != nil {
+			return err
+		}
+
+		var stale []uint
+		err = tx.Model(&models.PasswordHistory{}).Where("user_id = ?", id).
+			Order("created_at DESC, id DESC").
+			Offset(keepHistory).
+			Pluck("id", &stale).Error
+		if err != nil || len(stale) == 0 {
+			return err
+		}
+		return tx.Delete(&models.PasswordHistory{}, stale).Error
+	})
+}
+
+func (r *gormUserRepository) PasswordHistory(ctx context.Context, userID uint, limit int) ([]string, error) {
+	var hashes []string
+	err := r.db.WithContext(ctx).Model(&models.PasswordHistory{}).Where("user_id = ?", userID).
+		Order("created_at DESC, id DESC").
+		Limit(limit).
+		Pluck("password_hash", &hashes).Error
+	return hashes, err
+}
+
+func (r *gormUserRepository) ScheduleDeletion(ctx context.Context, id uint, dueAt *time.Time) error {
+	return r.db.WithContext(ctx).Model(&models.User{}).Where("id = ?", id).Update("deletion_due_at", dueAt).Error
+}
+
+func (r *gormUserRepository) ListDueForDeletion(ctx context.Context, before time.Time) ([]models.User, error) {
+	var users []models.User
+	err := r.db.WithContext(ctx).Where("is_active = ? AND deletion_due_at <= ?", true, before).Find(&users).Error
+	return users, err
+}
+
+func (r *gormUserRepository) Deactivate(ctx context.Context, id uint) error {
+	return r.db.WithContext(ctx).Model(&models.User{}).Where("id = ?", id).
+		Updates(map[string]interface{}{"is_active": false, "deletion_due_at": nil}).Error
+}
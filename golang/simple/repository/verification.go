@@ -0,0 +1,59 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+	"crud-example/models"
+)
+
+// VerificationTokenRepository stores the tokens sent in email verification links
+type VerificationTokenRepository interface {
+	// Create inserts a new verification token
+	Create(ctx context.Context, token *models.EmailVerificationToken) error
+	// FindUnused returns the token with the given hash if it was neither used nor has expired
+	FindUnused(ctx context.Context, tokenHash string) (*models.EmailVerificationToken, error)
+	// MarkUsed consumes a token and reports whether it was still unused
+	MarkUsed(ctx context.Context, id uint) (bool, error)
+	// CountSince counts the tokens created for a user after since
+	CountSince(ctx context.Context, userID uint, since time.Time) (int64, error)
+}
+
+// gormVerificationTokenRepository is the VerificationTokenRepository backed by the database
+type gormVerificationTokenRepository struct {
+	db *gorm.DB
+}
+
+// NewVerificationTokenRepository returns a VerificationTokenRepository backed by db
+func NewVerificationTokenRepository(db *gorm.DB) VerificationTokenRepository {
+	return &gormVerificationTokenRepository{db: db}
+}
+
+func (r *gormVerificationTokenRepository) Create(ctx context.Context, token *models.EmailVerificationToken) error {
+	return translate(r.db.WithContext(ctx).Create(token).Error)
+}
+
+func (r *gormVerificationTokenRepository) FindUnused(ctx context.Context, tokenHash string) (*models.EmailVerificationToken, error) {
+	var token models.EmailVerificationToken
+	err := r.db.WithContext(ctx).Where("token_hash = ? AND used_at IS NULL AND expires_at > ?", tokenHash, time.Now()).First(&token).Error
+	if err != nil {
+		return nil, translate(err)
+	}
+	return &token, nil
+}
+
+func (r *gormVerificationTokenRepository) MarkUsed(ctx context.Context, id uint) (bool, error) {
+	result := r.db.WithContext(ctx).Model(&models.EmailVerificationToken{}).
+		Where("id = ? AND used_at IS NULL", id).
+		Update("used_at", time.Now())
+	return result.RowsAffected > 0, result.Error
+}
+
+func (r *gormVerificationTokenRepository) CountSince(ctx context.Context, userID uint, since time.Time) (int64, error) {
+	var count int64
+	err := r.db.WithContext(ctx).Model(&models.EmailVerificationToken{}).
+		Where("user_id = ? AND created_at > ?", userID, since).
+		Count(&count).Error
+	return count, err
+}
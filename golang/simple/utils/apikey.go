@@ -0,0 +1,44 @@
+package utils
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"strings"
+)
+
+// apiKeyPrefix marks personal API keys so they are easy to recognise in logs and secret scanners
+const apiKeyPrefix = "ck_"
+
+// ErrInvalidAPIKey is returned when an API key is malformed
+var ErrInvalidAPIKey = errors.New("invalid API key")
+
+// GenerateAPIKey creates a personal API key of the form "ck_<id>.<secret>".
+// The public id is used to look the key up; only the hash of the secret is persisted.
+func GenerateAPIKey() (key string, publicID string, secretHash string, err error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", "", err
+	}
+	publicID = hex.EncodeToString(b)
+
+	secret, err := GenerateRandomToken(32)
+	if err != nil {
+		return "", "", "", err
+	}
+
+	return apiKeyPrefix + publicID + "." + secret, publicID, HashToken(secret), nil
+}
+
+// ParseAPIKey splits an API key into its public id and secret
+func ParseAPIKey(key string) (publicID string, secret string, err error) {
+	if !strings.HasPrefix(key, apiKeyPrefix) {
+		return "", "", ErrInvalidAPIKey
+	}
+
+	publicID, secret, found := strings.Cut(strings.TrimPrefix(key, apiKeyPrefix), ".")
+	if !found || publicID == "" || secret == "" {
+		return "", "", ErrInvalidAPIKey
+	}
+	return publicID, secret, nil
+}
@@ -0,0 +1,24 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAPIKeyRoundTrip(t *testing.T) {
+	key, publicID, hash, err := GenerateAPIKey()
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(key, "ck_"))
+
+	parsedID, secret, err := ParseAPIKey(key)
+	assert.NoError(t, err)
+	assert.Equal(t, publicID, parsedID)
+	assert.True(t, CompareTokenHash(secret, hash))
+
+	for _, invalid := range []string{"", "ck_", "ck_abc", "abc.def", "ck_.secret"} {
+		_, _, err := ParseAPIKey(invalid)
+		assert.ErrorIs(t, err, ErrInvalidAPIKey, invalid)
+	}
+}
@@ -0,0 +1,61 @@
+package utils
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+
+	"crud-example/models"
+	"crud-example/repository"
+)
+
+// Audit levels, matching the level ENUM of system_logs
+const (
+	AuditInfo    = "info"
+	AuditWarning = "warning"
+)
+
+// AuditEvent describes a security relevant event
+type AuditEvent struct {
+	Level     string
+	Message   string
+	UserID    *uint
+	IPAddress string
+	UserAgent string
+	Context   map[string]interface{}
+}
+
+// AuditLog records security relevant events in system_logs
+type AuditLog struct {
+	logs repository.AuditRepository
+}
+
+// NewAuditLog returns an AuditLog writing to logs
+func NewAuditLog(logs repository.AuditRepository) *AuditLog {
+	return &AuditLog{logs: logs}
+}
+
+// Record writes an event. Failures are logged but never returned so that auditing cannot
+// break the request being audited, and the entry is written even when ctx has been
+// cancelled by a client disconnecting.
+func (a *AuditLog) Record(ctx context.Context, event AuditEvent) {
+	entry := models.SystemLog{
+		Level:     event.Level,
+		Message:   event.Message,
+		UserID:    event.UserID,
+		IPAddress: event.IPAddress,
+		UserAgent: event.UserAgent,
+	}
+	if entry.Level == "" {
+		entry.Level = AuditInfo
+	}
+	if event.Context != nil {
+		if data, err := json.Marshal(event.Context); err == nil {
+			entry.Context = string(data)
+		}
+	}
+
+	if err := a.logs.Create(context.WithoutCancel(ctx), &entry); err != nil {
+		log.Printf("Failed to record audit event %q: %v", event.Message, err)
+	}
+}
@@ -2,56 +2,159 @@ package utils
 
 import (
 	"errors"
-	"os"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
-	"golang.org/x/crypto/bcrypt"
+	"crud-example/config"
+)
+
+// Token uses distinguish access tokens from tokens that only grant a single step of a flow
+const (
+	TokenUseAccess     = "access"
+	TokenUseMFAPending = "mfa_pending"
 )
 
 // Claims represents JWT claims
 type Claims struct {
+	UserID    uint   `json:"user_id"`
+	Email     string `json:"email"`
+	Role      string `json:"role,omitempty"`
+	SessionID string `json:"sid,omitempty"`
+	TokenUse  string `json:"token_use,omitempty"`
+	// Scope and ClientID are set on tokens issued to OAuth clients
+	Scope    string `json:"scope,omitempty"`
+	ClientID string `json:"client_id,omitempty"`
+	// Actor is set on impersonation tokens to the administrator acting as the user
+	Actor *Actor `json:"act,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// Actor identifies who is acting on behalf of the token subject, as the act claim of RFC 8693
+type Actor struct {
 	UserID uint   `json:"user_id"`
 	Email  string `json:"email"`
-	jwt.RegisteredClaims
 }
 
-// HashPassword hashes a password using bcrypt
+// Impersonated reports whether the token was issued to an administrator impersonating the user
+func (c *Claims) Impersonated() bool {
+	return c.Actor != nil
+}
+
+// ScopeList returns the scopes a token issued to an OAuth client is restricted to,
+// or nil for first-party tokens, which may use every permission of the user
+func (c *Claims) ScopeList() []string {
+	if c.ClientID == "" {
+		return nil
+	}
+	return append([]string{}, strings.Fields(c.Scope)...)
+}
+
+// HashPassword hashes a password with the current password hasher
 func HashPassword(password string) (string, error) {
-	bytes, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
-	return string(bytes), err
+	return CurrentPasswordHasher().Hash(password)
 }
 
-// CheckPassword checks if a password matches its hash
+// CheckPassword checks if a password matches its hash, whichever supported algorithm produced it
 func CheckPassword(password, hash string) bool {
-	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
-	return err == nil
+	// Accounts without a password are refused as slowly as wrong passwords
+	if hash == "" {
+		CheckDummyPassword(password)
+		return false
+	}
+	hasher, err := hasherFor(hash)
+	if err != nil {
+		return false
+	}
+	ok, err := hasher.Verify(password, hash)
+	return err == nil && ok
 }
 
-// GenerateToken generates a JWT token
-func GenerateToken(userID uint, email string) (string, error) {
-	// Get secret key from environment
-	secretKey := os.Getenv("JWT_SECRET")
-	if secretKey == "" {
-		secretKey = "your-secret-key"
-	}
+var (
+	dummyHashOnce sync.Once
+	dummyHash     string
+)
 
-	// Set expiration time
-	expirationTime := time.Now().Add(24 * time.Hour)
+// CheckDummyPassword spends the same time as CheckPassword without a real hash, so that
+// logins for unknown emails cannot be told apart from wrong passwords by their timing
+func CheckDummyPassword(password string) {
+	dummyHashOnce.Do(func() {
+		dummyHash, _ = HashPassword("dummy-password-for-timing")
+	})
+	CheckPassword(password, dummyHash)
+}
 
-	// Create claims
-	claims := &Claims{
-		UserID: userID,
-		Email:  email,
+// AccessTokenTTL returns the lifetime of access tokens (JWT_EXPIRATION, default 15m)
+func AccessTokenTTL() time.Duration {
+	return config.Current().JWT.Expiration
+}
+
+// GenerateToken generates a short-lived JWT access token
+func GenerateToken(userID uint, email string, role string) (string, error) {
+	return GenerateSessionToken(userID, email, role, "")
+}
+
+// GenerateSessionToken generates a short-lived JWT access token bound to a refresh token session
+func GenerateSessionToken(userID uint, email string, role string, sessionID string) (string, error) {
+	return signAccessToken(&Claims{
+		UserID:    userID,
+		Email:     email,
+		Role:      role,
+		SessionID: sessionID,
+	}, AccessTokenTTL())
+}
+
+// GenerateClientToken generates an access token issued to an OAuth client, restricted to
+// scope and addressed to this API (OAuthAudience). sessionID is empty when no refresh token was issued.
+func GenerateClientToken(userID uint, email string, role string, sessionID string, clientID string, scope string) (string, error) {
+	return signAccessToken(&Claims{
+		UserID:    userID,
+		Email:     email,
+		Role:      role,
+		SessionID: sessionID,
+		Scope:     scope,
+		ClientID:  clientID,
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(expirationTime),
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			Audience: jwt.ClaimStrings{OAuthAudience()},
 		},
+	}, AccessTokenTTL())
+}
+
+// ImpersonationTTL returns the lifetime of impersonation tokens (IMPERSONATION_TTL, default 30m)
+func ImpersonationTTL() time.Duration {
+	return config.Current().Tokens.ImpersonationTTL
+}
+
+// GenerateImpersonationToken generates an access token for the user carrying the
+// administrator in the act claim. It has no session, so it cannot be refreshed.
+func GenerateImpersonationToken(userID uint, email string, role string, actor Actor) (string, error) {
+	return signAccessToken(&Claims{
+		UserID: userID,
+		Email:  email,
+		Role:   role,
+		Actor:  &actor,
+	}, ImpersonationTTL())
+}
+
+// signAccessToken completes the registered claims of an access token valid for ttl and signs it
+func signAccessToken(claims *Claims, ttl time.Duration) (string, error) {
+	// Set expiration time
+	expirationTime := time.Now().Add(ttl)
+
+	// Unique token ID so the token can be revoked individually
+	jti, err := GenerateRandomToken(16)
+	if err != nil {
+		return "", err
 	}
 
-	// Create token
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	tokenString, err := token.SignedString([]byte(secretKey))
+	claims.TokenUse = TokenUseAccess
+	claims.ID = jti
+	claims.ExpiresAt = jwt.NewNumericDate(expirationTime)
+	claims.IssuedAt = jwt.NewNumericDate(time.Now())
+
+	// Sign token with the current key of the key ring
+	tokenString, err := CurrentKeyRing().Sign(claims)
 	if err != nil {
 		return "", err
 	}
@@ -59,18 +162,77 @@ func GenerateToken(userID uint, email string) (string, error) {
 	return tokenString, nil
 }
 
-// ValidateToken validates and parses a JWT token
+// OAuthAudience identifies this API in the aud claim of tokens issued to OAuth clients
+// (OAUTH_AUDIENCE, defaulting to APP_URL)
+func OAuthAudience() string {
+	cfg := config.Current()
+	if cfg.JWT.OAuthAudience != "" {
+		return cfg.JWT.OAuthAudience
+	}
+	return cfg.Server.AppURL
+}
+
+// MFATokenTTL is how long a user has to enter the second factor after the password
+const MFATokenTTL = 5 * time.Minute
+
+// GenerateMFAToken generates the short-lived token returned by the first login step of
+// users with MFA enabled. It can only be exchanged for an access token together with a valid code.
+func GenerateMFAToken(userID uint, email string) (string, error) {
+	jti, err := GenerateRandomToken(16)
+	if err != nil {
+		return "", err
+	}
+
+	claims := &Claims{
+		UserID:   userID,
+		Email:    email,
+		TokenUse: TokenUseMFAPending,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        jti,
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(MFATokenTTL)),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+		},
+	}
+
+	return CurrentKeyRing().Sign(claims)
+}
+
+// ValidateToken validates and parses a JWT access token
 func ValidateToken(tokenString string) (*Claims, error) {
-	// Get secret key from environment
-	secretKey := os.Getenv("JWT_SECRET")
-	if secretKey == "" {
-		secretKey = "your-secret-key"
+	claims, err := parseToken(tokenString)
+	if err != nil {
+		return nil, err
 	}
 
-	// Parse token
-	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
-		return []byte(secretKey), nil
-	})
+	// Tokens issued before token_use was introduced are access tokens
+	if claims.TokenUse != TokenUseAccess && claims.TokenUse != "" {
+		return nil, errors.New("not an access token")
+	}
+
+	// Tokens addressed to another audience are not meant for this API
+	if len(claims.Audience) > 0 && !containsString(claims.Audience, OAuthAudience()) {
+		return nil, errors.New("token audience mismatch")
+	}
+	return claims, nil
+}
+
+// ValidateMFAToken validates and parses a pending MFA token
+func ValidateMFAToken(tokenString string) (*Claims, error) {
+	claims, err := parseToken(tokenString)
+	if err != nil {
+		return nil, err
+	}
+
+	if claims.TokenUse != TokenUseMFAPending {
+		return nil, errors.New("not an MFA token")
+	}
+	return claims, nil
+}
+
+// parseToken verifies the signature and expiry of a JWT token and returns its claims
+func parseToken(tokenString string) (*Claims, error) {
+	// Parse token, selecting the verification key by its kid header
+	token, err := CurrentKeyRing().Parse(tokenString, &Claims{})
 
 	if err != nil {
 		return nil, err
@@ -82,4 +244,13 @@ func ValidateToken(tokenString string) (*Claims, error) {
 	}
 
 	return nil, errors.New("invalid token")
-} 
\ No newline at end of file
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
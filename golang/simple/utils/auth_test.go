@@ -0,0 +1,60 @@
+package utils
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenerateClientToken(t *testing.T) {
+	t.Setenv("OAUTH_AUDIENCE", "https://api.example.com")
+
+	token, err := GenerateClientToken(1, "test@example.com", "user", "", "client-1", "users:read profile:update")
+	require.NoError(t, err)
+
+	claims, err := ValidateToken(token)
+	require.NoError(t, err)
+	assert.Equal(t, "client-1", claims.ClientID)
+	assert.Equal(t, []string{"users:read", "profile:update"}, claims.ScopeList())
+	assert.Equal(t, []string{"https://api.example.com"}, []string(claims.Audience))
+
+	// Tokens addressed to another API are rejected
+	t.Setenv("OAUTH_AUDIENCE", "https://other.example.com")
+	_, err = ValidateToken(token)
+	assert.Error(t, err)
+}
+
+func TestClaimsScopeList(t *testing.T) {
+	// First-party tokens are not restricted
+	assert.Nil(t, (&Claims{}).ScopeList())
+
+	// A client token without scopes grants nothing
+	scopes := (&Claims{ClientID: "client-1"}).ScopeList()
+	assert.NotNil(t, scopes)
+	assert.Empty(t, scopes)
+}
+
+func TestGenerateImpersonationToken(t *testing.T) {
+	t.Setenv("IMPERSONATION_TTL", "10m")
+
+	token, err := GenerateImpersonationToken(2, "user@example.com", "user", Actor{UserID: 1, Email: "admin@example.com"})
+	require.NoError(t, err)
+
+	claims, err := ValidateToken(token)
+	require.NoError(t, err)
+	assert.True(t, claims.Impersonated())
+	assert.Equal(t, uint(2), claims.UserID)
+	assert.Equal(t, uint(1), claims.Actor.UserID)
+	assert.Equal(t, "admin@example.com", claims.Actor.Email)
+	assert.Empty(t, claims.SessionID)
+	assert.WithinDuration(t, claims.IssuedAt.Add(10*time.Minute), claims.ExpiresAt.Time, time.Second)
+
+	// Regular tokens have no actor
+	token, err = GenerateSessionToken(2, "user@example.com", "user", "sid")
+	require.NoError(t, err)
+	claims, err = ValidateToken(token)
+	require.NoError(t, err)
+	assert.False(t, claims.Impersonated())
+}
@@ -0,0 +1,305 @@
+package utils
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+	"crud-example/config"
+)
+
+// Password hashing algorithms, named after their identifier in PHC strings
+const (
+	HasherBcrypt   = config.HasherBcrypt
+	HasherArgon2id = config.HasherArgon2id
+)
+
+// ErrUnknownHashFormat is returned for stored hashes no hasher recognises
+var ErrUnknownHashFormat = errors.New("unknown password hash format")
+
+// PasswordHasher hashes passwords into self-describing strings: the algorithm, its version
+// and its parameters are stored with the hash so they can change without invalidating old hashes
+type PasswordHasher interface {
+	// ID is the algorithm identifier
+	ID() string
+	// Hash hashes a password with the hasher's current parameters
+	Hash(password string) (string, error)
+	// Verify checks a password against a hash produced by this algorithm with any parameters
+	Verify(password, encoded string) (bool, error)
+	// NeedsRehash reports whether a hash was not produced with this algorithm and its current parameters
+	NeedsRehash(encoded string) bool
+}
+
+// BcryptHasher hashes passwords with bcrypt, in its standard "$2a$<cost>$..." format
+type BcryptHasher struct {
+	Cost int
+}
+
+// ID returns the algorithm identifier
+func (h *BcryptHasher) ID() string {
+	return HasherBcrypt
+}
+
+// Hash hashes a password with the configured cost
+func (h *BcryptHasher) Hash(password string) (string, error) {
+	bytes, err := bcrypt.GenerateFromPassword([]byte(password), h.Cost)
+	return string(bytes), err
+}
+
+// Verify checks a password against a bcrypt hash
+func (h *BcryptHasher) Verify(password, encoded string) (bool, error) {
+	err := bcrypt.CompareHashAndPassword([]byte(encoded), []byte(password))
+	if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// NeedsRehash reports whether the hash is not a bcrypt hash of the configured cost
+func (h *BcryptHasher) NeedsRehash(encoded string) bool {
+	cost, err := bcrypt.Cost([]byte(encoded))
+	return err != nil || cost != h.Cost
+}
+
+// Argon2idHasher hashes passwords with Argon2id (RFC 9106) into PHC strings:
+// $argon2id$v=19$m=<memory KiB>,t=<iterations>,p=<parallelism>$<salt>$<hash>
+type Argon2idHasher struct {
+	Memory      uint32
+	Iterations  uint32
+	Parallelism uint8
+	SaltLength  uint32
+	KeyLength   uint32
+}
+
+// Limits of the Argon2id parameters accepted for new hashes. argon2.IDKey panics with zero
+// iterations or parallelism, and memory beyond a few GiB per hash would exhaust the server.
+const (
+	Argon2MaxMemory      = 4 * 1024 * 1024 // KiB
+	Argon2MaxIterations  = 64
+	Argon2MaxParallelism = 255
+)
+
+// Validate checks that the parameters are within the limits above. Argon2 needs at least
+// 8 KiB of memory per lane.
+func (h *Argon2idHasher) Validate() error {
+	var errs []error
+	if h.Iterations < 1 || h.Iterations > Argon2MaxIterations {
+		errs = append(errs, fmt.Errorf("ARGON2_ITERATIONS must be between 1 and %d", Argon2MaxIterations))
+	}
+	if h.Parallelism < 1 {
+		errs = append(errs, fmt.Errorf("ARGON2_PARALLELISM must be between 1 and %d", Argon2MaxParallelism))
+	}
+	if h.Memory < 8*uint32(h.Parallelism) || h.Memory > Argon2MaxMemory {
+		errs = append(errs, fmt.Errorf("ARGON2_MEMORY must be between 8 KiB per lane and %d KiB", Argon2MaxMemory))
+	}
+	if h.SaltLength < 8 || h.KeyLength < 16 {
+		errs = append(errs, errors.New("argon2id salt must be at least 8 bytes and key at least 16 bytes"))
+	}
+	return errors.Join(errs...)
+}
+
+// argon2idParams are the parameters decoded from an Argon2id PHC string
+type argon2idParams struct {
+	version     int
+	memory      uint32
+	iterations  uint32
+	parallelism uint8
+	salt        []byte
+	key         []byte
+}
+
+// ID returns the algorithm identifier
+func (h *Argon2idHasher) ID() string {
+	return HasherArgon2id
+}
+
+// Hash hashes a password with a random salt and the configured parameters
+func (h *Argon2idHasher) Hash(password string) (string, error) {
+	if err := h.Validate(); err != nil {
+		return "", err
+	}
+	salt := make([]byte, h.SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+
+	key := argon2.IDKey([]byte(password), salt, h.Iterations, h.Memory, h.Parallelism, h.KeyLength)
+	return fmt.Sprintf("$%s$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		HasherArgon2id, argon2.Version, h.Memory, h.Iterations, h.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+// Verify checks a password against an Argon2id hash using the parameters stored in it
+func (h *Argon2idHasher) Verify(password, encoded string) (bool, error) {
+	params, err := decodeArgon2id(encoded)
+	if err != nil {
+		return false, err
+	}
+
+	key := argon2.IDKey([]byte(password), params.salt, params.iterations, params.memory, params.parallelism, uint32(len(params.key)))
+	return subtle.ConstantTimeCompare(key, params.key) == 1, nil
+}
+
+// NeedsRehash reports whether the hash is not an Argon2id hash of the current version and parameters
+func (h *Argon2idHasher) NeedsRehash(encoded string) bool {
+	params, err := decodeArgon2id(encoded)
+	if err != nil {
+		return true
+	}
+	return params.version != argon2.Version ||
+		params.memory != h.Memory ||
+		params.iterations != h.Iterations ||
+		params.parallelism != h.Parallelism ||
+		uint32(len(params.salt)) != h.SaltLength ||
+		uint32(len(params.key)) != h.KeyLength
+}
+
+// decodeArgon2id parses an Argon2id PHC string
+func decodeArgon2id(encoded string) (*argon2idParams, error) {
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 || parts[0] != "" || parts[1] != HasherArgon2id {
+		return nil, ErrUnknownHashFormat
+	}
+
+	params := &argon2idParams{}
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &params.version); err != nil {
+		return nil, ErrUnknownHashFormat
+	}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.memory, &params.iterations, &params.parallelism); err != nil {
+		return nil, ErrUnknownHashFormat
+	}
+
+	var err error
+	if params.salt, err = base64.RawStdEncoding.DecodeString(parts[4]); err != nil {
+		return nil, ErrUnknownHashFormat
+	}
+	if params.key, err = base64.RawStdEncoding.DecodeString(parts[5]); err != nil || len(params.key) == 0 {
+		return nil, ErrUnknownHashFormat
+	}
+	if params.memory == 0 || params.iterations == 0 || params.parallelism == 0 {
+		return nil, ErrUnknownHashFormat
+	}
+	return params, nil
+}
+
+// PasswordHasherFromConfig builds the hasher selected by PASSWORD_HASHER (bcrypt or argon2id),
+// configured with BCRYPT_COST or ARGON2_MEMORY (KiB), ARGON2_ITERATIONS and ARGON2_PARALLELISM
+func PasswordHasherFromConfig(cfg config.PasswordConfig) (PasswordHasher, error) {
+	switch cfg.Hasher {
+	case HasherBcrypt:
+		if cfg.BcryptCost < bcrypt.MinCost || cfg.BcryptCost > bcrypt.MaxCost {
+			return nil, fmt.Errorf("BCRYPT_COST must be between %d and %d", bcrypt.MinCost, bcrypt.MaxCost)
+		}
+		return &BcryptHasher{Cost: cfg.BcryptCost}, nil
+	case HasherArgon2id:
+		// Values are range checked before the conversions so they cannot wrap around
+		memory, memoryErr := hasherParam("ARGON2_MEMORY", cfg.Argon2Memory, Argon2MaxMemory)
+		iterations, iterationsErr := hasherParam("ARGON2_ITERATIONS", cfg.Argon2Iterations, Argon2MaxIterations)
+		parallelism, parallelismErr := hasherParam("ARGON2_PARALLELISM", cfg.Argon2Parallelism, Argon2MaxParallelism)
+		if err := errors.Join(memoryErr, iterationsErr, parallelismErr); err != nil {
+			return nil, err
+		}
+		hasher := &Argon2idHasher{
+			Memory:      uint32(memory),
+			Iterations:  uint32(iterations),
+			Parallelism: uint8(parallelism),
+			SaltLength:  16,
+			KeyLength:   32,
+		}
+		return hasher, hasher.Validate()
+	default:
+		return nil, fmt.Errorf("unknown PASSWORD_HASHER %q", cfg.Hasher)
+	}
+}
+
+// hasherParam checks that the value of the setting key is between 1 and max
+func hasherParam(key string, value, max int) (int, error) {
+	if value < 1 || value > max {
+		return 0, fmt.Errorf("%s must be an integer between 1 and %d", key, max)
+	}
+	return value, nil
+}
+
+var (
+	hasherMu      sync.RWMutex
+	currentHasher PasswordHasher
+)
+
+// SetPasswordHasher replaces the hasher used for new password hashes
+func SetPasswordHasher(hasher PasswordHasher) {
+	hasherMu.Lock()
+	currentHasher = hasher
+	hasherMu.Unlock()
+}
+
+// CurrentPasswordHasher returns the hasher used for new password hashes, falling back to
+// bcrypt with the default cost when none was set
+func CurrentPasswordHasher() PasswordHasher {
+	hasherMu.RLock()
+	defer hasherMu.RUnlock()
+	if currentHasher == nil {
+		return &BcryptHasher{Cost: bcrypt.DefaultCost}
+	}
+	return currentHasher
+}
+
+// hasherFor returns a hasher able to verify the given hash
+func hasherFor(encoded string) (PasswordHasher, error) {
+	switch {
+	case strings.HasPrefix(encoded, "$"+HasherArgon2id+"$"):
+		return &Argon2idHasher{}, nil
+	case strings.HasPrefix(encoded, "$2a$"), strings.HasPrefix(encoded, "$2b$"), strings.HasPrefix(encoded, "$2y$"):
+		return &BcryptHasher{}, nil
+	}
+	return nil, ErrUnknownHashFormat
+}
+
+// PasswordNeedsRehash reports whether a stored hash should be replaced because it was not
+// produced by the current hasher with its current parameters
+func PasswordNeedsRehash(encoded string) bool {
+	return CurrentPasswordHasher().NeedsRehash(encoded)
+}
+
+// CalibrateBcrypt returns the lowest bcrypt cost whose hashing takes at least target on this host
+func CalibrateBcrypt(target time.Duration) (int, time.Duration) {
+	for cost := bcrypt.MinCost; ; cost++ {
+		elapsed := measureHash(&BcryptHasher{Cost: cost})
+		if elapsed >= target || cost == bcrypt.MaxCost {
+			return cost, elapsed
+		}
+	}
+}
+
+// CalibrateArgon2id returns the lowest number of iterations with the given memory (KiB) and
+// parallelism whose hashing takes at least target on this host
+func CalibrateArgon2id(target time.Duration, memory uint32, parallelism uint8) (*Argon2idHasher, time.Duration) {
+	hasher := &Argon2idHasher{Memory: memory, Parallelism: parallelism, SaltLength: 16, KeyLength: 32}
+	for hasher.Iterations = 1; ; hasher.Iterations++ {
+		elapsed := measureHash(hasher)
+		if elapsed >= target || hasher.Iterations == Argon2MaxIterations {
+			return hasher, elapsed
+		}
+	}
+}
+
+// measureHash returns the fastest of three hashing runs, ignoring warm-up noise
+func measureHash(hasher PasswordHasher) time.Duration {
+	var fastest time.Duration
+	for i := 0; i < 3; i++ {
+		start := time.Now()
+		if _, err := hasher.Hash("calibration-password"); err != nil {
+			return 0
+		}
+		if elapsed := time.Since(start); i == 0 || elapsed < fastest {
+			fastest = elapsed
+		}
+	}
+	return fastest
+}
@@ -0,0 +1,124 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+	"crud-example/config"
+)
+
+// testArgon2id uses small parameters so tests stay fast
+func testArgon2id() *Argon2idHasher {
+	return &Argon2idHasher{Memory: 1024, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32}
+}
+
+func TestPasswordHashers(t *testing.T) {
+	hashers := []PasswordHasher{&BcryptHasher{Cost: bcrypt.MinCost}, testArgon2id()}
+
+	for _, hasher := range hashers {
+		t.Run(hasher.ID(), func(t *testing.T) {
+			hash, err := hasher.Hash("correct horse")
+			require.NoError(t, err)
+
+			ok, err := hasher.Verify("correct horse", hash)
+			require.NoError(t, err)
+			assert.True(t, ok)
+
+			ok, err = hasher.Verify("wrong horse", hash)
+			require.NoError(t, err)
+			assert.False(t, ok)
+
+			assert.False(t, hasher.NeedsRehash(hash))
+		})
+	}
+}
+
+func TestArgon2idPHCFormat(t *testing.T) {
+	hash, err := testArgon2id().Hash("correct horse")
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(hash, "$argon2id$v=19$m=1024,t=1,p=1$"))
+
+	// Hashes stay verifiable after the parameters change, but are due for a rehash
+	stronger := &Argon2idHasher{Memory: 2048, Iterations: 2, Parallelism: 1, SaltLength: 16, KeyLength: 32}
+	ok, err := stronger.Verify("correct horse", hash)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.True(t, stronger.NeedsRehash(hash))
+
+	_, err = stronger.Verify("correct horse", "$argon2id$v=19$m=0,t=1,p=1$c2FsdA$a2V5")
+	assert.ErrorIs(t, err, ErrUnknownHashFormat)
+}
+
+func TestCheckPasswordAcrossAlgorithms(t *testing.T) {
+	defer SetPasswordHasher(nil)
+
+	// A legacy bcrypt hash keeps working after switching to Argon2id
+	SetPasswordHasher(&BcryptHasher{Cost: bcrypt.MinCost})
+	legacy, err := HashPassword("correct horse")
+	require.NoError(t, err)
+
+	SetPasswordHasher(testArgon2id())
+	assert.True(t, CheckPassword("correct horse", legacy))
+	assert.False(t, CheckPassword("wrong horse", legacy))
+	assert.True(t, PasswordNeedsRehash(legacy))
+
+	upgraded, err := HashPassword("correct horse")
+	require.NoError(t, err)
+	assert.True(t, CheckPassword("correct horse", upgraded))
+	assert.False(t, PasswordNeedsRehash(upgraded))
+
+	// A bcrypt hash with an outdated cost is due for a rehash too
+	SetPasswordHasher(&BcryptHasher{Cost: bcrypt.MinCost + 1})
+	assert.True(t, PasswordNeedsRehash(legacy))
+
+	assert.False(t, CheckPassword("correct horse", "plaintext"))
+
+	// Accounts without a password match no password, not even an empty one
+	assert.False(t, CheckPassword("", ""))
+}
+
+func TestPasswordHasherFromConfig(t *testing.T) {
+	t.Setenv("PASSWORD_HASHER", "argon2id")
+	t.Setenv("ARGON2_MEMORY", "19456")
+	t.Setenv("ARGON2_ITERATIONS", "2")
+	t.Setenv("ARGON2_PARALLELISM", "1")
+	hasher, err := PasswordHasherFromConfig(config.Current().Password)
+	require.NoError(t, err)
+	assert.Equal(t, &Argon2idHasher{Memory: 19456, Iterations: 2, Parallelism: 1, SaltLength: 16, KeyLength: 32}, hasher)
+
+	// Parameters argon2.IDKey panics on, or that would wrap around, fail at startup
+	for key, value := range map[string]string{
+		"ARGON2_ITERATIONS":  "0",
+		"ARGON2_PARALLELISM": "0",
+		"ARGON2_MEMORY":      "-1",
+	} {
+		t.Run(key+"="+value, func(t *testing.T) {
+			t.Setenv(key, value)
+			_, err := PasswordHasherFromConfig(config.Current().Password)
+			assert.ErrorContains(t, err, key)
+		})
+	}
+	t.Setenv("ARGON2_MEMORY", "8589934592")
+	_, err = PasswordHasherFromConfig(config.Current().Password)
+	assert.ErrorContains(t, err, "ARGON2_MEMORY")
+	t.Setenv("ARGON2_MEMORY", "4")
+	_, err = PasswordHasherFromConfig(config.Current().Password)
+	assert.ErrorContains(t, err, "ARGON2_MEMORY")
+	t.Setenv("ARGON2_MEMORY", "19456")
+
+	// A hasher built with invalid parameters returns an error instead of panicking
+	_, err = (&Argon2idHasher{Memory: 19456, SaltLength: 16, KeyLength: 32}).Hash("password")
+	assert.Error(t, err)
+
+	t.Setenv("PASSWORD_HASHER", "bcrypt")
+	t.Setenv("BCRYPT_COST", "40")
+	_, err = PasswordHasherFromConfig(config.Current().Password)
+	assert.Error(t, err)
+
+	t.Setenv("PASSWORD_HASHER", "md5")
+	_, err = PasswordHasherFromConfig(config.Current().Password)
+	assert.Error(t, err)
+}
@@ -0,0 +1,335 @@
+package utils
+
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"crud-example/config"
+)
+
+// DefaultJWTSecret is the insecure development secret used when JWT_SECRET is not set
+const DefaultJWTSecret = "your-secret-key"
+
+// hmacKeyID is the kid used for tokens signed with the shared JWT_SECRET
+const hmacKeyID = "hs256"
+
+var (
+	keyRingMu sync.RWMutex
+	keyRing   *KeyRing
+)
+
+// Key is a single key used to sign or verify tokens
+type Key struct {
+	ID     string
+	Method jwt.SigningMethod
+	// NotAfter is the time after which the key is no longer accepted; zero means no limit
+	NotAfter time.Time
+
+	signKey   interface{}
+	verifyKey interface{}
+}
+
+// CanSign reports whether the key holds private material
+func (k *Key) CanSign() bool {
+	return k.signKey != nil
+}
+
+// KeyRing holds the key used to sign new tokens and every key accepted when verifying them.
+// Keys of previous rotations stay in the ring, verification only, until NotAfter.
+type KeyRing struct {
+	signing *Key
+	keys    map[string]*Key
+}
+
+// NewKeyRing creates a key ring signing with the given key and also accepting the previous ones
+func NewKeyRing(signing *Key, previous ...*Key) (*KeyRing, error) {
+	if signing == nil || !signing.CanSign() {
+		return nil, errors.New("signing key must include a private key")
+	}
+
+	ring := &KeyRing{signing: signing, keys: map[string]*Key{signing.ID: signing}}
+	for _, key := range previous {
+		if _, exists := ring.keys[key.ID]; exists {
+			return nil, fmt.Errorf("duplicate key id %q", key.ID)
+		}
+		ring.keys[key.ID] = key
+	}
+	return ring, nil
+}
+
+// NewHMACKeyRing creates a key ring signing with a shared HS256 secret
+func NewHMACKeyRing(secret []byte) *KeyRing {
+	key := &Key{ID: hmacKeyID, Method: jwt.SigningMethodHS256, signKey: secret, verifyKey: secret}
+	return &KeyRing{signing: key, keys: map[string]*Key{key.ID: key}}
+}
+
+// SetKeyRing replaces the key ring used by GenerateToken and ValidateToken
+func SetKeyRing(ring *KeyRing) {
+	keyRingMu.Lock()
+	keyRing = ring
+	keyRingMu.Unlock()
+}
+
+// CurrentKeyRing returns the active key ring, falling back to JWT_SECRET when none was loaded
+func CurrentKeyRing() *KeyRing {
+	keyRingMu.RLock()
+	ring := keyRing
+	keyRingMu.RUnlock()
+	if ring != nil {
+		return ring
+	}
+
+	secret := config.Current().JWT.Secret
+	if secret == "" {
+		secret = DefaultJWTSecret
+	}
+	return NewHMACKeyRing([]byte(secret))
+}
+
+// LoadKeyRing builds the key ring from the JWT configuration:
+//   - JWT_SIGNING_KEY_FILE: PEM private key (RSA or Ed25519) used to sign new tokens
+//   - JWT_PREVIOUS_KEY_FILES: comma separated PEM files of rotated-out keys, each optionally
+//     suffixed with "@<RFC3339 time>" after which it is no longer accepted
+//
+// Without JWT_SIGNING_KEY_FILE tokens are signed with HS256 and JWT_SECRET. When release
+// is true, running with a missing or default JWT_SECRET is refused.
+func LoadKeyRing(cfg config.JWTConfig, release bool) (*KeyRing, error) {
+	signingFile := cfg.SigningKeyFile
+	if signingFile == "" {
+		secret := cfg.Secret
+		if secret == "" || secret == DefaultJWTSecret {
+			if release {
+				return nil, errors.New("JWT_SECRET must be set to a non-default value in release mode")
+			}
+			log.Println("⚠️  JWT_SECRET is not set, using the insecure default secret")
+			secret = DefaultJWTSecret
+		}
+		return NewHMACKeyRing([]byte(secret)), nil
+	}
+
+	signing, err := LoadKeyFile(signingFile)
+	if err != nil {
+		return nil, err
+	}
+
+	var previous []*Key
+	for _, entry := range strings.Split(cfg.PreviousKeyFiles, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		path, notAfter, hasDeadline := strings.Cut(entry, "@")
+		key, err := LoadKeyFile(path)
+		if err != nil {
+			return nil, err
+		}
+		if hasDeadline {
+			if key.NotAfter, err = time.Parse(time.RFC3339, notAfter); err != nil {
+				return nil, fmt.Errorf("invalid expiry for key %s: %w", path, err)
+			}
+		}
+		previous = append(previous, key)
+	}
+
+	return NewKeyRing(signing, previous...)
+}
+
+// LoadKeyFile loads an RSA or Ed25519 key from a PEM file
+func LoadKeyFile(path string) (*Key, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read key file %s: %w", path, err)
+	}
+	key, err := ParseKeyPEM(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse key file %s: %w", path, err)
+	}
+	return key, nil
+}
+
+// ParseKeyPEM parses a PEM encoded RSA or Ed25519 private or public key.
+// The key ID is the RFC 7638 thumbprint of the public key.
+func ParseKeyPEM(data []byte) (*Key, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM data found")
+	}
+
+	var parsed interface{}
+	var err error
+	switch block.Type {
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		parsed, err = x509.ParsePKIXPublicKey(block.Bytes)
+	case "RSA PUBLIC KEY":
+		parsed, err = x509.ParsePKCS1PublicKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("unsupported PEM block type %q", block.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	key := &Key{}
+	switch k := parsed.(type) {
+	case *rsa.PrivateKey:
+		key.Method, key.signKey, key.verifyKey = jwt.SigningMethodRS256, k, &k.PublicKey
+	case *rsa.PublicKey:
+		key.Method, key.verifyKey = jwt.SigningMethodRS256, k
+	case ed25519.PrivateKey:
+		key.Method, key.signKey, key.verifyKey = jwt.SigningMethodEdDSA, k, k.Public()
+	case ed25519.PublicKey:
+		key.Method, key.verifyKey = jwt.SigningMethodEdDSA, k
+	default:
+		return nil, fmt.Errorf("unsupported key type %T", parsed)
+	}
+
+	if pub, ok := key.verifyKey.(*rsa.PublicKey); ok && pub.N.BitLen() < 2048 {
+		return nil, errors.New("RSA keys must be at least 2048 bits")
+	}
+
+	key.ID = thumbprint(key.jwk())
+	return key, nil
+}
+
+// Sign signs the claims with the current signing key and sets the kid header
+func (r *KeyRing) Sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(r.signing.Method, claims)
+	token.Header["kid"] = r.signing.ID
+	return token.SignedString(r.signing.signKey)
+}
+
+// Parse parses and verifies a token with the key selected by its kid header
+func (r *KeyRing) Parse(tokenString string, claims jwt.Claims) (*jwt.Token, error) {
+	return jwt.ParseWithClaims(tokenString, claims, r.keyfunc, jwt.WithValidMethods(r.methods()))
+}
+
+func (r *KeyRing) keyfunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+
+	key, ok := r.keys[kid]
+	// Tokens issued before kid headers were introduced were signed with JWT_SECRET
+	if !ok && kid == "" && r.signing.ID == hmacKeyID {
+		key, ok = r.signing, true
+	}
+	if !ok {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+
+	// The algorithm must match the key, otherwise a public key could be used as an HMAC secret
+	if token.Method.Alg() != key.Method.Alg() {
+		return nil, fmt.Errorf("unexpected signing method %s for key %q", token.Method.Alg(), kid)
+	}
+	if !key.NotAfter.IsZero() && time.Now().After(key.NotAfter) {
+		return nil, fmt.Errorf("signing key %q has been retired", kid)
+	}
+
+	return key.verifyKey, nil
+}
+
+func (r *KeyRing) methods() []string {
+	seen := map[string]bool{}
+	var methods []string
+	for _, key := range r.keys {
+		if alg := key.Method.Alg(); !seen[alg] {
+			seen[alg] = true
+			methods = append(methods, alg)
+		}
+	}
+	return methods
+}
+
+// JWK is a JSON Web Key (RFC 7517) describing a public verification key
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid,omitempty"`
+	Use string `json:"use,omitempty"`
+	Alg string `json:"alg,omitempty"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+// JWKSet is the document served at /.well-known/jwks.json
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS returns the public keys of the ring that are still accepted.
+// Shared HMAC secrets are never published.
+func (r *KeyRing) JWKS() JWKSet {
+	set := JWKSet{Keys: []JWK{}}
+	now := time.Now()
+
+	// Signing key first so consumers looking at the first entry get the current key
+	ordered := []*Key{r.signing}
+	for _, key := range r.keys {
+		if key != r.signing {
+			ordered = append(ordered, key)
+		}
+	}
+
+	for _, key := range ordered {
+		if !key.NotAfter.IsZero() && now.After(key.NotAfter) {
+			continue
+		}
+		jwk := key.jwk()
+		if jwk.Kty == "" {
+			continue
+		}
+		jwk.Kid = key.ID
+		jwk.Use = "sig"
+		jwk.Alg = key.Method.Alg()
+		set.Keys = append(set.Keys, jwk)
+	}
+	return set
+}
+
+// jwk returns the required public members of the key, or an empty JWK for HMAC keys
+func (k *Key) jwk() JWK {
+	switch pub := k.verifyKey.(type) {
+	case *rsa.PublicKey:
+		return JWK{
+			Kty: "RSA",
+			N:   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+			E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+		}
+	case ed25519.PublicKey:
+		return JWK{Kty: "OKP", Crv: "Ed25519", X: base64.RawURLEncoding.EncodeToString(pub)}
+	}
+	return JWK{}
+}
+
+// thumbprint computes the RFC 7638 JWK thumbprint used as key ID
+func thumbprint(jwk JWK) string {
+	var members map[string]string
+	switch jwk.Kty {
+	case "RSA":
+		members = map[string]string{"e": jwk.E, "kty": jwk.Kty, "n": jwk.N}
+	case "OKP":
+		members = map[string]string{"crv": jwk.Crv, "kty": jwk.Kty, "x": jwk.X}
+	}
+	// encoding/json sorts map keys, which yields the canonical member order
+	data, _ := json.Marshal(members)
+	sum := sha256.Sum256(data)
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
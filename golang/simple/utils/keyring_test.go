@@ -0,0 +1,129 @@
+package utils
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"crud-example/config"
+)
+
+func rsaKeyPEM(t *testing.T) []byte {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+}
+
+func ed25519KeyPEM(t *testing.T) []byte {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+}
+
+func testClaims() *Claims {
+	return &Claims{
+		UserID: 1,
+		Email:  "test@example.com",
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute)),
+		},
+	}
+}
+
+func TestKeyRingSignAndParse(t *testing.T) {
+	tests := []struct {
+		name string
+		pem  []byte
+		alg  string
+	}{
+		{name: "RS256", pem: rsaKeyPEM(t), alg: "RS256"},
+		{name: "EdDSA", pem: ed25519KeyPEM(t), alg: "EdDSA"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key, err := ParseKeyPEM(tt.pem)
+			require.NoError(t, err)
+			ring, err := NewKeyRing(key)
+			require.NoError(t, err)
+
+			tokenString, err := ring.Sign(testClaims())
+			require.NoError(t, err)
+
+			token, err := ring.Parse(tokenString, &Claims{})
+			require.NoError(t, err)
+			assert.Equal(t, key.ID, token.Header["kid"])
+			assert.Equal(t, tt.alg, token.Method.Alg())
+			assert.Equal(t, uint(1), token.Claims.(*Claims).UserID)
+		})
+	}
+}
+
+func TestKeyRingRotation(t *testing.T) {
+	oldKey, err := ParseKeyPEM(rsaKeyPEM(t))
+	require.NoError(t, err)
+	newKey, err := ParseKeyPEM(ed25519KeyPEM(t))
+	require.NoError(t, err)
+
+	oldRing, err := NewKeyRing(oldKey)
+	require.NoError(t, err)
+	oldToken, err := oldRing.Sign(testClaims())
+	require.NoError(t, err)
+
+	// After rotation tokens signed with the previous key are still accepted
+	rotated, err := NewKeyRing(newKey, oldKey)
+	require.NoError(t, err)
+	_, err = rotated.Parse(oldToken, &Claims{})
+	assert.NoError(t, err)
+	assert.Len(t, rotated.JWKS().Keys, 2)
+	assert.Equal(t, newKey.ID, rotated.JWKS().Keys[0].Kid)
+
+	// Once the previous key is retired they are rejected
+	oldKey.NotAfter = time.Now().Add(-time.Second)
+	_, err = rotated.Parse(oldToken, &Claims{})
+	assert.Error(t, err)
+	assert.Len(t, rotated.JWKS().Keys, 1)
+}
+
+func TestKeyRingRejectsAlgorithmConfusion(t *testing.T) {
+	key, err := ParseKeyPEM(rsaKeyPEM(t))
+	require.NoError(t, err)
+	ring, err := NewKeyRing(key)
+	require.NoError(t, err)
+
+	// An HS256 token using the published public key as secret must not verify
+	forged := jwt.NewWithClaims(jwt.SigningMethodHS256, testClaims())
+	forged.Header["kid"] = key.ID
+	tokenString, err := forged.SignedString([]byte(ring.JWKS().Keys[0].N))
+	require.NoError(t, err)
+
+	_, err = ring.Parse(tokenString, &Claims{})
+	assert.Error(t, err)
+}
+
+func TestHMACKeyRingIsNotPublished(t *testing.T) {
+	ring := NewHMACKeyRing([]byte("secret"))
+	assert.Empty(t, ring.JWKS().Keys)
+}
+
+func TestLoadKeyRingRefusesDefaultSecretInRelease(t *testing.T) {
+	_, err := LoadKeyRing(config.JWTConfig{}, true)
+	assert.Error(t, err)
+
+	_, err = LoadKeyRing(config.JWTConfig{Secret: DefaultJWTSecret}, true)
+	assert.Error(t, err)
+
+	_, err = LoadKeyRing(config.JWTConfig{}, false)
+	assert.NoError(t, err)
+}
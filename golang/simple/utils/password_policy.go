@@ -0,0 +1,325 @@
+package utils
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+
+	"crud-example/config"
+)
+
+// Password policy rules reported in violations
+const (
+	RuleMinLength    = "min_length"
+	RuleMaxLength    = "max_length"
+	RuleUppercase    = "uppercase"
+	RuleLowercase    = "lowercase"
+	RuleDigit        = "digit"
+	RuleSymbol       = "symbol"
+	RulePersonalInfo = "personal_info"
+	RuleEntropy      = "entropy"
+	RuleBreached     = "breached"
+	// RuleHistory is reported by the handlers for recently used passwords
+	RuleHistory = "history"
+)
+
+// bcryptMaxLength is the number of bytes bcrypt takes into account
+const bcryptMaxLength = 72
+
+// PasswordViolation describes a password policy rule a password does not satisfy
+type PasswordViolation struct {
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+// PasswordPolicy holds the requirements passwords must meet
+type PasswordPolicy struct {
+	MinLength     int
+	RequireUpper  bool
+	RequireLower  bool
+	RequireDigit  bool
+	RequireSymbol bool
+	// DisallowPersonalInfo rejects passwords containing the user's name or email
+	DisallowPersonalInfo bool
+	// MinEntropy is the minimum estimated entropy in bits; 0 disables the check
+	MinEntropy int
+	// Breached is the list of known compromised passwords; nil disables the check
+	Breached *BreachedPasswords
+}
+
+// PasswordPolicyFromConfig builds the policy from the password settings. It fails when the
+// breached password directory cannot be read.
+func PasswordPolicyFromConfig(cfg config.PasswordConfig) (*PasswordPolicy, error) {
+	policy := &PasswordPolicy{
+		MinLength:            cfg.MinLength,
+		RequireUpper:         cfg.RequireUpper,
+		RequireLower:         cfg.RequireLower,
+		RequireDigit:         cfg.RequireDigit,
+		RequireSymbol:        cfg.RequireSymbol,
+		DisallowPersonalInfo: cfg.DisallowPersonalInfo,
+		MinEntropy:           cfg.MinEntropy,
+	}
+	if cfg.BreachedDir != "" {
+		policy.Breached = NewBreachedPasswords(cfg.BreachedDir, cfg.BreachedMinCount)
+		if err := policy.Breached.Verify(); err != nil {
+			return policy, fmt.Errorf("PASSWORD_BREACHED_DIR: %w", err)
+		}
+	}
+	return policy, nil
+}
+
+var (
+	policyMu      sync.RWMutex
+	currentPolicy *PasswordPolicy
+)
+
+// SetPasswordPolicy replaces the policy used by CurrentPasswordPolicy
+func SetPasswordPolicy(policy *PasswordPolicy) {
+	policyMu.Lock()
+	currentPolicy = policy
+	policyMu.Unlock()
+}
+
+// CurrentPasswordPolicy returns the configured policy, building it from the configuration
+// on first use. The server sets the policy at startup, so that an unreadable breached password
+// directory stops it; here the error is only logged.
+func CurrentPasswordPolicy() *PasswordPolicy {
+	policyMu.RLock()
+	policy := currentPolicy
+	policyMu.RUnlock()
+	if policy != nil {
+		return policy
+	}
+
+	policyMu.Lock()
+	defer policyMu.Unlock()
+	if currentPolicy == nil {
+		policy, err := PasswordPolicyFromConfig(config.Current().Password)
+		if err != nil {
+			log.Println("Invalid password policy:", err)
+		}
+		currentPolicy = policy
+	}
+	return currentPolicy
+}
+
+// Check returns every rule the password violates; personal holds the user's name, email
+// and other values the password must not contain
+func (p *PasswordPolicy) Check(password string, personal ...string) []PasswordViolation {
+	violations := []PasswordViolation{}
+	add := func(rule, message string) {
+		violations = append(violations, PasswordViolation{Rule: rule, Message: message})
+	}
+
+	if utf8.RuneCountInString(password) < p.MinLength {
+		add(RuleMinLength, "Password must be at least "+strconv.Itoa(p.MinLength)+" characters long")
+	}
+	if len(password) > bcryptMaxLength {
+		add(RuleMaxLength, "Password must be at most "+strconv.Itoa(bcryptMaxLength)+" bytes long")
+	}
+
+	var upper, lower, digit, symbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsDigit(r):
+			digit = true
+		default:
+			symbol = true
+		}
+	}
+	if p.RequireUpper && !upper {
+		add(RuleUppercase, "Password must contain an uppercase letter")
+	}
+	if p.RequireLower && !lower {
+		add(RuleLowercase, "Password must contain a lowercase letter")
+	}
+	if p.RequireDigit && !digit {
+		add(RuleDigit, "Password must contain a digit")
+	}
+	if p.RequireSymbol && !symbol {
+		add(RuleSymbol, "Password must contain a symbol")
+	}
+
+	if p.DisallowPersonalInfo && containsPersonalInfo(password, personal) {
+		add(RulePersonalInfo, "Password must not contain your name or email address")
+	}
+
+	if p.MinEntropy > 0 && PasswordEntropy(password) < float64(p.MinEntropy) {
+		add(RuleEntropy, "Password is too easy to guess")
+	}
+
+	if p.Breached != nil {
+		// The check fails open so that users are not locked out of changing passwords, but
+		// the failure is logged since breached passwords get through until it is fixed
+		breached, err := p.Breached.Contains(password)
+		if err != nil {
+			log.Println("Failed to check password against breached passwords:", err)
+		}
+		if breached {
+			add(RuleBreached, "Password has appeared in a data breach, please choose another one")
+		}
+	}
+
+	return violations
+}
+
+// containsPersonalInfo reports whether the password contains, ignoring case, one of the
+// values or a part of them: words of a name and the local part of an email
+func containsPersonalInfo(password string, values []string) bool {
+	lowered := strings.ToLower(password)
+	for _, value := range values {
+		value = strings.ToLower(value)
+		if at := strings.Index(value, "@"); at >= 0 {
+			value = value[:at]
+		}
+
+		parts := strings.FieldsFunc(value, func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+		})
+		for _, part := range parts {
+			// Very short fragments would reject too many passwords by accident
+			if utf8.RuneCountInString(part) >= 3 && strings.Contains(lowered, part) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// PasswordEntropy is a rough estimate of the entropy of a password in bits: the size of the
+// character pool it draws from times its length, where repeated and sequential characters
+// ("aaa", "abc", "321") only count half
+func PasswordEntropy(password string) float64 {
+	var pool int
+	var lower, upper, digit, symbol, other bool
+	for _, r := range password {
+		switch {
+		case r > unicode.MaxASCII:
+			other = true
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsDigit(r):
+			digit = true
+		default:
+			symbol = true
+		}
+	}
+	for _, class := range []struct {
+		present bool
+		size    int
+	}{{lower, 26}, {upper, 26}, {digit, 10}, {symbol, 33}, {other, 100}} {
+		if class.present {
+			pool += class.size
+		}
+	}
+	if pool == 0 {
+		return 0
+	}
+
+	var length float64
+	var previous rune = -1
+	for _, r := range password {
+		if previous >= 0 && (r == previous || r == previous+1 || r == previous-1) {
+			length += 0.5
+		} else {
+			length++
+		}
+		previous = r
+	}
+
+	return length * math.Log2(float64(pool))
+}
+
+// BreachedPasswords checks passwords against a local copy of a breached password list in
+// the k-anonymity range format: one file per 5 character SHA-1 prefix, named after the
+// prefix (optionally with a .txt extension), with "SUFFIX:COUNT" lines
+type BreachedPasswords struct {
+	dir      string
+	minCount int
+}
+
+// NewBreachedPasswords returns a checker reading prefix files from dir. Passwords are only
+// considered breached when they appear at least minCount times.
+func NewBreachedPasswords(dir string, minCount int) *BreachedPasswords {
+	if minCount < 1 {
+		minCount = 1
+	}
+	return &BreachedPasswords{dir: dir, minCount: minCount}
+}
+
+// Verify checks that the directory exists and can be read
+func (b *BreachedPasswords) Verify() error {
+	dir, err := os.Open(b.dir)
+	if err != nil {
+		return err
+	}
+	defer dir.Close()
+
+	info, err := dir.Stat()
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%s is not a directory", b.dir)
+	}
+	if _, err := dir.Readdirnames(1); err != nil && !errors.Is(err, io.EOF) {
+		return err
+	}
+	return nil
+}
+
+// Contains reports whether the password is in the list. Missing prefix files mean no breach is known.
+func (b *BreachedPasswords) Contains(password string) (bool, error) {
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+	prefix, suffix := hash[:5], hash[5:]
+
+	file, err := os.Open(filepath.Join(b.dir, prefix))
+	if errors.Is(err, os.ErrNotExist) {
+		file, err = os.Open(filepath.Join(b.dir, prefix+".txt"))
+	}
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		candidate, count, found := strings.Cut(line, ":")
+		if !strings.EqualFold(candidate, suffix) {
+			continue
+		}
+
+		// Lines without a count are treated as a single occurrence
+		n := 1
+		if found {
+			if parsed, err := strconv.Atoi(strings.TrimSpace(count)); err == nil {
+				n = parsed
+			}
+		}
+		return n >= b.minCount, nil
+	}
+	return false, scanner.Err()
+}
@@ -0,0 +1,97 @@
+package utils
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"crud-example/config"
+)
+
+func violatedRules(violations []PasswordViolation) []string {
+	rules := []string{}
+	for _, v := range violations {
+		rules = append(rules, v.Rule)
+	}
+	return rules
+}
+
+func TestPasswordPolicyCheck(t *testing.T) {
+	policy := &PasswordPolicy{
+		MinLength:            10,
+		RequireUpper:         true,
+		RequireLower:         true,
+		RequireDigit:         true,
+		RequireSymbol:        true,
+		DisallowPersonalInfo: true,
+		MinEntropy:           55,
+	}
+
+	tests := []struct {
+		name     string
+		password string
+		want     []string
+	}{
+		{name: "Strong password", password: "Tr0ub4dor&3x!", want: []string{}},
+		{name: "Too short and simple", password: "abc", want: []string{RuleMinLength, RuleUppercase, RuleDigit, RuleSymbol, RuleEntropy}},
+		{name: "Too long for bcrypt", password: "Aa1!" + strings.Repeat("x", 70), want: []string{RuleMaxLength}},
+		{name: "Contains name", password: "Janedoe#2024x", want: []string{RulePersonalInfo}},
+		{name: "Contains email local part", password: "J.smith99!Xy", want: []string{RulePersonalInfo}},
+		{name: "Repeated characters", password: "Aaaaaaaaa1!", want: []string{RuleEntropy}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			violations := policy.Check(tt.password, "Jane Doe", "j.smith99@example.com")
+			assert.Equal(t, tt.want, violatedRules(violations))
+		})
+	}
+}
+
+func TestPasswordEntropy(t *testing.T) {
+	assert.Zero(t, PasswordEntropy(""))
+	assert.Less(t, PasswordEntropy("aaaaaaaa"), PasswordEntropy("qzmxwnra"))
+	assert.Less(t, PasswordEntropy("abcdefgh"), PasswordEntropy("qzmxwnra"))
+	assert.Less(t, PasswordEntropy("qzmxwnra"), PasswordEntropy("qZmX7n!a"))
+}
+
+func TestBreachedPasswords(t *testing.T) {
+	dir := t.TempDir()
+
+	sum := sha1.Sum([]byte("password"))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+	content := "0018A45C4D1DEF81644B54AB7F969B88D65:1\r\n" + hash[5:] + ":3861493\r\n"
+	require.NoError(t, os.WriteFile(filepath.Join(dir, hash[:5]), []byte(content), 0o600))
+
+	breached := NewBreachedPasswords(dir, 1)
+	found, err := breached.Contains("password")
+	require.NoError(t, err)
+	assert.True(t, found)
+
+	// Passwords whose prefix file is missing are not known to be breached
+	found, err = breached.Contains("correct horse battery staple")
+	require.NoError(t, err)
+	assert.False(t, found)
+
+	// Rarely seen passwords can be tolerated with a minimum count
+	found, err = NewBreachedPasswords(dir, 5000000).Contains("password")
+	require.NoError(t, err)
+	assert.False(t, found)
+
+	policy := &PasswordPolicy{Breached: breached}
+	assert.Equal(t, []string{RuleBreached}, violatedRules(policy.Check("password")))
+
+	// The directory is checked at startup
+	assert.NoError(t, breached.Verify())
+	assert.Error(t, NewBreachedPasswords(filepath.Join(dir, "missing"), 1).Verify())
+	assert.Error(t, NewBreachedPasswords(filepath.Join(dir, hash[:5]), 1).Verify())
+
+	t.Setenv("PASSWORD_BREACHED_DIR", filepath.Join(dir, "missing"))
+	_, err = PasswordPolicyFromConfig(config.Current().Password)
+	assert.ErrorContains(t, err, "PASSWORD_BREACHED_DIR")
+}
@@ -0,0 +1,61 @@
+package utils
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+
+	"crud-example/config"
+)
+
+// ErrInvalidRefreshToken is returned when a refresh token is malformed
+var ErrInvalidRefreshToken = errors.New("invalid refresh token")
+
+// RefreshTokenTTL returns the lifetime of refresh tokens (REFRESH_TOKEN_EXPIRATION, default 30 days)
+func RefreshTokenTTL() time.Duration {
+	return config.Current().JWT.RefreshExpiration
+}
+
+// GenerateRandomToken returns a URL-safe random string built from n random bytes
+func GenerateRandomToken(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// HashToken hashes an opaque token with SHA-256 so it can be stored safely
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// CompareTokenHash checks in constant time whether token matches a stored hash
+func CompareTokenHash(token, hash string) bool {
+	return subtle.ConstantTimeCompare([]byte(HashToken(token)), []byte(hash)) == 1
+}
+
+// NewRefreshToken creates an opaque refresh token for a token family.
+// The token has the form "<familyID>.<secret>"; only the hash of the secret is persisted.
+func NewRefreshToken(familyID string) (token string, secretHash string, err error) {
+	secret, err := GenerateRandomToken(32)
+	if err != nil {
+		return "", "", err
+	}
+	return familyID + "." + secret, HashToken(secret), nil
+}
+
+// ParseRefreshToken splits a refresh token into its family ID and secret
+func ParseRefreshToken(token string) (familyID string, secret string, err error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", "", ErrInvalidRefreshToken
+	}
+	return parts[0], parts[1], nil
+}
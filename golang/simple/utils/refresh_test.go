@@ -0,0 +1,31 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRefreshTokenRoundTrip(t *testing.T) {
+	token, hash, err := NewRefreshToken("family")
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(token, "family."))
+
+	familyID, secret, err := ParseRefreshToken(token)
+	assert.NoError(t, err)
+	assert.Equal(t, "family", familyID)
+	assert.True(t, CompareTokenHash(secret, hash))
+	assert.False(t, CompareTokenHash(secret+"x", hash))
+}
+
+func TestParseRefreshTokenInvalid(t *testing.T) {
+	tests := []string{"", "no-separator", ".secret", "family.", "a.b.c"}
+
+	for _, tt := range tests {
+		t.Run(tt, func(t *testing.T) {
+			_, _, err := ParseRefreshToken(tt)
+			assert.ErrorIs(t, err, ErrInvalidRefreshToken)
+		})
+	}
+}
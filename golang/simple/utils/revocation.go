@@ -0,0 +1,185 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"crud-example/models"
+	"crud-example/repository"
+)
+
+// RevocationStore tracks revoked access tokens. The database is the source of
+// truth so revocations are shared between instances; answers are cached in memory
+// so that AuthMiddleware does not hit the database on every request. Revocations are
+// cached until the token would have expired anyway, while "not revoked" answers are
+// only trusted for cacheTTL so that revocations made by other instances propagate.
+type RevocationStore struct {
+	revocations repository.RevocationRepository
+	cacheTTL    time.Duration
+
+	mu     sync.RWMutex
+	tokens map[string]revocationEntry
+	users  map[uint]revocationEntry
+}
+
+type revocationEntry struct {
+	revoked       bool
+	revokedBefore time.Time
+	validUntil    time.Time
+}
+
+// NewRevocationStore creates a revocation store backed by revocations, caching negative
+// lookups for cacheTTL
+func NewRevocationStore(revocations repository.RevocationRepository, cacheTTL time.Duration) *RevocationStore {
+	return &RevocationStore{
+		revocations: revocations,
+		cacheTTL:    cacheTTL,
+		tokens:      make(map[string]revocationEntry),
+		users:       make(map[uint]revocationEntry),
+	}
+}
+
+// RevokeToken revokes a single access token until its expiry
+func (s *RevocationStore) RevokeToken(ctx context.Context, claims *Claims) error {
+	if claims.ID == "" {
+		return errors.New("token has no jti")
+	}
+
+	expiresAt := time.Now().Add(AccessTokenTTL())
+	if claims.ExpiresAt != nil {
+		expiresAt = claims.ExpiresAt.Time
+	}
+
+	revoked := models.RevokedToken{
+		JTI:       claims.ID,
+		UserID:    claims.UserID,
+		ExpiresAt: expiresAt,
+	}
+	if err := s.revocations.RevokeToken(ctx, &revoked); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.tokens[claims.ID] = revocationEntry{revoked: true, validUntil: expiresAt}
+	s.mu.Unlock()
+	return nil
+}
+
+// RevokeUser revokes every token issued to the user before the given time. Token issue times
+// have second precision, so before is truncated to the second: tokens issued in the same
+// second as the revocation stay valid, which lets a user log in again right after a password
+// reset or a logout from every device. Tokens bound to a session are still rejected through
+// the session, which is revoked together with them.
+func (s *RevocationStore) RevokeUser(ctx context.Context, userID uint, before time.Time) error {
+	before = before.Truncate(time.Second)
+	revocation := models.UserTokenRevocation{
+		UserID:        userID,
+		RevokedBefore: before,
+	}
+	if err := s.revocations.RevokeUser(ctx, &revocation); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.users[userID] = revocationEntry{revokedBefore: before, validUntil: time.Now().Add(s.cacheTTL)}
+	s.mu.Unlock()
+	return nil
+}
+
+// IsRevoked reports whether the token described by claims has been revoked,
+// either individually or by a revocation of all of the user's tokens
+func (s *RevocationStore) IsRevoked(ctx context.Context, claims *Claims) (bool, error) {
+	if claims.ID != "" {
+		revoked, err := s.isTokenRevoked(ctx, claims.ID)
+		if err != nil || revoked {
+			return revoked, err
+		}
+	}
+
+	revokedBefore, err := s.userRevokedBefore(ctx, claims.UserID)
+	if err != nil {
+		return false, err
+	}
+	if revokedBefore.IsZero() {
+		return false, nil
+	}
+	// Tokens without iat cannot be proven to be newer than the revocation
+	if claims.IssuedAt == nil {
+		return true, nil
+	}
+	return claims.IssuedAt.Time.Before(revokedBefore), nil
+}
+
+func (s *RevocationStore) isTokenRevoked(ctx context.Context, jti string) (bool, error) {
+	now := time.Now()
+
+	s.mu.RLock()
+	entry, ok := s.tokens[jti]
+	s.mu.RUnlock()
+	if ok && now.Before(entry.validUntil) {
+		return entry.revoked, nil
+	}
+
+	revoked, err := s.revocations.FindToken(ctx, jti)
+	switch {
+	case err == nil:
+		entry = revocationEntry{revoked: true, validUntil: revoked.ExpiresAt}
+	case errors.Is(err, repository.ErrNotFound):
+		entry = revocationEntry{revoked: false, validUntil: now.Add(s.cacheTTL)}
+	default:
+		return false, err
+	}
+
+	s.mu.Lock()
+	s.tokens[jti] = entry
+	s.mu.Unlock()
+	return entry.revoked, nil
+}
+
+func (s *RevocationStore) userRevokedBefore(ctx context.Context, userID uint) (time.Time, error) {
+	now := time.Now()
+
+	s.mu.RLock()
+	entry, ok := s.users[userID]
+	s.mu.RUnlock()
+	if ok && now.Before(entry.validUntil) {
+		return entry.revokedBefore, nil
+	}
+
+	revocation, err := s.revocations.FindUser(ctx, userID)
+	switch {
+	case err == nil:
+		entry = revocationEntry{revokedBefore: revocation.RevokedBefore.Truncate(time.Second), validUntil: now.Add(s.cacheTTL)}
+	case errors.Is(err, repository.ErrNotFound):
+		entry = revocationEntry{validUntil: now.Add(s.cacheTTL)}
+	default:
+		return time.Time{}, err
+	}
+
+	s.mu.Lock()
+	s.users[userID] = entry
+	s.mu.Unlock()
+	return entry.revokedBefore, nil
+}
+
+// Purge drops expired cache entries and revoked-token rows whose tokens have expired
+func (s *RevocationStore) Purge(ctx context.Context) error {
+	now := time.Now()
+
+	s.mu.Lock()
+	for jti, entry := range s.tokens {
+		if !now.Before(entry.validUntil) {
+			delete(s.tokens, jti)
+		}
+	}
+	for userID, entry := range s.users {
+		if !now.Before(entry.validUntil) {
+			delete(s.users, userID)
+		}
+	}
+	s.mu.Unlock()
+
+	return s.revocations.DeleteExpiredTokens(ctx, now)
+}
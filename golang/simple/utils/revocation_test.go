@@ -0,0 +1,68 @@
+package utils
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"crud-example/dbtest"
+	"crud-example/repository"
+)
+
+func TestRevocationStoreIssuedAt(t *testing.T) {
+	store := NewRevocationStore(repository.NewMemoryRevocationRepository(), time.Minute)
+	revokedBefore := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	// Cached answers are trusted without the database
+	store.users[1] = revocationEntry{revokedBefore: revokedBefore, validUntil: time.Now().Add(time.Minute)}
+
+	tests := []struct {
+		name     string
+		issuedAt *jwt.NumericDate
+		want     bool
+	}{
+		{name: "Issued in an earlier second", issuedAt: jwt.NewNumericDate(revokedBefore.Add(-time.Second)), want: true},
+		{name: "Issued in the second of the revocation", issuedAt: jwt.NewNumericDate(revokedBefore), want: false},
+		{name: "Issued later", issuedAt: jwt.NewNumericDate(revokedBefore.Add(time.Minute)), want: false},
+		{name: "Without iat", issuedAt: nil, want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims := &Claims{UserID: 1}
+			claims.IssuedAt = tt.issuedAt
+			revoked, err := store.IsRevoked(context.Background(), claims)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, revoked)
+		})
+	}
+}
+
+func TestRevocationStoreRevokeUser(t *testing.T) {
+	revocations := repository.NewRevocationRepository(dbtest.Open(t))
+	ctx := context.Background()
+	store := NewRevocationStore(revocations, time.Minute)
+
+	earlier := &Claims{UserID: 1}
+	earlier.IssuedAt = jwt.NewNumericDate(time.Now().Add(-time.Minute))
+
+	require.NoError(t, store.RevokeUser(ctx, 1, time.Now()))
+
+	// A login right after the revocation gets a token issued in the same second
+	later := &Claims{UserID: 1}
+	later.IssuedAt = jwt.NewNumericDate(time.Now())
+
+	// Both the cached answer and the one read back from the database by another instance
+	for _, store := range []*RevocationStore{store, NewRevocationStore(revocations, time.Minute)} {
+		revoked, err := store.IsRevoked(ctx, earlier)
+		require.NoError(t, err)
+		assert.True(t, revoked)
+
+		revoked, err = store.IsRevoked(ctx, later)
+		require.NoError(t, err)
+		assert.False(t, revoked)
+	}
+}
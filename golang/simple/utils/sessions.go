@@ -0,0 +1,139 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"crud-example/repository"
+)
+
+// SessionTracker checks that the session an access token is bound to is still active and
+// records when sessions were last used. Active answers are cached for cacheTTL so that
+// AuthMiddleware does not hit the database on every request; sessions revoked by this
+// instance are forgotten at once, while revocations made by other instances propagate
+// within cacheTTL. Last-seen times are coalesced in memory and written by Flush.
+type SessionTracker struct {
+	sessions repository.SessionRepository
+	cacheTTL time.Duration
+
+	mu     sync.Mutex
+	active map[string]sessionEntry
+	seen   map[string]time.Time
+}
+
+type sessionEntry struct {
+	userID     uint
+	validUntil time.Time
+}
+
+// NewSessionTracker creates a session tracker backed by sessions, caching active sessions
+// for cacheTTL
+func NewSessionTracker(sessions repository.SessionRepository, cacheTTL time.Duration) *SessionTracker {
+	return &SessionTracker{
+		sessions: sessions,
+		cacheTTL: cacheTTL,
+		active:   make(map[string]sessionEntry),
+		seen:     make(map[string]time.Time),
+	}
+}
+
+// IsActive reports whether the session of the user exists, has not been revoked and has not expired
+func (t *SessionTracker) IsActive(ctx context.Context, userID uint, sessionID string) (bool, error) {
+	now := time.Now()
+
+	t.mu.Lock()
+	entry, ok := t.active[sessionID]
+	t.mu.Unlock()
+	if ok && entry.userID == userID && now.Before(entry.validUntil) {
+		return true, nil
+	}
+
+	session, err := t.sessions.FindByToken(ctx, sessionID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if session.UserID != userID || !session.IsActive || !session.ExpiresAt.After(now) {
+		return false, nil
+	}
+
+	validUntil := now.Add(t.cacheTTL)
+	if session.ExpiresAt.Before(validUntil) {
+		validUntil = session.ExpiresAt
+	}
+
+	t.mu.Lock()
+	t.active[sessionID] = sessionEntry{userID: userID, validUntil: validUntil}
+	t.mu.Unlock()
+	return true, nil
+}
+
+// Forget drops the cached state of sessions that were just revoked
+func (t *SessionTracker) Forget(sessionIDs ...string) {
+	t.mu.Lock()
+	for _, sessionID := range sessionIDs {
+		delete(t.active, sessionID)
+		delete(t.seen, sessionID)
+	}
+	t.mu.Unlock()
+}
+
+// ForgetUser drops the cached state of the sessions of the user but keepSessionID, after they
+// were revoked together
+func (t *SessionTracker) ForgetUser(userID uint, keepSessionID string) {
+	t.mu.Lock()
+	for sessionID, entry := range t.active {
+		if entry.userID == userID && sessionID != keepSessionID {
+			delete(t.active, sessionID)
+			delete(t.seen, sessionID)
+		}
+	}
+	t.mu.Unlock()
+}
+
+// Touch records that the session was used now. Nothing is written until the next Flush.
+func (t *SessionTracker) Touch(sessionID string) {
+	t.mu.Lock()
+	t.seen[sessionID] = time.Now()
+	t.mu.Unlock()
+}
+
+// LastSeen returns the last use of the session recorded by this instance and not flushed yet
+func (t *SessionTracker) LastSeen(sessionID string) (time.Time, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	seen, ok := t.seen[sessionID]
+	return seen, ok
+}
+
+// Flush writes the pending last-seen times, one update per session however many
+// requests it made, and drops expired cache entries
+func (t *SessionTracker) Flush(ctx context.Context) error {
+	now := time.Now()
+
+	t.mu.Lock()
+	pending := t.seen
+	t.seen = make(map[string]time.Time)
+	for sessionID, entry := range t.active {
+		if !now.Before(entry.validUntil) {
+			delete(t.active, sessionID)
+		}
+	}
+	t.mu.Unlock()
+
+	var firstErr error
+	for sessionID, seen := range pending {
+		if err := t.sessions.TouchLastSeen(ctx, sessionID, seen); err != nil {
+			log.Printf("Failed to update last seen time of a session: %v", err)
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+	return firstErr
+}
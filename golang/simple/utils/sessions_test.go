@@ -0,0 +1,50 @@
+package utils
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"crud-example/repository"
+)
+
+func TestSessionTrackerTouch(t *testing.T) {
+	tracker := NewSessionTracker(repository.NewMemorySessionRepository(), time.Minute)
+
+	_, ok := tracker.LastSeen("session-1")
+	assert.False(t, ok)
+
+	tracker.Touch("session-1")
+	first, ok := tracker.LastSeen("session-1")
+	assert.True(t, ok)
+	assert.WithinDuration(t, time.Now(), first, time.Second)
+
+	// Repeated requests only keep the latest time
+	tracker.Touch("session-1")
+	latest, _ := tracker.LastSeen("session-1")
+	assert.False(t, latest.Before(first))
+	assert.Len(t, tracker.seen, 1)
+
+	// Cached answers are trusted without the database
+	tracker.active["session-1"] = sessionEntry{userID: 1, validUntil: time.Now().Add(time.Minute)}
+	active, err := tracker.IsActive(context.Background(), 1, "session-1")
+	assert.NoError(t, err)
+	assert.True(t, active)
+
+	// Revoked sessions are forgotten at once
+	tracker.Forget("session-1")
+	_, ok = tracker.LastSeen("session-1")
+	assert.False(t, ok)
+	assert.Empty(t, tracker.active)
+
+	// as are the sessions of a user revoked together, but the one kept
+	for _, sessionID := range []string{"session-1", "session-2", "session-3"} {
+		tracker.active[sessionID] = sessionEntry{userID: 1, validUntil: time.Now().Add(time.Minute)}
+	}
+	tracker.active["other-user"] = sessionEntry{userID: 2, validUntil: time.Now().Add(time.Minute)}
+	tracker.ForgetUser(1, "session-3")
+	assert.Len(t, tracker.active, 2)
+	assert.Contains(t, tracker.active, "session-3")
+	assert.Contains(t, tracker.active, "other-user")
+}
@@ -0,0 +1,111 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"crud-example/models"
+	"crud-example/repository"
+)
+
+// Setting keys stored in system_config
+const (
+	SettingMFARequiredRoles = "mfa_required_roles"
+)
+
+// settingsCacheTTL bounds how long a setting read from the database is reused
+const settingsCacheTTL = 30 * time.Second
+
+type cachedSetting struct {
+	value     string
+	expiresAt time.Time
+}
+
+// Settings reads and writes the runtime settings of system_config, caching values for
+// settingsCacheTTL so that checks made on every request do not hit the database
+type Settings struct {
+	settings repository.SettingRepository
+
+	mu    sync.RWMutex
+	cache map[string]cachedSetting
+}
+
+// NewSettings returns Settings backed by settings
+func NewSettings(settings repository.SettingRepository) *Settings {
+	return &Settings{settings: settings, cache: map[string]cachedSetting{}}
+}
+
+// Get returns the value of a setting, or "" if it is not set
+func (s *Settings) Get(ctx context.Context, key string) (string, error) {
+	s.mu.RLock()
+	cached, ok := s.cache[key]
+	s.mu.RUnlock()
+	if ok && time.Now().Before(cached.expiresAt) {
+		return cached.value, nil
+	}
+
+	var value string
+	setting, err := s.settings.Find(ctx, key)
+	switch {
+	case err == nil:
+		value = setting.ConfigValue
+	case !errors.Is(err, repository.ErrNotFound):
+		return "", err
+	}
+
+	s.mu.Lock()
+	s.cache[key] = cachedSetting{value: value, expiresAt: time.Now().Add(settingsCacheTTL)}
+	s.mu.Unlock()
+	return value, nil
+}
+
+// Set creates or updates a setting
+func (s *Settings) Set(ctx context.Context, key, value, description string) error {
+	setting := models.SystemConfig{
+		ConfigKey:   key,
+		ConfigValue: value,
+		ConfigType:  "string",
+		Description: description,
+	}
+	if err := s.settings.Save(ctx, &setting); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.cache[key] = cachedSetting{value: value, expiresAt: time.Now().Add(settingsCacheTTL)}
+	s.mu.Unlock()
+	return nil
+}
+
+// MFARequiredRoles returns the roles whose users must enable MFA
+func (s *Settings) MFARequiredRoles(ctx context.Context) ([]string, error) {
+	value, err := s.Get(ctx, SettingMFARequiredRoles)
+	if err != nil {
+		return nil, err
+	}
+
+	roles := []string{}
+	for _, role := range strings.Split(value, ",") {
+		if role = strings.TrimSpace(role); role != "" {
+			roles = append(roles, role)
+		}
+	}
+	return roles, nil
+}
+
+// RoleRequiresMFA reports whether users with the role must enable MFA
+func (s *Settings) RoleRequiresMFA(ctx context.Context, role string) (bool, error) {
+	roles, err := s.MFARequiredRoles(ctx)
+	if err != nil {
+		return false, err
+	}
+	for _, r := range roles {
+		if r == role {
+			return true, nil
+		}
+	}
+	return false, nil
+}
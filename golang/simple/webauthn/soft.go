@@ -0,0 +1,151 @@
+package webauthn
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+)
+
+// SoftAuthenticator is an in-memory platform authenticator holding one ES256 credential, so
+// that the ceremonies can be run without a browser, as in tests
+type SoftAuthenticator struct {
+	RPID         string
+	Origin       string
+	CredentialID []byte
+	// SignCount is the signature counter, incremented by every Get
+	SignCount uint32
+	// UserVerified is whether the authenticator reports having verified the user
+	UserVerified bool
+
+	userHandle []byte
+	es256      *ecdsa.PrivateKey
+	ed25519    ed25519.PrivateKey
+}
+
+// NewSoftAuthenticator returns an authenticator for the relying party rpID, answering
+// ceremonies as a client loaded from origin
+func NewSoftAuthenticator(rpID, origin string) (*SoftAuthenticator, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	credentialID := make([]byte, 16)
+	if _, err := rand.Read(credentialID); err != nil {
+		return nil, err
+	}
+	return &SoftAuthenticator{RPID: rpID, Origin: origin, CredentialID: credentialID, UserVerified: true, es256: key}, nil
+}
+
+func (a *SoftAuthenticator) coseKey() []byte {
+	if a.ed25519 != nil {
+		return encodeCBOR([]cborPair{
+			{coseKeyType, coseKeyTypeOKP},
+			{coseAlgorithm, AlgEdDSA},
+			{coseCurve, coseCurveEd25519},
+			{coseX, []byte(a.ed25519.Public().(ed25519.PublicKey))},
+		})
+	}
+	x := make([]byte, 32)
+	y := make([]byte, 32)
+	a.es256.X.FillBytes(x)
+	a.es256.Y.FillBytes(y)
+	return encodeCBOR([]cborPair{
+		{coseKeyType, coseKeyTypeEC2},
+		{coseAlgorithm, AlgES256},
+		{coseCurve, coseCurveP256},
+		{coseX, x},
+		{coseY, y},
+	})
+}
+
+func (a *SoftAuthenticator) authData(attested bool) []byte {
+	rpIDHash := sha256.Sum256([]byte(a.RPID))
+	data := append([]byte{}, rpIDHash[:]...)
+
+	flags := byte(flagUserPresent)
+	if a.UserVerified {
+		flags |= flagUserVerified
+	}
+	if attested {
+		flags |= flagAttestedCredential
+	}
+	data = append(data, flags)
+	data = binary.BigEndian.AppendUint32(data, a.SignCount)
+
+	if attested {
+		data = append(data, make([]byte, 16)...)
+		data = binary.BigEndian.AppendUint16(data, uint16(len(a.CredentialID)))
+		data = append(data, a.CredentialID...)
+		data = append(data, a.coseKey()...)
+	}
+	return data
+}
+
+func (a *SoftAuthenticator) clientData(ceremony string, challenge []byte) []byte {
+	data, _ := json.Marshal(map[string]interface{}{
+		"type":      ceremony,
+		"challenge": base64.RawURLEncoding.EncodeToString(challenge),
+		"origin":    a.Origin,
+	})
+	return data
+}
+
+// Create answers navigator.credentials.create(), binding the credential to the user of the
+// options
+func (a *SoftAuthenticator) Create(options *CreationOptions) *RegistrationCredential {
+	a.userHandle = options.User.ID
+	attestation := encodeCBOR([]cborPair{
+		{"fmt", "none"},
+		{"attStmt", []cborPair{}},
+		{"authData", a.authData(true)},
+	})
+	return &RegistrationCredential{
+		ID:    base64.RawURLEncoding.EncodeToString(a.CredentialID),
+		RawID: a.CredentialID,
+		Type:  "public-key",
+		Response: AttestationResponse{
+			ClientDataJSON:    a.clientData(ceremonyCreate, options.Challenge),
+			AttestationObject: attestation,
+			Transports:        []string{"internal"},
+		},
+	}
+}
+
+// Get answers navigator.credentials.get(), incrementing the signature counter
+func (a *SoftAuthenticator) Get(options *RequestOptions) (*AssertionCredential, error) {
+	a.SignCount++
+	authData := a.authData(false)
+	clientData := a.clientData(ceremonyGet, options.Challenge)
+
+	clientDataHash := sha256.Sum256(clientData)
+	signed := append(append([]byte{}, authData...), clientDataHash[:]...)
+
+	var signature []byte
+	if a.ed25519 != nil {
+		signature = ed25519.Sign(a.ed25519, signed)
+	} else {
+		digest := sha256.Sum256(signed)
+		var err error
+		signature, err = ecdsa.SignASN1(rand.Reader, a.es256, digest[:])
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &AssertionCredential{
+		ID:    base64.RawURLEncoding.EncodeToString(a.CredentialID),
+		RawID: a.CredentialID,
+		Type:  "public-key",
+		Response: AssertionResponse{
+			ClientDataJSON:    clientData,
+			AuthenticatorData: authData,
+			Signature:         signature,
+			UserHandle:        a.userHandle,
+		},
+	}, nil
+}
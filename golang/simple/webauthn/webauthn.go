@@ -0,0 +1,514 @@
+// Package webauthn implements the relying party side of WebAuthn registration and
+// authentication ceremonies for passkeys. Attestation statements are not verified: options
+// ask for "none" conveyance and every credential is trusted as self-attested.
+package webauthn
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Errors returned by the ceremonies
+var (
+	ErrInvalidClientData        = errors.New("invalid client data")
+	ErrChallengeMismatch        = errors.New("challenge mismatch")
+	ErrOriginMismatch           = errors.New("origin not allowed")
+	ErrInvalidAuthenticatorData = errors.New("invalid authenticator data")
+	ErrRPIDMismatch             = errors.New("relying party ID mismatch")
+	ErrUserNotPresent           = errors.New("user presence not confirmed")
+	ErrUserNotVerified          = errors.New("user verification required")
+	ErrInvalidSignature         = errors.New("invalid signature")
+	// ErrSignCountRegression means the signature counter did not increase, which suggests
+	// the authenticator was cloned
+	ErrSignCountRegression = errors.New("signature counter did not increase")
+)
+
+// Client data types of each ceremony
+const (
+	ceremonyCreate = "webauthn.create"
+	ceremonyGet    = "webauthn.get"
+)
+
+// Authenticator data flags
+const (
+	flagUserPresent        = 0x01
+	flagUserVerified       = 0x04
+	flagBackupEligible     = 0x08
+	flagAttestedCredential = 0x40
+)
+
+// User verification requirements
+const (
+	VerificationRequired  = "required"
+	VerificationPreferred = "preferred"
+)
+
+// Config identifies the relying party
+type Config struct {
+	// RPID is the domain credentials are scoped to
+	RPID   string
+	RPName string
+	// Origins lists the origins ceremonies may be run from
+	Origins []string
+	Timeout time.Duration
+}
+
+// NewConfig builds the relying party from WEBAUTHN_RP_ID, WEBAUTHN_RP_NAME, WEBAUTHN_ORIGINS
+// (comma separated) and WEBAUTHN_TIMEOUT. The relying party ID and origin default to those
+// of appURL.
+func NewConfig(appURL, rpID, rpName, origins string, timeout time.Duration) (*Config, error) {
+	parsed, err := url.Parse(appURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid APP_URL: %w", err)
+	}
+
+	cfg := &Config{RPID: rpID, RPName: rpName, Timeout: timeout}
+	if cfg.RPID == "" {
+		cfg.RPID = parsed.Hostname()
+	}
+	if cfg.RPName == "" {
+		cfg.RPName = "CRUD Example"
+	}
+
+	if origins == "" {
+		origins = parsed.Scheme + "://" + parsed.Host
+	}
+	for _, origin := range strings.Split(origins, ",") {
+		if origin = strings.TrimRight(strings.TrimSpace(origin), "/"); origin != "" {
+			cfg.Origins = append(cfg.Origins, origin)
+		}
+	}
+	if cfg.Timeout <= 0 {
+		return nil, fmt.Errorf("invalid WEBAUTHN_TIMEOUT %s", cfg.Timeout)
+	}
+	return cfg, nil
+}
+
+var (
+	configMu      sync.RWMutex
+	currentConfig *Config
+)
+
+// SetConfig replaces the configuration returned by CurrentConfig
+func SetConfig(cfg *Config) {
+	configMu.Lock()
+	currentConfig = cfg
+	configMu.Unlock()
+}
+
+// CurrentConfig returns the configured relying party, or the one of the default APP_URL
+// without SetConfig
+func CurrentConfig() *Config {
+	configMu.RLock()
+	cfg := currentConfig
+	configMu.RUnlock()
+	if cfg != nil {
+		return cfg
+	}
+
+	configMu.Lock()
+	defer configMu.Unlock()
+	if currentConfig == nil {
+		currentConfig = &Config{RPID: "localhost", RPName: "CRUD Example", Origins: []string{"http://localhost:8080"}, Timeout: 5 * time.Minute}
+	}
+	return currentConfig
+}
+
+// Base64URL is binary data encoded in JSON as unpadded base64url, as WebAuthn clients send it
+type Base64URL []byte
+
+// MarshalJSON encodes the bytes as an unpadded base64url string
+func (b Base64URL) MarshalJSON() ([]byte, error) {
+	return json.Marshal(base64.RawURLEncoding.EncodeToString(b))
+}
+
+// UnmarshalJSON decodes a base64url string
+func (b *Base64URL) UnmarshalJSON(data []byte) error {
+	var value string
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+	decoded, err := ParseBase64URL(value)
+	if err != nil {
+		return err
+	}
+	*b = decoded
+	return nil
+}
+
+// ParseBase64URL decodes a base64url string, with or without padding
+func ParseBase64URL(value string) (Base64URL, error) {
+	return base64.RawURLEncoding.DecodeString(strings.TrimRight(value, "="))
+}
+
+// String returns the unpadded base64url encoding, used to store and look up credential IDs
+func (b Base64URL) String() string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// RelyingParty identifies this server in creation options
+type RelyingParty struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// UserEntity describes the account a credential is created for
+type UserEntity struct {
+	ID          Base64URL `json:"id"`
+	Name        string    `json:"name"`
+	DisplayName string    `json:"displayName"`
+}
+
+// CredentialParameter is an accepted credential type and algorithm
+type CredentialParameter struct {
+	Type string `json:"type"`
+	Alg  int    `json:"alg"`
+}
+
+// CredentialDescriptor refers to an existing credential
+type CredentialDescriptor struct {
+	Type       string    `json:"type"`
+	ID         Base64URL `json:"id"`
+	Transports []string  `json:"transports,omitempty"`
+}
+
+// AuthenticatorSelection states the authenticator features the relying party asks for
+type AuthenticatorSelection struct {
+	ResidentKey        string `json:"residentKey"`
+	RequireResidentKey bool   `json:"requireResidentKey"`
+	UserVerification   string `json:"userVerification"`
+}
+
+// CreationOptions are the options of navigator.credentials.create()
+type CreationOptions struct {
+	RP                     RelyingParty           `json:"rp"`
+	User                   UserEntity             `json:"user"`
+	Challenge              Base64URL              `json:"challenge"`
+	PubKeyCredParams       []CredentialParameter  `json:"pubKeyCredParams"`
+	Timeout                int64                  `json:"timeout"`
+	ExcludeCredentials     []CredentialDescriptor `json:"excludeCredentials"`
+	AuthenticatorSelection AuthenticatorSelection `json:"authenticatorSelection"`
+	Attestation            string                 `json:"attestation"`
+}
+
+// RequestOptions are the options of navigator.credentials.get()
+type RequestOptions struct {
+	Challenge        Base64URL              `json:"challenge"`
+	Timeout          int64                  `json:"timeout"`
+	RPID             string                 `json:"rpId"`
+	AllowCredentials []CredentialDescriptor `json:"allowCredentials"`
+	UserVerification string                 `json:"userVerification"`
+}
+
+// AttestationResponse is the authenticator response of a registration ceremony
+type AttestationResponse struct {
+	ClientDataJSON    Base64URL `json:"clientDataJSON"`
+	AttestationObject Base64URL `json:"attestationObject"`
+	Transports        []string  `json:"transports"`
+}
+
+// RegistrationCredential is the credential returned by navigator.credentials.create()
+type RegistrationCredential struct {
+	ID       string              `json:"id"`
+	RawID    Base64URL           `json:"rawId"`
+	Type     string              `json:"type"`
+	Response AttestationResponse `json:"response"`
+}
+
+// AssertionResponse is the authenticator response of an authentication ceremony
+type AssertionResponse struct {
+	ClientDataJSON    Base64URL `json:"clientDataJSON"`
+	AuthenticatorData Base64URL `json:"authenticatorData"`
+	Signature         Base64URL `json:"signature"`
+	UserHandle        Base64URL `json:"userHandle"`
+}
+
+// AssertionCredential is the credential returned by navigator.credentials.get()
+type AssertionCredential struct {
+	ID       string            `json:"id"`
+	RawID    Base64URL         `json:"rawId"`
+	Type     string            `json:"type"`
+	Response AssertionResponse `json:"response"`
+}
+
+// Credential is a verified new credential to be stored for the user
+type Credential struct {
+	ID             []byte
+	PublicKey      []byte
+	SignCount      uint32
+	Transports     []string
+	UserVerified   bool
+	BackupEligible bool
+}
+
+// Assertion is the result of a verified authentication ceremony
+type Assertion struct {
+	SignCount    uint32
+	UserVerified bool
+}
+
+// NewChallenge returns a random challenge for a ceremony
+func NewChallenge() ([]byte, error) {
+	challenge := make([]byte, 32)
+	if _, err := rand.Read(challenge); err != nil {
+		return nil, err
+	}
+	return challenge, nil
+}
+
+// UserHandle returns the opaque user handle of a user ID, stored by authenticators with
+// discoverable credentials and returned on login
+func UserHandle(userID uint) []byte {
+	handle := make([]byte, 8)
+	binary.BigEndian.PutUint64(handle, uint64(userID))
+	return handle
+}
+
+// CreationOptions builds the options of a registration ceremony. Credentials the user
+// already has are excluded so the same authenticator is not registered twice.
+func (cfg *Config) CreationOptions(user UserEntity, challenge []byte, exclude []CredentialDescriptor) *CreationOptions {
+	if exclude == nil {
+		exclude = []CredentialDescriptor{}
+	}
+	return &CreationOptions{
+		RP:        RelyingParty{ID: cfg.RPID, Name: cfg.RPName},
+		User:      user,
+		Challenge: challenge,
+		PubKeyCredParams: []CredentialParameter{
+			{Type: "public-key", Alg: AlgES256},
+			{Type: "public-key", Alg: AlgEdDSA},
+			{Type: "public-key", Alg: AlgRS256},
+		},
+		Timeout:            cfg.Timeout.Milliseconds(),
+		ExcludeCredentials: exclude,
+		AuthenticatorSelection: AuthenticatorSelection{
+			ResidentKey:      "preferred",
+			UserVerification: VerificationPreferred,
+		},
+		Attestation: "none",
+	}
+}
+
+// RequestOptions builds the options of an authentication ceremony. An empty allow list lets
+// the user pick any discoverable credential for this relying party.
+func (cfg *Config) RequestOptions(challenge []byte, allow []CredentialDescriptor, userVerification string) *RequestOptions {
+	if allow == nil {
+		allow = []CredentialDescriptor{}
+	}
+	return &RequestOptions{
+		Challenge:        challenge,
+		Timeout:          cfg.Timeout.Milliseconds(),
+		RPID:             cfg.RPID,
+		AllowCredentials: allow,
+		UserVerification: userVerification,
+	}
+}
+
+// clientData is the collected client data signed by the authenticator
+type clientData struct {
+	Type        string `json:"type"`
+	Challenge   string `json:"challenge"`
+	Origin      string `json:"origin"`
+	CrossOrigin bool   `json:"crossOrigin"`
+}
+
+func parseClientData(raw []byte) (*clientData, []byte, error) {
+	var data clientData
+	if err := json.Unmarshal(raw, &data); err != nil {
+		return nil, nil, ErrInvalidClientData
+	}
+	challenge, err := ParseBase64URL(data.Challenge)
+	if err != nil || len(challenge) == 0 {
+		return nil, nil, ErrInvalidClientData
+	}
+	return &data, challenge, nil
+}
+
+// ChallengeOf returns the challenge a client answered, so the pending ceremony can be
+// looked up before the response is verified
+func ChallengeOf(clientDataJSON []byte) ([]byte, error) {
+	_, challenge, err := parseClientData(clientDataJSON)
+	return challenge, err
+}
+
+// verifyClientData checks the ceremony type, challenge and origin of the client data
+func (cfg *Config) verifyClientData(raw []byte, ceremony string, challenge []byte) error {
+	data, answered, err := parseClientData(raw)
+	if err != nil {
+		return err
+	}
+	if data.Type != ceremony {
+		return ErrInvalidClientData
+	}
+	if subtle.ConstantTimeCompare(answered, challenge) != 1 {
+		return ErrChallengeMismatch
+	}
+	if data.CrossOrigin {
+		return ErrOriginMismatch
+	}
+	for _, origin := range cfg.Origins {
+		if data.Origin == origin {
+			return nil
+		}
+	}
+	return ErrOriginMismatch
+}
+
+// authenticatorData is the parsed data signed by the authenticator
+type authenticatorData struct {
+	rpIDHash     []byte
+	flags        byte
+	signCount    uint32
+	credentialID []byte
+	publicKey    []byte
+}
+
+func parseAuthenticatorData(data []byte) (*authenticatorData, error) {
+	if len(data) < 37 {
+		return nil, ErrInvalidAuthenticatorData
+	}
+	parsed := &authenticatorData{
+		rpIDHash:  data[:32],
+		flags:     data[32],
+		signCount: binary.BigEndian.Uint32(data[33:37]),
+	}
+	if parsed.flags&flagAttestedCredential == 0 {
+		return parsed, nil
+	}
+
+	// Attested credential data: AAGUID, credential ID length and ID, then the COSE key
+	rest := data[37:]
+	if len(rest) < 18 {
+		return nil, ErrInvalidAuthenticatorData
+	}
+	idLength := int(binary.BigEndian.Uint16(rest[16:18]))
+	rest = rest[18:]
+	if idLength == 0 || idLength > 1023 || len(rest) < idLength {
+		return nil, ErrInvalidAuthenticatorData
+	}
+	parsed.credentialID = rest[:idLength]
+	rest = rest[idLength:]
+
+	_, after, err := decodeCBOR(rest)
+	if err != nil {
+		return nil, ErrInvalidAuthenticatorData
+	}
+	parsed.publicKey = rest[:len(rest)-len(after)]
+	return parsed, nil
+}
+
+// verifyFlags checks the relying party ID hash and the user presence and verification flags
+func (cfg *Config) verifyFlags(data *authenticatorData, requireUV bool) error {
+	rpIDHash := sha256.Sum256([]byte(cfg.RPID))
+	if !bytes.Equal(data.rpIDHash, rpIDHash[:]) {
+		return ErrRPIDMismatch
+	}
+	if data.flags&flagUserPresent == 0 {
+		return ErrUserNotPresent
+	}
+	if requireUV && data.flags&flagUserVerified == 0 {
+		return ErrUserNotVerified
+	}
+	return nil
+}
+
+// FinishRegistration verifies the response to a registration ceremony started with
+// challenge and returns the credential to store
+func (cfg *Config) FinishRegistration(credential *RegistrationCredential, challenge []byte, requireUV bool) (*Credential, error) {
+	if credential.Type != "public-key" {
+		return nil, ErrInvalidClientData
+	}
+	if err := cfg.verifyClientData(credential.Response.ClientDataJSON, ceremonyCreate, challenge); err != nil {
+		return nil, err
+	}
+
+	item, _, err := decodeCBOR(credential.Response.AttestationObject)
+	if err != nil {
+		return nil, fmt.Errorf("invalid attestation object: %w", err)
+	}
+	attestation, ok := item.(map[interface{}]interface{})
+	if !ok {
+		return nil, errors.New("invalid attestation object")
+	}
+	rawAuthData, ok := attestation["authData"].([]byte)
+	if !ok {
+		return nil, errors.New("invalid attestation object")
+	}
+
+	authData, err := parseAuthenticatorData(rawAuthData)
+	if err != nil {
+		return nil, err
+	}
+	if err := cfg.verifyFlags(authData, requireUV); err != nil {
+		return nil, err
+	}
+	if authData.credentialID == nil {
+		return nil, ErrInvalidAuthenticatorData
+	}
+	if len(credential.RawID) > 0 && !bytes.Equal(credential.RawID, authData.credentialID) {
+		return nil, ErrInvalidAuthenticatorData
+	}
+	if _, err := parsePublicKey(authData.publicKey); err != nil {
+		return nil, err
+	}
+
+	return &Credential{
+		ID:             append([]byte{}, authData.credentialID...),
+		PublicKey:      append([]byte{}, authData.publicKey...),
+		SignCount:      authData.signCount,
+		Transports:     credential.Response.Transports,
+		UserVerified:   authData.flags&flagUserVerified != 0,
+		BackupEligible: authData.flags&flagBackupEligible != 0,
+	}, nil
+}
+
+// FinishAssertion verifies the response to an authentication ceremony started with challenge
+// against a stored credential. storedSignCount is the last counter seen for the credential:
+// a counter that does not increase is reported as ErrSignCountRegression, except for
+// authenticators that do not implement counters and always send zero.
+func (cfg *Config) FinishAssertion(credential *AssertionCredential, challenge []byte, coseKey []byte, storedSignCount uint32, requireUV bool) (*Assertion, error) {
+	if credential.Type != "public-key" {
+		return nil, ErrInvalidClientData
+	}
+	if err := cfg.verifyClientData(credential.Response.ClientDataJSON, ceremonyGet, challenge); err != nil {
+		return nil, err
+	}
+
+	authData, err := parseAuthenticatorData(credential.Response.AuthenticatorData)
+	if err != nil {
+		return nil, err
+	}
+	if err := cfg.verifyFlags(authData, requireUV); err != nil {
+		return nil, err
+	}
+
+	key, err := parsePublicKey(coseKey)
+	if err != nil {
+		return nil, err
+	}
+	clientDataHash := sha256.Sum256(credential.Response.ClientDataJSON)
+	signed := append(append([]byte{}, credential.Response.AuthenticatorData...), clientDataHash[:]...)
+	if !key.verify(signed, credential.Response.Signature) {
+		return nil, ErrInvalidSignature
+	}
+
+	if (authData.signCount != 0 || storedSignCount != 0) && authData.signCount <= storedSignCount {
+		return nil, ErrSignCountRegression
+	}
+
+	return &Assertion{
+		SignCount:    authData.signCount,
+		UserVerified: authData.flags&flagUserVerified != 0,
+	}, nil
+}
@@ -0,0 +1,185 @@
+package webauthn
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newSoftAuthenticator(t *testing.T, rpID, origin string) *SoftAuthenticator {
+	authenticator, err := NewSoftAuthenticator(rpID, origin)
+	require.NoError(t, err)
+	return authenticator
+}
+
+// get answers the options with the authenticator
+func get(t *testing.T, authenticator *SoftAuthenticator, options *RequestOptions) *AssertionCredential {
+	response, err := authenticator.Get(options)
+	require.NoError(t, err)
+	return response
+}
+
+func testConfig() *Config {
+	return &Config{RPID: "example.com", RPName: "Example", Origins: []string{"https://example.com"}, Timeout: time.Minute}
+}
+
+// register runs a registration ceremony and returns the stored credential
+func register(t *testing.T, cfg *Config, authenticator *SoftAuthenticator) *Credential {
+	challenge, err := NewChallenge()
+	require.NoError(t, err)
+	options := cfg.CreationOptions(UserEntity{ID: UserHandle(42), Name: "user@example.com", DisplayName: "User"}, challenge, nil)
+
+	credential, err := cfg.FinishRegistration(authenticator.Create(options), challenge, false)
+	require.NoError(t, err)
+	return credential
+}
+
+func TestCeremonies(t *testing.T) {
+	cfg := testConfig()
+	authenticator := newSoftAuthenticator(t, "example.com", "https://example.com")
+
+	credential := register(t, cfg, authenticator)
+	assert.Equal(t, authenticator.CredentialID, credential.ID)
+	assert.Equal(t, []string{"internal"}, credential.Transports)
+	assert.True(t, credential.UserVerified)
+
+	// Two logins in a row, each with a higher counter
+	signCount := credential.SignCount
+	for i := 0; i < 2; i++ {
+		challenge, err := NewChallenge()
+		require.NoError(t, err)
+		options := cfg.RequestOptions(challenge, nil, VerificationRequired)
+
+		response := get(t, authenticator, options)
+		assert.Equal(t, UserHandle(42), []byte(response.Response.UserHandle))
+
+		assertion, err := cfg.FinishAssertion(response, challenge, credential.PublicKey, signCount, true)
+		require.NoError(t, err)
+		assert.True(t, assertion.UserVerified)
+		assert.Greater(t, assertion.SignCount, signCount)
+		signCount = assertion.SignCount
+	}
+}
+
+func TestEd25519Credential(t *testing.T) {
+	cfg := testConfig()
+	authenticator := newSoftAuthenticator(t, "example.com", "https://example.com")
+	_, authenticator.ed25519, _ = ed25519.GenerateKey(rand.Reader)
+
+	credential := register(t, cfg, authenticator)
+
+	challenge, _ := NewChallenge()
+	response := get(t, authenticator, cfg.RequestOptions(challenge, nil, VerificationPreferred))
+	_, err := cfg.FinishAssertion(response, challenge, credential.PublicKey, credential.SignCount, false)
+	assert.NoError(t, err)
+}
+
+func TestRegistrationRejected(t *testing.T) {
+	cfg := testConfig()
+
+	tests := []struct {
+		name      string
+		rpID      string
+		origin    string
+		uv        bool
+		requireUV bool
+		challenge func([]byte) []byte
+		wantErr   error
+	}{
+		{name: "Wrong challenge", rpID: "example.com", origin: "https://example.com", uv: true, challenge: func([]byte) []byte { return []byte("other") }, wantErr: ErrChallengeMismatch},
+		{name: "Wrong origin", rpID: "example.com", origin: "https://evil.example", uv: true, wantErr: ErrOriginMismatch},
+		{name: "Wrong relying party", rpID: "evil.example", origin: "https://example.com", uv: true, wantErr: ErrRPIDMismatch},
+		{name: "User not verified", rpID: "example.com", origin: "https://example.com", uv: false, requireUV: true, wantErr: ErrUserNotVerified},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			authenticator := newSoftAuthenticator(t, tt.rpID, tt.origin)
+			authenticator.UserVerified = tt.uv
+
+			challenge, _ := NewChallenge()
+			options := cfg.CreationOptions(UserEntity{ID: UserHandle(1), Name: "user@example.com"}, challenge, nil)
+			response := authenticator.Create(options)
+
+			expected := challenge
+			if tt.challenge != nil {
+				expected = tt.challenge(challenge)
+			}
+			_, err := cfg.FinishRegistration(response, expected, tt.requireUV)
+			assert.ErrorIs(t, err, tt.wantErr)
+		})
+	}
+}
+
+func TestAssertionRejected(t *testing.T) {
+	cfg := testConfig()
+	authenticator := newSoftAuthenticator(t, "example.com", "https://example.com")
+	credential := register(t, cfg, authenticator)
+
+	t.Run("Sign count regression", func(t *testing.T) {
+		challenge, _ := NewChallenge()
+		response := get(t, authenticator, cfg.RequestOptions(challenge, nil, VerificationPreferred))
+
+		// A clone would replay a counter we have already seen
+		_, err := cfg.FinishAssertion(response, challenge, credential.PublicKey, authenticator.SignCount, false)
+		assert.ErrorIs(t, err, ErrSignCountRegression)
+	})
+
+	t.Run("Tampered signature", func(t *testing.T) {
+		challenge, _ := NewChallenge()
+		response := get(t, authenticator, cfg.RequestOptions(challenge, nil, VerificationPreferred))
+		response.Response.AuthenticatorData[36]++
+
+		_, err := cfg.FinishAssertion(response, challenge, credential.PublicKey, 0, false)
+		assert.ErrorIs(t, err, ErrInvalidSignature)
+	})
+
+	t.Run("Registration data replayed as assertion", func(t *testing.T) {
+		challenge, _ := NewChallenge()
+		response := get(t, authenticator, cfg.RequestOptions(challenge, nil, VerificationPreferred))
+		response.Response.ClientDataJSON = authenticator.clientData(ceremonyCreate, challenge)
+
+		_, err := cfg.FinishAssertion(response, challenge, credential.PublicKey, 0, false)
+		assert.ErrorIs(t, err, ErrInvalidClientData)
+	})
+
+	t.Run("Other credential key", func(t *testing.T) {
+		other := newSoftAuthenticator(t, "example.com", "https://example.com")
+		otherCredential := register(t, cfg, other)
+
+		challenge, _ := NewChallenge()
+		response := get(t, authenticator, cfg.RequestOptions(challenge, nil, VerificationPreferred))
+		_, err := cfg.FinishAssertion(response, challenge, otherCredential.PublicKey, 0, false)
+		assert.ErrorIs(t, err, ErrInvalidSignature)
+	})
+}
+
+func TestChallengeOf(t *testing.T) {
+	authenticator := newSoftAuthenticator(t, "example.com", "https://example.com")
+	challenge, _ := NewChallenge()
+
+	answered, err := ChallengeOf(authenticator.clientData(ceremonyGet, challenge))
+	require.NoError(t, err)
+	assert.Equal(t, challenge, answered)
+
+	_, err = ChallengeOf([]byte("not json"))
+	assert.ErrorIs(t, err, ErrInvalidClientData)
+}
+
+func TestDecodeCBORRejectsMalformedInput(t *testing.T) {
+	inputs := [][]byte{
+		{},
+		{0x5a, 0xff, 0xff, 0xff, 0xff},    // byte string longer than the input
+		{0x9f},                            // indefinite-length array
+		{0xbb, 0, 0, 0, 1, 0, 0, 0, 0, 0}, // huge map
+		{0xf9, 0, 0},                      // half-precision float
+	}
+	for _, input := range inputs {
+		_, _, err := decodeCBOR(input)
+		assert.Error(t, err, "%x", input)
+	}
+}